@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+)
+
+// RotateMasterKeyHandler wraps the data keys of all cases with the current master
+// key from the config, evidence objects are not rewritten
+func (app *Application) RotateMasterKeyHandler(w http.ResponseWriter, r *http.Request) {
+	rotated, err := app.stores.RotateMasterKey()
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"rotated_keys": rotated})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+func TestRotateMasterKeyHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption data.EncryptionConfig
+		want       int
+	}{
+		{
+			name: "successful with encryption enabled",
+			encryption: data.EncryptionConfig{
+				MasterKey:   base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+				MasterKeyID: "first",
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "fails with encryption disabled",
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			obs, err := data.FromEncryptionConfig(data.Config{Encryption: tt.encryption}, app.stores.ObjectStore, memstore.NewKeyStore())
+			if err != nil {
+				t.Fatalf("failed to enable encryption: %v", err)
+			}
+			app.stores.ObjectStore = obs
+			req, err := http.NewRequest(http.MethodPost, "/admin/keys/rotate", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.RotateMasterKeyHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+	"go.uber.org/zap"
+)
+
+// VerifyAuditLogHandler recomputes the hash chain of the audit log, checks it
+// against the signed checkpoints and returns the report
+func (app *Application) VerifyAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := app.stores.VerifyAuditLog()
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"report": report})
+}
+
+// CreateAuditCheckpointHandler signs a checkpoint of the last entry of the audit log
+func (app *Application) CreateAuditCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+	cp, err := app.stores.CheckpointAuditLog()
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, envelope{"checkpoint": cp})
+}
+
+// ListAuditCheckpointsHandler returns all signed checkpoints of the audit log
+func (app *Application) ListAuditCheckpointsHandler(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := app.stores.ListAuditCheckpoints()
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if checkpoints == nil {
+		checkpoints = []data.AuditCheckpoint{}
+	}
+	app.respond(w, r, http.StatusOK, envelope{"checkpoints": checkpoints})
+}
+
+// startCheckpointer signs a checkpoint of the audit log every checkpoint interval
+// until the context is cancelled, it does nothing when the interval is zero
+func (app *Application) startCheckpointer(ctx context.Context) {
+	interval := app.config.Audit.CheckpointInterval
+	if interval <= 0 {
+		return
+	}
+	if app.stores.Signer == nil {
+		app.logger.Warn("audit checkpoints are disabled, signing key is not configured")
+		return
+	}
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.checkpoint()
+			}
+		}
+	})
+}
+
+// checkpoint signs one checkpoint of the audit log and logs it
+func (app *Application) checkpoint() {
+	cp, err := app.stores.CheckpointAuditLog()
+	if errors.Is(err, data.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		app.logger.Error("signing audit checkpoint failed", zap.Error(err))
+		return
+	}
+	app.logger.Info("signed audit checkpoint", zap.Int64("seq", cp.Seq), zap.String("entry_hash", cp.EntryHash))
+}
+
+// auditFlags are the flags of the audit subcommand
+type auditFlags struct {
+	Path       string
+	Checkpoint bool
+}
+
+func parseAuditFlags(programme string, args []string) (*auditFlags, string, error) {
+	flags := flag.NewFlagSet(programme, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf auditFlags
+	flags.StringVar(&conf.Path, "config", "", "Path to config file")
+	flags.BoolVar(&conf.Checkpoint, "checkpoint", false, "Sign a checkpoint when the audit log is intact")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+	return &conf, buf.String(), nil
+}
+
+// runAudit runs the audit subcommand and writes the verification report as JSON
+// to out. It returns the exit code, 1 when tampering was found and 2 on errors.
+func runAudit(programme string, args []string, out io.Writer) int {
+	conf, output, err := parseAuditFlags(programme, args)
+	if err != nil {
+		fmt.Fprintln(out, output)
+		return 2
+	}
+	settings, err := data.LoadProductionConfig(conf.Path)
+	if err != nil {
+		fmt.Fprintln(out, "loading config failed:", err)
+		return 2
+	}
+	stores, err := openStores(settings)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	return writeAuditReport(stores, conf.Checkpoint, out)
+}
+
+// writeAuditReport verifies the audit log and writes the report as JSON to out,
+// with checkpoint an intact log is checkpointed afterwards
+func writeAuditReport(stores data.Stores, checkpoint bool, out io.Writer) int {
+	report, err := stores.VerifyAuditLog()
+	if err != nil {
+		fmt.Fprintln(out, "verifying audit log failed:", err)
+		return 2
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(report)
+	if err != nil {
+		return 2
+	}
+	if !report.Valid {
+		return 1
+	}
+	if checkpoint && report.Entries > 0 {
+		_, err = stores.CheckpointAuditLog()
+		if err != nil {
+			fmt.Fprintln(out, "signing audit checkpoint failed:", err)
+			return 2
+		}
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// seedAuditTesting adds an evidence named video with a download in its chain of custody
+func seedAuditTesting(t *testing.T, app *Application) {
+	seedVerificationTesting(t, app)
+	rec := httptest.NewRecorder()
+	app.DownloadEvidenceHandler(rec, custodyRequest(t, http.MethodGet, "/", "1", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("failed to download evidence, status code %d", rec.Code)
+	}
+}
+
+func TestAuditHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(app *Application) http.HandlerFunc
+		signer  bool
+		want    int
+	}{
+		{
+			name:    "verifying the audit log successful",
+			handler: func(app *Application) http.HandlerFunc { return app.VerifyAuditLogHandler },
+			want:    http.StatusOK,
+		},
+		{
+			name:    "checkpointing the audit log successful",
+			handler: func(app *Application) http.HandlerFunc { return app.CreateAuditCheckpointHandler },
+			signer:  true,
+			want:    http.StatusCreated,
+		},
+		{
+			name:    "checkpointing without signing key fails",
+			handler: func(app *Application) http.HandlerFunc { return app.CreateAuditCheckpointHandler },
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "listing checkpoints successful",
+			handler: func(app *Application) http.HandlerFunc { return app.ListAuditCheckpointsHandler },
+			want:    http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			if tt.signer {
+				app = newTestDispositionServer(t)
+			}
+			seedAuditTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(app)(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestParseAuditFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *auditFlags
+		wantErr bool
+	}{
+		{
+			name: "without flags only verified the log",
+			want: &auditFlags{},
+		},
+		{
+			name: "with all flags checkpointed the log",
+			args: []string{"-config", "testdata/.config.json", "-checkpoint"},
+			want: &auditFlags{Path: "testdata/.config.json", Checkpoint: true},
+		},
+		{
+			name:    "with unknown flag failed",
+			args:    []string{"-repair"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := parseAuditFlags("der audit", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestWriteAuditReportReturnedExitCode(t *testing.T) {
+	app := newTestDispositionServer(t)
+	seedAuditTesting(t, app)
+	var out bytes.Buffer
+	if code := writeAuditReport(app.stores, true, &out); code != 0 {
+		t.Errorf("expected exit code 0 for intact log, got %d: %s", code, out.String())
+	}
+	checkpoints, err := app.stores.ListAuditCheckpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 {
+		t.Errorf("expected 1 checkpoint, got %d", len(checkpoints))
+	}
+	other, err := data.NewSigner(data.SigningConfig{PrivateKey: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", KeyID: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.stores.Signer = other
+	out.Reset()
+	if code := writeAuditReport(app.stores, false, &out); code != 1 {
+		t.Errorf("expected exit code 1 with tampering, got %d", code)
+	}
+	if !strings.Contains(out.String(), `"kind": "invalid_checkpoint_signature"`) {
+		t.Errorf("expected the invalid checkpoint in the report, got %s", out.String())
+	}
+}
@@ -36,6 +36,19 @@ func (app *Application) RemoveCaseHandler(w http.ResponseWriter, r *http.Request
 		app.respondError(w, r, err)
 		return
 	}
+	// only owners of the case can remove it
+	cs, err := app.stores.DBStore.GetCaseByName(name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.respondError(w, r, err)
+		return
+	}
+	if cs != nil {
+		err = app.checkCaseAccess(r, cs, data.CaseOwner)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
 	// delete case
 	err = app.stores.RemoveCase(name)
 	if err != nil {
@@ -45,7 +58,7 @@ func (app *Application) RemoveCaseHandler(w http.ResponseWriter, r *http.Request
 	app.respond(w, r, http.StatusOK, envelope{"Case": "case successfully deleted"})
 }
 func (app *Application) GetCaseHandler(w http.ResponseWriter, r *http.Request) {
-	cs, err := app.caseParser(r)
+	cs, err := app.caseParser(r, data.CaseViewer)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
@@ -54,10 +67,15 @@ func (app *Application) GetCaseHandler(w http.ResponseWriter, r *http.Request) {
 	app.respond(w, r, http.StatusOK, envelope{"Case": cs})
 }
 
-// ListCasesHandler returns a list of cases that exist in bought database and storage
+// ListCasesHandler returns a list of cases of the user that exist in bought database and storage
 func (app *Application) ListCasesHandler(w http.ResponseWriter, r *http.Request) {
-	// get cases
-	cases, err := app.stores.ListCases()
+	user, err := app.requestUser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	// get the cases of the user
+	cases, err := app.stores.ListUserCases(user)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
@@ -27,23 +27,37 @@ func TestCreateCaseHandler(t *testing.T) {
 			wantStatus: http.StatusCreated,
 		},
 		{
-			name: "with a invalid name with special characters failed",
+			name: "with a name with special characters succeeded",
 			requestBody: map[string]interface{}{
 				"name": "OSPGK25/22",
 			},
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusCreated,
 		},
 		{
-			name: "with invalid name with special characters failed",
+			name: "with a Cyrillic name with spaces succeeded",
 			requestBody: map[string]interface{}{
-				"name": "OSPG-K-25-22",
+				"name": "К 123/2026",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "with UPPERCASE and Latin characters succeeded",
+			requestBody: map[string]interface{}{
+				"name": "Kž1 45/2025",
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "with a blank name failed",
+			requestBody: map[string]interface{}{
+				"name": "  ",
 			},
 			wantStatus: http.StatusBadRequest,
 		},
 		{
-			name: "with UPPERCASE characters failed",
+			name: "with control characters failed",
 			requestBody: map[string]interface{}{
-				"name": "OSPGK2522",
+				"name": "K 1\n45/2025",
 			},
 			wantStatus: http.StatusBadRequest,
 		},
@@ -215,19 +229,19 @@ func TestBadJSONRequestFailsOnPOST(t *testing.T) {
 			handler:     app.DeleteEvidenceHandler,
 		},
 	}
+	user := &data.User{
+		Username: "test",
+	}
+	err := user.Password.Set("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.stores.User.Add(user)
+	if err != nil {
+		t.Fatal(err)
+	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			user := &data.User{
-				Username: "test",
-			}
-			err := user.Password.Set("test")
-			if err != nil {
-				t.Fatal(err)
-			}
-			err = app.stores.User.Add(user)
-			if err != nil {
-				t.Fatal(err)
-			}
 			payload := &Payload{
 				Username: "test",
 			}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// custodyCSVHeader are the columns of the chain of custody CSV export
+var custodyCSVHeader = []string{"id", "evidence_id", "case_id", "version", "action", "username", "client_ip", "user_agent", "hash", "detail", "created_at", "seq", "prev_hash", "entry_hash"}
+
+// ListCustodyHandler returns the chain of custody of an evidence, oldest first. With
+// format=csv in the query it is exported as a CSV file.
+func (app *Application) ListCustodyHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	events, err := app.stores.ListCustody(ev)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		if events == nil {
+			events = []data.CustodyEvent{}
+		}
+		app.respond(w, r, http.StatusOK, envelope{"custody": events})
+	case "csv":
+		app.respondCustodyCSV(w, r, ev, events)
+	default:
+		app.respondError(w, r, fmt.Errorf("%w : unsupported format %q", data.ErrInvalidRequest, r.URL.Query().Get("format")))
+	}
+}
+
+// respondCustodyCSV writes the chain of custody as a CSV file download
+func (app *Application) respondCustodyCSV(w http.ResponseWriter, r *http.Request, ev *data.Evidence, events []data.CustodyEvent) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="custody-%d.csv"`, ev.ID))
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	err := cw.Write(custodyCSVHeader)
+	for _, e := range events {
+		if err != nil {
+			break
+		}
+		err = cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			strconv.FormatInt(e.EvidenceID, 10),
+			strconv.FormatInt(e.CaseID, 10),
+			strconv.FormatInt(e.Version, 10),
+			e.Action,
+			e.Username,
+			e.ClientIP,
+			e.UserAgent,
+			e.Hash,
+			e.Detail,
+			e.CreatedAt.UTC().Format(time.RFC3339Nano),
+			strconv.FormatInt(e.Seq, 10),
+			e.PrevHash,
+			e.EntryHash,
+		})
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	// the status is already sent, so errors can only be logged
+	if err != nil {
+		app.logError(r, fmt.Errorf("responding with custody CSV : %w", err))
+	}
+}
+
+// custodyActor returns who makes the request for the custody events of the changes
+// it makes, the authenticated user with the client IP and user agent. The stores
+// record the events in the transactions of the changes.
+func (app *Application) custodyActor(r *http.Request) *data.CustodyEvent {
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	return &data.CustodyEvent{
+		Username:  payload.Username,
+		ClientIP:  clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// recordVersionCustody adds an event for a version of the evidence made by the
+// authenticated user of the request to its chain of custody, it is used for
+// accesses that don't change the evidence
+func (app *Application) recordVersionCustody(r *http.Request, ev *data.Evidence, version int64, hash string, action string, detail string) error {
+	event := app.custodyActor(r)
+	event.EvidenceID = ev.ID
+	event.CaseID = ev.CaseID
+	event.Version = version
+	event.Action = action
+	event.Hash = hash
+	event.Detail = detail
+	return app.stores.RecordCustody(event)
+}
+
+// clientIP returns the IP address of the client without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
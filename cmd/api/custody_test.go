@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// custodyRequest returns a request of the test user from a fixed client about the
+// evidence with the ID in the test case
+func custodyRequest(t *testing.T, method string, target string, evidenceID string, body string) *http.Request {
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "forensics/1.0")
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	rct.URLParams.Add("evidenceID", evidenceID)
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	return req.WithContext(ctx)
+}
+
+func TestDownloadEvidenceHandlerRecordedCustody(t *testing.T) {
+	app := newTestServer(t)
+	cs := seedVerificationTesting(t, app)
+	rec := httptest.NewRecorder()
+	app.DownloadEvidenceHandler(rec, custodyRequest(t, http.MethodGet, "/", "1", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	app.DownloadEvidenceHandler(rec, custodyRequest(t, http.MethodHead, "/", "1", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	ev, err := app.stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := app.stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the upload of the evidence is recorded before the download
+	if len(events) != 2 {
+		t.Fatalf("expected upload and download custody events, got %d", len(events))
+	}
+	got := events[1]
+	if got.ID == 0 || got.CreatedAt.IsZero() || got.EntryHash != got.ChainHash() {
+		t.Errorf("expected chained event with ID and time, got %+v", got)
+	}
+	got.ID, got.CreatedAt, got.EntryHash = 0, time.Time{}, ""
+	want := data.CustodyEvent{
+		Seq:        2,
+		EvidenceID: ev.ID,
+		CaseID:     cs.ID,
+		Version:    1,
+		Action:     data.CustodyDownload,
+		Username:   "test",
+		ClientIP:   "192.0.2.1",
+		UserAgent:  "forensics/1.0",
+		Hash:       ev.Hash,
+		PrevHash:   events[0].EntryHash,
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func TestDownloadEvidenceHandlerRecordedRequestsFromFirstByte(t *testing.T) {
+	app := newTestServer(t)
+	cs := seedVerificationTesting(t, app)
+	ev, err := app.stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"` + ev.Hash + `"`
+	requests := []struct {
+		header http.Header
+		want   int
+	}{
+		{header: http.Header{"Range": {"bytes=0-1"}}, want: http.StatusPartialContent},
+		{header: http.Header{"Range": {"bytes=2-"}}, want: http.StatusPartialContent},
+		{header: http.Header{"Range": {"bytes=-2"}}, want: http.StatusPartialContent},
+		{header: http.Header{"Range": {"bytes=2-"}, "If-Range": {etag}}, want: http.StatusPartialContent},
+		{header: http.Header{"Range": {"bytes=2-"}, "If-Range": {`"other"`}}, want: http.StatusOK},
+		{header: http.Header{"If-None-Match": {etag}}, want: http.StatusNotModified},
+		{header: http.Header{"If-Match": {`"other"`}}, want: http.StatusPreconditionFailed},
+		{header: http.Header{"Range": {"bytes=100-200"}}, want: http.StatusRequestedRangeNotSatisfiable},
+	}
+	for _, request := range requests {
+		req := custodyRequest(t, http.MethodGet, "/", "1", "")
+		for key, values := range request.header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		app.DownloadEvidenceHandler(rec, req)
+		if rec.Code != request.want {
+			t.Fatalf("expected status code %d for %v, got %d", request.want, request.header, rec.Code)
+		}
+	}
+	events, err := app.stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range events[1:] {
+		got = append(got, event.Action+" "+event.Detail)
+	}
+	// the range from the first byte and the whole file sent for the other If-Range,
+	// responses without content are not downloads
+	want := []string{data.CustodyDownload + " range bytes=0-1", data.CustodyDownload + " "}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func TestCustodyWriterSentNoContentWhenRecordingFailed(t *testing.T) {
+	app := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	w := &custodyWriter{ResponseWriter: rec, record: func(int) error {
+		return errors.New("custody log is unavailable")
+	}, fail: func(w http.ResponseWriter, err error) {
+		app.respondError(w, req, err)
+	}}
+	file := io.NopCloser(strings.NewReader("test"))
+	app.respondEvidence(w, req, &data.Evidence{Name: "video"}, &data.EvidenceVersion{Version: 1}, file)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "test") || rec.Header().Get("Content-Disposition") != "" {
+		t.Errorf("expected no content, got headers %v and body %q", rec.Header(), rec.Body.String())
+	}
+}
+
+func TestListCustodyHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		evidenceID string
+		format     string
+		want       int
+	}{
+		{
+			name:       "successful as JSON",
+			evidenceID: "1",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "successful as CSV",
+			evidenceID: "1",
+			format:     "csv",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "with unsupported format fails",
+			evidenceID: "1",
+			format:     "xml",
+			want:       http.StatusBadRequest,
+		},
+		{
+			name:       "with evidence that doesn't exist fails",
+			evidenceID: "2",
+			want:       http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedVerificationTesting(t, app)
+			rec := httptest.NewRecorder()
+			app.AddCommentHandler(rec, custodyRequest(t, http.MethodPost, "/", "1", `{"text": "looks fine"}`))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("failed to add comment, status code %d", rec.Code)
+			}
+			rec = httptest.NewRecorder()
+			app.ListCustodyHandler(rec, custodyRequest(t, http.MethodGet, "/?format="+tt.format, tt.evidenceID, ""))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if tt.format == "csv" {
+				if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+					t.Errorf("expected CSV content type, got %q", got)
+				}
+				records, err := csv.NewReader(rec.Body).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != 3 || !cmp.Equal(custodyCSVHeader, records[0]) {
+					t.Fatalf("unexpected CSV %v", records)
+				}
+				if records[2][4] != data.CustodyComment || records[2][5] != "test" || records[2][9] != "looks fine" {
+					t.Errorf("unexpected CSV record %v", records[2])
+				}
+				return
+			}
+			var body struct {
+				Custody []data.CustodyEvent `json:"custody"`
+			}
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Custody) != 2 || body.Custody[1].Action != data.CustodyComment || body.Custody[1].ClientIP != "192.0.2.1" {
+				t.Errorf("unexpected custody %+v", body.Custody)
+			}
+		})
+	}
+}
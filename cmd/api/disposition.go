@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// DisposeCaseHandler crypto-shreds a case at the end of its retention and responds
+// with the signed destruction certificate. The route requires case:dispose, so a
+// judge only has to be a member of the case.
+func (app *Application) DisposeCaseHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	cert, err := app.stores.DisposeCase(cs.Name, payload.Username)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, envelope{"Certificate": cert})
+}
+
+// GetCertificateHandler returns a destruction certificate
+func (app *Application) GetCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "certificateID"), 10, 64)
+	if err != nil || id < 1 {
+		app.respondError(w, r, fmt.Errorf("%w : invalid id parameter", data.ErrInvalidRequest))
+		return
+	}
+	cert, err := app.stores.Certificates.GetCertificate(id)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Certificate": cert})
+}
+
+// ListCertificatesHandler returns all destruction certificates
+func (app *Application) ListCertificatesHandler(w http.ResponseWriter, r *http.Request) {
+	certs, err := app.stores.Certificates.ListCertificates()
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Certificates": certs})
+}
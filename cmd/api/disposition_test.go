@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+// newTestDispositionServer returns a test server with encryption and signing enabled
+func newTestDispositionServer(t *testing.T) *Application {
+	app := newTestServer(t)
+	config := data.Config{
+		Encryption: data.EncryptionConfig{
+			MasterKey:   base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+			MasterKeyID: "first",
+		},
+		Signing: data.SigningConfig{
+			PrivateKey: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)),
+			KeyID:      "test",
+		},
+	}
+	obs, err := data.FromEncryptionConfig(config, app.stores.ObjectStore, memstore.NewKeyStore())
+	if err != nil {
+		t.Fatalf("failed to enable encryption: %v", err)
+	}
+	app.stores.ObjectStore = obs
+	app.stores.Signer, err = data.FromSigningConfig(config)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return app
+}
+
+func TestDisposeCaseHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		caseID string
+		want   int
+	}{
+		{
+			name:   "successful for existing case",
+			caseID: "1",
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "with case that doesn't exist fails",
+			caseID: "2",
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "with wrong caseID format fails",
+			caseID: "first",
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestDispositionServer(t)
+			seedForHandlerTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", tt.caseID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.DisposeCaseHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestGetCertificateHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		certificateID string
+		want          int
+	}{
+		{
+			name:          "successful for existing certificate",
+			certificateID: "1",
+			want:          http.StatusOK,
+		},
+		{
+			name:          "with certificate that doesn't exist fails",
+			certificateID: "2",
+			want:          http.StatusNotFound,
+		},
+		{
+			name:          "with wrong certificateID format fails",
+			certificateID: "first",
+			want:          http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestDispositionServer(t)
+			seedForHandlerTesting(t, app)
+			_, err := app.stores.DisposeCase("test", "test")
+			if err != nil {
+				t.Fatalf("failed to dispose case: %v", err)
+			}
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("certificateID", tt.certificateID)
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.GetCertificateHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestDisposeCaseHandlerAllowedJudgeViewingTheCase(t *testing.T) {
+	app := newTestDispositionServer(t)
+	seedForHandlerTesting(t, app)
+	addTestJudge(t, app, "judge", data.CaseViewer)
+	req, err := http.NewRequest(http.MethodPost, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "judge"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	rec := httptest.NewRecorder()
+	app.DisposeCaseHandler(rec, req.WithContext(ctx))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expected status code %d, got %d", http.StatusCreated, rec.Code)
+	}
+}
@@ -57,7 +57,30 @@ func (app *Application) unauthorizedUser(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *Application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	message := "your role doesn't permit this action"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *Application) alreadyExists(w http.ResponseWriter, r *http.Request) {
 	message := "resource already exists"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+func (app *Application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	message := "the request conflicts with the current state of the resource"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) hashMismatchResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+}
+
+func (app *Application) lockedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+	message := "the resource is under legal hold and can't be removed"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
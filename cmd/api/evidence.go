@@ -1,16 +1,25 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/miloszizic/der/internal/data"
 	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 )
 
-// CreateEvidenceHandler creates an evidence in a specific case
+// CreateEvidenceHandler creates an evidence in a specific case, the response has a
+// signed receipt of the evidence when a signing key is configured
 func (app *Application) CreateEvidenceHandler(w http.ResponseWriter, r *http.Request) {
-	cs, err := app.caseParser(r)
+	cs, err := app.caseParser(r, data.CaseContributor)
 	if err != nil {
 		fmt.Println(err)
 		app.respondError(w, r, err)
@@ -22,22 +31,38 @@ func (app *Application) CreateEvidenceHandler(w http.ResponseWriter, r *http.Req
 		app.respondError(w, r, err)
 		return
 	}
+	ev.Custody = app.custodyActor(r)
 	err = app.stores.CreateEvidence(ev, cs)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
-	app.respond(w, r, http.StatusCreated, envelope{"Evidence": ev})
+	body, err := app.ingestedEnvelope(ev)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, body)
 }
 
 // ListEvidencesHandler returns all evidences for a case by comparing evidences in the
-// database with the ones in the ObjectStore
+// database with the ones in the ObjectStore, with a folder in the query only the
+// folders and evidences directly in that folder are returned
 func (app *Application) ListEvidencesHandler(w http.ResponseWriter, r *http.Request) {
-	cs, err := app.caseParser(r)
+	cs, err := app.caseParser(r, data.CaseViewer)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
+	if r.URL.Query().Has("folder") {
+		listing, err := app.stores.ListFolder(cs, r.URL.Query().Get("folder"))
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		app.respond(w, r, http.StatusOK, folderListing(listing))
+		return
+	}
 	evidences, err := app.stores.ListEvidences(cs)
 	if err != nil {
 		app.respondError(w, r, err)
@@ -46,38 +71,161 @@ func (app *Application) ListEvidencesHandler(w http.ResponseWriter, r *http.Requ
 	app.respond(w, r, http.StatusOK, envelope{"evidences": evidences})
 }
 
-// DownloadEvidenceHandler returns an evidence from the database and the ObjectStore
+// DownloadEvidenceHandler returns the content of an evidence as a file download,
+// the latest version is returned unless a version is given in the query. Range and
+// conditional requests are supported with the stored SHA256 hash as the ETag.
+// Downloads are added to the chain of custody when the status is written, before
+// the content is sent, so requests that send no content aren't recorded. A resumed
+// download or a seek is one download, so only a request from the first byte is.
 func (app *Application) DownloadEvidenceHandler(w http.ResponseWriter, r *http.Request) {
 	// get evidence from the request
-	ev, err := app.evidenceParser(r)
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	version, err := versionParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	v, err := app.stores.GetEvidenceVersion(ev, version)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
 	// get evidence from the ObjectStore
-	file, err := app.stores.DownloadEvidence(ev)
+	file, err := app.stores.DownloadEvidenceVersion(ev, v.Version)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
+	if r.Method != http.MethodHead {
+		w = &custodyWriter{ResponseWriter: w, record: func(status int) error {
+			detail, ok := downloadCustodyDetail(r, status)
+			if !ok {
+				return nil
+			}
+			return app.recordVersionCustody(r, ev, v.Version, v.Hash, data.CustodyDownload, detail)
+		}, fail: func(w http.ResponseWriter, err error) {
+			app.respondError(w, r, err)
+		}}
+	}
 	//respond with evidence content
-	err = app.respondEvidence(w, r, *file)
+	app.respondEvidence(w, r, ev, v, *file)
+}
+
+// downloadCustodyDetail returns the detail of the download custody event and true
+// when a response with the status sends the version from its first byte. The whole
+// file has no detail, a range from byte 0 has the requested range. A range that
+// doesn't start at byte 0 continues a download.
+func downloadCustodyDetail(r *http.Request, status int) (string, bool) {
+	switch status {
+	case http.StatusOK:
+		return "", true
+	case http.StatusPartialContent:
+		ranges := r.Header.Get("Range")
+		first, _, _ := strings.Cut(strings.TrimPrefix(ranges, "bytes="), ",")
+		if !strings.HasPrefix(strings.TrimSpace(first), "0-") {
+			return "", false
+		}
+		return "range " + ranges, true
+	}
+	return "", false
+}
+
+// custodyWriter records a custody event with the status of the response before
+// it is written. When recording fails the failure is the response instead and
+// the content isn't sent.
+type custodyWriter struct {
+	http.ResponseWriter
+	record func(status int) error
+	fail   func(w http.ResponseWriter, err error)
+	wrote  bool
+	err    error
+}
+
+func (c *custodyWriter) WriteHeader(status int) {
+	if c.wrote {
+		return
+	}
+	c.wrote = true
+	c.err = c.record(status)
+	if c.err != nil {
+		// the headers of the content don't describe the failure
+		for _, key := range []string{"Content-Type", "Content-Length", "Content-Range", "Content-Disposition", "ETag", "Digest", "Repr-Digest", "Last-Modified", "Accept-Ranges"} {
+			c.Header().Del(key)
+		}
+		c.fail(c.ResponseWriter, c.err)
+		return
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *custodyWriter) Write(p []byte) (int, error) {
+	if !c.wrote {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the ResponseWriter for http.ResponseController
+func (c *custodyWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// ListEvidenceVersionsHandler returns the revision history of an evidence
+func (app *Application) ListEvidenceVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	versions, err := app.stores.ListEvidenceVersions(ev)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
+	app.respond(w, r, http.StatusOK, envelope{"versions": versions})
+}
 
+// FindEvidencesByHashHandler returns the evidences of all cases with a version
+// that has the hash from the query, the hash can be an MD5, SHA1, SHA256 or SHA512 digest
+func (app *Application) FindEvidencesByHashHandler(w http.ResponseWriter, r *http.Request) {
+	evidences, err := app.stores.FindEvidencesByHash(r.URL.Query().Get("hash"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	user, err := app.requestUser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	evidences, err = app.stores.FilterUserEvidences(evidences, user)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if evidences == nil {
+		evidences = []data.Evidence{}
+	}
+	app.respond(w, r, http.StatusOK, envelope{"evidences": evidences})
 }
 
 // DeleteEvidenceHandler deletes an evidence from the database and the ObjectStore
 func (app *Application) DeleteEvidenceHandler(w http.ResponseWriter, r *http.Request) {
 	// get evidence from the request
-	ev, err := app.evidenceParser(r)
+	ev, err := app.evidenceParser(r, data.CaseOwner)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
 	// delete evidence from the request
+	ev.Custody = app.custodyActor(r)
 	err = app.stores.DeleteEvidence(ev)
 	if err != nil {
 		app.respondError(w, r, err)
@@ -90,13 +238,14 @@ func (app *Application) DeleteEvidenceHandler(w http.ResponseWriter, r *http.Req
 // AddCommentHandler adds a comment to an evidence in the database
 func (app *Application) AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// get comment from the request
-	cm, err := app.commentParser(r)
+	ev, cm, err := app.commentParser(r)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
 	}
 	// add comment to the database
-	err = app.stores.AddEvidenceComment(cm)
+	cm.Custody = app.custodyActor(r)
+	err = app.stores.AddEvidenceComment(ev, cm)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
@@ -107,6 +256,7 @@ func (app *Application) AddCommentHandler(w http.ResponseWriter, r *http.Request
 
 // fileParser parses the evidence from the request body and returns it
 func (*Application) fileParser(r *http.Request, cs *data.Case) (*data.Evidence, error) {
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
 	file, handler, err := r.FormFile("upload_file")
 	if err != nil {
 		if errors.Is(err, http.ErrMissingFile) {
@@ -118,44 +268,205 @@ func (*Application) fileParser(r *http.Request, cs *data.Case) (*data.Evidence,
 		return nil, fmt.Errorf("%w: file is empty", data.ErrInvalidRequest)
 	}
 	defer file.Close()
+	declared, err := declaredHashesParser(r)
+	if err != nil {
+		return nil, err
+	}
 	evidence := &data.Evidence{
-		Name:   handler.Filename,
-		CaseID: cs.ID,
-		File:   file,
+		Name:           handler.Filename,
+		Folder:         r.FormValue("folder"),
+		CaseID:         cs.ID,
+		File:           file,
+		UploadedBy:     payload.Username,
+		DeclaredHashes: declared,
 	}
 	return evidence, nil
 }
 
-// commentParser parses the comment from the request and returns it
-func (app *Application) commentParser(r *http.Request) (*data.Comment, error) {
+// contentDigestAlgorithms maps the algorithms of the Content-Digest header to hash algorithms
+var contentDigestAlgorithms = map[string]string{
+	"md5":     data.HashMD5,
+	"sha":     data.HashSHA1,
+	"sha-256": data.HashSHA256,
+	"sha-512": data.HashSHA512,
+}
+
+// declaredHashesParser returns the hashes of the evidence file declared by the
+// client, a hex digest in the hash form field and the digests of the
+// Content-Digest header like sha-256=:<base64>:. Unknown algorithms of the header
+// are ignored.
+func declaredHashesParser(r *http.Request) (data.Hashes, error) {
+	declared := data.Hashes{}
+	if value := r.FormValue("hash"); value != "" {
+		algorithm, digest, err := data.HashAlgorithmOf(value)
+		if err != nil {
+			return nil, err
+		}
+		declared[algorithm] = digest
+	}
+	header := r.Header.Get("Content-Digest")
+	if header == "" {
+		return declared, nil
+	}
+	for _, member := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok || len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("%w : invalid Content-Digest header", data.ErrInvalidRequest)
+		}
+		algorithm, ok := contentDigestAlgorithms[strings.ToLower(key)]
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w : invalid %s digest in Content-Digest header", data.ErrInvalidRequest, key)
+		}
+		digest := hex.EncodeToString(sum)
+		if other, ok := declared[algorithm]; ok && other != digest {
+			return nil, fmt.Errorf("%w : different %s hashes were declared", data.ErrInvalidRequest, algorithm)
+		}
+		declared[algorithm] = digest
+	}
+	return declared, nil
+}
+
+// versionParser returns the evidence version from the query, zero when it isn't set
+func versionParser(r *http.Request) (int64, error) {
+	query := r.URL.Query().Get("version")
+	if query == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(query, 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w : invalid version parameter", data.ErrInvalidRequest)
+	}
+	return version, nil
+}
+
+// commentParser parses the comment from the request and returns it with the
+// evidence it is about
+func (app *Application) commentParser(r *http.Request) (*data.Evidence, *data.Comment, error) {
 	// get evidence from the request
-	ev, err := app.evidenceParser(r)
+	ev, err := app.evidenceParser(r, data.CaseContributor)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// get comment from the request
 	var cm data.Comment
 	err = app.readJSON(r, &cm)
 	if err != nil {
-		return nil, fmt.Errorf("parsing JSON comment : %w", err)
+		return nil, nil, fmt.Errorf("parsing JSON comment : %w", err)
 	}
 	comment := data.Comment{
 		Text:       cm.Text,
 		EvidenceID: ev.ID,
 	}
-	return &comment, nil
+	return ev, &comment, nil
+}
+
+// respondEvidence writes the evidence content with the headers of a file download.
+// The content is served with http.ServeContent, which handles Range and
+// conditional requests. Content that isn't seekable is copied to a temporary file
+// when it is first read, so a request that isn't modified doesn't read it.
+func (app *Application) respondEvidence(w http.ResponseWriter, r *http.Request, ev *data.Evidence, version *data.EvidenceVersion, file io.ReadCloser) {
+	defer file.Close()
+	header := w.Header()
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": ev.Name}))
+	contentType := mime.TypeByExtension(path.Ext(ev.Name))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	sum, err := hex.DecodeString(version.Hash)
+	if err == nil && len(sum) == sha256.Size {
+		digest := base64.StdEncoding.EncodeToString(sum)
+		header.Set("ETag", `"`+version.Hash+`"`)
+		header.Set("Digest", "sha-256="+digest)
+		header.Set("Repr-Digest", "sha-256=:"+digest+":")
+	}
+	content := &contentReader{Reader: file}
+	seeker, ok := file.(io.Seeker)
+	if !ok {
+		if contentType == "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		spooled := &spooledContent{src: content}
+		defer spooled.Close()
+		http.ServeContent(w, r, "", version.CreatedAt, spooled)
+	} else {
+		http.ServeContent(w, r, "", version.CreatedAt, struct {
+			io.Reader
+			io.Seeker
+		}{content, seeker})
+	}
+	// the status is already sent, so errors can only be logged
+	if content.err != nil {
+		app.logError(r, fmt.Errorf("responding with evidence : %w", content.err))
+	}
+}
+
+// contentReader keeps the first error from reading the evidence content other than io.EOF
+type contentReader struct {
+	io.Reader
+	err error
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// spooledContent makes content that isn't seekable seekable by copying it to a
+// temporary file on the first Read or Seek
+type spooledContent struct {
+	src  io.Reader
+	file *os.File
+	err  error
+}
+
+func (s *spooledContent) spool() error {
+	if s.file != nil || s.err != nil {
+		return s.err
+	}
+	file, err := os.CreateTemp("", "evidence-")
+	if err != nil {
+		s.err = fmt.Errorf("creating temporary file : %w", err)
+		return s.err
+	}
+	s.file = file
+	_, err = io.Copy(file, s.src)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s.err = fmt.Errorf("copying evidence to temporary file : %w", err)
+	}
+	return s.err
 }
 
-// respondEvidence returns a response with the evidence content with status code 200
-func (app *Application) respondEvidence(w http.ResponseWriter, r *http.Request, file io.ReadCloser) error {
-	// respond with evidence content
-	_, err := io.Copy(w, file)
+func (s *spooledContent) Read(p []byte) (int, error) {
+	err := s.spool()
 	if err != nil {
-		return fmt.Errorf("responding with evidence : %w", err)
+		return 0, err
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"evidence": "downloaded"}, nil)
+	return s.file.Read(p)
+}
+
+func (s *spooledContent) Seek(offset int64, whence int) (int64, error) {
+	err := s.spool()
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return 0, err
+	}
+	return s.file.Seek(offset, whence)
+}
+
+// Close removes the temporary file
+func (s *spooledContent) Close() error {
+	if s.file == nil {
+		return nil
 	}
-	return nil
+	s.file.Close()
+	return os.Remove(s.file.Name())
 }
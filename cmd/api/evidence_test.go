@@ -3,14 +3,21 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/miloszizic/der/internal/data"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -34,7 +41,7 @@ func TestCreateEvidenceHandler(t *testing.T) {
 			want:              http.StatusCreated,
 		},
 		{
-			name: "that already exists returns an error",
+			name: "that already exists creates a new version",
 			alreadyAddedEvidence: &data.Evidence{
 				CaseID: 1,
 				Name:   "video",
@@ -42,7 +49,7 @@ func TestCreateEvidenceHandler(t *testing.T) {
 			},
 			caseID:            "1",
 			evidenceNameToAdd: "video",
-			want:              http.StatusConflict,
+			want:              http.StatusCreated,
 		},
 		{
 			name: "with no file attached returns an error",
@@ -129,6 +136,119 @@ func TestCreateEvidenceHandler(t *testing.T) {
 		})
 	}
 }
+func TestCreateEvidenceHandlerCheckedDeclaredHash(t *testing.T) {
+	content := []byte("sample-content")
+	sha256Sum := sha256.Sum256(content)
+	md5Sum := md5.Sum(content)
+	other := sha256.Sum256([]byte("corrupted"))
+	tests := []struct {
+		name          string
+		formHash      string
+		contentDigest string
+		want          int
+		wantStatus    string
+	}{
+		{
+			name:       "with matching hash form field is verified",
+			formHash:   hex.EncodeToString(sha256Sum[:]),
+			want:       http.StatusCreated,
+			wantStatus: data.VerificationPassed,
+		},
+		{
+			name:          "with matching Content-Digest header is verified",
+			contentDigest: "sha-256=:" + base64.StdEncoding.EncodeToString(sha256Sum[:]) + ":, md5=:" + base64.StdEncoding.EncodeToString(md5Sum[:]) + ":",
+			want:          http.StatusCreated,
+			wantStatus:    data.VerificationPassed,
+		},
+		{
+			name:          "with unknown Content-Digest algorithm only is not verified",
+			contentDigest: "crc32c=:AAAAAA==:",
+			want:          http.StatusCreated,
+		},
+		{
+			name:     "with mismatching hash form field fails",
+			formHash: hex.EncodeToString(other[:]),
+			want:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "with mismatching Content-Digest header fails",
+			contentDigest: "sha-256=:" + base64.StdEncoding.EncodeToString(other[:]) + ":",
+			want:          http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "with malformed Content-Digest header fails",
+			contentDigest: "sha-256=" + hex.EncodeToString(sha256Sum[:]),
+			want:          http.StatusBadRequest,
+		},
+		{
+			name:          "with conflicting declared hashes fails",
+			formHash:      hex.EncodeToString(sha256Sum[:]),
+			contentDigest: "sha-256=:" + base64.StdEncoding.EncodeToString(other[:]) + ":",
+			want:          http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			body := new(bytes.Buffer)
+			writer := multipart.NewWriter(body)
+			if tt.formHash != "" {
+				err := writer.WriteField("hash", tt.formHash)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			part, err := writer.CreateFormFile("upload_file", "image.dd")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = part.Write(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("POST", "/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			if tt.contentDigest != "" {
+				req.Header.Set("Content-Digest", tt.contentDigest)
+			}
+			rec := httptest.NewRecorder()
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			app.CreateEvidenceHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			cs, err := app.stores.DBStore.GetCaseByName("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := app.stores.DBStore.GetEvidenceByName(cs, "", "image.dd")
+			if tt.want != http.StatusCreated {
+				if err == nil {
+					t.Errorf("expected evidence not to be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.VerificationStatus != tt.wantStatus {
+				t.Errorf("expected verification status %q, got %q", tt.wantStatus, ev.VerificationStatus)
+			}
+		})
+	}
+}
+
 func TestGetEvidenceHandler(t *testing.T) {
 	tests := []struct {
 		name                 string
@@ -379,6 +499,7 @@ func TestListEvidencesHandlerReturnedAllEvidencesFromDBAndOBS(t *testing.T) {
 			return
 		}
 		evidence.Hash = hash
+		evidence.Hashes = data.Hashes{data.HashSHA256: hash}
 		_, err = app.stores.DBStore.CreateEvidence(evidence)
 		if err != nil {
 			t.Errorf("failed to create evidence: %v", err)
@@ -551,3 +672,353 @@ func TestAddCommentHandler(t *testing.T) {
 		})
 	}
 }
+
+// seedEvidenceVersions adds an evidence named video with two versions to the test case
+func seedEvidenceVersions(t *testing.T, app *Application) {
+	cs, err := app.stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"first", "second"} {
+		err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString(content)}, cs)
+		if err != nil {
+			t.Fatalf("failed to create evidence: %v", err)
+		}
+	}
+}
+
+func TestDownloadEvidenceHandlerWithVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    int
+		content string
+	}{
+		{
+			name:    "without version returns the latest version",
+			version: "",
+			want:    http.StatusOK,
+			content: "second",
+		},
+		{
+			name:    "with first version returns the first content",
+			version: "1",
+			want:    http.StatusOK,
+			content: "first",
+		},
+		{
+			name:    "with version that doesn't exist fails",
+			version: "5",
+			want:    http.StatusNotFound,
+		},
+		{
+			name:    "with invalid version format fails",
+			version: "abc",
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "with version zero fails",
+			version: "0",
+			want:    http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			seedEvidenceVersions(t, app)
+			target := "/"
+			if tt.version != "" {
+				target = "/?version=" + tt.version
+			}
+			req, err := http.NewRequest("GET", target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("evidenceID", "1")
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			req = req.WithContext(ctx)
+			app.DownloadEvidenceHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.content != "" && !bytes.HasPrefix(rec.Body.Bytes(), []byte(tt.content)) {
+				t.Errorf("expected content %q, got %q", tt.content, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestListEvidenceVersionsHandlerReturnedAllVersions(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	seedEvidenceVersions(t, app)
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	rct.URLParams.Add("evidenceID", "1")
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	req = req.WithContext(ctx)
+	app.ListEvidenceVersionsHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	var got struct {
+		Versions []data.EvidenceVersion `json:"versions"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, v := range got.Versions {
+		versions = append(versions, v.Version)
+	}
+	want := []int64{1, 2}
+	if !cmp.Equal(want, versions) {
+		t.Errorf(cmp.Diff(want, versions))
+	}
+}
+
+func TestFindEvidencesByHashHandler(t *testing.T) {
+	firstMD5 := md5.Sum([]byte("first"))
+	missing := sha256.Sum256([]byte("missing"))
+	tests := []struct {
+		name  string
+		hash  string
+		want  int
+		found int
+	}{
+		{
+			name:  "with MD5 of an older version found the evidence",
+			hash:  hex.EncodeToString(firstMD5[:]),
+			want:  http.StatusOK,
+			found: 1,
+		},
+		{
+			name:  "with hash that doesn't match found nothing",
+			hash:  hex.EncodeToString(missing[:]),
+			want:  http.StatusOK,
+			found: 0,
+		},
+		{
+			name: "with invalid hash fails",
+			hash: "abcd",
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			seedEvidenceVersions(t, app)
+			req, err := http.NewRequest("GET", "/?hash="+tt.hash, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			app.FindEvidencesByHashHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Evidences []data.Evidence `json:"evidences"`
+			}
+			err = json.NewDecoder(rec.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Evidences) != tt.found {
+				t.Errorf("expected %d evidences, got %d", tt.found, len(got.Evidences))
+			}
+		})
+	}
+}
+
+func TestDownloadEvidenceHandlerServedFileDownload(t *testing.T) {
+	content := "the quick brown fox"
+	sum := sha256.Sum256([]byte(content))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	tests := []struct {
+		name      string
+		encrypted bool
+		header    http.Header
+		want      int
+		body      string
+	}{
+		{
+			name: "without range returns the whole file",
+			want: http.StatusOK,
+			body: content,
+		},
+		{
+			name:   "with range returns part of the file",
+			header: http.Header{"Range": {"bytes=4-8"}},
+			want:   http.StatusPartialContent,
+			body:   "quick",
+		},
+		{
+			name:      "with range returns part of an encrypted file",
+			encrypted: true,
+			header:    http.Header{"Range": {"bytes=10-"}},
+			want:      http.StatusPartialContent,
+			body:      "brown fox",
+		},
+		{
+			name:   "with range that can't be satisfied fails",
+			header: http.Header{"Range": {"bytes=100-200"}},
+			want:   http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:   "with matching If-None-Match is not modified",
+			header: http.Header{"If-None-Match": {etag}},
+			want:   http.StatusNotModified,
+		},
+		{
+			name:   "with other If-Match fails the precondition",
+			header: http.Header{"If-Match": {`"other"`}},
+			want:   http.StatusPreconditionFailed,
+		},
+		{
+			name:   "with matching If-Range returns the range",
+			header: http.Header{"Range": {"bytes=0-2"}, "If-Range": {etag}},
+			want:   http.StatusPartialContent,
+			body:   "the",
+		},
+		{
+			name:   "with other If-Range returns the whole file",
+			header: http.Header{"Range": {"bytes=0-2"}, "If-Range": {`"other"`}},
+			want:   http.StatusOK,
+			body:   content,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			if tt.encrypted {
+				app = newTestDispositionServer(t)
+			}
+			seedForHandlerTesting(t, app)
+			cs, err := app.stores.DBStore.GetCaseByName("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "fox-notes.txt", File: bytes.NewBufferString(content)}, cs)
+			if err != nil {
+				t.Fatalf("failed to create evidence: %v", err)
+			}
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("evidenceID", "1")
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			app.DownloadEvidenceHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if rec.Header().Get("ETag") != etag {
+				t.Errorf("expected ETag %s, got %q", etag, rec.Header().Get("ETag"))
+			}
+			if tt.body == "" {
+				return
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+			wantHeader := map[string]string{
+				"Content-Type":        "text/plain; charset=utf-8",
+				"Content-Length":      strconv.Itoa(len(tt.body)),
+				"Content-Disposition": "attachment; filename=fox-notes.txt",
+				"Digest":              "sha-256=" + base64.StdEncoding.EncodeToString(sum[:]),
+				"Repr-Digest":         "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":",
+			}
+			for key, want := range wantHeader {
+				if got := rec.Header().Get(key); got != want {
+					t.Errorf("expected %s %q, got %q", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRespondEvidenceServedContentThatIsNotSeekable(t *testing.T) {
+	content := "the quick brown fox"
+	sum := sha256.Sum256([]byte(content))
+	version := &data.EvidenceVersion{Version: 1, Hash: hex.EncodeToString(sum[:])}
+	etag := `"` + version.Hash + `"`
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+		body   string
+	}{
+		{
+			name: "without range returns the whole file",
+			want: http.StatusOK,
+			body: content,
+		},
+		{
+			name:   "with range returns part of the file",
+			header: http.Header{"Range": {"bytes=4-8"}},
+			want:   http.StatusPartialContent,
+			body:   "quick",
+		},
+		{
+			name:   "with matching If-None-Match is not modified",
+			header: http.Header{"If-None-Match": {etag}},
+			want:   http.StatusNotModified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			// io.NopCloser hides the Seek method of the reader
+			file := io.NopCloser(strings.NewReader(content))
+			app.respondEvidence(rec, req, &data.Evidence{Name: "fox-notes"}, version, file)
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, rec.Body.String())
+			}
+			if tt.body == "" {
+				return
+			}
+			if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(tt.body)) {
+				t.Errorf("expected Content-Length %d, got %q", len(tt.body), got)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/octet-stream" {
+				t.Errorf("expected Content-Type %q, got %q", "application/octet-stream", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// folderRequest is the path of a folder to create
+type folderRequest struct {
+	Path string `json:"path"`
+}
+
+// moveFolderRequest is the current and the new path of a folder
+type moveFolderRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// moveEvidenceRequest is the new folder and name of an evidence, fields that are
+// left out keep their current value
+type moveEvidenceRequest struct {
+	Folder *string `json:"folder"`
+	Name   *string `json:"name"`
+}
+
+// CreateFolderHandler adds a folder to a case together with the folders it is in
+func (app *Application) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req folderRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	folder, err := app.stores.CreateFolder(cs, req.Path)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, envelope{"folder": folder})
+}
+
+// MoveFolderHandler moves or renames a folder of a case with everything in it
+func (app *Application) MoveFolderHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req moveFolderRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	folder, err := app.stores.MoveFolder(cs, req.From, req.To)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"folder": folder})
+}
+
+// MoveEvidenceHandler moves an evidence to another folder of its case or renames it
+func (app *Application) MoveEvidenceHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req moveEvidenceRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	folder, name := ev.Folder, ev.Name
+	if req.Folder != nil {
+		folder = *req.Folder
+	}
+	if req.Name != nil {
+		name = *req.Name
+	}
+	ev.Custody = app.custodyActor(r)
+	err = app.stores.MoveEvidence(ev, folder, name)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Evidence": ev})
+}
+
+// folderListing is the response of a folder listing
+func folderListing(listing *data.FolderListing) envelope {
+	return envelope{"folder": listing.Path, "folders": listing.Folders, "evidences": listing.Evidences}
+}
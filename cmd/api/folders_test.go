@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// seedFolderTesting adds an evidence named "Scene 1.mp4" in the folder "Police report/Videos" of the test case
+func seedFolderTesting(t *testing.T, app *Application) {
+	seedForHandlerTesting(t, app)
+	cs, err := app.stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "Police report/Videos", File: bytes.NewBufferString("test")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+}
+
+// folderRequestContext adds the URL parameters and the authorization payload to the request
+func folderRequestContext(req *http.Request, caseID string, evidenceID string) *http.Request {
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", caseID)
+	if evidenceID != "" {
+		rct.URLParams.Add("evidenceID", evidenceID)
+	}
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	return req.WithContext(ctx)
+}
+
+func TestCreateFolderHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		caseID string
+		body   string
+		want   int
+	}{
+		{
+			name:   "successful with nested path",
+			caseID: "1",
+			body:   `{"path": "Lab results/Toxicology"}`,
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "with existing folder fails",
+			caseID: "1",
+			body:   `{"path": "Police report/Videos"}`,
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "with empty path fails",
+			caseID: "1",
+			body:   `{"path": "/"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "with relative path fails",
+			caseID: "1",
+			body:   `{"path": "Police report/../Videos"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "with case that doesn't exist fails",
+			caseID: "2",
+			body:   `{"path": "Lab results"}`,
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedFolderTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.CreateFolderHandler(rec, folderRequestContext(req, tt.caseID, ""))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestListEvidencesHandlerListedFolder(t *testing.T) {
+	tests := []struct {
+		name          string
+		folder        string
+		wantFolders   []string
+		wantEvidences []string
+		want          int
+	}{
+		{
+			name:          "root lists top folders",
+			folder:        "",
+			wantFolders:   []string{"Police report"},
+			wantEvidences: []string{},
+			want:          http.StatusOK,
+		},
+		{
+			name:          "nested folder lists its evidences",
+			folder:        "Police report/Videos",
+			wantFolders:   []string{},
+			wantEvidences: []string{"Scene 1.mp4"},
+			want:          http.StatusOK,
+		},
+		{
+			name:   "folder that doesn't exist fails",
+			folder: "Lab results",
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedFolderTesting(t, app)
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := req.URL.Query()
+			q.Set("folder", tt.folder)
+			req.URL.RawQuery = q.Encode()
+			rec := httptest.NewRecorder()
+			app.ListEvidencesHandler(rec, folderRequestContext(req, "1", ""))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Folder    string          `json:"folder"`
+				Folders   []data.Folder   `json:"folders"`
+				Evidences []data.Evidence `json:"evidences"`
+			}
+			err = json.NewDecoder(rec.Body).Decode(&got)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			folders := []string{}
+			for _, f := range got.Folders {
+				folders = append(folders, f.Path)
+			}
+			evidences := []string{}
+			for _, ev := range got.Evidences {
+				evidences = append(evidences, ev.Name)
+			}
+			if !cmp.Equal(folders, tt.wantFolders) {
+				t.Errorf(cmp.Diff(tt.wantFolders, folders))
+			}
+			if !cmp.Equal(evidences, tt.wantEvidences) {
+				t.Errorf(cmp.Diff(tt.wantEvidences, evidences))
+			}
+		})
+	}
+}
+
+func TestMoveEvidenceHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		evidenceID string
+		body       string
+		wantFolder string
+		wantName   string
+		want       int
+	}{
+		{
+			name:       "successful rename keeps the folder",
+			evidenceID: "1",
+			body:       `{"name": "Scene 1 (raw).mp4"}`,
+			wantFolder: "Police report/Videos",
+			wantName:   "Scene 1 (raw).mp4",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "successful move to root",
+			evidenceID: "1",
+			body:       `{"folder": ""}`,
+			wantFolder: "",
+			wantName:   "Scene 1.mp4",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "with invalid name fails",
+			evidenceID: "1",
+			body:       `{"name": "a/b"}`,
+			want:       http.StatusBadRequest,
+		},
+		{
+			name:       "with evidence that doesn't exist fails",
+			evidenceID: "2",
+			body:       `{"name": "video"}`,
+			want:       http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedFolderTesting(t, app)
+			req, err := http.NewRequest(http.MethodPatch, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.MoveEvidenceHandler(rec, folderRequestContext(req, "1", tt.evidenceID))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			ev, err := app.stores.GetEvidenceByID(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Folder != tt.wantFolder || ev.Name != tt.wantName {
+				t.Errorf("expected evidence %q in %q, got %q in %q", tt.wantName, tt.wantFolder, ev.Name, ev.Folder)
+			}
+		})
+	}
+}
+
+func TestMoveFolderHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "successful rename",
+			body: `{"from": "Police report", "to": "Police reports"}`,
+			want: http.StatusOK,
+		},
+		{
+			name: "with folder that doesn't exist fails",
+			body: `{"from": "Lab results", "to": "Lab"}`,
+			want: http.StatusNotFound,
+		},
+		{
+			name: "into itself fails",
+			body: `{"from": "Police report", "to": "Police report/Videos/Old"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "to existing folder fails",
+			body: `{"from": "Police report/Videos", "to": "Police report"}`,
+			want: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedFolderTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.MoveFolderHandler(rec, folderRequestContext(req, "1", ""))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -13,8 +13,9 @@ import (
 	"strings"
 )
 
-// readIDParam reads an id param from a request.
-func (app *Application) caseParser(r *http.Request) (*data.Case, error) {
+// caseParser parses the case ID from the request url and returns the case, the
+// user of the request must be a member of the case with at least the case role.
+func (app *Application) caseParser(r *http.Request, need string) (*data.Case, error) {
 	urlID := chi.URLParam(r, "caseID")
 	id, err := strconv.ParseInt(urlID, 10, 64)
 	if err != nil || id < 1 {
@@ -24,17 +25,22 @@ func (app *Application) caseParser(r *http.Request) (*data.Case, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = app.checkCaseAccess(r, cs, need)
+	if err != nil {
+		return nil, err
+	}
 	return cs, nil
 }
 
-// evidenceParser parses the request url and returns caseID and evidenceID.
-func (app *Application) evidenceParser(r *http.Request) (*data.Evidence, error) {
+// evidenceParser parses the request url and returns the evidence of the case,
+// the user of the request must be a member of the case with at least the case role.
+func (app *Application) evidenceParser(r *http.Request, need string) (*data.Evidence, error) {
 	evID := chi.URLParam(r, "evidenceID")
 	id, err := strconv.ParseInt(evID, 10, 64)
 	if err != nil || id < 1 {
 		return nil, fmt.Errorf("%w : invalid id parameter", data.ErrInvalidRequest)
 	}
-	cs, err := app.caseParser(r)
+	cs, err := app.caseParser(r, need)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +51,29 @@ func (app *Application) evidenceParser(r *http.Request) (*data.Evidence, error)
 	return ev, nil
 }
 
+// requestUser returns the user of the request, it is loaded by
+// MiddlewarePermissionChecker or looked up by the username of the token
+func (app *Application) requestUser(r *http.Request) (*data.User, error) {
+	if user, ok := r.Context().Value(authorizationUserKey).(*data.User); ok {
+		return user, nil
+	}
+	payload, ok := r.Context().Value(authorizationPayloadKey).(*Payload)
+	if !ok {
+		return nil, data.ErrUnauthorized
+	}
+	return app.stores.User.GetByUsername(payload.Username)
+}
+
+// checkCaseAccess returns ErrForbidden unless the user of the request has at
+// least the case role in the case
+func (app *Application) checkCaseAccess(r *http.Request, cs *data.Case, need string) error {
+	user, err := app.requestUser(r)
+	if err != nil {
+		return err
+	}
+	return app.stores.CheckCaseAccess(cs, user, need)
+}
+
 // Envelope type for better documentation, also it's to make sure that your JSON
 // always returns its response as a non-array JSON object for security reasons.
 type envelope map[string]interface{}
@@ -129,10 +158,18 @@ func (app *Application) respondError(w http.ResponseWriter, r *http.Request, err
 		app.notFoundResponse(w, r)
 	case errors.Is(err, data.ErrAlreadyExists):
 		app.alreadyExists(w, r)
+	case errors.Is(err, data.ErrConflict):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, data.ErrLocked):
+		app.lockedResponse(w, r, err)
+	case errors.Is(err, data.ErrHashMismatch):
+		app.hashMismatchResponse(w, r, err)
 	case errors.Is(err, data.ErrInvalidRequest):
 		app.badRequestResponse(w, r, err)
 	case errors.Is(err, data.ErrUnauthorized):
 		app.unauthorizedUser(w, r)
+	case errors.Is(err, data.ErrForbidden):
+		app.forbiddenResponse(w, r, err)
 	case errors.Is(err, data.ErrInvalidCredentials):
 		app.invalidCredentialsResponse(w, r)
 	default:
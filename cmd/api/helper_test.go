@@ -1,10 +1,8 @@
 package api
 
 import (
-	"context"
-	"database/sql"
 	"github.com/miloszizic/der/internal/data"
-	"github.com/minio/minio-go/v7"
+	"github.com/miloszizic/der/internal/data/memstore"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"io"
@@ -34,76 +32,22 @@ func newTestServer(t *testing.T) *Application {
 	if err != nil {
 		t.Errorf("failed to create tokenMaker maker: %v", err)
 	}
-	db, err := data.FromPostgresDB(config.Database.ConnectionInfo())
-	if err != nil {
-		t.Errorf("failed to create database: %v", err)
-	}
-	resetTestPostgresDB(db, t)
-	minioCfg := config.Minio
-	minioClient, err := data.FromMinio(
-		minioCfg.Endpoint,
-		minioCfg.AccessKey,
-		minioCfg.SecretKey,
-	)
-	restartTestMinio(minioClient, t)
-	if err != nil {
-		t.Errorf("failed to create ostorage client: %v", err)
-	}
 	app := &Application{
 		logger:     logger,
 		tokenMaker: tokenMaker,
 		config:     config,
-		stores:     data.NewStores(db, minioClient),
+		stores:     memstore.NewStores(),
 	}
 	return app
 
 }
 
-func resetTestPostgresDB(sqlDB *sql.DB, t *testing.T) {
-	if _, err := sqlDB.Exec("TRUNCATE TABLE users,user_cases,evidences,cases,comments CASCADE;"); err != nil {
-		t.Errorf("failed to truncate tables: %v", err)
-	}
-	if _, err := sqlDB.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1;"); err != nil {
-		t.Errorf("failed to truncate tables: %v", err)
-	}
-	if _, err := sqlDB.Exec("ALTER SEQUENCE cases_id_seq RESTART WITH 1;"); err != nil {
-		t.Errorf("failed to truncate tables: %v", err)
-	}
-	if _, err := sqlDB.Exec("ALTER SEQUENCE evidences_id_seq RESTART WITH 1;"); err != nil {
-		t.Errorf("failed to truncate tables: %v", err)
-	}
-	if _, err := sqlDB.Exec("ALTER SEQUENCE comments_id_seq RESTART WITH 1;"); err != nil {
-		t.Errorf("failed to truncate tables: %v", err)
-	}
-}
-
-func restartTestMinio(client *minio.Client, t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	buckets, err := client.ListBuckets(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	for _, bucket := range buckets {
-		objects := client.ListObjects(ctx, bucket.Name, minio.ListObjectsOptions{})
-		for object := range objects {
-			errR := client.RemoveObject(ctx, bucket.Name, object.Key, minio.RemoveObjectOptions{})
-			if errR != nil {
-				t.Fatal(errR)
-			}
-		}
-		if err = client.RemoveBucket(context.Background(), bucket.Name); err != nil {
-			t.Fatal(err)
-		}
-	}
-}
-
 // seedForHandlerTesting seeds the database with one user and one case for testing
 func seedForHandlerTesting(t *testing.T, app *Application) {
 	// get new test server
 	user := &data.User{
 		Username: "test",
+		Role:     data.RoleAdministrator,
 	}
 	err := user.Password.Set("test")
 	if err != nil {
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// holdRequest is the legal hold to place, without evidence ID the whole case is held
+type holdRequest struct {
+	EvidenceID int64      `json:"evidence_id"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// PlaceHoldHandler puts a case or one of its evidences under legal hold. The route
+// requires hold:manage, so a judge only has to be a member of the case. The
+// response reports whether the hold was mirrored to the object store.
+func (app *Application) PlaceHoldHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req holdRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	hold := &data.LegalHold{
+		CaseID:     cs.ID,
+		EvidenceID: req.EvidenceID,
+		Reason:     req.Reason,
+		IssuedBy:   payload.Username,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	mirrored, err := app.stores.PlaceHold(hold)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, envelope{"hold": hold, "mirrored": mirrored})
+}
+
+// ListHoldsHandler returns all legal holds of a case, including released ones
+func (app *Application) ListHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	holds, err := app.stores.ListHolds(cs)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"holds": holds})
+}
+
+// ReleaseHoldHandler releases a legal hold of a case, like placing it requires
+// hold:manage and membership of the case
+func (app *Application) ReleaseHoldHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "holdID"), 10, 64)
+	if err != nil || id < 1 {
+		app.respondError(w, r, fmt.Errorf("%w : invalid id parameter", data.ErrInvalidRequest))
+		return
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	hold, err := app.stores.ReleaseHold(cs.ID, id, payload.Username)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"hold": hold})
+}
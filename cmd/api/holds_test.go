@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// seedHoldTesting adds an evidence named video to the test case and places a legal hold on the case
+func seedHoldTesting(t *testing.T, app *Application) {
+	seedForHandlerTesting(t, app)
+	cs, err := app.stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString("test")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	_, err = app.stores.PlaceHold(&data.LegalHold{CaseID: cs.ID, Reason: "court order", IssuedBy: "test"})
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+}
+
+func TestPlaceHoldHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		caseID string
+		body   string
+		want   int
+	}{
+		{
+			name:   "successful for the whole case",
+			caseID: "1",
+			body:   `{"reason": "preservation order"}`,
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "successful for an evidence with expiry",
+			caseID: "1",
+			body:   `{"evidence_id": 1, "reason": "preservation order", "expires_at": "2099-01-01T00:00:00Z"}`,
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "without reason fails",
+			caseID: "1",
+			body:   `{"evidence_id": 1}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "with evidence that doesn't exist fails",
+			caseID: "1",
+			body:   `{"evidence_id": 4, "reason": "preservation order"}`,
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "with case that doesn't exist fails",
+			caseID: "2",
+			body:   `{"reason": "preservation order"}`,
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedHoldTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", tt.caseID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.PlaceHoldHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestReleaseHoldHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		caseID string
+		holdID string
+		want   int
+	}{
+		{
+			name:   "successful for existing hold",
+			caseID: "1",
+			holdID: "1",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "with hold that doesn't exist fails",
+			caseID: "1",
+			holdID: "2",
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "with wrong holdID format fails",
+			caseID: "1",
+			holdID: "first",
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedHoldTesting(t, app)
+			req, err := http.NewRequest(http.MethodDelete, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", tt.caseID)
+			rct.URLParams.Add("holdID", tt.holdID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.ReleaseHoldHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteEvidenceHandlerRefusedEvidenceUnderLegalHold(t *testing.T) {
+	app := newTestServer(t)
+	seedHoldTesting(t, app)
+	req, err := http.NewRequest(http.MethodDelete, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	rct.URLParams.Add("evidenceID", "1")
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	rec := httptest.NewRecorder()
+	app.DeleteEvidenceHandler(rec, req.WithContext(ctx))
+	if rec.Code != http.StatusLocked {
+		t.Errorf("expected status code %d, got %d", http.StatusLocked, rec.Code)
+	}
+}
+
+// addTestJudge adds a judge and, when role isn't empty, makes them a member of the test case
+func addTestJudge(t *testing.T, app *Application, username, role string) {
+	t.Helper()
+	err := app.stores.CreateUser(&data.UserRequest{Username: username, Password: "secret", Role: data.RoleJudge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role == "" {
+		return
+	}
+	_, err = app.stores.SetCaseMember(&data.Case{ID: 1, Name: "test"}, username, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHoldHandlersAllowedJudgeViewingTheCase(t *testing.T) {
+	app := newTestServer(t)
+	seedHoldTesting(t, app)
+	addTestJudge(t, app, "judge", data.CaseViewer)
+	addTestJudge(t, app, "outsider", "")
+	tests := []struct {
+		name     string
+		username string
+		handler  http.HandlerFunc
+		holdID   string
+		body     string
+		want     int
+	}{
+		{
+			name:     "viewer places hold",
+			username: "judge",
+			handler:  app.PlaceHoldHandler,
+			body:     `{"reason": "preservation order"}`,
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "viewer releases hold",
+			username: "judge",
+			handler:  app.ReleaseHoldHandler,
+			holdID:   "1",
+			want:     http.StatusOK,
+		},
+		{
+			name:     "judge of another case fails",
+			username: "outsider",
+			handler:  app.PlaceHoldHandler,
+			body:     `{"reason": "preservation order"}`,
+			want:     http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("holdID", tt.holdID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: tt.username})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
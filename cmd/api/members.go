@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// ListCaseMembersHandler returns the members of the case with their case roles
+func (app *Application) ListCaseMembersHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	members, err := app.stores.ListCaseMembers(cs)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if members == nil {
+		members = []data.CaseMember{}
+	}
+	app.respond(w, r, http.StatusOK, envelope{"members": members})
+}
+
+// SetCaseMemberHandler gives the user named in the URL access to the case with
+// the case role from the request, owners of the case can change its members
+func (app *Application) SetCaseMemberHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseOwner)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req roleRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	member, err := app.stores.SetCaseMember(cs, chi.URLParam(r, "username"), req.Role)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"member": member})
+}
+
+// RemoveCaseMemberHandler removes the access of the user named in the URL to the case
+func (app *Application) RemoveCaseMemberHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseOwner)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.stores.RemoveCaseMember(cs, chi.URLParam(r, "username"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"member": "successfully removed"})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// addTestMember adds a user with the role and, with a case role, makes the user
+// a member of the test case
+func addTestMember(t *testing.T, app *Application, username string, role string, caseRole string) {
+	err := app.stores.CreateUser(&data.UserRequest{Username: username, Password: "secret", Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caseRole == "" {
+		return
+	}
+	cs, err := app.stores.GetCaseByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.stores.SetCaseMember(cs, username, caseRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveAs serves the request through the routes of the app with a token of the user
+func serveAs(t *testing.T, app *Application, username string, method string, target string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	addAuthorization(t, request, app, "Bearer", username, time.Hour)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRoutesRequiredCaseMembership(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		caseRole string
+		method   string
+		target   string
+		body     string
+		want     int
+	}{
+		{
+			name:   "clerk who isn't a member reading the case forbidden",
+			role:   data.RoleClerk,
+			method: http.MethodGet,
+			target: "/cases/1",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "clerk who isn't a member listing evidences forbidden",
+			role:   data.RoleClerk,
+			method: http.MethodGet,
+			target: "/cases/1/evidences",
+			want:   http.StatusForbidden,
+		},
+		{
+			name:     "defense viewer reading the case allowed",
+			role:     data.RoleDefense,
+			caseRole: data.CaseViewer,
+			method:   http.MethodGet,
+			target:   "/cases/1",
+			want:     http.StatusOK,
+		},
+		{
+			name:     "clerk viewer creating a folder forbidden",
+			role:     data.RoleClerk,
+			caseRole: data.CaseViewer,
+			method:   http.MethodPost,
+			target:   "/cases/1/folders",
+			body:     `{"path": "Photos"}`,
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "clerk contributor creating a folder allowed",
+			role:     data.RoleClerk,
+			caseRole: data.CaseContributor,
+			method:   http.MethodPost,
+			target:   "/cases/1/folders",
+			body:     `{"path": "Photos"}`,
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "judge viewer placing a hold",
+			role:     data.RoleJudge,
+			caseRole: data.CaseViewer,
+			method:   http.MethodPost,
+			target:   "/cases/1/holds",
+			body:     `{"reason": "appeal"}`,
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "clerk owner placing a hold forbidden",
+			role:     data.RoleClerk,
+			caseRole: data.CaseOwner,
+			method:   http.MethodPost,
+			target:   "/cases/1/holds",
+			body:     `{"reason": "appeal"}`,
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "clerk contributor adding a member forbidden",
+			role:     data.RoleClerk,
+			caseRole: data.CaseContributor,
+			method:   http.MethodPut,
+			target:   "/cases/1/members/other",
+			body:     `{"role": "viewer"}`,
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "clerk owner adding a member allowed",
+			role:     data.RoleClerk,
+			caseRole: data.CaseOwner,
+			method:   http.MethodPut,
+			target:   "/cases/1/members/other",
+			body:     `{"role": "viewer"}`,
+			want:     http.StatusOK,
+		},
+		{
+			name:   "administrator who isn't a member reading the case allowed",
+			role:   data.RoleAdministrator,
+			method: http.MethodGet,
+			target: "/cases/1",
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			addTestMember(t, app, "member", tt.role, tt.caseRole)
+			addTestMember(t, app, "other", data.RoleClerk, "")
+			recorder := serveAs(t, app, "member", tt.method, tt.target, tt.body)
+			if recorder.Code != tt.want {
+				t.Errorf("expected status code %d, got %d: %s", tt.want, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestListCasesHandlerListedOnlyCasesOfMember(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	addTestMember(t, app, "member", data.RoleClerk, "")
+	recorder := serveAs(t, app, "member", http.MethodPost, "/cases", `{"name": "other"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	recorder = serveAs(t, app, "member", http.MethodGet, "/cases", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var got struct {
+		Cases []data.Case `json:"cases"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Cases) != 1 || got.Cases[0].Name != "other" {
+		t.Errorf("expected only the case of the member, got %+v", got.Cases)
+	}
+}
+
+func TestCaseMemberHandlers(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	addTestMember(t, app, "member", data.RoleDefense, data.CaseViewer)
+	recorder := serveAs(t, app, "test", http.MethodPut, "/cases/1/members/member", `{"role": "contributor"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recorder = serveAs(t, app, "member", http.MethodGet, "/cases/1/members", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var got struct {
+		Members []data.CaseMember `json:"members"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []data.CaseMember{
+		{CaseID: 1, UserID: 2, Username: "member", Role: data.CaseContributor},
+		{CaseID: 1, UserID: 1, Username: "test", Role: data.CaseOwner},
+	}
+	if !cmp.Equal(want, got.Members) {
+		t.Errorf(cmp.Diff(want, got.Members))
+	}
+	recorder = serveAs(t, app, "test", http.MethodDelete, "/cases/1/members/member", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recorder = serveAs(t, app, "member", http.MethodGet, "/cases/1/members", "")
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d after removal, got %d", http.StatusForbidden, recorder.Code)
+	}
+	recorder = serveAs(t, app, "test", http.MethodDelete, "/cases/1/members/test", "")
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected status code %d removing the last owner, got %d", http.StatusConflict, recorder.Code)
+	}
+}
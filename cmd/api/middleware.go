@@ -16,6 +16,7 @@ type authorization string
 var (
 	authorizationHeaderKey  authorization = "authorization"
 	authorizationPayloadKey authorization = "authorization_payload"
+	authorizationUserKey    authorization = "authorization_user"
 	sugaredLogFormat                      = `[%s] "%s %s %s" from %s - %s %dB in %s`
 )
 
@@ -46,10 +47,25 @@ func (app *Application) AuthMiddleware(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		// refresh tokens only get new access tokens
+		if payload.Kind == TokenRefresh {
+			app.respondError(w, r, fmt.Errorf("%w : refresh token used as access token", data.ErrUnauthorized))
+			return
+		}
+		// the session of the token must not be revoked
+		_, err = app.stores.CheckSession(payload.SessionID)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
 		ctx := context.WithValue(r.Context(), authorizationPayloadKey, payload)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// MiddlewarePermissionChecker loads the user of the token, users whose role has
+// no permissions are rejected. The permission each route needs is checked by
+// RequirePermission.
 func (app *Application) MiddlewarePermissionChecker(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctxPayload := r.Context().Value(authorizationPayloadKey)
@@ -59,16 +75,51 @@ func (app *Application) MiddlewarePermissionChecker(next http.Handler) http.Hand
 			app.respondError(w, r, err)
 			return
 		}
-		if user.Role != "admin" {
+		if len(data.Permissions(user.Role)) == 0 {
 			app.respondError(w, r, data.ErrUnauthorized)
 			return
 		}
-		ctx := context.WithValue(r.Context(), authorizationPayloadKey, payload)
+		ctx := context.WithValue(r.Context(), authorizationUserKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 
 }
 
+// RequirePermission is a middleware that lets through only users whose role
+// grants the permission, it runs after MiddlewarePermissionChecker
+func (app *Application) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(authorizationUserKey).(*data.User)
+			if !ok {
+				app.respondError(w, r, data.ErrUnauthorized)
+				return
+			}
+			if !data.HasPermission(user.Role, permission) {
+				app.respondError(w, r, fmt.Errorf("%w : role %q doesn't grant %q", data.ErrForbidden, user.Role, permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ExtendDeadlines lets the requests of a route read the body and write the response
+// until the timeout instead of the server timeouts, which are too short to transfer
+// large evidences or to create them when an upload completes
+func ExtendDeadlines(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline := time.Now().Add(timeout)
+			rc := http.NewResponseController(w)
+			// writers that don't support deadlines have none to extend
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Logger is a middleware that logs the start and end of each request, along
 // with some useful data about what was requested, what the response status was,
 // and how long it took to return.
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// oidcCookie keeps the state, nonce and code verifier of a single sign-on login
+// between the redirect to the identity provider and the callback
+const oidcCookie = "der_oidc"
+
+// oidcLoginTTL is how long in seconds the user has to sign in at the provider
+const oidcLoginTTL = 10 * 60
+
+// OIDCLoginHandler starts a single sign-on login, it redirects the user to the
+// identity provider with a new state, nonce and PKCE code challenge
+func (app *Application) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if app.stores.OIDC == nil {
+		app.respondError(w, r, fmt.Errorf("%w : single sign-on is not configured", data.ErrNotFound))
+		return
+	}
+	values := make([]string, 3)
+	for i := range values {
+		value, err := randomValue()
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	authURL, err := app.stores.OIDC.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    strings.Join(values, "."),
+		Path:     "/oidc",
+		MaxAge:   oidcLoginTTL,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes a single sign-on login, it redeems the code of the
+// identity provider, provisions the user of the ID token and starts a session
+func (app *Application) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if app.stores.OIDC == nil {
+		app.respondError(w, r, fmt.Errorf("%w : single sign-on is not configured", data.ErrNotFound))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/oidc", MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil})
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		app.respondError(w, r, fmt.Errorf("%w : identity provider returned %s", data.ErrUnauthorized, query.Get("error")))
+		return
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		app.respondError(w, r, fmt.Errorf("%w : login wasn't started", data.ErrUnauthorized))
+		return
+	}
+	values := strings.Split(cookie.Value, ".")
+	if len(values) != 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(query.Get("state"))) != 1 {
+		app.respondError(w, r, fmt.Errorf("%w : state doesn't match the login", data.ErrUnauthorized))
+		return
+	}
+	identity, err := app.stores.OIDC.Exchange(query.Get("code"), values[2], values[1])
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	user, err := app.stores.ProvisionOIDCUser(identity)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	response, err := app.startSession(r, user)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Login": response})
+}
+
+// randomValue returns 32 random bytes base64url encoded, it is used for the
+// state, nonce and code verifier
+func randomValue() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
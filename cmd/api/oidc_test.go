@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/oidctest"
+)
+
+// newTestOIDCServer returns a test server that signs users in at the IdP
+func newTestOIDCServer(t *testing.T) (*Application, *oidctest.IdP) {
+	app := newTestServer(t)
+	idp := oidctest.NewIdP(t, "der")
+	provider, err := data.NewOIDCProvider(data.OIDCConfig{
+		Issuer:      idp.Issuer(),
+		ClientID:    idp.ClientID,
+		RedirectURL: "http://example.com/oidc/callback",
+		RoleMapping: "clerks:clerk",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.stores.OIDC = provider
+	return app, idp
+}
+
+// startOIDCLogin starts a login through the routes of the app and returns the
+// callback URL the IdP redirected back to with the login cookie
+func startOIDCLogin(t *testing.T, app *Application, idp *oidctest.IdP) (*url.URL, *http.Cookie) {
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusFound, recorder.Code, recorder.Body.String())
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected the login cookie, got %+v", cookies)
+	}
+	return idp.Authorize(t, recorder.Header().Get("Location")), cookies[0]
+}
+
+// finishOIDCLogin serves the callback through the routes of the app
+func finishOIDCLogin(app *Application, callback *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestOIDCLoginProvisionedUserAndStartedSession(t *testing.T) {
+	app, idp := newTestOIDCServer(t)
+	idp.SignIn(oidctest.Identity{Subject: "1001", Username: "clerk", Groups: []string{"clerks"}})
+	callback, cookie := startOIDCLogin(t, app, idp)
+	recorder := finishOIDCLogin(app, callback, cookie)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var got struct {
+		Login LoginUserResponse `json:"Login"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Login.User.Username != "clerk" || got.Login.User.Role != data.RoleClerk {
+		t.Errorf("expected the provisioned clerk, got %+v", got.Login.User)
+	}
+	if code := serveWithToken(app, got.Login.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Errorf("expected status code %d with the access token, got %d", http.StatusOK, code)
+	}
+	// the code can only be redeemed once
+	recorder = finishOIDCLogin(app, callback, cookie)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d redeeming the code again, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
+
+func TestOIDCCallbackHandlerRejectedLogin(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		change func(callback *url.URL, cookie *http.Cookie) *http.Cookie
+		want   int
+	}{
+		{
+			name:   "callback without the login cookie",
+			groups: []string{"clerks"},
+			change: func(callback *url.URL, cookie *http.Cookie) *http.Cookie { return nil },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "callback with the state of another login",
+			groups: []string{"clerks"},
+			change: func(callback *url.URL, cookie *http.Cookie) *http.Cookie {
+				query := callback.Query()
+				query.Set("state", "forged")
+				callback.RawQuery = query.Encode()
+				return cookie
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:   "callback with an error of the identity provider",
+			groups: []string{"clerks"},
+			change: func(callback *url.URL, cookie *http.Cookie) *http.Cookie {
+				callback.RawQuery = url.Values{"error": {"access_denied"}, "state": {callback.Query().Get("state")}}.Encode()
+				return cookie
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:   "user without a mapped group",
+			groups: []string{"visitors"},
+			change: func(callback *url.URL, cookie *http.Cookie) *http.Cookie { return cookie },
+			want:   http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, idp := newTestOIDCServer(t)
+			idp.SignIn(oidctest.Identity{Subject: "1001", Username: "clerk", Groups: tt.groups})
+			callback, cookie := startOIDCLogin(t, app, idp)
+			recorder := finishOIDCLogin(app, callback, tt.change(callback, cookie))
+			if recorder.Code != tt.want {
+				t.Errorf("expected status code %d, got %d: %s", tt.want, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestOIDCLoginHandlerWithoutProviderNotFound(t *testing.T) {
+	app := newTestServer(t)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
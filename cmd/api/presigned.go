@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// presignedUploadRequest names the evidence that will be uploaded and its folder
+type presignedUploadRequest struct {
+	Name   string `json:"name"`
+	Folder string `json:"folder"`
+}
+
+// completeUploadRequest optionally declares the SHA256 hash of the uploaded content
+type completeUploadRequest struct {
+	SHA256 string `json:"sha256"`
+}
+
+// PresignDownloadHandler returns a short-lived URL that downloads an evidence
+// directly from the object store
+func (app *Application) PresignDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	version, err := versionParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	url, err := app.stores.PresignDownload(ev, version, app.config.Presign.Expiry)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	v, err := app.stores.GetEvidenceVersion(ev, version)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.recordVersionCustody(r, ev, v.Version, v.Hash, data.CustodyPresignedDownload, "expires at "+url.ExpiresAt.Format(time.RFC3339))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"download": url})
+}
+
+// CreatePresignedUploadHandler returns a short-lived URL the client uploads an
+// evidence to, the upload must be completed to create the evidence
+func (app *Application) CreatePresignedUploadHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req presignedUploadRequest
+	err = app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	upload := &data.PresignedUpload{
+		CaseID:   cs.ID,
+		Name:     req.Name,
+		Folder:   req.Folder,
+		Username: payload.Username,
+	}
+	err = app.stores.CreatePresignedUpload(upload, app.config.Presign.Expiry)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, envelope{"upload": upload})
+}
+
+// CompletePresignedUploadHandler creates the evidence from an object uploaded
+// with a presigned URL
+func (app *Application) CompletePresignedUploadHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var req completeUploadRequest
+	if r.ContentLength != 0 {
+		err = app.readJSON(r, &req)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	ev, err := app.stores.CompletePresignedUpload(cs.ID, chi.URLParam(r, "uploadID"), payload.Username, req.SHA256, app.custodyActor(r))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	body, err := app.ingestedEnvelope(ev)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusCreated, body)
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// presigningStore hands out fake presigned URLs for the in-memory ObjectStore
+type presigningStore struct {
+	data.ObjectStore
+}
+
+func (p *presigningStore) PresignGet(caseName string, objectName string, filename string, expiry time.Duration) (string, error) {
+	return "https://storage/" + caseName + "/" + objectName, nil
+}
+
+func (p *presigningStore) PresignPut(caseName string, objectName string, expiry time.Duration) (string, error) {
+	return "https://storage/" + caseName + "/" + objectName, nil
+}
+
+// seedPresignTesting adds an evidence named video to the test case, the object store presigns URLs when presign is true
+func seedPresignTesting(t *testing.T, app *Application, presign bool) {
+	if presign {
+		app.stores.ObjectStore = &presigningStore{ObjectStore: app.stores.ObjectStore}
+	}
+	seedForHandlerTesting(t, app)
+	cs, err := app.stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString("test")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+}
+
+func TestPresignDownloadHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		presign    bool
+		evidenceID string
+		version    string
+		want       int
+	}{
+		{
+			name:       "successful for existing evidence",
+			presign:    true,
+			evidenceID: "1",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "with version that doesn't exist fails",
+			presign:    true,
+			evidenceID: "1",
+			version:    "2",
+			want:       http.StatusNotFound,
+		},
+		{
+			name:       "with evidence that doesn't exist fails",
+			presign:    true,
+			evidenceID: "2",
+			want:       http.StatusNotFound,
+		},
+		{
+			name:       "with object store without presigned URLs fails",
+			presign:    false,
+			evidenceID: "1",
+			want:       http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedPresignTesting(t, app, tt.presign)
+			target := "/"
+			if tt.version != "" {
+				target += "?version=" + tt.version
+			}
+			req, err := http.NewRequest(http.MethodPost, target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("evidenceID", tt.evidenceID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.PresignDownloadHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCreatePresignedUploadHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		caseID string
+		body   string
+		want   int
+	}{
+		{
+			name:   "successful for new evidence",
+			caseID: "1",
+			body:   `{"name": "audio"}`,
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "successful for new version of existing evidence",
+			caseID: "1",
+			body:   `{"name": "video"}`,
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "with invalid name fails",
+			caseID: "1",
+			body:   `{"name": "my/audio"}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "with case that doesn't exist fails",
+			caseID: "2",
+			body:   `{"name": "audio"}`,
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedPresignTesting(t, app, true)
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", tt.caseID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.CreatePresignedUploadHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCompletePresignedUploadHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		uploaded bool
+		uploadID string
+		username string
+		body     string
+		want     int
+	}{
+		{
+			name:     "successful for uploaded evidence",
+			uploaded: true,
+			body:     `{"sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}`,
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "successful without declared hash",
+			uploaded: true,
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "without uploaded evidence fails",
+			uploaded: false,
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "with upload that doesn't exist fails",
+			uploaded: true,
+			uploadID: "unknown",
+			want:     http.StatusNotFound,
+		},
+		{
+			name:     "with upload of another user fails",
+			uploaded: true,
+			username: "other",
+			want:     http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedPresignTesting(t, app, true)
+			upload := &data.PresignedUpload{CaseID: 1, Name: "audio", Username: "test"}
+			if tt.username != "" {
+				upload.Username = tt.username
+			}
+			err := app.stores.CreatePresignedUpload(upload, 0)
+			if err != nil {
+				t.Fatalf("failed to create presigned upload: %v", err)
+			}
+			if tt.uploaded {
+				_, err = app.stores.ObjectStore.CreateEvidence(&data.Evidence{Name: upload.ObjectName}, "test", strings.NewReader("test"))
+				if err != nil {
+					t.Fatalf("failed to upload object: %v", err)
+				}
+			}
+			uploadID := upload.ID
+			if tt.uploadID != "" {
+				uploadID = tt.uploadID
+			}
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("uploadID", uploadID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.CompletePresignedUploadHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestPresignHandlersRefusedEncryptedCase(t *testing.T) {
+	app := newTestDispositionServer(t)
+	encrypted := app.stores.ObjectStore.(*data.EncryptedStore)
+	encrypted.ObjectStore = &presigningStore{ObjectStore: encrypted.ObjectStore}
+	seedPresignTesting(t, app, false)
+	handlers := map[string]http.HandlerFunc{
+		"download": app.PresignDownloadHandler,
+		"upload":   app.CreatePresignedUploadHandler,
+	}
+	for name, handler := range handlers {
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"name": "audio"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rct := chi.NewRouteContext()
+		rct.URLParams.Add("caseID", "1")
+		rct.URLParams.Add("evidenceID", "1")
+		ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+		rec := httptest.NewRecorder()
+		handler(rec, req.WithContext(ctx))
+		if rec.Code != http.StatusConflict {
+			t.Errorf("expected status code %d presigning %s, got %d", http.StatusConflict, name, rec.Code)
+		}
+	}
+}
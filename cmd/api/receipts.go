@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// receiptRequest is a receipt to verify, the statement exactly as it was returned
+// and its base64 encoded signature
+type receiptRequest struct {
+	Statement string `json:"statement"`
+	Signature []byte `json:"signature"`
+}
+
+// SigningKeyHandler publishes the public key that verifies the receipts and
+// certificates signed by the server. keys lists the current key first and then
+// the previous keys that verify documents signed before the key was replaced.
+func (app *Application) SigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if app.stores.Signer == nil {
+		app.respondError(w, r, fmt.Errorf("%w : signing key is not configured", data.ErrNotFound))
+		return
+	}
+	current := app.stores.Signer.KeyID()
+	publicKeys := app.stores.Signer.PublicKeys()
+	ids := make([]string, 0, len(publicKeys))
+	for id := range publicKeys {
+		if id != current {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	keys := make([]map[string]string, 0, len(publicKeys))
+	for _, id := range append([]string{current}, ids...) {
+		keys = append(keys, map[string]string{
+			"key_id":     id,
+			"algorithm":  "Ed25519",
+			"public_key": base64.StdEncoding.EncodeToString(publicKeys[id]),
+		})
+	}
+	app.respond(w, r, http.StatusOK, envelope{
+		"key_id":     current,
+		"algorithm":  "Ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(app.stores.Signer.PublicKey()),
+		"keys":       keys,
+	})
+}
+
+// VerifyReceiptHandler reports whether a receipt was signed by the server, it
+// returns the statement of the receipt with the result
+func (app *Application) VerifyReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	var req receiptRequest
+	err := app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	receipt := &data.Receipt{Statement: req.Statement, Signature: req.Signature}
+	valid, err := app.stores.VerifyReceipt(receipt)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"valid": valid, "receipt": receipt})
+}
+
+// ingestedEnvelope is the response to an ingested evidence, a signed receipt is
+// added when a signing key is configured
+func (app *Application) ingestedEnvelope(ev *data.Evidence) (envelope, error) {
+	if app.stores.Signer == nil {
+		return envelope{"Evidence": ev}, nil
+	}
+	receipt, err := app.stores.IssueReceipt(ev)
+	if err != nil {
+		return nil, err
+	}
+	return envelope{"Evidence": ev, "receipt": receipt}, nil
+}
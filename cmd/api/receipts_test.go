@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// createEvidenceWithReceipt uploads an evidence named image.dd to the test case
+// and returns the receipt from the response
+func createEvidenceWithReceipt(t *testing.T, app *Application) data.Receipt {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("upload_file", "image.dd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = part.Write([]byte("sample-content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	rec := httptest.NewRecorder()
+	app.CreateEvidenceHandler(rec, req.WithContext(ctx))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, rec.Code)
+	}
+	var got struct {
+		Receipt data.Receipt `json:"receipt"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.Receipt
+}
+
+func TestCreateEvidenceHandlerReturnedVerifiableReceipt(t *testing.T) {
+	app := newTestDispositionServer(t)
+	seedForHandlerTesting(t, app)
+	receipt := createEvidenceWithReceipt(t, app)
+	if receipt.Name != "image.dd" || receipt.UploadedBy != "test" || receipt.Hashes[data.HashSHA256] == "" {
+		t.Fatalf("unexpected receipt %+v", receipt.ReceiptStatement)
+	}
+	rec := httptest.NewRecorder()
+	app.SigningKeyHandler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/signing-key", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	var key struct {
+		KeyID     string `json:"key_id"`
+		PublicKey string `json:"public_key"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyID != receipt.KeyID || !ed25519.Verify(publicKey, []byte(receipt.Statement), receipt.Signature) {
+		t.Errorf("expected receipt to verify with the published key %q", key.KeyID)
+	}
+}
+
+func TestCreateEvidenceHandlerWithoutSigningKeyReturnedNoReceipt(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	receipt := createEvidenceWithReceipt(t, app)
+	if receipt.Statement != "" {
+		t.Errorf("expected no receipt, got %+v", receipt)
+	}
+	rec := httptest.NewRecorder()
+	app.SigningKeyHandler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/signing-key", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestVerifyReceiptHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(receipt *data.Receipt)
+		want      int
+		wantValid bool
+	}{
+		{
+			name:      "with issued receipt is valid",
+			change:    func(receipt *data.Receipt) {},
+			want:      http.StatusOK,
+			wantValid: true,
+		},
+		{
+			name: "with changed receipt is invalid",
+			change: func(receipt *data.Receipt) {
+				receipt.Statement = strings.Replace(receipt.Statement, "image.dd", "other.dd", 1)
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "with statement that isn't JSON fails",
+			change: func(receipt *data.Receipt) {
+				receipt.Statement = "receipt"
+			},
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestDispositionServer(t)
+			seedForHandlerTesting(t, app)
+			receipt := createEvidenceWithReceipt(t, app)
+			tt.change(&receipt)
+			body, err := json.Marshal(receiptRequest{Statement: receipt.Statement, Signature: receipt.Signature})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.VerifyReceiptHandler(rec, httptest.NewRequest(http.MethodPost, "/receipts/verify", bytes.NewReader(body)))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Valid bool `json:"valid"`
+			}
+			err = json.NewDecoder(rec.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Valid != tt.wantValid {
+				t.Errorf("expected valid %v, got %v", tt.wantValid, got.Valid)
+			}
+		})
+	}
+}
+
+func TestSigningKeyHandlerPublishedPreviousKeys(t *testing.T) {
+	app := newTestDispositionServer(t)
+	previous := base64.StdEncoding.EncodeToString(app.stores.Signer.PublicKey())
+	signer, err := data.NewSigner(data.SigningConfig{
+		PrivateKey:   base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32)),
+		KeyID:        "next",
+		PreviousKeys: "test:" + previous,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.stores.Signer = signer
+	rec := httptest.NewRecorder()
+	app.SigningKeyHandler(rec, httptest.NewRequest(http.MethodGet, "/.well-known/signing-key", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	var got struct {
+		KeyID string `json:"key_id"`
+		Keys  []struct {
+			KeyID     string `json:"key_id"`
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.KeyID != "next" || len(got.Keys) != 2 || got.Keys[0].KeyID != "next" || got.Keys[1].KeyID != "test" || got.Keys[1].PublicKey != previous {
+		t.Errorf("expected the current key and the previous key test, got %+v", got)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// ReconcileHandler compares the database with the object store and returns the
+// drift report, repairs are only made when they are enabled in the body
+func (app *Application) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	var opts data.ReconcileOptions
+	if r.ContentLength != 0 {
+		err := app.readJSON(r, &opts)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+	report, err := app.stores.Reconcile(opts)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"report": report})
+}
+
+// reconcileFlags are the flags of the reconcile subcommand
+type reconcileFlags struct {
+	Path string
+	data.ReconcileOptions
+}
+
+func parseReconcileFlags(programme string, args []string) (*reconcileFlags, string, error) {
+	flags := flag.NewFlagSet(programme, flag.ContinueOnError)
+	var buf bytes.Buffer
+	flags.SetOutput(&buf)
+
+	var conf reconcileFlags
+	flags.StringVar(&conf.Path, "config", "", "Path to config file")
+	flags.BoolVar(&conf.VerifyHashes, "verify-hashes", false, "Recompute the hash of every object")
+	flags.BoolVar(&conf.Quarantine, "quarantine", false, "Quarantine objects without a database row")
+	flags.BoolVar(&conf.MarkRows, "mark-rows", false, "Mark evidences with missing or mismatched objects")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, buf.String(), err
+	}
+	return &conf, buf.String(), nil
+}
+
+// runReconcile runs the reconcile subcommand and writes the drift report as JSON
+// to out. It returns the exit code, 1 when drift was found and 2 on errors.
+func runReconcile(programme string, args []string, out io.Writer) int {
+	conf, output, err := parseReconcileFlags(programme, args)
+	if err != nil {
+		fmt.Fprintln(out, output)
+		return 2
+	}
+	settings, err := data.LoadProductionConfig(conf.Path)
+	if err != nil {
+		fmt.Fprintln(out, "loading config failed:", err)
+		return 2
+	}
+	stores, err := openStores(settings)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	return writeReconcileReport(stores, conf.ReconcileOptions, out)
+}
+
+// writeReconcileReport reconciles the stores and writes the report as JSON to out
+func writeReconcileReport(stores data.Stores, opts data.ReconcileOptions, out io.Writer) int {
+	report, err := stores.Reconcile(opts)
+	if err != nil {
+		fmt.Fprintln(out, "reconciling stores failed:", err)
+		return 2
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(report)
+	if err != nil {
+		return 2
+	}
+	if len(report.Drifts) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+func TestReconcileHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "successful without options",
+			want: http.StatusOK,
+		},
+		{
+			name: "successful with repair options",
+			body: `{"verify_hashes": true, "quarantine": true, "mark_rows": true}`,
+			want: http.StatusOK,
+		},
+		{
+			name: "with unknown option fails",
+			body: `{"delete": true}`,
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedVerificationTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/admin/reconcile", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			app.ReconcileHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestParseReconcileFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *reconcileFlags
+		wantErr bool
+	}{
+		{
+			name: "without flags only compared the stores",
+			want: &reconcileFlags{},
+		},
+		{
+			name: "with all flags enabled every repair",
+			args: []string{"-config", "testdata/.config.json", "-verify-hashes", "-quarantine", "-mark-rows"},
+			want: &reconcileFlags{
+				Path:             "testdata/.config.json",
+				ReconcileOptions: data.ReconcileOptions{VerifyHashes: true, Quarantine: true, MarkRows: true},
+			},
+		},
+		{
+			name:    "with unknown flag failed",
+			args:    []string{"-delete"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := parseReconcileFlags("der reconcile", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestWriteReconcileReportReturnedExitCode(t *testing.T) {
+	app := newTestServer(t)
+	seedVerificationTesting(t, app)
+	var out bytes.Buffer
+	if code := writeReconcileReport(app.stores, data.ReconcileOptions{}, &out); code != 0 {
+		t.Errorf("expected exit code 0 without drift, got %d: %s", code, out.String())
+	}
+	_, err := app.stores.ObjectStore.CreateEvidence(&data.Evidence{Name: "stray"}, "test", strings.NewReader("stray"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := writeReconcileReport(app.stores, data.ReconcileOptions{}, &out); code != 1 {
+		t.Errorf("expected exit code 1 with drift, got %d", code)
+	}
+	if !strings.Contains(out.String(), `"kind": "orphan_object"`) {
+		t.Errorf("expected the orphan object in the report, got %s", out.String())
+	}
+}
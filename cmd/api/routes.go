@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
 	"net/http"
 )
 
@@ -14,28 +15,94 @@ func (app *Application) routes() http.Handler {
 		// not protected routes
 		r.Get("/ping", app.Ping)
 		r.Post("/login", app.Login)
+		r.Post("/tokens/refresh", app.RefreshTokenHandler)
+		r.Get("/oidc/login", app.OIDCLoginHandler)
+		r.Get("/oidc/callback", app.OIDCCallbackHandler)
+		r.Get("/.well-known/signing-key", app.SigningKeyHandler)
+		r.Get("/.well-known/paseto-keys", app.TokenKeysHandler)
+		r.Post("/receipts/verify", app.VerifyReceiptHandler)
 	})
 	// protected routes
 	r.Group(func(r chi.Router) {
 		// Middlewares in use
 		r.Use(app.AuthMiddleware)
 		r.Use(app.MiddlewarePermissionChecker)
+		// can returns the middleware that requires the permission
+		can := app.RequirePermission
 
 		// users routes
-		r.Post("/register", app.CreateUserHandler)
+		r.With(can(data.PermUserManage)).Post("/register", app.CreateUserHandler)
+		r.With(can(data.PermUserManage)).Get("/roles", app.ListRolesHandler)
+		r.With(can(data.PermUserManage)).Put("/users/{username}/role", app.SetUserRoleHandler)
+		r.With(can(data.PermUserManage)).Get("/users/{username}/sessions", app.ListUserSessionsHandler)
+		r.With(can(data.PermUserManage)).Delete("/users/{username}/sessions", app.RevokeUserSessionsHandler)
+		r.With(can(data.PermUserManage)).Delete("/users/{username}/sessions/{sessionID}", app.RevokeUserSessionHandler)
+		r.Post("/logout", app.LogoutHandler)
 
 		// cases
-		r.Post("/cases", app.CreateCaseHandler)
-		r.Get("/cases", app.ListCasesHandler)
-		r.Get("/cases/{CaseID}", app.GetCaseHandler)
-		r.Delete("/cases/{caseID}", app.RemoveCaseHandler)
+		r.With(can(data.PermCaseCreate)).Post("/cases", app.CreateCaseHandler)
+		r.With(can(data.PermCaseRead)).Get("/cases", app.ListCasesHandler)
+		r.With(can(data.PermCaseRead)).Get("/cases/{caseID}", app.GetCaseHandler)
+		r.With(can(data.PermCaseDelete)).Delete("/cases/{caseID}", app.RemoveCaseHandler)
+		r.With(can(data.PermCaseDispose)).Post("/cases/{caseID}/disposition", app.DisposeCaseHandler)
+
+		// case members
+		r.With(can(data.PermCaseRead)).Get("/cases/{caseID}/members", app.ListCaseMembersHandler)
+		r.With(can(data.PermCaseRead)).Put("/cases/{caseID}/members/{username}", app.SetCaseMemberHandler)
+		r.With(can(data.PermCaseRead)).Delete("/cases/{caseID}/members/{username}", app.RemoveCaseMemberHandler)
+
+		// legal holds
+		r.With(can(data.PermCaseRead)).Get("/cases/{caseID}/holds", app.ListHoldsHandler)
+		r.With(can(data.PermHoldManage)).Post("/cases/{caseID}/holds", app.PlaceHoldHandler)
+		r.With(can(data.PermHoldManage)).Delete("/cases/{caseID}/holds/{holdID}", app.ReleaseHoldHandler)
+
+		// folders
+		r.With(can(data.PermFolderManage)).Post("/cases/{caseID}/folders", app.CreateFolderHandler)
+		r.With(can(data.PermFolderManage)).Post("/cases/{caseID}/folders/move", app.MoveFolderHandler)
+
+		// destruction certificates
+		r.With(can(data.PermCertificateRead)).Get("/certificates", app.ListCertificatesHandler)
+		r.With(can(data.PermCertificateRead)).Get("/certificates/{certificateID}", app.GetCertificateHandler)
 
 		// evidences
-		r.Get("/cases/{caseID}/evidences", app.ListEvidencesHandler)
-		r.Post("/cases/{caseID}/evidences", app.CreateEvidenceHandler)
-		r.Get("/cases/{caseID}/evidences/{evidenceID}", app.DownloadEvidenceHandler)
-		r.Delete("/cases/{caseID}/evidences/{evidenceID}", app.DeleteEvidenceHandler)
-		r.Post("/cases/{caseID}/evidences/{evidenceID}/comment", app.AddCommentHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/evidences", app.FindEvidencesByHashHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/cases/{caseID}/evidences", app.ListEvidencesHandler)
+		r.With(can(data.PermEvidenceUpload)).Post("/cases/{caseID}/evidences", app.CreateEvidenceHandler)
+		r.With(can(data.PermEvidenceDownload)).Get("/cases/{caseID}/evidences/{evidenceID}", app.DownloadEvidenceHandler)
+		r.With(can(data.PermEvidenceDownload)).Head("/cases/{caseID}/evidences/{evidenceID}", app.DownloadEvidenceHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/cases/{caseID}/evidences/{evidenceID}/versions", app.ListEvidenceVersionsHandler)
+		r.With(can(data.PermEvidenceMove)).Patch("/cases/{caseID}/evidences/{evidenceID}", app.MoveEvidenceHandler)
+		r.With(can(data.PermEvidenceDelete)).Delete("/cases/{caseID}/evidences/{evidenceID}", app.DeleteEvidenceHandler)
+		r.With(can(data.PermEvidenceComment)).Post("/cases/{caseID}/evidences/{evidenceID}/comment", app.AddCommentHandler)
+		r.With(can(data.PermEvidenceVerify)).Post("/cases/{caseID}/evidences/{evidenceID}/verify", app.VerifyEvidenceHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/cases/{caseID}/evidences/{evidenceID}/verifications", app.ListVerificationsHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/cases/{caseID}/evidences/{evidenceID}/custody", app.ListCustodyHandler)
+		r.With(can(data.PermEvidenceRead)).Get("/cases/{caseID}/evidences/{evidenceID}/timestamp", app.DownloadTimestampHandler)
+		r.With(can(data.PermEvidenceVerify)).Post("/cases/{caseID}/evidences/{evidenceID}/timestamp/verify", app.VerifyTimestampHandler)
+
+		// direct transfers with presigned object store URLs
+		r.With(can(data.PermEvidenceDownload)).Post("/cases/{caseID}/evidences/{evidenceID}/presigned-download", app.PresignDownloadHandler)
+		r.With(can(data.PermEvidenceUpload)).Post("/cases/{caseID}/presigned-uploads", app.CreatePresignedUploadHandler)
+		r.With(can(data.PermEvidenceUpload), ExtendDeadlines(uploadTimeout)).Post("/cases/{caseID}/presigned-uploads/{uploadID}/complete", app.CompletePresignedUploadHandler)
+
+		// administration
+		r.With(can(data.PermKeyManage)).Post("/admin/keys/rotate", app.RotateMasterKeyHandler)
+		r.With(can(data.PermStorageReconcile)).Post("/admin/reconcile", app.ReconcileHandler)
+		r.With(can(data.PermAuditRead)).Post("/admin/audit/verify", app.VerifyAuditLogHandler)
+		r.With(can(data.PermAuditRead)).Get("/admin/audit/checkpoints", app.ListAuditCheckpointsHandler)
+		r.With(can(data.PermAuditManage)).Post("/admin/audit/checkpoints", app.CreateAuditCheckpointHandler)
+
+		// resumable uploads
+		r.Route("/cases/{caseID}/uploads", func(r chi.Router) {
+			r.Use(can(data.PermEvidenceUpload))
+			r.Use(ExtendDeadlines(uploadTimeout))
+			r.Use(app.TusMiddleware)
+			r.Options("/", app.UploadOptionsHandler)
+			r.Post("/", app.CreateUploadHandler)
+			r.Head("/{uploadID}", app.UploadOffsetHandler)
+			r.Patch("/{uploadID}", app.AppendUploadHandler)
+			r.Delete("/{uploadID}", app.TerminateUploadHandler)
+		})
 	})
 	return r
 }
@@ -28,6 +28,12 @@ type Application struct {
 }
 
 func Run() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[0]+" reconcile", os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAudit(os.Args[0]+" audit", os.Args[2:], os.Stdout))
+	}
 	conf, output, err := data.ParseFlags(os.Args[0], os.Args[1:])
 	if err == flag.ErrHelp {
 		fmt.Println(output)
@@ -55,32 +61,24 @@ func Run() {
 func NewApplication(config data.Config) (*Application, error) {
 	logger := initLogger()
 	defer logger.Sync()
-	tokenMaker, err := NewPasetoMaker(config.SymmetricKey)
+	tokenMaker, err := NewTokenMaker(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create paseto maker for tokens: %w", err)
 	}
-	db, err := data.FromPostgresDB(config.Database.ConnectionInfo())
+	stores, err := openStores(config)
 	if err != nil {
-		logger.Fatal("calling database failed", zap.Error(err))
-	}
-	minioConfig := config.Minio
-	minioClient, err := data.FromMinio(
-		minioConfig.Endpoint,
-		minioConfig.AccessKey,
-		minioConfig.SecretKey,
-	)
-	if err != nil {
-		logger.Fatal("calling minio failed", zap.Error(err))
+		logger.Fatal("opening stores failed", zap.Error(err))
 	}
 	app := &Application{
 		logger:     logger,
 		tokenMaker: tokenMaker,
 		config:     config,
-		stores:     data.NewStores(db, minioClient),
+		stores:     stores,
 	}
 	//add default user
 	user := &data.User{
 		Username: "Simba",
+		Role:     data.RoleAdministrator,
 	}
 	err = user.Password.Set("opsAdmin")
 	if err != nil {
@@ -94,6 +92,40 @@ func NewApplication(config data.Config) (*Application, error) {
 
 }
 
+// openStores connects to the database and the object store from the config
+func openStores(config data.Config) (data.Stores, error) {
+	db, err := data.FromPostgresDB(config.Database.ConnectionInfo())
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("calling database failed: %w", err)
+	}
+	obs, err := data.FromStorageConfig(config)
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("creating object store failed: %w", err)
+	}
+	obs, err = data.FromEncryptionConfig(config, obs, data.NewKeyStore(db))
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("enabling evidence encryption failed: %w", err)
+	}
+	stores := data.NewStores(db, obs)
+	stores.Signer, err = data.FromSigningConfig(config)
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("loading signing key failed: %w", err)
+	}
+	stores.Timestamper, err = data.FromTimestampingConfig(config)
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("configuring time-stamping failed: %w", err)
+	}
+	stores.HashAlgorithms, err = data.ParseHashAlgorithms(config.Hashing.Algorithms)
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("configuring hash algorithms failed: %w", err)
+	}
+	stores.OIDC, err = data.FromOIDCConfig(config)
+	if err != nil {
+		return data.Stores{}, fmt.Errorf("configuring single sign-on failed: %w", err)
+	}
+	return stores, nil
+}
+
 func (app *Application) Serve() error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.config.Port),
@@ -105,6 +137,9 @@ func (app *Application) Serve() error {
 
 	shutdownError := make(chan error)
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -122,12 +157,17 @@ func (app *Application) Serve() error {
 
 		app.logger.Info("completing background tasks", zap.String("addr", srv.Addr))
 
+		stopBackground()
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
 
 	app.logger.Info("starting background tasks", zap.String("addr", srv.Addr), zap.String("env", app.config.Env))
 
+	app.startScrubber(backgroundCtx)
+	app.startCheckpointer(backgroundCtx)
+
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
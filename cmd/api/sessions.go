@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// refreshRequest is the refresh token to exchange for new tokens
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new
+// refresh token, the refresh token can only be used once
+func (app *Application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	err := app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payload, err := app.tokenMaker.VerifyToken(req.RefreshToken)
+	if err != nil {
+		app.respondError(w, r, fmt.Errorf("%w : invalid refresh token", data.ErrUnauthorized))
+		return
+	}
+	if payload.Kind != TokenRefresh {
+		app.respondError(w, r, fmt.Errorf("%w : access token used as refresh token", data.ErrUnauthorized))
+		return
+	}
+	// the rotated session keeps the expiry of the login
+	refreshToken, refreshPayload, err := app.tokenMaker.CreateRefreshToken(payload.Username, time.Until(payload.ExpiresAt))
+	if err != nil {
+		app.respondError(w, r, fmt.Errorf("creating refresh token: %w", err))
+		return
+	}
+	_, err = app.stores.RefreshSession(payload.ID, refreshPayload.ID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	user, err := app.stores.User.GetByUsername(payload.Username)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	response, err := app.sessionResponse(user, refreshToken, refreshPayload)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Login": response})
+}
+
+// LogoutHandler revokes the session of the access token, its refresh token and
+// access tokens stop working
+func (app *Application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	err := app.stores.RevokeSession(payload.SessionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Logout": "session successfully revoked"})
+}
+
+// ListUserSessionsHandler returns the active sessions of the user named in the URL
+func (app *Application) ListUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.stores.ListActiveSessions(chi.URLParam(r, "username"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if sessions == nil {
+		sessions = []data.Session{}
+	}
+	app.respond(w, r, http.StatusOK, envelope{"sessions": sessions})
+}
+
+// RevokeUserSessionHandler revokes a session of the user named in the URL
+func (app *Application) RevokeUserSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		app.respondError(w, r, fmt.Errorf("%w : invalid session id parameter", data.ErrInvalidRequest))
+		return
+	}
+	err = app.stores.RevokeUserSession(chi.URLParam(r, "username"), id)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"session": "successfully revoked"})
+}
+
+// RevokeUserSessionsHandler revokes all active sessions of the user named in the URL
+func (app *Application) RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	revoked, err := app.stores.RevokeUserSessions(chi.URLParam(r, "username"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"revoked": revoked})
+}
+
+// sessionResponse creates an access token of the session of the refresh token
+// and returns both tokens
+func (app *Application) sessionResponse(user *data.User, refreshToken string, refreshPayload *Payload) (*LoginUserResponse, error) {
+	accessToken, accessPayload, err := app.tokenMaker.CreateAccessToken(user.Username, refreshPayload.ID, app.config.AccessTokenDuration)
+	if err != nil {
+		return nil, fmt.Errorf("creating access token: %w", err)
+	}
+	return &LoginUserResponse{
+		SessionID:             refreshPayload.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiresAt,
+		User:                  *user,
+	}, nil
+}
+
+// refreshTokenDuration returns how long a session can be refreshed after the login
+func (app *Application) refreshTokenDuration() time.Duration {
+	if app.config.Sessions.RefreshTokenDuration > 0 {
+		return app.config.Sessions.RefreshTokenDuration
+	}
+	return data.DefaultRefreshTokenDuration
+}
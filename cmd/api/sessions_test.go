@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// loginAs logs the user in through the routes of the app and returns the tokens
+func loginAs(t *testing.T, app *Application, username string, password string) LoginUserResponse {
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(fmt.Sprintf(`{"username": %q, "password": %q}`, username, password)))
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var got struct {
+		Login LoginUserResponse `json:"Login"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.Login
+}
+
+// refreshWith exchanges the refresh token through the routes of the app and
+// returns the status code with the new tokens
+func refreshWith(t *testing.T, app *Application, refreshToken string) (int, LoginUserResponse) {
+	request := httptest.NewRequest(http.MethodPost, "/tokens/refresh", strings.NewReader(fmt.Sprintf(`{"refresh_token": %q}`, refreshToken)))
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, LoginUserResponse{}
+	}
+	var got struct {
+		Login LoginUserResponse `json:"Login"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, got.Login
+}
+
+// serveWithToken serves the request through the routes of the app with the access token
+func serveWithToken(app *Application, token string, method string, target string) int {
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set(string(authorizationHeaderKey), "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+// newTestSessionServer returns a test server with the test user and a clerk
+func newTestSessionServer(t *testing.T) *Application {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	err := app.stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestRefreshTokenHandlerRotatedRefreshToken(t *testing.T) {
+	app := newTestSessionServer(t)
+	login := loginAs(t, app, "clerk", "secret")
+	if code := serveWithToken(app, login.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Fatalf("expected status code %d with the access token, got %d", http.StatusOK, code)
+	}
+	code, refreshed := refreshWith(t, app, login.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d refreshing, got %d", http.StatusOK, code)
+	}
+	if refreshed.SessionID == login.SessionID || refreshed.RefreshToken == login.RefreshToken {
+		t.Errorf("expected a new session and refresh token, got %+v", refreshed)
+	}
+	if code := serveWithToken(app, refreshed.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Errorf("expected status code %d with the new access token, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, login.AccessToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with the access token of the rotated session, got %d", http.StatusUnauthorized, code)
+	}
+	// replaying the rotated refresh token revokes the session it was rotated into
+	code, _ = refreshWith(t, app, login.RefreshToken)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d replaying the refresh token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := serveWithToken(app, refreshed.AccessToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d after the replay, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestTokensOfTheWrongKindRejected(t *testing.T) {
+	app := newTestSessionServer(t)
+	login := loginAs(t, app, "clerk", "secret")
+	if code := serveWithToken(app, login.RefreshToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with the refresh token as access token, got %d", http.StatusUnauthorized, code)
+	}
+	code, _ := refreshWith(t, app, login.AccessToken)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d refreshing with the access token, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestLogoutHandlerRevokedSession(t *testing.T) {
+	app := newTestSessionServer(t)
+	login := loginAs(t, app, "clerk", "secret")
+	if code := serveWithToken(app, login.AccessToken, http.MethodPost, "/logout"); code != http.StatusOK {
+		t.Fatalf("expected status code %d logging out, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, login.AccessToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d after logout, got %d", http.StatusUnauthorized, code)
+	}
+	code, _ := refreshWith(t, app, login.RefreshToken)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d refreshing after logout, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestUserSessionsHandlers(t *testing.T) {
+	app := newTestSessionServer(t)
+	admin := loginAs(t, app, "test", "test")
+	first := loginAs(t, app, "clerk", "secret")
+	second := loginAs(t, app, "clerk", "secret")
+	request := httptest.NewRequest(http.MethodGet, "/users/clerk/sessions", nil)
+	request.Header.Set(string(authorizationHeaderKey), "Bearer "+admin.AccessToken)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var got struct {
+		Sessions []data.Session `json:"sessions"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Sessions) != 2 || got.Sessions[0].ID != first.SessionID || got.Sessions[0].ClientIP != "192.0.2.1" {
+		t.Fatalf("expected both sessions of the clerk, got %+v", got.Sessions)
+	}
+	if code := serveWithToken(app, admin.AccessToken, http.MethodDelete, "/users/clerk/sessions/"+first.SessionID.String()); code != http.StatusOK {
+		t.Fatalf("expected status code %d revoking a session, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, first.AccessToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with the revoked session, got %d", http.StatusUnauthorized, code)
+	}
+	if code := serveWithToken(app, second.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Errorf("expected status code %d with the other session, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, admin.AccessToken, http.MethodDelete, "/users/clerk/sessions"); code != http.StatusOK {
+		t.Fatalf("expected status code %d revoking all sessions, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, second.AccessToken, http.MethodGet, "/cases"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d after revoking all sessions, got %d", http.StatusUnauthorized, code)
+	}
+	if code := serveWithToken(app, second.AccessToken, http.MethodGet, "/users/clerk/sessions"); code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d listing sessions with a revoked session, got %d", http.StatusUnauthorized, code)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// DownloadTimestampHandler returns the DER encoded RFC 3161 time-stamp token of
+// the evidence hash, the version query parameter selects an older version
+func (app *Application) DownloadTimestampHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	version, err := versionParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	v, err := app.stores.GetTimestampToken(ev, version)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-token")
+	w.Header().Set("Content-Length", strconv.Itoa(len(v.TimestampToken)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="evidence-%d-v%d.tst"`, ev.ID, v.Version))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(v.TimestampToken)
+	if err != nil {
+		app.logError(r, fmt.Errorf("responding with time-stamp token : %w", err))
+	}
+}
+
+// VerifyTimestampHandler checks the time-stamp token of the evidence against the
+// hash it was stored with and returns the time it certifies
+func (app *Application) VerifyTimestampHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	version, err := versionParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	verification, err := app.stores.VerifyTimestamp(ev, version)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"timestamp": verification})
+}
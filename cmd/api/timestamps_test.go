@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// newTestTimestampServer returns a test server that time-stamps evidences with
+// the built-in TSA
+func newTestTimestampServer(t *testing.T) *Application {
+	app := newTestServer(t)
+	tsa, err := data.NewLocalTSA(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.stores.Timestamper = tsa
+	return app
+}
+
+func TestTimestampHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamps bool
+		target     string
+		want       int
+	}{
+		{
+			name:       "with time-stamped evidence successful",
+			timestamps: true,
+			target:     "/",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "with version that doesn't exist fails",
+			timestamps: true,
+			target:     "/?version=2",
+			want:       http.StatusNotFound,
+		},
+		{
+			name:   "with evidence ingested without TSA fails",
+			target: "/",
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			if tt.timestamps {
+				app = newTestTimestampServer(t)
+			}
+			seedForHandlerTesting(t, app)
+			createEvidenceWithReceipt(t, app)
+			rec := httptest.NewRecorder()
+			app.DownloadTimestampHandler(rec, custodyRequest(t, http.MethodGet, tt.target, "1", ""))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d from download, got %d", tt.want, rec.Code)
+			}
+			if tt.want == http.StatusOK && rec.Header().Get("Content-Type") != "application/timestamp-token" {
+				t.Errorf("expected time-stamp token content type, got %q", rec.Header().Get("Content-Type"))
+			}
+			rec = httptest.NewRecorder()
+			app.VerifyTimestampHandler(rec, custodyRequest(t, http.MethodPost, tt.target, "1", ""))
+			if rec.Code != tt.want {
+				t.Fatalf("expected status code %d from verification, got %d", tt.want, rec.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Timestamp data.TimestampVerification `json:"timestamp"`
+			}
+			err := json.NewDecoder(rec.Body).Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Timestamp.Valid || got.Timestamp.Version != 1 {
+				t.Errorf("expected valid time-stamp of version 1, got %+v", got.Timestamp)
+			}
+		})
+	}
+}
+
+func TestDownloadTimestampHandlerReturnedTokenOfEvidenceHash(t *testing.T) {
+	app := newTestTimestampServer(t)
+	seedForHandlerTesting(t, app)
+	createEvidenceWithReceipt(t, app)
+	rec := httptest.NewRecorder()
+	app.DownloadTimestampHandler(rec, custodyRequest(t, http.MethodGet, "/", "1", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	ev, err := app.stores.DBStore.GetEvidenceByID(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = data.VerifyTimestampToken(rec.Body.Bytes(), ev.Hash, app.stores.Timestamper.Certificate())
+	if err != nil {
+		t.Errorf("expected token of the evidence hash, got %v", err)
+	}
+}
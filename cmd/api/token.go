@@ -9,12 +9,32 @@ import (
 	"time"
 )
 
+// Kinds of tokens, access tokens authorize requests and refresh tokens get new
+// access tokens
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
 //Payload contains information about database of the tokenMaker
 type Payload struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// Kind is TokenAccess or TokenRefresh, tokens without a kind are access tokens
+	Kind string `json:"kind,omitempty"`
+	// SessionID is the session of an access token, a refresh token is the
+	// session with its own ID
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+// Session returns the ID of the session the token belongs to
+func (payload *Payload) Session() uuid.UUID {
+	if payload.Kind == TokenRefresh {
+		return payload.ID
+	}
+	return payload.SessionID
 }
 
 func (payload *Payload) ValidTime() error {
@@ -42,6 +62,10 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 type Maker interface {
 	//CreateToken creates a new tokenMaker
 	CreateToken(username string, duration time.Duration) (string, *Payload, error)
+	// CreateAccessToken creates an access token of the session
+	CreateAccessToken(username string, sessionID uuid.UUID, duration time.Duration) (string, *Payload, error)
+	// CreateRefreshToken creates a refresh token, its ID is the ID of the session
+	CreateRefreshToken(username string, duration time.Duration) (string, *Payload, error)
 
 	VerifyToken(token string) (*Payload, error)
 }
@@ -69,6 +93,31 @@ func (maker *PasetoMaker) CreateToken(username string, duration time.Duration) (
 	if err != nil {
 		return "", payload, err
 	}
+	return maker.encrypt(payload)
+}
+
+//CreateAccessToken creates a new paseto access token of the session
+func (maker *PasetoMaker) CreateAccessToken(username string, sessionID uuid.UUID, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	payload.Kind = TokenAccess
+	payload.SessionID = sessionID
+	return maker.encrypt(payload)
+}
+
+//CreateRefreshToken creates a new paseto refresh token
+func (maker *PasetoMaker) CreateRefreshToken(username string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	payload.Kind = TokenRefresh
+	return maker.encrypt(payload)
+}
+
+func (maker *PasetoMaker) encrypt(payload *Payload) (string, *Payload, error) {
 	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
 	if err != nil {
 		return "", nil, err
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// publicHeader is the header of PASETO v4.public tokens
+const publicHeader = "v4.public."
+
+// TokenKey is a public key that verifies tokens, published in the key set so
+// other services can verify the tokens without the secret
+type TokenKey struct {
+	ID        string
+	PublicKey ed25519.PublicKey
+}
+
+// tokenFooter is the footer of v4.public tokens, it names the key that signed them
+type tokenFooter struct {
+	KeyID string `json:"kid"`
+}
+
+// PublicKeyMaker is a PASETO v4.public implementation of maker interface, it
+// signs tokens with the current Ed25519 key and verifies them with the key named
+// in their footer, so keys can be rotated without logging everyone out
+type PublicKeyMaker struct {
+	keyID string
+	key   ed25519.PrivateKey
+	keys  map[string]ed25519.PublicKey
+}
+
+// NewPublicKeyMaker creates a PublicKeyMaker from the tokens config, the
+// private key is a base64 encoded 32 byte Ed25519 seed and previous keys are
+// id:key pairs of base64 encoded public keys
+func NewPublicKeyMaker(config data.TokensConfig) (Maker, error) {
+	if config.KeyID == "" {
+		return nil, fmt.Errorf("%w : token key id is missing", data.ErrInvalidRequest)
+	}
+	seed, err := base64.StdEncoding.DecodeString(config.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w : token key must be a 32 byte base64 encoded seed", data.ErrInvalidRequest)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	maker := &PublicKeyMaker{
+		keyID: config.KeyID,
+		key:   key,
+		keys:  map[string]ed25519.PublicKey{config.KeyID: key.Public().(ed25519.PublicKey)},
+	}
+	for _, pair := range strings.Split(config.PreviousKeys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w : previous token keys must be id:key pairs", data.ErrInvalidRequest)
+		}
+		if _, exists := maker.keys[id]; exists {
+			return nil, fmt.Errorf("%w : token key id %q is used twice", data.ErrInvalidRequest, id)
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w : token key %q must be a 32 byte base64 encoded public key", data.ErrInvalidRequest, id)
+		}
+		maker.keys[id] = publicKey
+	}
+	return maker, nil
+}
+
+// NewTokenMaker creates the maker of the config, a PublicKeyMaker when a token
+// key is configured and a PasetoMaker of the symmetric key otherwise
+func NewTokenMaker(config data.Config) (Maker, error) {
+	if config.Tokens.PrivateKey == "" {
+		return NewPasetoMaker(config.SymmetricKey)
+	}
+	return NewPublicKeyMaker(config.Tokens)
+}
+
+// CreateToken creates a new signed token
+func (maker *PublicKeyMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	return maker.sign(payload)
+}
+
+// CreateAccessToken creates a new signed access token of the session
+func (maker *PublicKeyMaker) CreateAccessToken(username string, sessionID uuid.UUID, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	payload.Kind = TokenAccess
+	payload.SessionID = sessionID
+	return maker.sign(payload)
+}
+
+// CreateRefreshToken creates a new signed refresh token
+func (maker *PublicKeyMaker) CreateRefreshToken(username string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	payload.Kind = TokenRefresh
+	return maker.sign(payload)
+}
+
+func (maker *PublicKeyMaker) sign(payload *Payload) (string, *Payload, error) {
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	footer, err := json.Marshal(tokenFooter{KeyID: maker.keyID})
+	if err != nil {
+		return "", nil, err
+	}
+	signature := ed25519.Sign(maker.key, preAuthEncode([]byte(publicHeader), message, footer, nil))
+	token := publicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...)) +
+		"." + base64.RawURLEncoding.EncodeToString(footer)
+	return token, payload, nil
+}
+
+// VerifyToken checks the signature of the token with the key named in its
+// footer and returns its payload
+func (maker *PublicKeyMaker) VerifyToken(token string) (*Payload, error) {
+	message, err := maker.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	payload := &Payload{}
+	err = json.Unmarshal(message, payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token payload: %w", err)
+	}
+	err = payload.ValidTime()
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// verify returns the message of the token when its signature is valid
+func (maker *PublicKeyMaker) verify(token string) ([]byte, error) {
+	if !strings.HasPrefix(token, publicHeader) {
+		return nil, errors.New("token is not a v4.public token")
+	}
+	parts := strings.Split(token[len(publicHeader):], ".")
+	if len(parts) != 2 {
+		return nil, errors.New("token has no key id")
+	}
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(body) < ed25519.SignatureSize {
+		return nil, errors.New("invalid token encoding")
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("invalid token encoding")
+	}
+	var f tokenFooter
+	err = json.Unmarshal(footer, &f)
+	if err != nil {
+		return nil, errors.New("invalid token footer")
+	}
+	publicKey, ok := maker.keys[f.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown token key id %q", f.KeyID)
+	}
+	message := body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, preAuthEncode([]byte(publicHeader), message, footer, nil), signature) {
+		return nil, errors.New("invalid token signature")
+	}
+	return message, nil
+}
+
+// Keys returns the keys that verify tokens ordered by id
+func (maker *PublicKeyMaker) Keys() []TokenKey {
+	keys := make([]TokenKey, 0, len(maker.keys))
+	for id, publicKey := range maker.keys {
+		keys = append(keys, TokenKey{ID: id, PublicKey: publicKey})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// preAuthEncode is the pre-authentication encoding of PASETO, the count of the
+// pieces followed by each piece prefixed with its length
+func preAuthEncode(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(pieces)))
+	buf.Write(length)
+	for _, piece := range pieces {
+		binary.LittleEndian.PutUint64(length, uint64(len(piece)))
+		buf.Write(length)
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
+
+// TokenKeysHandler publishes the public keys that verify the tokens as a JWKS
+// like key set, the kid in the footer of a token names its key
+func (app *Application) TokenKeysHandler(w http.ResponseWriter, r *http.Request) {
+	maker, ok := app.tokenMaker.(*PublicKeyMaker)
+	if !ok {
+		app.respondError(w, r, fmt.Errorf("%w : tokens aren't signed with a public key", data.ErrNotFound))
+		return
+	}
+	var keys []envelope
+	for _, key := range maker.Keys() {
+		keys = append(keys, envelope{
+			"kid":     key.ID,
+			"kty":     "OKP",
+			"crv":     "Ed25519",
+			"alg":     "EdDSA",
+			"use":     "sig",
+			"version": "v4.public",
+			"x":       base64.RawURLEncoding.EncodeToString(key.PublicKey),
+		})
+	}
+	app.respond(w, r, http.StatusOK, envelope{"keys": keys})
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// testTokenSeed returns a base64 encoded Ed25519 seed filled with the byte
+func testTokenSeed(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), ed25519.SeedSize)))
+}
+
+// testTokenPublicKey returns the base64 encoded public key of testTokenSeed
+func testTokenPublicKey(b byte) string {
+	seed := []byte(strings.Repeat(string(b), ed25519.SeedSize))
+	return base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+}
+
+func TestPreAuthEncodeSignedPASETOTestVector(t *testing.T) {
+	// test vector 4-S-1 of the PASETO v4 specification
+	secretKey, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte(`{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`)
+	want := "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+	signature := ed25519.Sign(secretKey, preAuthEncode([]byte(publicHeader), message, nil, nil))
+	got := publicHeader + base64.RawURLEncoding.EncodeToString(append(message, signature...))
+	if got != want {
+		t.Errorf("expected token %s, got %s", want, got)
+	}
+}
+
+func TestPublicKeyMakerVerifiedTokensOfRotatedKeys(t *testing.T) {
+	old, err := NewPublicKeyMaker(data.TokensConfig{PrivateKey: testTokenSeed(1), KeyID: "2023"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewPublicKeyMaker(data.TokensConfig{PrivateKey: testTokenSeed(2), KeyID: "2024", PreviousKeys: "2023:" + testTokenPublicKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _, err := old.CreateToken("clerk", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := current.CreateAccessToken("clerk", [16]byte{1}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		maker   Maker
+		token   string
+		wantErr bool
+	}{
+		{name: "token of the current key verified", maker: current, token: token},
+		{name: "token of a previous key verified", maker: current, token: oldToken},
+		{name: "token of an unknown key rejected", maker: old, token: token, wantErr: true},
+		{name: "token with a changed payload rejected", maker: current, token: tamperTokenPayload(t, token), wantErr: true},
+		{name: "token without a key id rejected", maker: current, token: token[:strings.LastIndex(token, ".")], wantErr: true},
+		{name: "symmetric token rejected", maker: current, token: symmetricTestToken(t), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := tt.maker.VerifyToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && payload.Username != "clerk" {
+				t.Errorf("expected the token of the clerk, got %+v", payload)
+			}
+		})
+	}
+}
+
+// tamperTokenPayload returns the token with the username in its payload replaced
+func tamperTokenPayload(t *testing.T, token string) string {
+	parts := strings.Split(strings.TrimPrefix(token, publicHeader), ".")
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = []byte(strings.Replace(string(body), `"clerk"`, `"admin"`, 1))
+	return publicHeader + base64.RawURLEncoding.EncodeToString(body) + "." + parts[1]
+}
+
+// symmetricTestToken returns a v2.local token of the test symmetric key
+func symmetricTestToken(t *testing.T) string {
+	maker, err := NewPasetoMaker(data.TestAppConfig().SymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := maker.CreateToken("clerk", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestNewPublicKeyMakerWithInvalidConfigFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		config data.TokensConfig
+	}{
+		{name: "missing key id", config: data.TokensConfig{PrivateKey: testTokenSeed(1)}},
+		{name: "short seed", config: data.TokensConfig{PrivateKey: "c2VlZA==", KeyID: "2024"}},
+		{name: "previous key without id", config: data.TokensConfig{PrivateKey: testTokenSeed(1), KeyID: "2024", PreviousKeys: testTokenPublicKey(2)}},
+		{name: "previous key with the current id", config: data.TokensConfig{PrivateKey: testTokenSeed(1), KeyID: "2024", PreviousKeys: "2024:" + testTokenPublicKey(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPublicKeyMaker(tt.config)
+			if !errors.Is(err, data.ErrInvalidRequest) {
+				t.Errorf("expected error %v, got %v", data.ErrInvalidRequest, err)
+			}
+		})
+	}
+}
+
+func TestTokenKeysHandlerPublishedVerificationKeys(t *testing.T) {
+	app := newTestServer(t)
+	maker, err := NewPublicKeyMaker(data.TokensConfig{PrivateKey: testTokenSeed(2), KeyID: "2024", PreviousKeys: "2023:" + testTokenPublicKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.tokenMaker = maker
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/paseto-keys", nil)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var got struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, key := range got.Keys {
+		ids = append(ids, key["kid"])
+		publicKey, err := base64.RawURLEncoding.DecodeString(key["x"])
+		if err != nil || len(publicKey) != ed25519.PublicKeySize || key["crv"] != "Ed25519" {
+			t.Errorf("expected an Ed25519 public key, got %+v", key)
+		}
+	}
+	if want := []string{"2023", "2024"}; !cmp.Equal(want, ids) {
+		t.Errorf(cmp.Diff(want, ids))
+	}
+}
+
+func TestTokenKeysHandlerWithSymmetricKeyNotFound(t *testing.T) {
+	app := newTestServer(t)
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/paseto-keys", nil)
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestLoginWithPublicKeyTokensAuthorized(t *testing.T) {
+	app := newTestSessionServer(t)
+	maker, err := NewPublicKeyMaker(data.TokensConfig{PrivateKey: testTokenSeed(2), KeyID: "2024"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.tokenMaker = maker
+	login := loginAs(t, app, "clerk", "secret")
+	if !strings.HasPrefix(login.AccessToken, publicHeader) {
+		t.Fatalf("expected a v4.public access token, got %s", login.AccessToken)
+	}
+	if code := serveWithToken(app, login.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Errorf("expected status code %d with the access token, got %d", http.StatusOK, code)
+	}
+	code, refreshed := refreshWith(t, app, login.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d refreshing, got %d", http.StatusOK, code)
+	}
+	if code := serveWithToken(app, refreshed.AccessToken, http.MethodGet, "/cases"); code != http.StatusOK {
+		t.Errorf("expected status code %d with the refreshed access token, got %d", http.StatusOK, code)
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// Resumable uploads follow the tus 1.0 protocol, https://tus.io/protocols/resumable-upload
+const (
+	tusVersion            = "1.0.0"
+	tusExtensions         = "creation,termination"
+	tusOffsetContentType  = "application/offset+octet-stream"
+	tusResumableHeader    = "Tus-Resumable"
+	tusUploadOffsetHeader = "Upload-Offset"
+	tusUploadLengthHeader = "Upload-Length"
+)
+
+// uploadTimeout is how long a request of a resumable upload can take, the last
+// chunk reads all parts back to create the evidence
+const uploadTimeout = time.Hour
+
+// TusMiddleware sets the Tus-Resumable header on every response and rejects
+// requests for a protocol version the server doesn't support
+func (app *Application) TusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(tusResumableHeader, tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get(tusResumableHeader) != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			app.errorResponse(w, r, http.StatusPreconditionFailed, "unsupported tus version")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UploadOptionsHandler describes the tus protocol support of the server
+func (app *Application) UploadOptionsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if app.config.Uploads.MaxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.config.Uploads.MaxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUploadHandler starts a resumable upload of an evidence in a specific case,
+// the evidence name is taken from the filename in the Upload-Metadata header. An
+// upload to an existing evidence creates its next version.
+func (app *Application) CreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	upload, err := app.uploadRequestParser(r, cs)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if app.config.Uploads.MaxSize > 0 && upload.Length > app.config.Uploads.MaxSize {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, "upload is larger than the maximum size")
+		return
+	}
+	err = app.stores.CreateUpload(upload)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/cases/%d/uploads/%s", cs.ID, upload.ID))
+	w.Header().Set(tusUploadOffsetHeader, "0")
+	if upload.Complete() {
+		_, err := app.stores.CompleteUpload(upload, cs, app.custodyActor(r))
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// UploadOffsetHandler returns how many bytes of the upload were received
+func (app *Application) UploadOffsetHandler(w http.ResponseWriter, r *http.Request) {
+	_, upload, err := app.uploadParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(tusUploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(tusUploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// AppendUploadHandler appends a chunk to the upload, when the last chunk is
+// received the evidence is created in the case
+func (app *Application) AppendUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, "content type must be "+tusOffsetContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(tusUploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		app.respondError(w, r, fmt.Errorf("%w : invalid Upload-Offset header", data.ErrInvalidRequest))
+		return
+	}
+	cs, upload, err := app.uploadParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if r.ContentLength > upload.Length-upload.Offset {
+		app.respondError(w, r, fmt.Errorf("%w : chunk exceeds upload length", data.ErrInvalidRequest))
+		return
+	}
+	upload, err = app.stores.AppendUpload(upload, cs, offset, r.Body)
+	if err != nil {
+		if upload != nil {
+			w.Header().Set(tusUploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+		}
+		app.respondError(w, r, err)
+		return
+	}
+	if upload.Complete() {
+		_, err := app.stores.CompleteUpload(upload, cs, app.custodyActor(r))
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+	w.Header().Set(tusUploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TerminateUploadHandler removes an upload and the chunks received so far
+func (app *Application) TerminateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	cs, upload, err := app.uploadParser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.stores.RemoveUpload(upload, cs)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadRequestParser reads the upload length and metadata from the creation request
+func (app *Application) uploadRequestParser(r *http.Request, cs *data.Case) (*data.Upload, error) {
+	length, err := strconv.ParseInt(r.Header.Get(tusUploadLengthHeader), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("%w : invalid Upload-Length header", data.ErrInvalidRequest)
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return nil, err
+	}
+	name := metadata["filename"]
+	if name == "" {
+		return nil, fmt.Errorf("%w : filename is missing from Upload-Metadata", data.ErrInvalidRequest)
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	upload := &data.Upload{
+		CaseID:   cs.ID,
+		Name:     name,
+		Folder:   metadata["folder"],
+		Length:   length,
+		Username: payload.Username,
+	}
+	return upload, nil
+}
+
+// uploadParser returns the case and the upload from the request url, the upload
+// must belong to the case and be started by the authenticated user
+func (app *Application) uploadParser(r *http.Request) (*data.Case, *data.Upload, error) {
+	cs, err := app.caseParser(r, data.CaseContributor)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := chi.URLParam(r, "uploadID")
+	upload, err := app.stores.Uploads.GetUpload(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	if upload.CaseID != cs.ID || upload.Username != payload.Username {
+		return nil, nil, fmt.Errorf("%w : upload : %q", data.ErrNotFound, id)
+	}
+	return cs, upload, nil
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, it is a comma separated
+// list of keys and base64 encoded values
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%w : invalid Upload-Metadata value for %q", data.ErrInvalidRequest, fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("%w : invalid Upload-Metadata header", data.ErrInvalidRequest)
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// newUploadRequest creates a tus request with the payload and URL params set
+func newUploadRequest(t *testing.T, method, uploadID string, body io.Reader) *http.Request {
+	req, err := http.NewRequest(method, "/", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(tusResumableHeader, tusVersion)
+	payload := &Payload{
+		Username: "test",
+	}
+	rct := chi.NewRouteContext()
+	rct.URLParams.Add("caseID", "1")
+	rct.URLParams.Add("uploadID", uploadID)
+	ctx := context.WithValue(req.Context(), authorizationPayloadKey, payload)
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+	return req.WithContext(ctx)
+}
+
+// createTestUpload starts an upload of an evidence with the given name and length
+func createTestUpload(t *testing.T, app *Application, name string, length string) string {
+	req := newUploadRequest(t, http.MethodPost, "", nil)
+	req.Header.Set(tusUploadLengthHeader, length)
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name)))
+	rec := httptest.NewRecorder()
+	app.CreateUploadHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/cases/1/uploads/") {
+		t.Fatalf("unexpected upload location %q", location)
+	}
+	return strings.TrimPrefix(location, "/cases/1/uploads/")
+}
+
+// appendTestChunk sends a chunk of the upload and returns the recorded response
+func appendTestChunk(t *testing.T, app *Application, id string, offset string, chunk string) *httptest.ResponseRecorder {
+	req := newUploadRequest(t, http.MethodPatch, id, strings.NewReader(chunk))
+	req.Header.Set("Content-Type", tusOffsetContentType)
+	req.Header.Set(tusUploadOffsetHeader, offset)
+	rec := httptest.NewRecorder()
+	app.AppendUploadHandler(rec, req)
+	return rec
+}
+
+func TestUploadHandlersCreatedEvidenceFromChunks(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	id := createTestUpload(t, app, "video", "6")
+
+	rec := appendTestChunk(t, app, id, "0", "sam")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	req := newUploadRequest(t, http.MethodHead, id, nil)
+	rec = httptest.NewRecorder()
+	app.UploadOffsetHandler(rec, req)
+	if got := rec.Header().Get(tusUploadOffsetHeader); got != "3" {
+		t.Errorf("expected upload offset 3, got %q", got)
+	}
+	rec = appendTestChunk(t, app, id, "3", "ple")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	cs := &data.Case{ID: 1, Name: "test"}
+	ev, err := app.stores.DBStore.GetEvidenceByName(cs, "", "video")
+	if err != nil {
+		t.Fatalf("failed to get evidence: %v", err)
+	}
+	want := "af2bdbe1aa9b6ec1e2ade1d694f41fc71a831d0268e9891562113d8a62add1bf"
+	if ev.Hash != want {
+		t.Errorf("expected hash %q, got %q", want, ev.Hash)
+	}
+	file, err := app.stores.ObjectStore.GetEvidence("test", ev.ObjectName)
+	if err != nil {
+		t.Fatalf("failed to get evidence file: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "sample" {
+		t.Errorf("expected content %q, got %q", "sample", content)
+	}
+	_, err = app.stores.Uploads.GetUpload(id)
+	if err == nil {
+		t.Errorf("expected completed upload to be removed")
+	}
+}
+
+func TestCreateUploadHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   string
+		metadata string
+		want     int
+	}{
+		{
+			name:     "successful with filename and length",
+			length:   "4",
+			metadata: "filename " + base64.StdEncoding.EncodeToString([]byte("picture")),
+			want:     http.StatusCreated,
+		},
+		{
+			name:     "for evidence that already exists creates a new version",
+			length:   "4",
+			metadata: "filename " + base64.StdEncoding.EncodeToString([]byte("video")),
+			want:     http.StatusCreated,
+		},
+		{
+			name:   "without filename fails",
+			length: "4",
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:     "with bad metadata encoding fails",
+			length:   "4",
+			metadata: "filename !!!",
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "with invalid folder fails",
+			length:   "4",
+			metadata: "filename " + base64.StdEncoding.EncodeToString([]byte("picture")) + ",folder " + base64.StdEncoding.EncodeToString([]byte("a//b")),
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "without length fails",
+			metadata: "filename " + base64.StdEncoding.EncodeToString([]byte("picture")),
+			want:     http.StatusBadRequest,
+		},
+		{
+			name:     "larger than maximum size fails",
+			length:   "2048",
+			metadata: "filename " + base64.StdEncoding.EncodeToString([]byte("picture")),
+			want:     http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			app.config.Uploads.MaxSize = 1024
+			seedForHandlerTesting(t, app)
+			err := app.stores.CreateEvidence(&data.Evidence{CaseID: 1, Name: "video", File: bytes.NewBufferString("test")}, &data.Case{ID: 1, Name: "test"})
+			if err != nil {
+				t.Fatalf("failed to create evidence: %v", err)
+			}
+			req := newUploadRequest(t, http.MethodPost, "", nil)
+			req.Header.Set(tusUploadLengthHeader, tt.length)
+			req.Header.Set("Upload-Metadata", tt.metadata)
+			rec := httptest.NewRecorder()
+			app.CreateUploadHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAppendUploadHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		uploadID    string
+		contentType string
+		offset      string
+		chunk       string
+		want        int
+	}{
+		{
+			name:        "successful with matching offset",
+			contentType: tusOffsetContentType,
+			offset:      "0",
+			chunk:       "sam",
+			want:        http.StatusNoContent,
+		},
+		{
+			name:        "with wrong offset returns conflict",
+			contentType: tusOffsetContentType,
+			offset:      "2",
+			chunk:       "sam",
+			want:        http.StatusConflict,
+		},
+		{
+			name:        "with wrong content type fails",
+			contentType: "application/json",
+			offset:      "0",
+			chunk:       "sam",
+			want:        http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "with chunk larger than the upload fails",
+			contentType: tusOffsetContentType,
+			offset:      "0",
+			chunk:       "sample-content",
+			want:        http.StatusBadRequest,
+		},
+		{
+			name:        "with upload that doesn't exist fails",
+			uploadID:    "a3bb189e-8bf9-3888-9912-ace4e6543002",
+			contentType: tusOffsetContentType,
+			offset:      "0",
+			chunk:       "sam",
+			want:        http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			id := createTestUpload(t, app, "video", "6")
+			if tt.uploadID != "" {
+				id = tt.uploadID
+			}
+			req := newUploadRequest(t, http.MethodPatch, id, strings.NewReader(tt.chunk))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set(tusUploadOffsetHeader, tt.offset)
+			rec := httptest.NewRecorder()
+			app.AppendUploadHandler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestTerminateUploadHandlerRemovedUpload(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	id := createTestUpload(t, app, "video", "6")
+	req := newUploadRequest(t, http.MethodDelete, id, nil)
+	rec := httptest.NewRecorder()
+	app.TerminateUploadHandler(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	rec = appendTestChunk(t, app, id, "0", "sam")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestUploadHandlersRejectedUploadOfAnotherUser(t *testing.T) {
+	app := newTestServer(t)
+	seedForHandlerTesting(t, app)
+	err := app.stores.CreateUser(&data.UserRequest{Username: "other", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.stores.SetCaseMember(&data.Case{ID: 1, Name: "test"}, "other", data.CaseContributor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createTestUpload(t, app, "video", "6")
+	handlers := map[string]http.HandlerFunc{
+		http.MethodHead:   app.UploadOffsetHandler,
+		http.MethodPatch:  app.AppendUploadHandler,
+		http.MethodDelete: app.TerminateUploadHandler,
+	}
+	for method, handler := range handlers {
+		req := newUploadRequest(t, method, id, strings.NewReader("sam"))
+		req.Header.Set("Content-Type", tusOffsetContentType)
+		req.Header.Set(tusUploadOffsetHeader, "0")
+		req = req.WithContext(context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "other"}))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d for %s, got %d", http.StatusNotFound, method, rec.Code)
+		}
+	}
+	upload, err := app.stores.Uploads.GetUpload(id)
+	if err != nil {
+		t.Fatalf("expected the upload to be kept: %v", err)
+	}
+	if upload.Offset != 0 {
+		t.Errorf("expected no chunk to be added, got offset %d", upload.Offset)
+	}
+}
+
+func TestTusMiddlewareRejectedUnsupportedVersion(t *testing.T) {
+	app := newTestServer(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(tusResumableHeader, "0.2.2")
+	rec := httptest.NewRecorder()
+	app.TusMiddleware(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status code %d, got %d", http.StatusPreconditionFailed, rec.Code)
+	}
+	if got := rec.Header().Get("Tus-Version"); got != tusVersion {
+		t.Errorf("expected Tus-Version %q, got %q", tusVersion, got)
+	}
+	req = httptest.NewRequest(http.MethodOptions, "/", nil)
+	rec = httptest.NewRecorder()
+	app.TusMiddleware(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected OPTIONS to pass without Tus-Resumable, got %d", rec.Code)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/miloszizic/der/internal/data"
 	"net/http"
 	"time"
@@ -37,7 +39,7 @@ func (app *Application) Login(w http.ResponseWriter, r *http.Request) {
 		app.respondError(w, r, err)
 		return
 	}
-	response, err := app.LoginUser(request)
+	response, err := app.LoginUser(r, request)
 	if err != nil {
 		app.respondError(w, r, err)
 		return
@@ -47,12 +49,17 @@ func (app *Application) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 type LoginUserResponse struct {
-	AccessToken          string    `json:"access_token"`
-	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
-	User                 data.User `json:"user"`
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	User                  data.User `json:"user"`
 }
 
-func (app *Application) LoginUser(request *data.UserRequest) (*LoginUserResponse, error) {
+// LoginUser checks the credentials and starts a session of the user from the
+// client of the request
+func (app *Application) LoginUser(r *http.Request, request *data.UserRequest) (*LoginUserResponse, error) {
 	if request.Username == "" || request.Password == "" {
 		return nil, fmt.Errorf("%w : username and password are required", data.ErrInvalidCredentials)
 	}
@@ -70,18 +77,21 @@ func (app *Application) LoginUser(request *data.UserRequest) (*LoginUserResponse
 	if !match {
 		return nil, fmt.Errorf("%w : invalid credentials", data.ErrInvalidCredentials)
 	}
-	accessToken, accessPayload, err := app.tokenMaker.CreateToken(
-		user.Username,
-		app.config.AccessTokenDuration)
+	return app.startSession(r, user)
+}
+
+// startSession starts a session of the signed in user from the client of the
+// request and returns its tokens
+func (app *Application) startSession(r *http.Request, user *data.User) (*LoginUserResponse, error) {
+	refreshToken, refreshPayload, err := app.tokenMaker.CreateRefreshToken(user.Username, app.refreshTokenDuration())
 	if err != nil {
-		return nil, fmt.Errorf("creating access token: %w", err)
+		return nil, fmt.Errorf("creating refresh token: %w", err)
 	}
-	rsp := LoginUserResponse{
-		AccessToken:          accessToken,
-		AccessTokenExpiresAt: accessPayload.ExpiresAt,
-		User:                 *user,
+	_, err = app.stores.StartSession(refreshPayload.ID, user, r.UserAgent(), clientIP(r), refreshPayload.ExpiresAt)
+	if err != nil {
+		return nil, err
 	}
-	return &rsp, nil
+	return app.sessionResponse(user, refreshToken, refreshPayload)
 }
 
 func (app *Application) userParser(w http.ResponseWriter, r *http.Request) (*data.UserRequest, error) {
@@ -93,3 +103,29 @@ func (app *Application) userParser(w http.ResponseWriter, r *http.Request) (*dat
 	}
 	return &req, nil
 }
+
+// roleRequest is the role to assign to a user
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// ListRolesHandler returns the roles that can be assigned with their permissions
+func (app *Application) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.respond(w, r, http.StatusOK, envelope{"roles": data.Roles()})
+}
+
+// SetUserRoleHandler assigns a role to the user named in the URL
+func (app *Application) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	err := app.readJSON(r, &req)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	user, err := app.stores.SetUserRole(chi.URLParam(r, "username"), req.Role)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"User": envelope{"username": user.Username, "role": user.Role, "permissions": data.Permissions(user.Role)}})
+}
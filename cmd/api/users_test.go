@@ -2,7 +2,9 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"github.com/go-chi/chi/v5"
 	"github.com/miloszizic/der/internal/data"
 	"net/http"
 	"net/http/httptest"
@@ -184,3 +186,56 @@ func TestCreateUserHandlerFailedWithEmptyPassword(t *testing.T) {
 		t.Errorf("handler returned wrong status code. expected: %d. Got: %d.", http.StatusBadRequest, status)
 	}
 }
+func TestSetUserRoleHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		body     string
+		want     int
+		wantRole string
+	}{
+		{
+			name:     "assigning a role successful",
+			username: "test",
+			body:     `{"role": "prosecutor"}`,
+			want:     http.StatusOK,
+			wantRole: data.RoleProsecutor,
+		},
+		{
+			name:     "assigning an unknown role failed",
+			username: "test",
+			body:     `{"role": "sheriff"}`,
+			want:     http.StatusBadRequest,
+			wantRole: data.RoleAdministrator,
+		},
+		{
+			name:     "assigning a role to a missing user failed",
+			username: "nobody",
+			body:     `{"role": "judge"}`,
+			want:     http.StatusNotFound,
+			wantRole: data.RoleAdministrator,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedForHandlerTesting(t, app)
+			request := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader([]byte(tt.body)))
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("username", tt.username)
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rct))
+			response := httptest.NewRecorder()
+			app.SetUserRoleHandler(response, request)
+			if response.Code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, response.Code)
+			}
+			user, err := app.stores.User.GetByUsername("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("expected role %q, got %q", tt.wantRole, user.Role)
+			}
+		})
+	}
+}
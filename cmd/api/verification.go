@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+	"go.uber.org/zap"
+)
+
+// VerifyEvidenceHandler recomputes the hashes of all versions of an evidence
+// and compares them with the stored ones
+func (app *Application) VerifyEvidenceHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payload := r.Context().Value(authorizationPayloadKey).(*Payload)
+	verifications, err := app.stores.VerifyEvidence(ev, payload.Username)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"Evidence": ev, "verifications": verifications})
+}
+
+// ListVerificationsHandler returns the verification history of an evidence
+func (app *Application) ListVerificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ev, err := app.evidenceParser(r, data.CaseViewer)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	verifications, err := app.stores.ListVerifications(ev)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.respond(w, r, http.StatusOK, envelope{"verifications": verifications})
+}
+
+// background runs fn in a goroutine that is waited for on shutdown
+func (app *Application) background(fn func()) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background task panicked", zap.Any("panic", err))
+			}
+		}()
+		fn()
+	}()
+}
+
+// startScrubber re-verifies all evidences every scrubber interval until the
+// context is cancelled, it does nothing when the interval is zero
+func (app *Application) startScrubber(ctx context.Context) {
+	interval := app.config.Scrubber.Interval
+	if interval <= 0 {
+		return
+	}
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.scrub(ctx)
+			}
+		}
+	})
+}
+
+// scrub runs one pass of the scrubber and logs its report
+func (app *Application) scrub(ctx context.Context) {
+	started := time.Now()
+	report, err := app.stores.VerifyAllEvidences(ctx, data.ScrubberName)
+	if err != nil && ctx.Err() == nil {
+		app.logger.Error("verifying evidences failed", zap.Error(err))
+	}
+	app.logger.Info("verified evidences",
+		zap.Int("evidences", report.Evidences),
+		zap.Int("passed", report.Passed),
+		zap.Int("failed", report.Failed),
+		zap.Duration("took", time.Since(started)))
+	if report.Failed > 0 {
+		app.logger.Warn("evidences failed verification", zap.Int("failed", report.Failed))
+	}
+}
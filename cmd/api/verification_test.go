@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// seedVerificationTesting adds an evidence named video to the test case
+func seedVerificationTesting(t *testing.T, app *Application) *data.Case {
+	seedForHandlerTesting(t, app)
+	cs, err := app.stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString("test")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	return cs
+}
+
+func TestVerifyEvidenceHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		evidenceID string
+		want       int
+	}{
+		{
+			name:       "successful for existing evidence",
+			evidenceID: "1",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "with evidence that doesn't exist fails",
+			evidenceID: "2",
+			want:       http.StatusNotFound,
+		},
+		{
+			name:       "with wrong evidenceID format fails",
+			evidenceID: "first",
+			want:       http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestServer(t)
+			seedVerificationTesting(t, app)
+			req, err := http.NewRequest(http.MethodPost, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rct := chi.NewRouteContext()
+			rct.URLParams.Add("caseID", "1")
+			rct.URLParams.Add("evidenceID", tt.evidenceID)
+			ctx := context.WithValue(req.Context(), authorizationPayloadKey, &Payload{Username: "test"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rct)
+			rec := httptest.NewRecorder()
+			app.VerifyEvidenceHandler(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestScrubberVerifiedEvidencesUntilStopped(t *testing.T) {
+	app := newTestServer(t)
+	cs := seedVerificationTesting(t, app)
+	app.config.Scrubber.Interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	app.startScrubber(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ev, err := app.stores.GetEvidenceByID(1, cs.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.VerificationStatus == data.VerificationPassed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the scrubber to verify the evidence")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	app.wg.Wait()
+	verifications, err := app.stores.ListVerifications(&data.Evidence{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifications[0].VerifiedBy != data.ScrubberName {
+		t.Errorf("expected verification by %q, got %q", data.ScrubberName, verifications[0].VerifiedBy)
+	}
+}
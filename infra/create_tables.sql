@@ -9,8 +9,12 @@ CREATE TABLE IF NOT EXISTS "cases" (
 	"id" SERIAL,
 	"name"	VARCHAR(255) NOT NULL,
 	"tags"	text[] ,
+	"storage_key"	VARCHAR(63) UNIQUE,
 	PRIMARY KEY("id")
 );
+-- cases created before storage keys keep their bucket, which is named after the case
+ALTER TABLE "cases" ADD COLUMN IF NOT EXISTS "storage_key" VARCHAR(63) UNIQUE;
+UPDATE "cases" SET "storage_key" = "name" WHERE "storage_key" IS NULL;
 CREATE TABLE IF NOT EXISTS "user_cases" (
 	"user_id"	integer,
 	"case_id"	integer,
@@ -22,7 +26,14 @@ CREATE TABLE IF NOT EXISTS "evidences" (
 	"id" SERIAL,
 	"case_id"	integer,
 	"name"	VARCHAR(255) NOT NULL,
+	"folder"	VARCHAR(1024) NOT NULL DEFAULT '',
+	"object_name"	VARCHAR(255) NOT NULL DEFAULT '',
 	"hash"	VARCHAR(255) NOT NULL,
+	"md5"	VARCHAR(32) NOT NULL DEFAULT '',
+	"sha1"	VARCHAR(40) NOT NULL DEFAULT '',
+	"sha512"	VARCHAR(128) NOT NULL DEFAULT '',
+	"verified_at"	timestamptz,
+	"verification_status"	VARCHAR(32) NOT NULL DEFAULT '',
 	PRIMARY KEY("id"),
 	CONSTRAINT "fk_cases_evidence" FOREIGN KEY("case_id") REFERENCES "cases"("id")
 );
@@ -35,3 +46,228 @@ CREATE TABLE IF NOT EXISTS "comments" (
 --    CONSTRAINT "fk_comments_user" FOREIGN KEY("user_id") REFERENCES "users"("id"),
 	CONSTRAINT "fk_comments_evidence" FOREIGN KEY("evidence_id") REFERENCES "evidences"("id")
 );
+
+CREATE TABLE IF NOT EXISTS "case_keys" (
+	"case_name"	VARCHAR(255) NOT NULL,
+	"wrapped_key"	bytea NOT NULL,
+	"master_key_id"	VARCHAR(255) NOT NULL,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("case_name")
+);
+
+CREATE TABLE IF NOT EXISTS "destruction_certificates" (
+	"id" SERIAL,
+	"case_id"	integer NOT NULL,
+	"case_name"	VARCHAR(255) NOT NULL,
+	"statement"	text NOT NULL,
+	"signature"	bytea NOT NULL,
+	PRIMARY KEY("id"),
+	UNIQUE("case_id")
+);
+
+CREATE TABLE IF NOT EXISTS "evidence_versions" (
+	"evidence_id"	integer NOT NULL,
+	"version"	integer NOT NULL,
+	"hash"	VARCHAR(255) NOT NULL,
+	"md5"	VARCHAR(32) NOT NULL DEFAULT '',
+	"sha1"	VARCHAR(40) NOT NULL DEFAULT '',
+	"sha512"	VARCHAR(128) NOT NULL DEFAULT '',
+	"object_name"	VARCHAR(255) NOT NULL,
+	"uploaded_by"	VARCHAR(255) NOT NULL DEFAULT '',
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("evidence_id","version"),
+	CONSTRAINT "fk_evidence_versions_evidence" FOREIGN KEY("evidence_id") REFERENCES "evidences"("id")
+);
+-- evidences uploaded before versioning become their first version
+INSERT INTO "evidence_versions" ("evidence_id", "version", "hash", "object_name")
+SELECT "id", 1, "hash", "name" FROM "evidences" e
+WHERE NOT EXISTS (SELECT 1 FROM "evidence_versions" v WHERE v.evidence_id = e.id);
+
+-- legal holds are kept after release and outlive the cases they are about
+CREATE TABLE IF NOT EXISTS "legal_holds" (
+	"id" SERIAL,
+	"case_id"	integer NOT NULL,
+	"evidence_id"	integer NOT NULL DEFAULT 0,
+	"reason"	text NOT NULL,
+	"issued_by"	VARCHAR(255) NOT NULL,
+	"expires_at"	timestamptz,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	"released_by"	VARCHAR(255),
+	"released_at"	timestamptz,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS "legal_holds_case_id" ON "legal_holds" ("case_id");
+
+CREATE TABLE IF NOT EXISTS "presigned_uploads" (
+	"id"	VARCHAR(36) NOT NULL,
+	"case_id"	integer NOT NULL,
+	"name"	VARCHAR(255) NOT NULL,
+	"folder"	VARCHAR(1024) NOT NULL DEFAULT '',
+	"object_name"	VARCHAR(255) NOT NULL,
+	"username"	VARCHAR(255) NOT NULL,
+	"expires_at"	timestamptz NOT NULL,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("id")
+);
+
+-- evidences created before the scrubber get the columns of their last verification
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "verified_at" timestamptz;
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "verification_status" VARCHAR(32) NOT NULL DEFAULT '';
+
+-- verification history is kept after the evidences are removed
+CREATE TABLE IF NOT EXISTS "verifications" (
+	"id" SERIAL,
+	"evidence_id"	integer NOT NULL,
+	"case_id"	integer NOT NULL,
+	"version"	integer NOT NULL,
+	"status"	VARCHAR(32) NOT NULL,
+	"expected_hash"	VARCHAR(255) NOT NULL,
+	"computed_hash"	VARCHAR(255) NOT NULL DEFAULT '',
+	"detail"	text NOT NULL DEFAULT '',
+	"verified_by"	VARCHAR(255) NOT NULL,
+	"verified_at"	timestamptz NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS "verifications_evidence_id" ON "verifications" ("evidence_id");
+
+-- evidences created before folders are in the root folder of their case and
+-- stored under their name, new evidences are stored under generated object names
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "folder" VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "object_name" VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE "evidences" SET "object_name" = "name" WHERE "object_name" = '';
+CREATE UNIQUE INDEX IF NOT EXISTS "evidences_case_folder_name" ON "evidences" ("case_id", "folder", "name");
+ALTER TABLE "presigned_uploads" ADD COLUMN IF NOT EXISTS "folder" VARCHAR(1024) NOT NULL DEFAULT '';
+
+-- virtual folders of a case, the root folder has no row
+CREATE TABLE IF NOT EXISTS "folders" (
+	"id" SERIAL,
+	"case_id"	integer NOT NULL,
+	"path"	VARCHAR(1024) NOT NULL,
+	"parent"	VARCHAR(1024) NOT NULL,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("id"),
+	UNIQUE("case_id","path"),
+	CONSTRAINT "fk_folders_case" FOREIGN KEY("case_id") REFERENCES "cases"("id")
+);
+CREATE INDEX IF NOT EXISTS "folders_case_id_parent" ON "folders" ("case_id", "parent");
+
+-- digests of other algorithms are computed at ingest next to the SHA256 hash,
+-- evidences ingested before have only their SHA256 hash
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "md5" VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "sha1" VARCHAR(40) NOT NULL DEFAULT '';
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "sha512" VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE "evidence_versions" ADD COLUMN IF NOT EXISTS "md5" VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE "evidence_versions" ADD COLUMN IF NOT EXISTS "sha1" VARCHAR(40) NOT NULL DEFAULT '';
+ALTER TABLE "evidence_versions" ADD COLUMN IF NOT EXISTS "sha512" VARCHAR(128) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS "evidence_versions_hash" ON "evidence_versions" ("hash");
+CREATE INDEX IF NOT EXISTS "evidence_versions_md5" ON "evidence_versions" ("md5");
+CREATE INDEX IF NOT EXISTS "evidence_versions_sha1" ON "evidence_versions" ("sha1");
+CREATE INDEX IF NOT EXISTS "evidence_versions_sha512" ON "evidence_versions" ("sha512");
+
+-- chain of custody of evidences is kept after the evidences are removed, the
+-- events of all evidences form one audit log chained by hash
+CREATE TABLE IF NOT EXISTS "custody_events" (
+	"id" SERIAL,
+	"seq"	bigint NOT NULL,
+	"evidence_id"	integer NOT NULL,
+	"case_id"	integer NOT NULL,
+	"version"	integer NOT NULL DEFAULT 0,
+	"action"	VARCHAR(32) NOT NULL,
+	"username"	VARCHAR(255) NOT NULL,
+	"client_ip"	VARCHAR(64) NOT NULL DEFAULT '',
+	"user_agent"	text NOT NULL DEFAULT '',
+	"hash"	VARCHAR(255) NOT NULL DEFAULT '',
+	"detail"	text NOT NULL DEFAULT '',
+	"created_at"	timestamptz NOT NULL,
+	"prev_hash"	VARCHAR(64) NOT NULL,
+	"entry_hash"	VARCHAR(64) NOT NULL,
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS "custody_events_evidence_id" ON "custody_events" ("evidence_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "custody_events_seq" ON "custody_events" ("seq");
+
+-- head of the audit log, its one row is locked to append an event so concurrent
+-- events can't fork the chain. It starts at the last event of an existing log.
+CREATE TABLE IF NOT EXISTS "custody_chain_head" (
+	"id"	boolean NOT NULL DEFAULT true CHECK ("id"),
+	"seq"	bigint NOT NULL,
+	"entry_hash"	VARCHAR(64) NOT NULL,
+	PRIMARY KEY("id")
+);
+INSERT INTO "custody_chain_head" ("seq", "entry_hash")
+	SELECT "seq", "entry_hash" FROM "custody_events" ORDER BY "seq" DESC LIMIT 1
+	ON CONFLICT DO NOTHING;
+INSERT INTO "custody_chain_head" ("seq", "entry_hash") VALUES (0, '') ON CONFLICT DO NOTHING;
+
+-- signed checkpoints of the audit log, each one follows the checkpoint with the
+-- statement hash in prev_checkpoint and only the first one follows none
+CREATE TABLE IF NOT EXISTS "audit_checkpoints" (
+	"id" SERIAL,
+	"seq"	bigint NOT NULL,
+	"entry_hash"	VARCHAR(64) NOT NULL,
+	"prev_checkpoint"	VARCHAR(64) NOT NULL UNIQUE,
+	"statement"	text NOT NULL,
+	"signature"	bytea NOT NULL,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("id")
+);
+
+-- RFC 3161 time-stamp tokens of the hashes, evidences ingested without a TSA have none
+ALTER TABLE "evidences" ADD COLUMN IF NOT EXISTS "timestamp_token" bytea;
+ALTER TABLE "evidence_versions" ADD COLUMN IF NOT EXISTS "timestamp_token" bytea;
+
+-- users are assigned one of the roles clerk, judge, prosecutor, defense, auditor
+-- or administrator, users with the former admin role keep its full permissions
+ALTER TABLE "users" ALTER COLUMN "role" SET DEFAULT 'clerk';
+
+-- members of a case are an owner, contributor or viewer of it, the users who
+-- created the cases stay their owners
+ALTER TABLE "user_cases" ADD COLUMN IF NOT EXISTS "role" VARCHAR(32) NOT NULL DEFAULT 'owner';
+
+-- sessions of logged in users keyed by the ID of their refresh token, a refresh
+-- revokes the session and replaces it with a new one
+CREATE TABLE IF NOT EXISTS "sessions" (
+	"id"	uuid,
+	"user_id"	integer NOT NULL,
+	"username"	VARCHAR(255) NOT NULL,
+	"user_agent"	VARCHAR(512) NOT NULL DEFAULT '',
+	"client_ip"	VARCHAR(64) NOT NULL DEFAULT '',
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	"expires_at"	timestamptz NOT NULL,
+	"revoked_at"	timestamptz,
+	"replaced_by"	uuid,
+	PRIMARY KEY("id"),
+	CONSTRAINT "fk_sessions_user" FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "sessions_user_id" ON "sessions" ("user_id");
+
+-- identities of users at the OpenID Connect identity provider, users who sign in
+-- with single sign-on are linked to their subject at the issuer
+CREATE TABLE IF NOT EXISTS "user_identities" (
+	"issuer"	VARCHAR(255) NOT NULL,
+	"subject"	VARCHAR(255) NOT NULL,
+	"user_id"	integer NOT NULL,
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("issuer", "subject"),
+	CONSTRAINT "fk_user_identities_user" FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+-- users who sign in with single sign-on the first time concurrently can't both
+-- be added with the same username
+CREATE UNIQUE INDEX IF NOT EXISTS "users_username" ON "users" ("username");
+
+-- resumable uploads in progress, the received chunks are objects in the bucket of
+-- the case named in "parts" in order
+CREATE TABLE IF NOT EXISTS "uploads" (
+	"id"	VARCHAR(36) NOT NULL,
+	"case_id"	integer NOT NULL,
+	"name"	VARCHAR(255) NOT NULL,
+	"folder"	VARCHAR(1024) NOT NULL DEFAULT '',
+	"length"	bigint NOT NULL,
+	"offset"	bigint NOT NULL DEFAULT 0,
+	"username"	VARCHAR(255) NOT NULL,
+	"hash_state"	bytea,
+	"parts"	text[] NOT NULL DEFAULT '{}',
+	"created_at"	timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY("id")
+);
+CREATE INDEX IF NOT EXISTS "uploads_case_id" ON "uploads" ("case_id");
@@ -0,0 +1,264 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Kinds of tampering found by verifying the audit log
+const (
+	AuditModifiedEntry      = "modified_entry"
+	AuditMissingEntry       = "missing_entry"
+	AuditReorderedEntry     = "reordered_entry"
+	AuditBrokenLink         = "broken_link"
+	AuditCheckpointMismatch = "checkpoint_mismatch"
+	AuditInvalidSignature   = "invalid_checkpoint_signature"
+	AuditBrokenCheckpoints  = "broken_checkpoint_chain"
+)
+
+// custodyEntry is the content of a custody event that is hashed into the chain,
+// the fields are marshalled in this order
+type custodyEntry struct {
+	Seq        int64  `json:"seq"`
+	PrevHash   string `json:"prev_hash"`
+	EvidenceID int64  `json:"evidence_id"`
+	CaseID     int64  `json:"case_id"`
+	Version    int64  `json:"version"`
+	Action     string `json:"action"`
+	Username   string `json:"username"`
+	ClientIP   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent"`
+	Hash       string `json:"hash"`
+	Detail     string `json:"detail"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// Link chains the event to the previous event of the audit log, the first event
+// follows sequence number zero and an empty hash. The time of the event is kept
+// with the microsecond precision of the database so its hash can be recomputed.
+func (e *CustodyEvent) Link(prevSeq int64, prevHash string) {
+	e.Seq = prevSeq + 1
+	e.PrevHash = prevHash
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.EntryHash = e.ChainHash()
+}
+
+// ChainHash computes the hex encoded SHA256 hash of the event and the hash of the
+// previous event, it differs from EntryHash when the event was changed
+func (e *CustodyEvent) ChainHash() string {
+	entry, _ := json.Marshal(custodyEntry{
+		Seq:        e.Seq,
+		PrevHash:   e.PrevHash,
+		EvidenceID: e.EvidenceID,
+		CaseID:     e.CaseID,
+		Version:    e.Version,
+		Action:     e.Action,
+		Username:   e.Username,
+		ClientIP:   e.ClientIP,
+		UserAgent:  e.UserAgent,
+		Hash:       e.Hash,
+		Detail:     e.Detail,
+		CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(entry)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditCheckpointStatement is the signed content of a checkpoint, it commits to
+// the audit log up to and including the entry with the sequence number and to
+// the previous checkpoint by the hash of its statement. The first checkpoint has
+// an empty PrevCheckpoint.
+type AuditCheckpointStatement struct {
+	Seq            int64     `json:"seq"`
+	EntryHash      string    `json:"entry_hash"`
+	PrevCheckpoint string    `json:"prev_checkpoint"`
+	CreatedAt      time.Time `json:"created_at"`
+	KeyID          string    `json:"key_id"`
+}
+
+// AuditCheckpoint is a signed checkpoint of the audit log. Statement is the exact
+// JSON that was signed, the signature can be verified with the public key of the
+// signing key named in the statement.
+type AuditCheckpoint struct {
+	ID int64 `json:"id"`
+	AuditCheckpointStatement
+	Statement string `json:"statement"`
+	Signature []byte `json:"signature"`
+}
+
+// parseStatement fills the checkpoint fields from the signed statement
+func (c *AuditCheckpoint) parseStatement() error {
+	err := json.Unmarshal([]byte(c.Statement), &c.AuditCheckpointStatement)
+	if err != nil {
+		return fmt.Errorf("reading checkpoint statement : %w", err)
+	}
+	return nil
+}
+
+// Hash returns the hex encoded SHA256 hash of the signed statement, the next
+// checkpoint commits to it
+func (c *AuditCheckpoint) Hash() string {
+	sum := sha256.Sum256([]byte(c.Statement))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAuditCheckpoint signs the statement and returns the checkpoint
+func NewAuditCheckpoint(statement AuditCheckpointStatement, signer *Signer) (*AuditCheckpoint, error) {
+	statement.KeyID = signer.KeyID()
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	cp := &AuditCheckpoint{
+		Statement: string(body),
+		Signature: signer.Sign(body),
+	}
+	err = cp.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// CheckpointAuditLog signs a checkpoint of the last entry of the audit log that
+// follows the last checkpoint. When the last checkpoint already covers that entry
+// it is returned instead of a new one, an empty log returns ErrNotFound.
+func (s *Stores) CheckpointAuditLog() (*AuditCheckpoint, error) {
+	if s.Signer == nil {
+		return nil, fmt.Errorf("%w : signing key is not configured", ErrInvalidRequest)
+	}
+	last, err := s.Custody.LastCustodyEvent()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints, err := s.Custody.ListCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("getting audit checkpoints : %w", err)
+	}
+	prev := ""
+	if n := len(checkpoints); n > 0 {
+		if checkpoints[n-1].Seq == last.Seq && checkpoints[n-1].EntryHash == last.EntryHash {
+			return &checkpoints[n-1], nil
+		}
+		prev = checkpoints[n-1].Hash()
+	}
+	cp, err := NewAuditCheckpoint(AuditCheckpointStatement{
+		Seq:            last.Seq,
+		EntryHash:      last.EntryHash,
+		PrevCheckpoint: prev,
+		CreatedAt:      time.Now().UTC().Truncate(time.Second),
+	}, s.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("signing audit checkpoint : %w", err)
+	}
+	err = s.Custody.AddCheckpoint(cp)
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// ListAuditCheckpoints returns all checkpoints of the audit log ordered by ID
+func (s *Stores) ListAuditCheckpoints() ([]AuditCheckpoint, error) {
+	checkpoints, err := s.Custody.ListCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("getting audit checkpoints : %w", err)
+	}
+	return checkpoints, nil
+}
+
+// AuditIssue is a single sign of tampering with the audit log
+type AuditIssue struct {
+	Kind         string `json:"kind"`
+	Seq          int64  `json:"seq,omitempty"`
+	EventID      int64  `json:"event_id,omitempty"`
+	CheckpointID int64  `json:"checkpoint_id,omitempty"`
+	Detail       string `json:"detail"`
+}
+
+// AuditReport is the result of verifying the audit log
+type AuditReport struct {
+	CheckedAt   time.Time    `json:"checked_at"`
+	Entries     int          `json:"entries"`
+	Checkpoints int          `json:"checkpoints"`
+	LastSeq     int64        `json:"last_seq"`
+	LastHash    string       `json:"last_hash"`
+	Valid       bool         `json:"valid"`
+	Issues      []AuditIssue `json:"issues"`
+}
+
+// VerifyAuditLog recomputes the hash chain of the audit log and checks it against
+// the signed checkpoints. Modified entries don't match their hash, deleted and
+// reordered entries break the sequence and the links of the chain, and entries
+// removed from the end of the log or a rewritten chain don't match the checkpoints.
+// Checkpoints are chained too, so removing one of them breaks the next.
+func (s *Stores) VerifyAuditLog() (*AuditReport, error) {
+	events, err := s.Custody.ListAuditLog()
+	if err != nil {
+		return nil, fmt.Errorf("getting audit log : %w", err)
+	}
+	checkpoints, err := s.Custody.ListCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("getting audit checkpoints : %w", err)
+	}
+	report := &AuditReport{
+		CheckedAt:   time.Now().UTC(),
+		Entries:     len(events),
+		Checkpoints: len(checkpoints),
+		Issues:      []AuditIssue{},
+	}
+	hashes := make(map[int64]string, len(events))
+	next := int64(1)
+	prevHash := ""
+	for _, e := range events {
+		switch {
+		case e.Seq > next:
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditMissingEntry, Seq: next, Detail: fmt.Sprintf("entries %d to %d are missing", next, e.Seq-1)})
+		case e.Seq < next:
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditReorderedEntry, Seq: e.Seq, EventID: e.ID, Detail: fmt.Sprintf("entry %d is out of order", e.Seq)})
+		}
+		if e.PrevHash != prevHash {
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditBrokenLink, Seq: e.Seq, EventID: e.ID, Detail: fmt.Sprintf("entry %d doesn't follow the previous entry", e.Seq)})
+		}
+		if e.ChainHash() != e.EntryHash {
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditModifiedEntry, Seq: e.Seq, EventID: e.ID, Detail: fmt.Sprintf("entry %d doesn't match its hash", e.Seq)})
+		}
+		if e.Seq >= next {
+			next = e.Seq + 1
+		}
+		prevHash = e.EntryHash
+		hashes[e.Seq] = e.EntryHash
+		report.LastSeq, report.LastHash = e.Seq, e.EntryHash
+	}
+	prevCheckpoint := ""
+	for _, cp := range checkpoints {
+		if !s.checkpointSigned(&cp) {
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditInvalidSignature, Seq: cp.Seq, CheckpointID: cp.ID, Detail: fmt.Sprintf("checkpoint %d isn't signed by a signing key", cp.ID)})
+		}
+		if cp.PrevCheckpoint != prevCheckpoint {
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditBrokenCheckpoints, Seq: cp.Seq, CheckpointID: cp.ID, Detail: fmt.Sprintf("checkpoint %d doesn't follow the previous checkpoint", cp.ID)})
+		}
+		prevCheckpoint = cp.Hash()
+		hash, ok := hashes[cp.Seq]
+		switch {
+		case !ok:
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditCheckpointMismatch, Seq: cp.Seq, CheckpointID: cp.ID, Detail: fmt.Sprintf("entry %d of checkpoint %d is missing", cp.Seq, cp.ID)})
+		case hash != cp.EntryHash:
+			report.Issues = append(report.Issues, AuditIssue{Kind: AuditCheckpointMismatch, Seq: cp.Seq, CheckpointID: cp.ID, Detail: fmt.Sprintf("entry %d doesn't match checkpoint %d", cp.Seq, cp.ID)})
+		}
+	}
+	report.Valid = len(report.Issues) == 0
+	return report, nil
+}
+
+// checkpointSigned reports whether the checkpoint was signed by the signing key
+// named in it, the current key or a previous one
+func (s *Stores) checkpointSigned(cp *AuditCheckpoint) bool {
+	if s.Signer == nil {
+		return false
+	}
+	return s.Signer.VerifyKey(cp.KeyID, []byte(cp.Statement), cp.Signature)
+}
@@ -0,0 +1,340 @@
+package data_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+// tamperingStore changes the audit log and the checkpoints it returns like a DBA
+// editing the tables would
+type tamperingStore struct {
+	data.CustodyStore
+	tamper            func(events []data.CustodyEvent) []data.CustodyEvent
+	tamperCheckpoints func(checkpoints []data.AuditCheckpoint) []data.AuditCheckpoint
+}
+
+func (s *tamperingStore) ListAuditLog() ([]data.CustodyEvent, error) {
+	events, err := s.CustodyStore.ListAuditLog()
+	if err != nil || s.tamper == nil {
+		return events, err
+	}
+	return s.tamper(events), nil
+}
+
+func (s *tamperingStore) ListCheckpoints() ([]data.AuditCheckpoint, error) {
+	checkpoints, err := s.CustodyStore.ListCheckpoints()
+	if err != nil || s.tamperCheckpoints == nil {
+		return checkpoints, err
+	}
+	return s.tamperCheckpoints(checkpoints), nil
+}
+
+// checkpointTestAuditLog signs a checkpoint of the audit log after each of the
+// number of new events
+func checkpointTestAuditLog(t *testing.T, stores data.Stores, number int) []*data.AuditCheckpoint {
+	t.Helper()
+	var checkpoints []*data.AuditCheckpoint
+	for i := 0; i < number; i++ {
+		err := stores.RecordCustody(&data.CustodyEvent{EvidenceID: 1, CaseID: 1, Action: data.CustodyDownload, Username: "clerk", Hash: "hash-video"})
+		if err != nil {
+			t.Fatalf("failed to record custody: %v", err)
+		}
+		cp, err := stores.CheckpointAuditLog()
+		if err != nil {
+			t.Fatalf("failed to checkpoint audit log: %v", err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints
+}
+
+// getTestAuditStores returns in-memory stores with a signing key and an audit log
+// of five events
+func getTestAuditStores(t *testing.T) data.Stores {
+	stores, cs := getTestHoldStores(t)
+	stores.Signer = getTestSigner(t)
+	for _, action := range []string{data.CustodyUpload, data.CustodyDownload, data.CustodyComment, data.CustodyMove, data.CustodyDownload} {
+		err := stores.RecordCustody(&data.CustodyEvent{EvidenceID: 1, CaseID: cs.ID, Action: action, Username: "clerk", Hash: "hash-video"})
+		if err != nil {
+			t.Fatalf("failed to record custody: %v", err)
+		}
+	}
+	return stores
+}
+
+// auditIssueKinds returns the kinds of the issues in order
+func auditIssueKinds(report *data.AuditReport) []string {
+	var kinds []string
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func TestRecordCustodyChainedEvents(t *testing.T) {
+	stores := getTestAuditStores(t)
+	events, err := stores.Custody.ListAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevHash := ""
+	for i, e := range events {
+		if e.Seq != int64(i+1) || e.PrevHash != prevHash || e.EntryHash != e.ChainHash() {
+			t.Errorf("event %d isn't chained: %+v", i, e)
+		}
+		prevHash = e.EntryHash
+	}
+}
+
+func TestVerifyAuditLogFoundTampering(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint bool
+		tamper     func(events []data.CustodyEvent) []data.CustodyEvent
+		want       []string
+	}{
+		{
+			name:   "untouched log is valid",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent { return events },
+		},
+		{
+			name: "modified entry",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent {
+				events[1].Username = "someone else"
+				return events
+			},
+			want: []string{data.AuditModifiedEntry},
+		},
+		{
+			name: "deleted entry",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent {
+				return append(events[:2], events[3:]...)
+			},
+			want: []string{data.AuditMissingEntry, data.AuditBrokenLink},
+		},
+		{
+			name: "reordered entries",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent {
+				events[1], events[2] = events[2], events[1]
+				return events
+			},
+			want: []string{data.AuditMissingEntry, data.AuditBrokenLink, data.AuditReorderedEntry, data.AuditBrokenLink, data.AuditBrokenLink},
+		},
+		{
+			name: "deleted entry with renumbered and rehashed chain",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent {
+				events = append(events[:2], events[3:]...)
+				prevSeq, prevHash := int64(0), ""
+				for i := range events {
+					events[i].Link(prevSeq, prevHash)
+					prevSeq, prevHash = events[i].Seq, events[i].EntryHash
+				}
+				return events
+			},
+			checkpoint: true,
+			want:       []string{data.AuditCheckpointMismatch},
+		},
+		{
+			name: "deleted last entry",
+			tamper: func(events []data.CustodyEvent) []data.CustodyEvent {
+				return events[:len(events)-1]
+			},
+			checkpoint: true,
+			want:       []string{data.AuditCheckpointMismatch},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := getTestAuditStores(t)
+			if tt.checkpoint {
+				_, err := stores.CheckpointAuditLog()
+				if err != nil {
+					t.Fatalf("failed to checkpoint audit log: %v", err)
+				}
+			}
+			stores.Custody = &tamperingStore{CustodyStore: stores.Custody, tamper: tt.tamper}
+			report, err := stores.VerifyAuditLog()
+			if err != nil {
+				t.Fatalf("failed to verify audit log: %v", err)
+			}
+			if got := auditIssueKinds(report); !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+			if report.Valid != (len(tt.want) == 0) {
+				t.Errorf("expected valid %v, got %v", len(tt.want) == 0, report.Valid)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditLogFoundCheckpointOfAnotherKey(t *testing.T) {
+	stores := getTestAuditStores(t)
+	_, err := stores.CheckpointAuditLog()
+	if err != nil {
+		t.Fatalf("failed to checkpoint audit log: %v", err)
+	}
+	other, err := data.NewSigner(data.SigningConfig{PrivateKey: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", KeyID: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores.Signer = other
+	report, err := stores.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("failed to verify audit log: %v", err)
+	}
+	want := []string{data.AuditInvalidSignature}
+	if got := auditIssueKinds(report); !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func TestVerifyAuditLogFoundRemovedCheckpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(checkpoints []data.AuditCheckpoint) []data.AuditCheckpoint
+		want   []string
+	}{
+		{
+			name:   "untouched checkpoints are valid",
+			tamper: func(checkpoints []data.AuditCheckpoint) []data.AuditCheckpoint { return checkpoints },
+		},
+		{
+			name: "deleted checkpoint",
+			tamper: func(checkpoints []data.AuditCheckpoint) []data.AuditCheckpoint {
+				return append(checkpoints[:1], checkpoints[2:]...)
+			},
+			want: []string{data.AuditBrokenCheckpoints},
+		},
+		{
+			name: "deleted first checkpoint",
+			tamper: func(checkpoints []data.AuditCheckpoint) []data.AuditCheckpoint {
+				return checkpoints[1:]
+			},
+			want: []string{data.AuditBrokenCheckpoints},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := getTestAuditStores(t)
+			checkpointTestAuditLog(t, stores, 3)
+			stores.Custody = &tamperingStore{CustodyStore: stores.Custody, tamperCheckpoints: tt.tamper}
+			report, err := stores.VerifyAuditLog()
+			if err != nil {
+				t.Fatalf("failed to verify audit log: %v", err)
+			}
+			if got := auditIssueKinds(report); !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestVerifyAuditLogVerifiedCheckpointOfPreviousKey(t *testing.T) {
+	stores := getTestAuditStores(t)
+	checkpointTestAuditLog(t, stores, 1)
+	previous := base64.StdEncoding.EncodeToString(stores.Signer.PublicKey())
+	rotated, err := data.NewSigner(data.SigningConfig{
+		PrivateKey:   "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+		KeyID:        "other",
+		PreviousKeys: "test:" + previous,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores.Signer = rotated
+	checkpointTestAuditLog(t, stores, 1)
+	report, err := stores.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("failed to verify audit log: %v", err)
+	}
+	if !report.Valid || report.Checkpoints != 2 {
+		t.Errorf("expected 2 valid checkpoints, got %+v", report)
+	}
+}
+
+func TestCheckpointAuditLogChainedCheckpoints(t *testing.T) {
+	stores := getTestAuditStores(t)
+	checkpoints := checkpointTestAuditLog(t, stores, 2)
+	if checkpoints[0].PrevCheckpoint != "" || checkpoints[1].PrevCheckpoint != checkpoints[0].Hash() {
+		t.Errorf("expected the second checkpoint to follow the first, got %q and %q", checkpoints[0].PrevCheckpoint, checkpoints[1].PrevCheckpoint)
+	}
+	// a checkpoint signed concurrently after the first one
+	fork, err := data.NewAuditCheckpoint(data.AuditCheckpointStatement{
+		Seq:            checkpoints[1].Seq,
+		EntryHash:      checkpoints[1].EntryHash,
+		PrevCheckpoint: checkpoints[0].Hash(),
+	}, stores.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.Custody.AddCheckpoint(fork)
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected %v for a second checkpoint following the first, got %v", data.ErrConflict, err)
+	}
+}
+
+func TestCheckpointAuditLog(t *testing.T) {
+	stores := getTestAuditStores(t)
+	first, err := stores.CheckpointAuditLog()
+	if err != nil {
+		t.Fatalf("failed to checkpoint audit log: %v", err)
+	}
+	last, err := stores.Custody.LastCustodyEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seq != last.Seq || first.EntryHash != last.EntryHash || first.KeyID != "test" {
+		t.Errorf("unexpected checkpoint %+v", first.AuditCheckpointStatement)
+	}
+	if !stores.Signer.Verify([]byte(first.Statement), first.Signature) {
+		t.Errorf("expected checkpoint signed by the signing key")
+	}
+	again, err := stores.CheckpointAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("expected the checkpoint %d of the unchanged log, got %d", first.ID, again.ID)
+	}
+}
+
+func TestCheckpointAuditLogFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		stores func(t *testing.T) data.Stores
+		want   error
+	}{
+		{
+			name: "without signing key",
+			stores: func(t *testing.T) data.Stores {
+				stores := getTestAuditStores(t)
+				stores.Signer = nil
+				return stores
+			},
+			want: data.ErrInvalidRequest,
+		},
+		{
+			name: "with empty audit log",
+			stores: func(t *testing.T) data.Stores {
+				stores := memstore.NewStores()
+				stores.Signer = getTestSigner(t)
+				return stores
+			},
+			want: data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := tt.stores(t)
+			_, err := stores.CheckpointAuditLog()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
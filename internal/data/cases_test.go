@@ -0,0 +1,78 @@
+package data_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+func TestValidateCaseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		caseName string
+		want     error
+	}{
+		{name: "Cyrillic name with spaces is valid", caseName: "К 123/2026"},
+		{name: "Latin name with diacritics is valid", caseName: "Kž1 45/2025"},
+		{name: "empty name fails", caseName: "", want: data.ErrInvalidRequest},
+		{name: "blank name fails", caseName: " \t ", want: data.ErrInvalidRequest},
+		{name: "name with control characters fails", caseName: "K 1\n45/2025", want: data.ErrInvalidRequest},
+		{name: "name with invalid UTF-8 fails", caseName: "K \xff", want: data.ErrInvalidRequest},
+		{name: "too long name fails", caseName: strings.Repeat("К", 256), want: data.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := data.ValidateCaseName(tt.caseName)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCreateCaseStoredUnicodeNameUnderStorageKey(t *testing.T) {
+	stores := memstore.NewStores()
+	err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"К 123/2026", "Kž1 45/2025"} {
+		err = stores.CreateCase(user, name)
+		if err != nil {
+			t.Fatalf("failed to create case %q: %v", name, err)
+		}
+	}
+	cases, err := stores.ListCases()
+	if err != nil {
+		t.Fatalf("failed to list cases: %v", err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("expected 2 cases, got %d", len(cases))
+	}
+	for _, cs := range cases {
+		if !strings.HasPrefix(cs.StorageKey, "case-") || cs.Bucket() != cs.StorageKey {
+			t.Errorf("expected case %q to be stored under a generated key, got %q", cs.Name, cs.Bucket())
+		}
+		exists, err := stores.ObjectStore.CaseExists(cs.Bucket())
+		if err != nil || !exists {
+			t.Errorf("expected bucket %q of case %q to exist, got %v, %v", cs.Bucket(), cs.Name, exists, err)
+		}
+	}
+	if cases[0].StorageKey == cases[1].StorageKey {
+		t.Errorf("expected cases to have different storage keys, both got %q", cases[0].StorageKey)
+	}
+}
+
+func TestCaseBucketFellBackToNameWithoutStorageKey(t *testing.T) {
+	cs := &data.Case{Name: "legacy"}
+	if cs.Bucket() != "legacy" {
+		t.Errorf("expected case without storage key to be stored under its name, got %q", cs.Bucket())
+	}
+}
@@ -10,12 +10,24 @@ import (
 )
 
 type Config struct {
-	Port                int            `json:"port"`
-	Env                 string         `json:"env"`
-	SymmetricKey        string         `json:"symmetric"`
-	AccessTokenDuration time.Duration  `json:"duration"`
-	Database            PostgresConfig `json:"database"`
-	Minio               MinioConfig    `json:"minio"`
+	Port                int                `json:"port"`
+	Env                 string             `json:"env"`
+	SymmetricKey        string             `json:"symmetric"`
+	AccessTokenDuration time.Duration      `json:"duration"`
+	Database            PostgresConfig     `json:"database"`
+	Minio               MinioConfig        `json:"minio"`
+	Storage             StorageConfig      `json:"storage"`
+	Uploads             UploadsConfig      `json:"uploads"`
+	Presign             PresignConfig      `json:"presign"`
+	Scrubber            ScrubberConfig     `json:"scrubber"`
+	Encryption          EncryptionConfig   `json:"encryption"`
+	Signing             SigningConfig      `json:"signing"`
+	Hashing             HashingConfig      `json:"hashing"`
+	Audit               AuditConfig        `json:"audit"`
+	Timestamping        TimestampingConfig `json:"timestamping"`
+	Sessions            SessionsConfig     `json:"sessions"`
+	Tokens              TokensConfig       `json:"tokens"`
+	OIDC                OIDCConfig         `json:"oidc"`
 }
 
 type PostgresConfig struct {
@@ -32,6 +44,200 @@ type MinioConfig struct {
 	SecretKey string `json:"secret"`
 }
 
+// Storage drivers that can be selected in the StorageConfig
+const (
+	StorageDriverMinio = "minio"
+	StorageDriverLocal = "local"
+)
+
+// StorageConfig selects the ObjectStore implementation, when driver is empty
+// MinIO is used. Path is the root directory for the local driver.
+type StorageConfig struct {
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+}
+
+// UploadsConfig configures resumable uploads, MaxSize limits the upload length in
+// bytes, zero means no limit. Chunks are kept in the object store until the
+// upload is complete.
+type UploadsConfig struct {
+	MaxSize int64 `json:"max_size"`
+}
+
+// PresignConfig configures presigned URLs, Expiry is how long a URL stays valid
+// and defaults to DefaultPresignExpiry
+type PresignConfig struct {
+	Expiry time.Duration `json:"expiry"`
+}
+
+// UnmarshalJSON reads the expiry as a duration string like "15m"
+func (p *PresignConfig) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Expiry string `json:"expiry"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*p = PresignConfig{}
+	if tmp.Expiry == "" {
+		return nil
+	}
+	expiry, err := time.ParseDuration(tmp.Expiry)
+	if err != nil {
+		return err
+	}
+	p.Expiry = expiry
+	return nil
+}
+
+// ScrubberConfig configures the background verification of evidence hashes,
+// Interval is the time between two passes and zero disables the scrubber
+type ScrubberConfig struct {
+	Interval time.Duration `json:"interval"`
+}
+
+// UnmarshalJSON reads the interval as a duration string like "24h"
+func (s *ScrubberConfig) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		Interval string `json:"interval"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*s = ScrubberConfig{}
+	if tmp.Interval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(tmp.Interval)
+	if err != nil {
+		return err
+	}
+	s.Interval = interval
+	return nil
+}
+
+// EncryptionConfig enables encryption of evidences at rest when MasterKey is set.
+// MasterKey is a base64 encoded 256 bit key that wraps the data keys of cases and
+// MasterKeyID names it. PreviousKeys is a comma separated list of id:key pairs of
+// retired master keys, they are kept until the data keys are rotated to the new key.
+type EncryptionConfig struct {
+	MasterKey    string `json:"master_key"`
+	MasterKeyID  string `json:"master_key_id"`
+	PreviousKeys string `json:"previous_keys"`
+}
+
+// SigningConfig holds the Ed25519 key that signs the documents the registry
+// issues. PrivateKey is a base64 encoded 32 byte seed and KeyID names the key.
+// PreviousKeys is a comma separated list of id:key pairs of the base64 encoded
+// public keys of retired keys, documents they signed are still verified.
+type SigningConfig struct {
+	PrivateKey   string `json:"private_key"`
+	KeyID        string `json:"key_id"`
+	PreviousKeys string `json:"previous_keys"`
+}
+
+// HashingConfig selects the hash algorithms computed when evidences are ingested,
+// Algorithms is a comma separated list like "md5,sha1,sha512" and defaults to
+// DefaultHashAlgorithms. SHA256 is always computed.
+type HashingConfig struct {
+	Algorithms string `json:"algorithms"`
+}
+
+// AuditConfig configures the signed checkpoints of the audit log,
+// CheckpointInterval is the time between two checkpoints and zero disables them
+type AuditConfig struct {
+	CheckpointInterval time.Duration `json:"checkpoint_interval"`
+}
+
+// UnmarshalJSON reads the checkpoint interval as a duration string like "1h"
+func (a *AuditConfig) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		CheckpointInterval string `json:"checkpoint_interval"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*a = AuditConfig{}
+	if tmp.CheckpointInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(tmp.CheckpointInterval)
+	if err != nil {
+		return err
+	}
+	a.CheckpointInterval = interval
+	return nil
+}
+
+// TimestampingConfig configures RFC 3161 time-stamping of ingested evidences. URL
+// is the time-stamping authority, "local" selects the built-in TSA and empty
+// disables time-stamping. CertFile is the PEM certificate of the TSA that tokens
+// must be signed with. The built-in TSA signs with CertFile and the PEM PKCS #8
+// key in KeyFile, without them it uses an ephemeral certificate.
+type TimestampingConfig struct {
+	URL      string `json:"url"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// SessionsConfig configures the sessions of logged in users, RefreshTokenDuration
+// is how long a session can be refreshed after the login and defaults to
+// DefaultRefreshTokenDuration
+type SessionsConfig struct {
+	RefreshTokenDuration time.Duration `json:"refresh_duration"`
+}
+
+// UnmarshalJSON reads the refresh token duration as a duration string like "24h"
+func (s *SessionsConfig) UnmarshalJSON(data []byte) error {
+	var tmp struct {
+		RefreshTokenDuration string `json:"refresh_duration"`
+	}
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*s = SessionsConfig{}
+	if tmp.RefreshTokenDuration == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(tmp.RefreshTokenDuration)
+	if err != nil {
+		return err
+	}
+	s.RefreshTokenDuration = duration
+	return nil
+}
+
+// TokensConfig switches the tokens to PASETO v4.public when PrivateKey is set,
+// otherwise they are v2.local tokens of the symmetric key. PrivateKey is a base64
+// encoded 32 byte Ed25519 seed and KeyID names it in the footer of the tokens.
+// PreviousKeys is a comma separated list of id:key pairs of the base64 encoded
+// public keys of retired keys, tokens they signed are verified until they expire.
+type TokensConfig struct {
+	PrivateKey   string `json:"private_key"`
+	KeyID        string `json:"key_id"`
+	PreviousKeys string `json:"previous_keys"`
+}
+
+// OIDCConfig enables single sign-on at an OpenID Connect identity provider when
+// Issuer is set. RedirectURL is the /oidc/callback URL of the server registered
+// with the client, ClientSecret is only needed by confidential clients. Scopes is
+// a space separated list and defaults to DefaultOIDCScopes. UsernameClaim and
+// GroupsClaim name the ID token claims the username and the groups are read from.
+// RoleMapping is a comma separated list of group:role pairs, the first pair with
+// a group of the user gives its role, otherwise DefaultRole does. Without either
+// the login is refused.
+type OIDCConfig struct {
+	Issuer        string `json:"issuer"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+	RedirectURL   string `json:"redirect_url"`
+	Scopes        string `json:"scopes"`
+	UsernameClaim string `json:"username_claim"`
+	GroupsClaim   string `json:"groups_claim"`
+	RoleMapping   string `json:"role_mapping"`
+	DefaultRole   string `json:"default_role"`
+}
+
 func (p *PostgresConfig) ConnectionInfo() string {
 	if p.Password == "" {
 		return fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=disable", p.Host, p.Port, p.User, p.Name)
@@ -44,12 +250,24 @@ func (p *PostgresConfig) ConnectionInfo() string {
 // with Time.Duration values that are not supported by the default
 func (c *Config) UnmarshalJSON(data []byte) error {
 	var tmp struct {
-		Port                int            `json:"port"`
-		Env                 string         `json:"env"`
-		SymmetricKey        string         `json:"symmetric"`
-		AccessTokenDuration string         `json:"duration"`
-		Database            PostgresConfig `json:"database"`
-		Minio               MinioConfig    `json:"minio"`
+		Port                int                `json:"port"`
+		Env                 string             `json:"env"`
+		SymmetricKey        string             `json:"symmetric"`
+		AccessTokenDuration string             `json:"duration"`
+		Database            PostgresConfig     `json:"database"`
+		Minio               MinioConfig        `json:"minio"`
+		Storage             StorageConfig      `json:"storage"`
+		Uploads             UploadsConfig      `json:"uploads"`
+		Presign             PresignConfig      `json:"presign"`
+		Scrubber            ScrubberConfig     `json:"scrubber"`
+		Encryption          EncryptionConfig   `json:"encryption"`
+		Signing             SigningConfig      `json:"signing"`
+		Hashing             HashingConfig      `json:"hashing"`
+		Audit               AuditConfig        `json:"audit"`
+		Timestamping        TimestampingConfig `json:"timestamping"`
+		Sessions            SessionsConfig     `json:"sessions"`
+		Tokens              TokensConfig       `json:"tokens"`
+		OIDC                OIDCConfig         `json:"oidc"`
 	}
 	if err := json.Unmarshal(data, &tmp); err != nil {
 		return err
@@ -65,6 +283,18 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		AccessTokenDuration: duration,
 		Database:            tmp.Database,
 		Minio:               tmp.Minio,
+		Storage:             tmp.Storage,
+		Uploads:             tmp.Uploads,
+		Presign:             tmp.Presign,
+		Scrubber:            tmp.Scrubber,
+		Encryption:          tmp.Encryption,
+		Signing:             tmp.Signing,
+		Hashing:             tmp.Hashing,
+		Audit:               tmp.Audit,
+		Timestamping:        tmp.Timestamping,
+		Sessions:            tmp.Sessions,
+		Tokens:              tmp.Tokens,
+		OIDC:                tmp.OIDC,
 	}
 	return nil
 }
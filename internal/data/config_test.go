@@ -120,3 +120,104 @@ func TestLoadProductionConfigWithInvalidJSONFormatFailed(t *testing.T) {
 		t.Errorf("expected error, got nil")
 	}
 }
+func TestUnmarshalJSONReadStorageSettings(t *testing.T) {
+	dat := []byte(`{"duration": "1h", "storage": {"driver": "local", "path": "/srv/evidence"}}`)
+	want := data.StorageConfig{
+		Driver: data.StorageDriverLocal,
+		Path:   "/srv/evidence",
+	}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Storage, want) {
+		t.Errorf(cmp.Diff(want, got.Storage))
+	}
+}
+func TestUnmarshalJSONReadHashingSettings(t *testing.T) {
+	dat := []byte(`{"duration": "1h", "hashing": {"algorithms": "md5,sha512"}}`)
+	want := data.HashingConfig{Algorithms: "md5,sha512"}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Hashing, want) {
+		t.Errorf(cmp.Diff(want, got.Hashing))
+	}
+}
+func TestUnmarshalJSONReadAuditSettings(t *testing.T) {
+	dat := []byte(`{"duration": "1h", "audit": {"checkpoint_interval": "30m"}}`)
+	want := data.AuditConfig{CheckpointInterval: 30 * time.Minute}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Audit, want) {
+		t.Errorf(cmp.Diff(want, got.Audit))
+	}
+}
+func TestUnmarshalJSONReadTimestampingSettings(t *testing.T) {
+	dat := []byte(`{"duration": "1h", "timestamping": {"url": "local", "cert_file": "tsa.crt", "key_file": "tsa.key"}}`)
+	want := data.TimestampingConfig{URL: data.TimestampLocal, CertFile: "tsa.crt", KeyFile: "tsa.key"}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Timestamping, want) {
+		t.Errorf(cmp.Diff(want, got.Timestamping))
+	}
+}
+func TestUnmarshalJSONReadSessionsSettings(t *testing.T) {
+	dat := []byte(`{"duration": "15m", "sessions": {"refresh_duration": "12h"}}`)
+	want := data.SessionsConfig{RefreshTokenDuration: 12 * time.Hour}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Sessions, want) {
+		t.Errorf(cmp.Diff(want, got.Sessions))
+	}
+}
+func TestUnmarshalJSONReadTokensSettings(t *testing.T) {
+	dat := []byte(`{"duration": "15m", "tokens": {"private_key": "c2VlZA==", "key_id": "2024", "previous_keys": "2023:cHVibGlj"}}`)
+	want := data.TokensConfig{PrivateKey: "c2VlZA==", KeyID: "2024", PreviousKeys: "2023:cHVibGlj"}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.Tokens, want) {
+		t.Errorf(cmp.Diff(want, got.Tokens))
+	}
+}
+func TestUnmarshalJSONReadOIDCSettings(t *testing.T) {
+	dat := []byte(`{"duration": "15m", "oidc": {"issuer": "https://id.example.gov", "client_id": "der", "redirect_url": "https://der.example.gov/oidc/callback", "role_mapping": "judges:judge,clerks:clerk", "default_role": "defense"}}`)
+	want := data.OIDCConfig{
+		Issuer:      "https://id.example.gov",
+		ClientID:    "der",
+		RedirectURL: "https://der.example.gov/oidc/callback",
+		RoleMapping: "judges:judge,clerks:clerk",
+		DefaultRole: data.RoleDefense,
+	}
+	var got data.Config
+	err := got.UnmarshalJSON(dat)
+	if err != nil {
+		t.Fatalf("failed to unmarshal test data: %v", err)
+	}
+	if !cmp.Equal(got.OIDC, want) {
+		t.Errorf(cmp.Diff(want, got.OIDC))
+	}
+}
+func TestFromStorageConfigWithUnknownDriverFailed(t *testing.T) {
+	config := data.TestAppConfig()
+	config.Storage.Driver = "tape"
+	_, err := data.FromStorageConfig(config)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
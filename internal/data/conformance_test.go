@@ -0,0 +1,34 @@
+//go:build integration
+
+package data_test
+
+import (
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/storetest"
+)
+
+// getConformanceStores returns Stores backed by the test Postgres and MinIO
+func getConformanceStores(t *testing.T) data.Stores {
+	stores, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("failed to get test stores: %v", err)
+	}
+	return stores
+}
+
+func TestMinioConformance(t *testing.T) {
+	storetest.RunObjectStoreSuite(t, func(t *testing.T) data.ObjectStore {
+		return getConformanceStores(t).ObjectStore
+	})
+}
+func TestPostgresDBStoreConformance(t *testing.T) {
+	storetest.RunDBStoreSuite(t, getConformanceStores)
+}
+func TestPostgresUserStoreConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, getConformanceStores)
+}
+func TestPostgresUploadStoreConformance(t *testing.T) {
+	storetest.RunUploadStoreSuite(t, getConformanceStores)
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Actions recorded in the chain of custody of an evidence
+const (
+	CustodyUpload            = "upload"
+	CustodyDownload          = "download"
+	CustodyPresignedDownload = "presigned_download"
+	CustodyComment           = "comment"
+	CustodyMove              = "move"
+	CustodyVerify            = "verify"
+	CustodyDelete            = "delete"
+	CustodyDestroy           = "destroy"
+)
+
+// CustodyEvent records who accessed an evidence, when, from where and what the
+// content hash was at that time. Events of all evidences form one audit log in
+// which every event is chained to the previous one by hash, see Link.
+type CustodyEvent struct {
+	ID         int64     `json:"id"`
+	Seq        int64     `json:"seq"`
+	EvidenceID int64     `json:"evidence_id"`
+	CaseID     int64     `json:"case_id"`
+	Version    int64     `json:"version,omitempty"`
+	Action     string    `json:"action"`
+	Username   string    `json:"username"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Hash       string    `json:"hash"`
+	Detail     string    `json:"detail,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"prev_hash"`
+	EntryHash  string    `json:"entry_hash"`
+}
+
+// CustodyStore keeps the chain of custody of evidences and the signed checkpoints
+// of the audit log, events are never removed and outlive the evidences they are
+// about. AddCustodyEvent links the event to the last one of the log.
+type CustodyStore interface {
+	AddCustodyEvent(event *CustodyEvent) error
+	ListCustodyEvents(evidenceID int64) ([]CustodyEvent, error)
+	ListAuditLog() ([]CustodyEvent, error)
+	LastCustodyEvent() (*CustodyEvent, error)
+	AddCheckpoint(cp *AuditCheckpoint) error
+	ListCheckpoints() ([]AuditCheckpoint, error)
+}
+
+type Custody struct {
+	DB *sql.DB
+}
+
+func NewCustodyStore(db *sql.DB) CustodyStore {
+	return &Custody{
+		DB: db,
+	}
+}
+
+// custodyColumns are the columns of custody events in the order scanCustodyEvent reads them
+const custodyColumns = `"id", "seq", "evidence_id", "case_id", "version", "action", "username", "client_ip", "user_agent", "hash", "detail", "created_at", "prev_hash", "entry_hash"`
+
+func scanCustodyEvent(row scanner) (*CustodyEvent, error) {
+	e := &CustodyEvent{}
+	err := row.Scan(&e.ID, &e.Seq, &e.EvidenceID, &e.CaseID, &e.Version, &e.Action, &e.Username, &e.ClientIP, &e.UserAgent, &e.Hash, &e.Detail, &e.CreatedAt, &e.PrevHash, &e.EntryHash)
+	if err != nil {
+		return nil, err
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+	return e, nil
+}
+
+// AddCustodyEvent links the event to the last event of the audit log and stores
+// it, the head of the chain is locked so concurrent events can't fork the chain
+func (c *Custody) AddCustodyEvent(event *CustodyEvent) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = addCustodyEvent(tx, event)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addCustodyEvent adds the event in the transaction of the change it records, a
+// nil event is not recorded. It locks the row of the chain head, so only appending
+// to the chain is serialized and not the changes of evidences. The lock is held
+// until the transaction ends and every event waits for it, so the event has to be
+// added last: statements after it would keep all other events waiting.
+func addCustodyEvent(tx *sql.Tx, event *CustodyEvent) error {
+	if event == nil {
+		return nil
+	}
+	var prevSeq int64
+	var prevHash string
+	err := tx.QueryRow(`SELECT "seq", "entry_hash" FROM "custody_chain_head" FOR UPDATE`).Scan(&prevSeq, &prevHash)
+	if err != nil {
+		return fmt.Errorf("locking custody chain head : %w", err)
+	}
+	event.Link(prevSeq, prevHash)
+	err = tx.QueryRow(`INSERT INTO "custody_events" ("seq", "evidence_id", "case_id", "version", "action", "username", "client_ip", "user_agent", "hash", "detail", "created_at", "prev_hash", "entry_hash")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		event.Seq, event.EvidenceID, event.CaseID, event.Version, event.Action, event.Username, event.ClientIP, event.UserAgent, event.Hash, event.Detail, event.CreatedAt, event.PrevHash, event.EntryHash).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("inserting custody event : %w", err)
+	}
+	_, err = tx.Exec(`UPDATE "custody_chain_head" SET "seq" = $1, "entry_hash" = $2`, event.Seq, event.EntryHash)
+	if err != nil {
+		return fmt.Errorf("updating custody chain head : %w", err)
+	}
+	return nil
+}
+
+// ListCustodyEvents returns the chain of custody of an evidence, oldest first
+func (c *Custody) ListCustodyEvents(evidenceID int64) ([]CustodyEvent, error) {
+	return c.listCustodyEvents(`SELECT `+custodyColumns+` FROM "custody_events" WHERE evidence_id = $1 ORDER BY seq`, evidenceID)
+}
+
+// ListAuditLog returns the events of all evidences in the order they were added
+func (c *Custody) ListAuditLog() ([]CustodyEvent, error) {
+	return c.listCustodyEvents(`SELECT ` + custodyColumns + ` FROM "custody_events" ORDER BY id`)
+}
+
+func (c *Custody) listCustodyEvents(query string, args ...interface{}) ([]CustodyEvent, error) {
+	rows, err := c.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []CustodyEvent
+	for rows.Next() {
+		e, err := scanCustodyEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	return events, rows.Err()
+}
+
+// LastCustodyEvent returns the last event of the audit log or ErrNotFound when it is empty
+func (c *Custody) LastCustodyEvent() (*CustodyEvent, error) {
+	e, err := scanCustodyEvent(c.DB.QueryRow(`SELECT ` + custodyColumns + ` FROM "custody_events" ORDER BY seq DESC LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : audit log is empty", ErrNotFound)
+	}
+	return e, err
+}
+
+// AddCheckpoint stores a signed checkpoint and sets its ID, a checkpoint only
+// follows one checkpoint so another one following the same returns ErrConflict
+func (c *Custody) AddCheckpoint(cp *AuditCheckpoint) error {
+	err := c.DB.QueryRow(`INSERT INTO "audit_checkpoints" ("seq", "entry_hash", "prev_checkpoint", "statement", "signature") VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		cp.Seq, cp.EntryHash, cp.PrevCheckpoint, cp.Statement, cp.Signature).Scan(&cp.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : checkpoint %q is already followed by a checkpoint", ErrConflict, cp.PrevCheckpoint)
+		}
+		return fmt.Errorf("inserting audit checkpoint : %w", err)
+	}
+	return nil
+}
+
+// ListCheckpoints returns all checkpoints ordered by ID
+func (c *Custody) ListCheckpoints() ([]AuditCheckpoint, error) {
+	rows, err := c.DB.Query(`SELECT "id", "statement", "signature" FROM "audit_checkpoints" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var checkpoints []AuditCheckpoint
+	for rows.Next() {
+		cp := AuditCheckpoint{}
+		err = rows.Scan(&cp.ID, &cp.Statement, &cp.Signature)
+		if err != nil {
+			return nil, err
+		}
+		err = cp.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
+
+// RecordCustody adds an event to the chain of custody of an evidence and to the
+// audit log, the time of the event is set when it is missing
+func (s *Stores) RecordCustody(event *CustodyEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	err := s.Custody.AddCustodyEvent(event)
+	if err != nil {
+		return fmt.Errorf("recording custody event: %w , evidence id: %d ", err, event.EvidenceID)
+	}
+	return nil
+}
+
+// custodyEvent returns the event of an action on the evidence made by the actor,
+// which holds the user, client and detail of the request. Changes without an
+// actor are recorded for the uploader of the evidence.
+func custodyEvent(actor *CustodyEvent, action string, ev *Evidence) *CustodyEvent {
+	var event CustodyEvent
+	if actor != nil {
+		event = *actor
+	}
+	if event.Username == "" {
+		event.Username = ev.UploadedBy
+	}
+	event.EvidenceID = ev.ID
+	event.CaseID = ev.CaseID
+	event.Action = action
+	event.Hash = ev.Hash
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return &event
+}
+
+// withDetail returns a copy of the actor of a change with the detail of the change
+func withDetail(actor *CustodyEvent, detail string) *CustodyEvent {
+	var event CustodyEvent
+	if actor != nil {
+		event = *actor
+	}
+	event.Detail = detail
+	return &event
+}
+
+// ListCustody returns the chain of custody of the evidence, oldest first
+func (s *Stores) ListCustody(ev *Evidence) ([]CustodyEvent, error) {
+	events, err := s.Custody.ListCustodyEvents(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting custody events from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	return events, nil
+}
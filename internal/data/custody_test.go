@@ -0,0 +1,166 @@
+package data_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// custodyActions returns the actions of the events in order
+func custodyActions(events []data.CustodyEvent) []string {
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	return actions
+}
+
+func TestRecordCustodyListedEventsOldestFirst(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{data.CustodyDownload, data.CustodyComment} {
+		err = stores.RecordCustody(&data.CustodyEvent{EvidenceID: ev.ID, CaseID: cs.ID, Action: action, Username: "clerk", Hash: ev.Hash})
+		if err != nil {
+			t.Fatalf("failed to record custody: %v", err)
+		}
+	}
+	events, err := stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{data.CustodyUpload, data.CustodyDownload, data.CustodyComment}
+	if got := custodyActions(events); !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	for _, e := range events {
+		if e.CreatedAt.IsZero() || e.ID == 0 {
+			t.Errorf("expected event with ID and time, got %+v", e)
+		}
+	}
+}
+
+func TestVerifyEvidenceRecordedCustody(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stores.VerifyEvidence(ev, "auditor")
+	if err != nil {
+		t.Fatalf("failed to verify evidence: %v", err)
+	}
+	events, err := stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected upload and verify custody events, got %d", len(events))
+	}
+	got := events[1]
+	if got.Action != data.CustodyVerify || got.Username != "auditor" || got.Hash != ev.Hash || got.Detail != data.VerificationPassed {
+		t.Errorf("unexpected custody event %+v", got)
+	}
+}
+
+func TestDisposeCaseRecordedCustodyOfEveryEvidence(t *testing.T) {
+	stores, _ := getTestDispositionStores(t)
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	evidences, err := stores.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stores.DisposeCase("test", "judge")
+	if err != nil {
+		t.Fatalf("failed to dispose case: %v", err)
+	}
+	for i := range evidences {
+		events, err := stores.ListCustody(&evidences[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[1].Action != data.CustodyDestroy || events[1].Username != "judge" || events[1].Hash != evidences[i].Hash {
+			t.Errorf("expected destroy event by judge for %q, got %+v", evidences[i].Name, events)
+		}
+	}
+}
+
+func TestEvidenceChangesRecordedCustody(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	actor := &data.CustodyEvent{Username: "clerk", ClientIP: "192.0.2.1", UserAgent: "forensics/1.0"}
+	ev := &data.Evidence{CaseID: cs.ID, Name: "video", File: strings.NewReader("video, edited"), UploadedBy: "clerk", Custody: actor}
+	err := stores.CreateEvidence(ev, cs)
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	err = stores.AddEvidenceComment(ev, &data.Comment{Text: "edited", Custody: actor})
+	if err != nil {
+		t.Fatalf("failed to add comment: %v", err)
+	}
+	ev.Custody = actor
+	err = stores.MoveEvidence(ev, "edits", "video")
+	if err != nil {
+		t.Fatalf("failed to move evidence: %v", err)
+	}
+	ev.Custody = actor
+	err = stores.DeleteEvidence(ev)
+	if err != nil {
+		t.Fatalf("failed to delete evidence: %v", err)
+	}
+	events, err := stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []data.CustodyEvent{
+		{Action: data.CustodyUpload, Version: 1},
+		{Action: data.CustodyUpload, Version: 2, Username: "clerk", ClientIP: "192.0.2.1", UserAgent: "forensics/1.0", Hash: ev.Hash},
+		{Action: data.CustodyComment, Username: "clerk", ClientIP: "192.0.2.1", UserAgent: "forensics/1.0", Hash: ev.Hash, Detail: "edited"},
+		{Action: data.CustodyMove, Username: "clerk", ClientIP: "192.0.2.1", UserAgent: "forensics/1.0", Hash: ev.Hash, Detail: `moved from "video" to "edits/video"`},
+		{Action: data.CustodyDelete, Username: "clerk", ClientIP: "192.0.2.1", UserAgent: "forensics/1.0", Hash: ev.Hash},
+	}
+	var got []data.CustodyEvent
+	for i, e := range events {
+		if e.EvidenceID != ev.ID || e.CaseID != cs.ID || e.CreatedAt.IsZero() {
+			t.Errorf("expected event of the evidence with a time, got %+v", e)
+		}
+		if i == 0 {
+			// the first version was uploaded before the test
+			e.Hash = ""
+		}
+		got = append(got, data.CustodyEvent{Action: e.Action, Version: e.Version, Username: e.Username, ClientIP: e.ClientIP, UserAgent: e.UserAgent, Hash: e.Hash, Detail: e.Detail})
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func TestFailedEvidenceChangeRecordedNoCustody(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stores.PlaceHold(&data.LegalHold{CaseID: cs.ID, EvidenceID: ev.ID, Reason: "appeal", IssuedBy: "judge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.DeleteEvidence(ev)
+	if !errors.Is(err, data.ErrLocked) {
+		t.Fatalf("expected error %v, got %v", data.ErrLocked, err)
+	}
+	events, err := stores.ListCustody(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{data.CustodyUpload}; !cmp.Equal(want, custodyActions(events)) {
+		t.Errorf(cmp.Diff(want, custodyActions(events)))
+	}
+}
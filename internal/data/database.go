@@ -6,25 +6,87 @@ import (
 	"fmt"
 	"github.com/lib/pq"
 	"io"
+	"time"
 )
 
+// Case is identified by its name, a free-form display name, and stored in the
+// object store under its StorageKey
 type Case struct {
-	ID   int64    `json:"id"`
-	Name string   `json:"name"`
-	Tags []string `json:"tags"`
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Tags       []string `json:"tags"`
+	StorageKey string   `json:"storage_key,omitempty"`
 }
+
+// Bucket returns the name the case is stored under in the object store, cases
+// without a storage key are stored under their name
+func (cs *Case) Bucket() string {
+	if cs.StorageKey != "" {
+		return cs.StorageKey
+	}
+	return cs.Name
+}
+// Evidence is identified by its name within a folder of its case, the content of
+// its first version is stored in the object store under ObjectName
 type Evidence struct {
-	ID     int64     `json:"id"`
-	CaseID int64     `json:"case_id,omitempty"`
-	File   io.Reader `json:"file,omitempty"`
-	Name   string    `json:"name,omitempty"`
-	Hash   string    `json:"hash,omitempty"`
+	ID                 int64      `json:"id"`
+	CaseID             int64      `json:"case_id,omitempty"`
+	File               io.Reader  `json:"file,omitempty"`
+	Name               string     `json:"name,omitempty"`
+	Folder             string     `json:"folder"`
+	ObjectName         string     `json:"-"`
+	Hash               string     `json:"hash,omitempty"`
+	Hashes             Hashes     `json:"hashes,omitempty"`
+	UploadedBy         string     `json:"uploaded_by,omitempty"`
+	ExpectedHash       string     `json:"-"`
+	DeclaredHashes     Hashes     `json:"-"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	VerificationStatus string     `json:"verification_status,omitempty"`
+	// TimestampToken is the RFC 3161 token of the current hash
+	TimestampToken []byte `json:"-"`
+	// PresignedUploadID is the presigned upload the evidence is completed from, it
+	// is removed in the transaction that creates the evidence
+	PresignedUploadID string `json:"-"`
+	// Custody is the event of the change to the evidence, it is added to the chain
+	// of custody in the transaction that makes the change. Handlers set who made
+	// the change and the Stores complete it.
+	Custody *CustodyEvent `json:"-"`
+}
+
+// Object returns the name the first version of the evidence is stored under in the
+// object store, evidences without an object name are stored under their name
+func (ev *Evidence) Object() string {
+	if ev.ObjectName != "" {
+		return ev.ObjectName
+	}
+	return ev.Name
+}
+
+// EvidenceVersion is one revision of an evidence, the first version is stored
+// under the object name of the evidence and later versions under generated names.
+type EvidenceVersion struct {
+	EvidenceID int64     `json:"evidence_id"`
+	Version    int64     `json:"version"`
+	Hash       string    `json:"hash"`
+	Hashes     Hashes    `json:"hashes,omitempty"`
+	ObjectName string    `json:"-"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	// TimestampToken is the RFC 3161 token of the hash
+	TimestampToken []byte `json:"-"`
+	// PresignedUploadID is the presigned upload the version is completed from, it
+	// is removed in the transaction that adds the version
+	PresignedUploadID string `json:"-"`
+	// Custody is the upload event of the version, it is added with the version
+	Custody *CustodyEvent `json:"-"`
 }
 
 type Comment struct {
 	ID         int64  `json:"id"`
 	EvidenceID int64  `json:"evidence_id,omitempty"`
 	Text       string `json:"text,omitempty"`
+	// Custody is the comment event of the evidence, it is added with the comment
+	Custody *CustodyEvent `json:"-"`
 }
 
 type DBStore interface {
@@ -35,15 +97,28 @@ type DBStore interface {
 	GetCaseByID(id int64) (*Case, error)
 	GetCaseByUserID(userID int64) ([]Case, error)
 	RemoveCase(cs *Case) error
+	AddCaseMember(member *CaseMember) error
+	GetCaseMember(caseID int64, userID int64) (*CaseMember, error)
+	ListCaseMembers(caseID int64) ([]CaseMember, error)
+	RemoveCaseMember(caseID int64, userID int64) error
 	FindCaseByTags(tags []string) ([]Case, error)
 	CreateEvidence(evidence *Evidence) (int64, error)
 	GetEvidenceByID(id int64, caseID int64) (*Evidence, error)
 	EvidenceExists(evidence *Evidence) (bool, error)
-	GetEvidenceByName(cs *Case, name string) (*Evidence, error)
+	GetEvidenceByName(cs *Case, folder string, name string) (*Evidence, error)
 	RemoveEvidence(evidence *Evidence) error
 	GetEvidenceByCaseID(CaseID int64) ([]Evidence, error)
+	AddEvidenceVersion(version *EvidenceVersion) error
+	GetEvidenceVersion(evidenceID int64, version int64) (*EvidenceVersion, error)
+	ListEvidenceVersions(evidenceID int64) ([]EvidenceVersion, error)
+	FindEvidencesByHash(algorithm string, digest string) ([]Evidence, error)
 	AddComment(comment *Comment) error
 	GetCommentsByID(evidenceID int64) ([]Comment, error)
+	AddFolder(folder *Folder) error
+	GetFolder(caseID int64, path string) (*Folder, error)
+	ListFolders(caseID int64, parent string) ([]Folder, error)
+	MoveEvidence(evidence *Evidence, folder string, name string) error
+	MoveFolder(caseID int64, from string, to string) error
 }
 
 type DB struct {
@@ -56,6 +131,44 @@ func NewDBStore(db *sql.DB) DBStore {
 	}
 }
 
+// caseColumns are the columns scanned into a Case, cases added without a storage
+// key have a NULL one
+const caseColumns = `"id", "name", "tags", COALESCE("storage_key", '')`
+
+// evidenceColumns are the columns scanned into an Evidence by scanEvidence
+const evidenceColumns = `id, case_id, name, folder, object_name, hash, md5, sha1, sha512, verified_at, verification_status, timestamp_token`
+
+func scanEvidence(row scanner, evidence *Evidence) error {
+	var md5, sha1, sha512 string
+	err := row.Scan(&evidence.ID, &evidence.CaseID, &evidence.Name, &evidence.Folder, &evidence.ObjectName, &evidence.Hash, &md5, &sha1, &sha512, &evidence.VerifiedAt, &evidence.VerificationStatus, &evidence.TimestampToken)
+	if err != nil {
+		return err
+	}
+	evidence.Hashes = Hashes{HashMD5: md5, HashSHA1: sha1, HashSHA512: sha512}.Stored(evidence.Hash)
+	return nil
+}
+
+// versionColumns are the columns scanned into an EvidenceVersion by scanVersion
+const versionColumns = `evidence_id, version, hash, md5, sha1, sha512, object_name, uploaded_by, created_at, timestamp_token`
+
+func scanVersion(row scanner, v *EvidenceVersion) error {
+	var md5, sha1, sha512 string
+	err := row.Scan(&v.EvidenceID, &v.Version, &v.Hash, &md5, &sha1, &sha512, &v.ObjectName, &v.UploadedBy, &v.CreatedAt, &v.TimestampToken)
+	if err != nil {
+		return err
+	}
+	v.Hashes = Hashes{HashMD5: md5, HashSHA1: sha1, HashSHA512: sha512}.Stored(v.Hash)
+	return nil
+}
+
+// hashColumns are the columns of evidences and their versions that hold the digests
+var hashColumns = map[string]string{
+	HashMD5:    "md5",
+	HashSHA1:   "sha1",
+	HashSHA256: "hash",
+	HashSHA512: "sha512",
+}
+
 // AddCase a new case to the database or return an error
 func (d *DB) AddCase(cs *Case, user *User) error {
 	if cs.Name == "" {
@@ -68,12 +181,12 @@ func (d *DB) AddCase(cs *Case, user *User) error {
 
 	// first insert the case into the cases table and get the id
 	var caseID int64
-	err = tx.QueryRow(`INSERT INTO "cases" ("name", "tags") VALUES ($1, $2) RETURNING id;`, cs.Name, pq.Array(cs.Tags)).Scan(&caseID)
+	err = tx.QueryRow(`INSERT INTO "cases" ("name", "tags", "storage_key") VALUES ($1, $2, NULLIF($3, '')) RETURNING id;`, cs.Name, pq.Array(cs.Tags), cs.StorageKey).Scan(&caseID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
-	_, err = tx.Exec(`INSERT INTO "user_cases" ("user_id", "case_id") VALUES ($1, $2)`, user.ID, caseID)
+	_, err = tx.Exec(`INSERT INTO "user_cases" ("user_id", "case_id", "role") VALUES ($1, $2, $3)`, user.ID, caseID, CaseOwner)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -91,7 +204,7 @@ func (d *DB) CaseExists(name string) (bool, error) {
 
 // ListCases all cases in the database or an error
 func (d *DB) ListCases() ([]Case, error) {
-	rows, err := d.DB.Query(`SELECT * FROM "cases"`)
+	rows, err := d.DB.Query(`SELECT `+caseColumns+` FROM "cases"`)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +213,7 @@ func (d *DB) ListCases() ([]Case, error) {
 	var cases []Case
 	for rows.Next() {
 		var cs Case
-		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags))
+		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags), &cs.StorageKey)
 		if rErr != nil {
 			return nil, err
 		}
@@ -113,7 +226,7 @@ func (d *DB) ListCases() ([]Case, error) {
 // GetCaseByName returns a case by name from the database or an error
 func (d *DB) GetCaseByName(name string) (*Case, error) {
 	cs := &Case{}
-	err := d.DB.QueryRow(`SELECT * FROM "cases" WHERE name = $1`, name).Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags))
+	err := d.DB.QueryRow(`SELECT `+caseColumns+` FROM "cases" WHERE name = $1`, name).Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags), &cs.StorageKey)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +236,7 @@ func (d *DB) GetCaseByName(name string) (*Case, error) {
 // GetCaseByID returns a case by id from the database or an error
 func (d *DB) GetCaseByID(id int64) (*Case, error) {
 	cs := &Case{}
-	err := d.DB.QueryRow(`SELECT * FROM "cases" WHERE id = $1`, id).Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags))
+	err := d.DB.QueryRow(`SELECT `+caseColumns+` FROM "cases" WHERE id = $1`, id).Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags), &cs.StorageKey)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +245,7 @@ func (d *DB) GetCaseByID(id int64) (*Case, error) {
 
 //GetCaseByUserID returns a case by id from the database or an error
 func (d *DB) GetCaseByUserID(userID int64) ([]Case, error) {
-	rows, err := d.DB.Query(`SELECT * FROM "cases" WHERE id IN (SELECT case_id FROM "user_cases" WHERE user_id = $1)`, userID)
+	rows, err := d.DB.Query(`SELECT `+caseColumns+` FROM "cases" WHERE id IN (SELECT case_id FROM "user_cases" WHERE user_id = $1)`, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("%w : user id : %d", ErrNotFound, userID)
@@ -144,7 +257,7 @@ func (d *DB) GetCaseByUserID(userID int64) ([]Case, error) {
 	var cases []Case
 	for rows.Next() {
 		var cs Case
-		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags))
+		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags), &cs.StorageKey)
 		if rErr != nil {
 			return nil, rErr
 		}
@@ -166,6 +279,11 @@ func (d *DB) RemoveCase(cs *Case) error {
 	if err != nil {
 		return err
 	}
+	// and the folders of the case
+	_, err = tx.Exec(`DELETE FROM "folders" WHERE case_id = $1`, cs.ID)
+	if err != nil {
+		return err
+	}
 	// then remove from cases table
 	_, err = tx.Exec(`DELETE FROM "cases" WHERE id = $1`, cs.ID)
 	if err != nil {
@@ -176,7 +294,7 @@ func (d *DB) RemoveCase(cs *Case) error {
 
 // FindCaseByTags returns cases with matching tags
 func (d *DB) FindCaseByTags(tags []string) ([]Case, error) {
-	sel := `SELECT * FROM "cases" WHERE $1 <@ tags`
+	sel := `SELECT ` + caseColumns + ` FROM "cases" WHERE $1 <@ tags`
 	rows, err := d.DB.Query(sel, pq.Array(tags))
 	if err != nil {
 		return nil, err
@@ -185,7 +303,7 @@ func (d *DB) FindCaseByTags(tags []string) ([]Case, error) {
 	var cases []Case
 	for rows.Next() {
 		var cs Case
-		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags))
+		rErr := rows.Scan(&cs.ID, &cs.Name, pq.Array(&cs.Tags), &cs.StorageKey)
 		if rErr != nil {
 			return nil, err
 		}
@@ -195,9 +313,41 @@ func (d *DB) FindCaseByTags(tags []string) ([]Case, error) {
 }
 
 // CreateEvidence is used to create a new evidence in specific case in the database
-// It returns the new evidence ID
+// together with its first version and the folders it is in. It returns the new evidence ID
 func (d *DB) CreateEvidence(evidence *Evidence) (int64, error) {
-	err := d.DB.QueryRow(`INSERT INTO evidences (case_id, name, hash) VALUES ($1, $2, $3) RETURNING id;`, evidence.CaseID, evidence.Name, evidence.Hash).Scan(&evidence.ID)
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	err = removePresignedUpload(tx, evidence.PresignedUploadID)
+	if err != nil {
+		return 0, err
+	}
+	err = addFolders(tx, evidence.CaseID, evidence.Folder)
+	if err != nil {
+		return 0, err
+	}
+	hashes := evidence.Hashes
+	err = tx.QueryRow(`INSERT INTO evidences (case_id, name, folder, object_name, hash, md5, sha1, sha512, timestamp_token) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`,
+		evidence.CaseID, evidence.Name, evidence.Folder, evidence.Object(), evidence.Hash, hashes[HashMD5], hashes[HashSHA1], hashes[HashSHA512], evidence.TimestampToken).Scan(&evidence.ID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO "evidence_versions" ("evidence_id", "version", "hash", "md5", "sha1", "sha512", "object_name", "uploaded_by", "timestamp_token") VALUES ($1, 1, $2, $3, $4, $5, $6, $7, $8)`,
+		evidence.ID, evidence.Hash, hashes[HashMD5], hashes[HashSHA1], hashes[HashSHA512], evidence.Object(), evidence.UploadedBy, evidence.TimestampToken)
+	if err != nil {
+		return 0, err
+	}
+	if evidence.Custody != nil {
+		evidence.Custody.EvidenceID = evidence.ID
+		evidence.Custody.Version = 1
+	}
+	err = addCustodyEvent(tx, evidence.Custody)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return 0, err
 	}
@@ -207,7 +357,7 @@ func (d *DB) CreateEvidence(evidence *Evidence) (int64, error) {
 // GetEvidenceByID is used to get an evidence by its ID from specific case in the database
 func (d *DB) GetEvidenceByID(id int64, caseID int64) (*Evidence, error) {
 	var evidence Evidence
-	err := d.DB.QueryRow("SELECT id, case_id, name, hash FROM evidences WHERE id = $1 AND case_id = $2", id, caseID).Scan(&evidence.ID, &evidence.CaseID, &evidence.Name, &evidence.Hash)
+	err := scanEvidence(d.DB.QueryRow("SELECT "+evidenceColumns+" FROM evidences WHERE id = $1 AND case_id = $2", id, caseID), &evidence)
 	if err != nil {
 		return nil, err
 	}
@@ -215,17 +365,17 @@ func (d *DB) GetEvidenceByID(id int64, caseID int64) (*Evidence, error) {
 }
 
 // EvidenceExists is used to check if an evidence exists in the database,
-// evidence must contain a valid case ID in it
+// evidence must contain a valid case ID and its folder in it
 func (d *DB) EvidenceExists(evidence *Evidence) (bool, error) {
 	var count int
-	_ = d.DB.QueryRow("SELECT id FROM evidences WHERE case_id = $1 AND name = $2", evidence.CaseID, evidence.Name).Scan(&count)
+	_ = d.DB.QueryRow("SELECT id FROM evidences WHERE case_id = $1 AND folder = $2 AND name = $3", evidence.CaseID, evidence.Folder, evidence.Name).Scan(&count)
 	return count > 0, nil
 }
 
-// GetEvidenceByName is used to get an evidence by its name from specific case in the database
-func (d *DB) GetEvidenceByName(cs *Case, name string) (*Evidence, error) {
+// GetEvidenceByName is used to get an evidence by its name from a folder of specific case in the database
+func (d *DB) GetEvidenceByName(cs *Case, folder string, name string) (*Evidence, error) {
 	var object Evidence
-	err := d.DB.QueryRow("SELECT id, case_id, name, hash FROM evidences WHERE case_id = $1 AND name = $2", cs.ID, name).Scan(&object.ID, &object.CaseID, &object.Name, &object.Hash)
+	err := scanEvidence(d.DB.QueryRow("SELECT "+evidenceColumns+" FROM evidences WHERE case_id = $1 AND folder = $2 AND name = $3", cs.ID, folder, name), &object)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("%w :evidence not found: %q", ErrInvalidRequest, name)
@@ -248,17 +398,26 @@ func (d *DB) RemoveEvidence(evidence *Evidence) error {
 		return err
 	}
 
+	_, err = tx.Exec(`DELETE FROM "evidence_versions" WHERE evidence_id = $1`, evidence.ID)
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec(`DELETE FROM "evidences" WHERE id = $1 AND case_id = $2;`, evidence.ID, evidence.CaseID)
 	if err != nil {
 		return err
 	}
+	err = addCustodyEvent(tx, evidence.Custody)
+	if err != nil {
+		return err
+	}
 
 	return tx.Commit()
 }
 
 // GetEvidenceByCaseID is used to get all evidences from specific case in the database
 func (d *DB) GetEvidenceByCaseID(CaseID int64) ([]Evidence, error) {
-	rows, err := d.DB.Query(`SELECT id, case_id, name, hash FROM evidences WHERE case_id = $1;`, CaseID)
+	rows, err := d.DB.Query(`SELECT `+evidenceColumns+` FROM evidences WHERE case_id = $1;`, CaseID)
 	if err != nil {
 		return nil, err
 	}
@@ -267,7 +426,7 @@ func (d *DB) GetEvidenceByCaseID(CaseID int64) ([]Evidence, error) {
 	var evidences []Evidence
 	for rows.Next() {
 		var object Evidence
-		rErr := rows.Scan(&object.ID, &object.CaseID, &object.Name, &object.Hash)
+		rErr := scanEvidence(rows, &object)
 		if rErr != nil {
 			return nil, rErr
 		}
@@ -276,10 +435,124 @@ func (d *DB) GetEvidenceByCaseID(CaseID int64) ([]Evidence, error) {
 	return evidences, nil
 }
 
+// AddEvidenceVersion adds the next version of an evidence and makes its hash the
+// hash of the evidence. It sets the version number and creation time.
+func (d *DB) AddEvidenceVersion(version *EvidenceVersion) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// lock the evidence so concurrent uploads get different version numbers
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM "evidences" WHERE id = $1 FOR UPDATE`, version.EvidenceID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w : evidence id : %d", ErrNotFound, version.EvidenceID)
+		}
+		return err
+	}
+	err = removePresignedUpload(tx, version.PresignedUploadID)
+	if err != nil {
+		return err
+	}
+	hashes := version.Hashes
+	err = tx.QueryRow(`INSERT INTO "evidence_versions" ("evidence_id", "version", "hash", "md5", "sha1", "sha512", "object_name", "uploaded_by", "timestamp_token")
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, $8 FROM "evidence_versions" WHERE evidence_id = $1
+		RETURNING version, created_at`,
+		version.EvidenceID, version.Hash, hashes[HashMD5], hashes[HashSHA1], hashes[HashSHA512], version.ObjectName, version.UploadedBy, version.TimestampToken).Scan(&version.Version, &version.CreatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE "evidences" SET hash = $1, md5 = $2, sha1 = $3, sha512 = $4, timestamp_token = $5 WHERE id = $6`,
+		version.Hash, hashes[HashMD5], hashes[HashSHA1], hashes[HashSHA512], version.TimestampToken, version.EvidenceID)
+	if err != nil {
+		return err
+	}
+	if version.Custody != nil {
+		version.Custody.EvidenceID = version.EvidenceID
+		version.Custody.Version = version.Version
+	}
+	err = addCustodyEvent(tx, version.Custody)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetEvidenceVersion returns a version of an evidence or ErrNotFound
+func (d *DB) GetEvidenceVersion(evidenceID int64, version int64) (*EvidenceVersion, error) {
+	var v EvidenceVersion
+	err := scanVersion(d.DB.QueryRow(`SELECT `+versionColumns+` FROM "evidence_versions" WHERE evidence_id = $1 AND version = $2`, evidenceID, version), &v)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : version %d of evidence id : %d", ErrNotFound, version, evidenceID)
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListEvidenceVersions returns all versions of an evidence from the oldest to the newest
+func (d *DB) ListEvidenceVersions(evidenceID int64) ([]EvidenceVersion, error) {
+	rows, err := d.DB.Query(`SELECT `+versionColumns+` FROM "evidence_versions" WHERE evidence_id = $1 ORDER BY version`, evidenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []EvidenceVersion
+	for rows.Next() {
+		var v EvidenceVersion
+		err = scanVersion(rows, &v)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// FindEvidencesByHash returns the evidences of all cases with a version whose
+// content has the digest of the algorithm
+func (d *DB) FindEvidencesByHash(algorithm string, digest string) ([]Evidence, error) {
+	column, ok := hashColumns[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w : unsupported hash algorithm %q", ErrInvalidRequest, algorithm)
+	}
+	rows, err := d.DB.Query(`SELECT `+evidenceColumns+` FROM evidences
+		WHERE id IN (SELECT evidence_id FROM "evidence_versions" WHERE `+column+` = $1) ORDER BY id`, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var evidences []Evidence
+	for rows.Next() {
+		var ev Evidence
+		err = scanEvidence(rows, &ev)
+		if err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, ev)
+	}
+	return evidences, rows.Err()
+}
+
 //AddComment is used to add a comment to an evidence in the database
 func (d *DB) AddComment(comment *Comment) error {
-	_, err := d.DB.Exec(`INSERT INTO "comments" ("evidence_id", "content") VALUES ($1, $2 );`, comment.EvidenceID, comment.Text)
-	return err
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO "comments" ("evidence_id", "content") VALUES ($1, $2 );`, comment.EvidenceID, comment.Text)
+	if err != nil {
+		return err
+	}
+	err = addCustodyEvent(tx, comment.Custody)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 //GetCommentsByID is used to get all comments from an evidence in the database
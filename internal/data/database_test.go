@@ -1,4 +1,4 @@
-////go:build integration
+//go:build integration
 
 package data_test
 
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/miloszizic/der/internal/data"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -545,7 +546,7 @@ func TestGetEvidenceByNameRetrievedCorrectEvidence(t *testing.T) {
 			t.Errorf("creating the evidence failed: %v", err)
 		}
 	}
-	got, err := store.DBStore.GetEvidenceByName(testCase, "picture")
+	got, err := store.DBStore.GetEvidenceByName(testCase, "", "picture")
 	if err != nil {
 		t.Errorf("failed to get evidences by case ID: %v", err)
 	}
@@ -591,7 +592,7 @@ func TestGetEvidenceByNameReturnedErrorForMissingEvidence(t *testing.T) {
 			t.Errorf("creating the evidence failed: %v", err)
 		}
 	}
-	_, err = store.DBStore.GetEvidenceByName(testCase, "dog")
+	_, err = store.DBStore.GetEvidenceByName(testCase, "", "dog")
 	if errors.Is(err, data.ErrNotFound) {
 		t.Errorf("Expected ErrNotFound, got %v", err)
 	}
@@ -665,3 +666,100 @@ func TestAddCommentAddedCommentToTheEvidence(t *testing.T) {
 		t.Errorf(cmp.Diff(want, got))
 	}
 }
+
+func TestCustodyEventsRejectedDuplicateSeq(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("Error creating stores: %v", err)
+	}
+	event := &data.CustodyEvent{EvidenceID: 1, CaseID: 1, Action: data.CustodyUpload, Username: "clerk"}
+	err = store.RecordCustody(event)
+	if err != nil {
+		t.Fatalf("Error recording custody: %v", err)
+	}
+	custody := store.Custody.(*data.Custody)
+	_, err = custody.DB.Exec(`INSERT INTO "custody_events" ("seq", "evidence_id", "case_id", "action", "username", "created_at", "prev_hash", "entry_hash") VALUES ($1, 1, 1, $2, 'clerk', now(), '', '')`,
+		event.Seq, data.CustodyDownload)
+	if err == nil {
+		t.Errorf("expected the event with seq %d to be rejected", event.Seq)
+	}
+}
+
+func TestConcurrentCustodyEventsFormedOneChain(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("Error creating stores: %v", err)
+	}
+	errs := make([]error, 8)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.RecordCustody(&data.CustodyEvent{EvidenceID: int64(i + 1), CaseID: 1, Action: data.CustodyDownload, Username: "clerk"})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Error recording custody: %v", err)
+		}
+	}
+	report, err := store.VerifyAuditLog()
+	if err != nil {
+		t.Fatalf("Error verifying audit log: %v", err)
+	}
+	if !report.Valid || report.Entries != len(errs) || report.LastSeq != int64(len(errs)) {
+		t.Errorf("expected one valid chain of %d entries, got %+v", len(errs), report)
+	}
+}
+
+func TestAddUserIdentityRolledBackUserOfLinkedIdentity(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("Error creating stores: %v", err)
+	}
+	for i, username := range []string{"clerk", "other"} {
+		user := &data.User{Username: username, Role: data.RoleClerk}
+		err = user.Password.Set("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Identities.AddUserIdentity(user, &data.Identity{Issuer: "https://id.example.gov", Subject: "1001"})
+		if i == 0 && err != nil {
+			t.Fatalf("Error adding user with identity: %v", err)
+		}
+		if i == 1 && !errors.Is(err, data.ErrAlreadyExists) {
+			t.Errorf("expected error %v for a linked identity, got %v", data.ErrAlreadyExists, err)
+		}
+	}
+	_, err = store.User.GetByUsername("other")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the user of the linked identity to be rolled back, got %v", err)
+	}
+}
+
+func TestAddUserIdentityOfTakenUsernameReturnedConflict(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("Error creating stores: %v", err)
+	}
+	for i, subject := range []string{"1001", "1002"} {
+		user := &data.User{Username: "clerk", Role: data.RoleClerk}
+		err = user.Password.Set("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Identities.AddUserIdentity(user, &data.Identity{Issuer: "https://id.example.gov", Subject: subject})
+		if i == 0 && err != nil {
+			t.Fatalf("Error adding user with identity: %v", err)
+		}
+		if i == 1 && !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected error %v for a taken username, got %v", data.ErrConflict, err)
+		}
+	}
+	_, err = store.Identities.GetIdentity("https://id.example.gov", "1002")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected the identity of the taken username not to be linked, got %v", err)
+	}
+}
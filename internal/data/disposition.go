@@ -0,0 +1,297 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DispositionMethod is the method recorded in destruction certificates, evidences
+// are made unreadable by destroying the data key of the case
+const DispositionMethod = "crypto-shredding"
+
+// destructionScope states in certificates what a disposition destroys. The data
+// key is only deleted from the live database, copies of it in database backups
+// can still be unwrapped with the master key until that key is retired.
+const destructionScope = "The data key of the case was deleted from the database and its evidence objects were removed from the object store. " +
+	"Database backups taken before the disposition still hold the data key wrapped with master key %q, " +
+	"the evidences are unrecoverable only once that master key is destroyed."
+
+// DestroyedEvidence is an evidence version listed in a destruction certificate
+type DestroyedEvidence struct {
+	Folder  string `json:"folder,omitempty"`
+	Name    string `json:"name"`
+	Version int64  `json:"version,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// DestructionStatement is the signed content of a destruction certificate
+type DestructionStatement struct {
+	CaseID     int64               `json:"case_id"`
+	CaseName   string              `json:"case_name"`
+	Evidences  []DestroyedEvidence `json:"evidences"`
+	Method     string              `json:"method"`
+	DisposedBy string              `json:"disposed_by"`
+	DisposedAt time.Time           `json:"disposed_at"`
+	// Destroyed states exactly what was destroyed and what can still recover it
+	Destroyed string `json:"destroyed"`
+	// MasterKeyID is the master key that wrapped the data key of the case
+	MasterKeyID string `json:"master_key_id"`
+	KeyID       string `json:"key_id"`
+}
+
+// DestructionCertificate proves that the evidences of a case were destroyed.
+// Statement is the exact JSON that was signed, the signature can be verified
+// with the public key of the signing key named in the statement.
+type DestructionCertificate struct {
+	ID int64 `json:"id"`
+	DestructionStatement
+	Statement string `json:"statement"`
+	Signature []byte `json:"signature"`
+}
+
+// CertificateStore keeps destruction certificates, they are never removed and
+// outlive the cases they are about
+type CertificateStore interface {
+	AddCertificate(cert *DestructionCertificate) error
+	GetCertificate(id int64) (*DestructionCertificate, error)
+	GetCertificateByCaseID(caseID int64) (*DestructionCertificate, error)
+	ListCertificates() ([]DestructionCertificate, error)
+}
+
+type Certificates struct {
+	DB *sql.DB
+}
+
+func NewCertificateStore(db *sql.DB) CertificateStore {
+	return &Certificates{
+		DB: db,
+	}
+}
+
+// AddCertificate stores a signed certificate and sets its ID
+func (c *Certificates) AddCertificate(cert *DestructionCertificate) error {
+	err := c.DB.QueryRow(`INSERT INTO "destruction_certificates" ("case_id", "case_name", "statement", "signature") VALUES ($1, $2, $3, $4) RETURNING id`,
+		cert.CaseID, cert.CaseName, cert.Statement, cert.Signature).Scan(&cert.ID)
+	if err != nil {
+		return fmt.Errorf("inserting destruction certificate : %w", err)
+	}
+	return nil
+}
+
+// GetCertificate returns a certificate by its ID or ErrNotFound
+func (c *Certificates) GetCertificate(id int64) (*DestructionCertificate, error) {
+	row := c.DB.QueryRow(`SELECT "id", "statement", "signature" FROM "destruction_certificates" WHERE id = $1`, id)
+	cert, err := scanCertificate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : certificate id : %d", ErrNotFound, id)
+	}
+	return cert, err
+}
+
+// GetCertificateByCaseID returns the certificate of a case or ErrNotFound
+func (c *Certificates) GetCertificateByCaseID(caseID int64) (*DestructionCertificate, error) {
+	row := c.DB.QueryRow(`SELECT "id", "statement", "signature" FROM "destruction_certificates" WHERE case_id = $1`, caseID)
+	cert, err := scanCertificate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : certificate for case id : %d", ErrNotFound, caseID)
+	}
+	return cert, err
+}
+
+// ListCertificates returns all certificates ordered by ID
+func (c *Certificates) ListCertificates() ([]DestructionCertificate, error) {
+	rows, err := c.DB.Query(`SELECT "id", "statement", "signature" FROM "destruction_certificates" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var certs []DestructionCertificate
+	for rows.Next() {
+		cert, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, *cert)
+	}
+	return certs, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCertificate(row scanner) (*DestructionCertificate, error) {
+	cert := &DestructionCertificate{}
+	err := row.Scan(&cert.ID, &cert.Statement, &cert.Signature)
+	if err != nil {
+		return nil, err
+	}
+	err = cert.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// parseStatement fills the certificate fields from the signed statement
+func (c *DestructionCertificate) parseStatement() error {
+	err := json.Unmarshal([]byte(c.Statement), &c.DestructionStatement)
+	if err != nil {
+		return fmt.Errorf("reading certificate statement : %w", err)
+	}
+	return nil
+}
+
+// NewDestructionCertificate signs the statement and returns the certificate
+func NewDestructionCertificate(statement DestructionStatement, signer *Signer) (*DestructionCertificate, error) {
+	statement.KeyID = signer.KeyID()
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	cert := &DestructionCertificate{
+		Statement: string(body),
+		Signature: signer.Sign(body),
+	}
+	err = cert.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// DisposeCase destroys a case at the end of its retention. The data key of the
+// case is deleted, which makes every copy of its evidences in the object store
+// unreadable, and a signed certificate listing the destroyed evidences is kept.
+// Database backups keep the wrapped data key, the certificate names the master
+// key that has to be retired before the evidences are unrecoverable. The evidences and
+// the case are removed afterwards, if that fails the disposition can be repeated
+// and the existing certificate is returned. The destruction is added to the chain
+// of custody of every evidence. Cases under legal hold are refused.
+func (s *Stores) DisposeCase(name string, username string) (*DestructionCertificate, error) {
+	if s.Signer == nil {
+		return nil, fmt.Errorf("%w : signing key is not configured", ErrInvalidRequest)
+	}
+	shredder, ok := s.ObjectStore.(KeyShredder)
+	if !ok {
+		return nil, fmt.Errorf("%w : evidence encryption is not enabled", ErrInvalidRequest)
+	}
+	cs, err := s.DBStore.GetCaseByName(name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : case name : %q ", ErrNotFound, name)
+		}
+		return nil, fmt.Errorf("getting case from DB : %w", err)
+	}
+	// the key must not be destroyed while the case is under legal hold
+	err = s.checkCaseHolds(cs)
+	if err != nil {
+		return nil, err
+	}
+	evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidences from DB : %w", err)
+	}
+	err = s.liftExpiredHolds(cs, evidences)
+	if err != nil {
+		return nil, err
+	}
+	masterKeyID, err := shredder.CaseKeyID(cs.Bucket())
+	if err != nil {
+		return nil, fmt.Errorf("checking case key : %w", err)
+	}
+	hasKey := masterKeyID != ""
+	cert, err := s.Certificates.GetCertificateByCaseID(cs.ID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if !hasKey {
+			return nil, fmt.Errorf("%w : case %q is not encrypted and can't be crypto-shredded", ErrInvalidRequest, cs.Name)
+		}
+		cert, err = s.certifyDestruction(cs, evidences, username, masterKeyID)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("getting destruction certificate : %w", err)
+	}
+	if hasKey {
+		err = shredder.DestroyCaseKey(cs.Bucket())
+		if err != nil {
+			return nil, fmt.Errorf("destroying case key : %w", err)
+		}
+	}
+	for i := range evidences {
+		objectNames, err := s.evidenceObjectNames(&evidences[i])
+		if err != nil {
+			return nil, err
+		}
+		evidences[i].Custody = custodyEvent(&CustodyEvent{
+			Username: username,
+			Detail:   fmt.Sprintf("%s, certificate %d", DispositionMethod, cert.ID),
+		}, CustodyDestroy, &evidences[i])
+		err = s.DBStore.RemoveEvidence(&evidences[i])
+		if err != nil {
+			return nil, fmt.Errorf("removing evidence from DB: %w , evidence name: %q ", err, evidences[i].Name)
+		}
+		for _, name := range objectNames {
+			err = s.ObjectStore.RemoveEvidence(&Evidence{ID: evidences[i].ID, CaseID: cs.ID, Name: name}, cs.Bucket())
+			if err != nil {
+				return nil, fmt.Errorf("removing evidence from object store: %w , evidence name: %q ", err, evidences[i].Name)
+			}
+		}
+	}
+	err = s.RemoveCase(cs.Name)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// certifyDestruction signs and stores the certificate for every version of the
+// evidences of a case whose data key is wrapped with the master key
+func (s *Stores) certifyDestruction(cs *Case, evidences []Evidence, username string, masterKeyID string) (*DestructionCertificate, error) {
+	destroyed := []DestroyedEvidence{}
+	for i := range evidences {
+		versions, err := s.ListEvidenceVersions(&evidences[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			destroyed = append(destroyed, DestroyedEvidence{Folder: evidences[i].Folder, Name: evidences[i].Name, Hash: evidences[i].Hash})
+		}
+		for _, v := range versions {
+			destroyed = append(destroyed, DestroyedEvidence{Folder: evidences[i].Folder, Name: evidences[i].Name, Version: v.Version, Hash: v.Hash})
+		}
+	}
+	sort.Slice(destroyed, func(i, j int) bool {
+		if destroyed[i].Folder != destroyed[j].Folder {
+			return destroyed[i].Folder < destroyed[j].Folder
+		}
+		if destroyed[i].Name != destroyed[j].Name {
+			return destroyed[i].Name < destroyed[j].Name
+		}
+		return destroyed[i].Version < destroyed[j].Version
+	})
+	cert, err := NewDestructionCertificate(DestructionStatement{
+		CaseID:      cs.ID,
+		CaseName:    cs.Name,
+		Evidences:   destroyed,
+		Method:      DispositionMethod,
+		DisposedBy:  username,
+		DisposedAt:  time.Now().UTC().Truncate(time.Second),
+		Destroyed:   fmt.Sprintf(destructionScope, masterKeyID),
+		MasterKeyID: masterKeyID,
+	}, s.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("signing destruction certificate : %w", err)
+	}
+	err = s.Certificates.AddCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
@@ -0,0 +1,213 @@
+package data_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+func getTestSigner(t *testing.T) *data.Signer {
+	signer, err := data.NewSigner(data.SigningConfig{
+		PrivateKey: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)),
+		KeyID:      "test",
+	})
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// getTestDispositionStores returns in-memory stores with encryption and signing
+// enabled and a case named test with two evidences
+func getTestDispositionStores(t *testing.T) (data.Stores, data.KeyStore) {
+	stores := memstore.NewStores()
+	keys := memstore.NewKeyStore()
+	keyring := getTestKeyring(t, data.EncryptionConfig{MasterKey: testMasterKey(1), MasterKeyID: "first"})
+	stores.ObjectStore = data.NewEncryptedStore(stores.ObjectStore, keys, keyring)
+	stores.Signer = getTestSigner(t)
+	err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.CreateCase(user, "test")
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"video", "picture"} {
+		err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: name, File: strings.NewReader(name)}, cs)
+		if err != nil {
+			t.Fatalf("failed to create evidence: %v", err)
+		}
+	}
+	return stores, keys
+}
+
+func TestDisposeCaseDestroyedKeyAndIssuedSignedCertificate(t *testing.T) {
+	stores, keys := getTestDispositionStores(t)
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := stores.DisposeCase("test", "judge")
+	if err != nil {
+		t.Fatalf("failed to dispose case: %v", err)
+	}
+	var names []string
+	for _, ev := range cert.Evidences {
+		names = append(names, ev.Name)
+	}
+	want := []string{"picture", "video"}
+	if !cmp.Equal(want, names) {
+		t.Errorf(cmp.Diff(want, names))
+	}
+	if cert.Method != data.DispositionMethod || cert.DisposedBy != "judge" || cert.KeyID != "test" {
+		t.Errorf("unexpected certificate statement %+v", cert.DestructionStatement)
+	}
+	// backups hold the data key wrapped with the master key, so it must be named
+	if cert.MasterKeyID != "first" || !strings.Contains(cert.Destroyed, `master key "first"`) {
+		t.Errorf("expected the certificate to name the master key of the case, got %q, %q", cert.MasterKeyID, cert.Destroyed)
+	}
+	if !stores.Signer.Verify([]byte(cert.Statement), cert.Signature) {
+		t.Errorf("expected certificate signature to verify")
+	}
+	_, err = keys.GetCaseKey(cs.Bucket())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected case key to be destroyed, got %v", err)
+	}
+	exists, err := stores.DBStore.CaseExists("test")
+	if err != nil || exists {
+		t.Errorf("expected case to be removed, got %v, %v", exists, err)
+	}
+	stored, err := stores.Certificates.GetCertificate(cert.ID)
+	if err != nil {
+		t.Fatalf("expected certificate to be kept after the case is removed, got %v", err)
+	}
+	if !cmp.Equal(cert, stored) {
+		t.Errorf(cmp.Diff(cert, stored))
+	}
+}
+
+func TestDisposeCaseListedHashesOfEvidences(t *testing.T) {
+	stores, _ := getTestDispositionStores(t)
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	evidences, err := stores.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]string{}
+	for _, ev := range evidences {
+		hashes[ev.Name] = ev.Hash
+	}
+	cert, err := stores.DisposeCase("test", "judge")
+	if err != nil {
+		t.Fatalf("failed to dispose case: %v", err)
+	}
+	for _, ev := range cert.Evidences {
+		if ev.Hash == "" || ev.Hash != hashes[ev.Name] {
+			t.Errorf("expected hash %q for %q, got %q", hashes[ev.Name], ev.Name, ev.Hash)
+		}
+	}
+}
+
+func TestDisposeCaseFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(stores *data.Stores)
+		dispose string
+		want    error
+	}{
+		{
+			name:    "with case that doesn't exist",
+			prepare: func(stores *data.Stores) {},
+			dispose: "missing",
+			want:    data.ErrNotFound,
+		},
+		{
+			name:    "without a signing key",
+			prepare: func(stores *data.Stores) { stores.Signer = nil },
+			dispose: "test",
+			want:    data.ErrInvalidRequest,
+		},
+		{
+			name: "without encryption",
+			prepare: func(stores *data.Stores) {
+				stores.ObjectStore = stores.ObjectStore.(*data.EncryptedStore).ObjectStore
+			},
+			dispose: "test",
+			want:    data.ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, _ := getTestDispositionStores(t)
+			tt.prepare(&stores)
+			_, err := stores.DisposeCase(tt.dispose, "judge")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDisposeCaseRefusedCaseCreatedWithoutEncryption(t *testing.T) {
+	stores, _ := getTestDispositionStores(t)
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the case is only in the underlying store, so it has no data key
+	err = stores.ObjectStore.(*data.EncryptedStore).ObjectStore.CreateCase(&data.Case{Name: "plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.DBStore.AddCase(&data.Case{Name: "plain"}, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stores.DisposeCase("plain", "judge")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func TestDisposeCaseListedEveryEvidenceVersion(t *testing.T) {
+	stores, _ := getTestDispositionStores(t)
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: strings.NewReader("edited")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence version: %v", err)
+	}
+	cert, err := stores.DisposeCase("test", "judge")
+	if err != nil {
+		t.Fatalf("failed to dispose case: %v", err)
+	}
+	var got []string
+	for _, ev := range cert.Evidences {
+		got = append(got, fmt.Sprintf("%s/%d", ev.Name, ev.Version))
+	}
+	want := []string{"picture/1", "video/1", "video/2"}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,650 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Evidence objects of encrypted cases are stored as a header followed by
+// segments. The header holds a random salt that derives a key for the object
+// from the case data key, every segment holds up to segmentSize bytes of
+// plaintext sealed with AES-256-GCM. The nonce is the segment number and a flag
+// for the last segment, so segments can't be reordered or dropped.
+const (
+	encryptionMagic = "DERENC01"
+	saltSize        = 32
+	segmentSize     = 64 * 1024
+	dataKeySize     = 32
+	headerSize      = len(encryptionMagic) + saltSize
+)
+
+// KeyRotator is implemented by object stores that encrypt evidences
+type KeyRotator interface {
+	RotateMasterKey() (int, error)
+}
+
+// KeyShredder is implemented by object stores that can destroy the data key of a
+// case, after that its evidences can't be decrypted with the live database.
+// CaseKeyID returns the id of the master key that wraps the data key of a case
+// and an empty id for cases that are not encrypted.
+type KeyShredder interface {
+	CaseKeyID(caseName string) (string, error)
+	DestroyCaseKey(caseName string) error
+}
+
+// Keyring holds the master keys that wrap the case data keys, new data keys are
+// always wrapped with the current key and the previous keys are only used to unwrap.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring from the encryption config, keys are base64
+// encoded 256 bit keys.
+func NewKeyring(config EncryptionConfig) (*Keyring, error) {
+	if config.MasterKeyID == "" {
+		return nil, fmt.Errorf("%w : master key id is missing", ErrInvalidRequest)
+	}
+	k := &Keyring{current: config.MasterKeyID, keys: map[string]cipher.AEAD{}}
+	err := k.add(config.MasterKeyID, config.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range strings.Split(config.PreviousKeys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w : previous keys must be id:key pairs", ErrInvalidRequest)
+		}
+		if _, exists := k.keys[id]; exists {
+			return nil, fmt.Errorf("%w : master key id %q is used twice", ErrInvalidRequest, id)
+		}
+		err = k.add(id, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(id, encoded string) error {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != dataKeySize {
+		return fmt.Errorf("%w : master key %q must be 32 base64 encoded bytes", ErrInvalidRequest, id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	k.keys[id] = aead
+	return nil
+}
+
+// CurrentID returns the id of the key used to wrap new data keys
+func (k *Keyring) CurrentID() string {
+	return k.current
+}
+
+// Wrap encrypts the data key of a case with the current master key, the case
+// name is authenticated so a wrapped key can't be moved to another case.
+func (k *Keyring) Wrap(caseName string, dataKey []byte) (*CaseKey, error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &CaseKey{
+		CaseName:    caseName,
+		WrappedKey:  aead.Seal(nonce, nonce, dataKey, []byte(caseName)),
+		MasterKeyID: k.current,
+	}, nil
+}
+
+// Unwrap decrypts the data key of a case with the master key it was wrapped with
+func (k *Keyring) Unwrap(key *CaseKey) ([]byte, error) {
+	aead, ok := k.keys[key.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q of case %q is not configured", key.MasterKeyID, key.CaseName)
+	}
+	if len(key.WrappedKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w : wrapped key of case %q", ErrIntegrity, key.CaseName)
+	}
+	nonce, sealed := key.WrappedKey[:aead.NonceSize()], key.WrappedKey[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(key.CaseName))
+	if err != nil {
+		return nil, fmt.Errorf("%w : wrapped key of case %q", ErrIntegrity, key.CaseName)
+	}
+	return dataKey, nil
+}
+
+// EncryptedStore is an ObjectStore that encrypts evidences before they are
+// written to the underlying store. Every case gets its own data key, cases that
+// were created before encryption was enabled have no key and stay in plaintext.
+type EncryptedStore struct {
+	ObjectStore
+	Keys    KeyStore
+	Keyring *Keyring
+}
+
+// NewEncryptedStore wraps an ObjectStore with envelope encryption
+func NewEncryptedStore(obs ObjectStore, keys KeyStore, keyring *Keyring) ObjectStore {
+	return &EncryptedStore{
+		ObjectStore: obs,
+		Keys:        keys,
+		Keyring:     keyring,
+	}
+}
+
+// CreateCase creates the case and a new data key for it
+func (e *EncryptedStore) CreateCase(cs *Case) error {
+	err := e.ObjectStore.CreateCase(cs)
+	if err != nil {
+		return err
+	}
+	dataKey := make([]byte, dataKeySize)
+	_, err = rand.Read(dataKey)
+	if err == nil {
+		err = e.addKey(cs.Bucket(), dataKey)
+	}
+	if err != nil {
+		errR := e.ObjectStore.RemoveCase(cs.Bucket())
+		if errR != nil {
+			return fmt.Errorf("creating case key : %w, removing case from object store : %v", err, errR)
+		}
+		return fmt.Errorf("creating case key : %w", err)
+	}
+	return nil
+}
+
+// addKey stores the wrapped data key, a key left from an earlier case with the
+// same name is replaced as the case was just created empty
+func (e *EncryptedStore) addKey(caseName string, dataKey []byte) error {
+	key, err := e.Keyring.Wrap(caseName, dataKey)
+	if err != nil {
+		return err
+	}
+	err = e.Keys.RemoveCaseKey(caseName)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return e.Keys.AddCaseKey(key)
+}
+
+// RemoveCase removes the case and its data key
+func (e *EncryptedStore) RemoveCase(name string) error {
+	err := e.ObjectStore.RemoveCase(name)
+	if err != nil {
+		return err
+	}
+	err = e.Keys.RemoveCaseKey(name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("removing case key : %w", err)
+	}
+	return nil
+}
+
+// CreateEvidence encrypts the evidence while it is written and returns the
+// SHA256 hash of the plaintext
+func (e *EncryptedStore) CreateEvidence(evidence *Evidence, caseName string, file io.Reader) (string, error) {
+	if file == nil {
+		return "", fmt.Errorf("%w : evidence file is missing", ErrInvalidRequest)
+	}
+	dataKey, err := e.dataKey(caseName)
+	if err != nil {
+		return "", err
+	}
+	if dataKey == nil {
+		return e.ObjectStore.CreateEvidence(evidence, caseName, file)
+	}
+	h := sha256.New()
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := encryptStream(pw, io.TeeReader(file, h), dataKey)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	_, err = e.ObjectStore.CreateEvidence(evidence, caseName, pr)
+	pr.CloseWithError(errors.New("object store stopped reading"))
+	errE := <-done
+	if err != nil {
+		return "", err
+	}
+	if errE != nil {
+		errR := e.ObjectStore.RemoveEvidence(evidence, caseName)
+		if errR != nil {
+			return "", fmt.Errorf("encrypting evidence : %w, removing evidence : %v", errE, errR)
+		}
+		return "", fmt.Errorf("encrypting evidence : %w", errE)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GetEvidence returns a reader that decrypts the evidence while it is read
+func (e *EncryptedStore) GetEvidence(caseName string, evidenceName string) (io.ReadCloser, error) {
+	dataKey, err := e.dataKey(caseName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := e.ObjectStore.GetEvidence(caseName, evidenceName)
+	if err != nil || dataKey == nil {
+		return file, err
+	}
+	return newDecryptReader(file, dataKey), nil
+}
+
+// HasCaseKey returns true if the case has a data key, cases without one are not encrypted
+func (e *EncryptedStore) HasCaseKey(caseName string) (bool, error) {
+	_, err := e.Keys.GetCaseKey(caseName)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CaseKeyID returns the id of the master key that wraps the data key of a case,
+// the id is empty when the case is not encrypted
+func (e *EncryptedStore) CaseKeyID(caseName string) (string, error) {
+	key, err := e.Keys.GetCaseKey(caseName)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return key.MasterKeyID, nil
+}
+
+// DestroyCaseKey removes the data key of a case, the objects of the case stay in
+// the object store but can't be decrypted anymore. Copies of the wrapped key in
+// database backups can be unwrapped until their master key is retired.
+func (e *EncryptedStore) DestroyCaseKey(caseName string) error {
+	return e.Keys.RemoveCaseKey(caseName)
+}
+
+// SetLegalHold passes the legal hold to the wrapped store when it supports legal holds
+func (e *EncryptedStore) SetLegalHold(caseName string, objectName string, enabled bool) error {
+	holder, ok := e.ObjectStore.(LegalHolder)
+	if !ok {
+		return nil
+	}
+	return holder.SetLegalHold(caseName, objectName, enabled)
+}
+
+// PresignGet passes the request to the wrapped store, evidences of encrypted
+// cases can't be downloaded directly as the object store only has the ciphertext
+func (e *EncryptedStore) PresignGet(caseName string, objectName string, filename string, expiry time.Duration) (string, error) {
+	presigner, err := e.plaintextPresigner(caseName)
+	if err != nil {
+		return "", err
+	}
+	return presigner.PresignGet(caseName, objectName, filename, expiry)
+}
+
+// PresignPut passes the request to the wrapped store, evidences of encrypted
+// cases can't be uploaded directly as they would be stored in plaintext
+func (e *EncryptedStore) PresignPut(caseName string, objectName string, expiry time.Duration) (string, error) {
+	presigner, err := e.plaintextPresigner(caseName)
+	if err != nil {
+		return "", err
+	}
+	return presigner.PresignPut(caseName, objectName, expiry)
+}
+
+// CopyObject passes the copy to the wrapped store for cases that are not encrypted,
+// objects are only copied to complete presigned uploads and those are refused
+// for encrypted cases
+func (e *EncryptedStore) CopyObject(caseName string, srcName string, dstName string) error {
+	copier, ok := e.ObjectStore.(ObjectCopier)
+	if !ok {
+		return fmt.Errorf("%w : object store doesn't copy objects", ErrInvalidRequest)
+	}
+	encrypted, err := e.HasCaseKey(caseName)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return fmt.Errorf("%w : objects of encrypted case %q can't be copied", ErrConflict, caseName)
+	}
+	return copier.CopyObject(caseName, srcName, dstName)
+}
+
+// plaintextPresigner returns the Presigner of the wrapped store for cases that are
+// not encrypted. With encryption enabled every new case is encrypted, so presigned
+// URLs only work for cases created before it was enabled and the other cases
+// get ErrConflict.
+func (e *EncryptedStore) plaintextPresigner(caseName string) (Presigner, error) {
+	presigner, ok := e.ObjectStore.(Presigner)
+	if !ok {
+		return nil, fmt.Errorf("%w : object store doesn't support presigned URLs", ErrInvalidRequest)
+	}
+	encrypted, err := e.HasCaseKey(caseName)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return nil, fmt.Errorf("%w : evidences of encrypted case %q can't be transferred with presigned URLs, use the evidence and resumable upload endpoints", ErrConflict, caseName)
+	}
+	return presigner, nil
+}
+
+// RotateMasterKey wraps all data keys that are not wrapped with the current
+// master key again, object bodies are not rewritten. It returns the number of
+// rewrapped keys.
+func (e *EncryptedStore) RotateMasterKey() (int, error) {
+	keys, err := e.Keys.ListCaseKeys()
+	if err != nil {
+		return 0, fmt.Errorf("listing case keys : %w", err)
+	}
+	rotated := 0
+	for i := range keys {
+		if keys[i].MasterKeyID == e.Keyring.CurrentID() {
+			continue
+		}
+		dataKey, err := e.Keyring.Unwrap(&keys[i])
+		if err != nil {
+			return rotated, err
+		}
+		key, err := e.Keyring.Wrap(keys[i].CaseName, dataKey)
+		if err != nil {
+			return rotated, err
+		}
+		err = e.Keys.UpdateCaseKey(key)
+		if err != nil {
+			return rotated, fmt.Errorf("updating key of case %q : %w", key.CaseName, err)
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// dataKey returns the unwrapped data key of a case or nil when the case is not encrypted
+func (e *EncryptedStore) dataKey(caseName string) ([]byte, error) {
+	key, err := e.Keys.GetCaseKey(caseName)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return e.Keyring.Unwrap(key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// objectAEAD derives the key of a single object from the case data key and the object salt
+func objectAEAD(dataKey, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, dataKeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, dataKey, salt, []byte("der evidence")), key)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key)
+}
+
+func segmentNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptStream writes the encrypted form of src to dst
+func encryptStream(dst io.Writer, src io.Reader, dataKey []byte) error {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	aead, err := objectAEAD(dataKey, salt)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(append([]byte(encryptionMagic), salt...))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, segmentSize)
+	next := make([]byte, segmentSize)
+	sealed := make([]byte, 0, segmentSize+aead.Overhead())
+	n, err := io.ReadFull(src, buf)
+	for counter := uint64(0); ; counter++ {
+		// a segment is the last one when nothing follows it, so one segment is read ahead
+		last := false
+		var m int
+		var nextErr error
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			last = true
+		case err != nil:
+			return err
+		default:
+			m, nextErr = io.ReadFull(src, next)
+			if m == 0 && errors.Is(nextErr, io.EOF) {
+				last = true
+			}
+		}
+		sealed = aead.Seal(sealed[:0], segmentNonce(counter, last), buf[:n], nil)
+		_, err = dst.Write(sealed)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		buf, next = next, buf
+		n, err = m, nextErr
+	}
+}
+
+// decryptReader decrypts an encrypted object segment by segment. When the object
+// is seekable the reader is seekable too, only the segment holding the new
+// position is decrypted so ranges of large evidences can be read.
+type decryptReader struct {
+	src     io.ReadCloser
+	dataKey []byte
+	aead    cipher.AEAD
+	counter uint64
+	sealed  []byte
+	buf     []byte
+	plain   []byte
+	done    bool
+	err     error
+	pos     int64
+	seek    bool
+	size    int64
+}
+
+func newDecryptReader(src io.ReadCloser, dataKey []byte) *decryptReader {
+	return &decryptReader{src: src, dataKey: dataKey, size: -1}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.seek {
+		d.seek = false
+		d.err = d.seekSegment()
+	}
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	d.pos += int64(n)
+	return n, nil
+}
+
+// Seek sets the plaintext offset of the next Read
+func (d *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := d.src.(io.Seeker)
+	if !ok {
+		return 0, errors.New("evidence object is not seekable")
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		size, err := d.plainSize(seeker)
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != d.pos {
+		d.pos = offset
+		d.seek = true
+	}
+	return offset, nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.src.Close()
+}
+
+// seekSegment decrypts the segment holding the current position
+func (d *decryptReader) seekSegment() error {
+	seeker := d.src.(io.Seeker)
+	size, err := d.plainSize(seeker)
+	if err != nil {
+		return err
+	}
+	d.seek = false
+	d.plain = nil
+	d.done = false
+	if d.pos >= size {
+		d.done = true
+		return nil
+	}
+	segment := d.pos / segmentSize
+	_, err = seeker.Seek(int64(headerSize)+segment*int64(segmentSize+d.aead.Overhead()), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	d.counter = uint64(segment)
+	err = d.next()
+	if err != nil {
+		return err
+	}
+	d.plain = d.plain[d.pos-segment*segmentSize:]
+	return nil
+}
+
+// plainSize returns the size of the plaintext, it is computed from the size of
+// the object as every segment but the last one is full
+func (d *decryptReader) plainSize(seeker io.Seeker) (int64, error) {
+	if d.size >= 0 {
+		return d.size, nil
+	}
+	if d.aead == nil {
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+		err = d.readHeader()
+		if err != nil {
+			return 0, err
+		}
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	sealedSize := int64(segmentSize + d.aead.Overhead())
+	body := end - int64(headerSize)
+	segments := (body + sealedSize - 1) / sealedSize
+	size := body - segments*int64(d.aead.Overhead())
+	if body <= 0 || size < 0 {
+		return 0, fmt.Errorf("%w : evidence is truncated", ErrIntegrity)
+	}
+	d.size = size
+	// the object is read from the position of the reader again
+	d.seek = true
+	return size, nil
+}
+
+// readHeader reads the object header and derives the key of the object
+func (d *decryptReader) readHeader() error {
+	header := make([]byte, headerSize)
+	_, err := io.ReadFull(d.src, header)
+	if err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return fmt.Errorf("%w : evidence is not encrypted", ErrIntegrity)
+	}
+	d.aead, err = objectAEAD(d.dataKey, header[len(encryptionMagic):])
+	if err != nil {
+		return err
+	}
+	d.sealed = make([]byte, segmentSize+d.aead.Overhead())
+	d.buf = make([]byte, 0, segmentSize)
+	return nil
+}
+
+// next decrypts the next segment into plain
+func (d *decryptReader) next() error {
+	if d.aead == nil {
+		err := d.readHeader()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := io.ReadFull(d.src, d.sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w : evidence is truncated", ErrIntegrity)
+		}
+		return err
+	}
+	// a full segment may still be the last one
+	plain, errO := d.aead.Open(d.buf[:0], segmentNonce(d.counter, false), d.sealed[:n], nil)
+	if errO != nil {
+		plain, errO = d.aead.Open(d.buf[:0], segmentNonce(d.counter, true), d.sealed[:n], nil)
+		if errO != nil {
+			return fmt.Errorf("%w : evidence segment %d can't be decrypted", ErrIntegrity, d.counter)
+		}
+		d.done = true
+		extra, _ := d.src.Read(make([]byte, 1))
+		if extra > 0 {
+			return fmt.Errorf("%w : evidence has data after the last segment", ErrIntegrity)
+		}
+	}
+	d.plain = plain
+	d.counter++
+	return nil
+}
@@ -0,0 +1,328 @@
+package data_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+	"github.com/miloszizic/der/internal/data/storetest"
+)
+
+// testMasterKey returns a base64 encoded master key filled with one byte
+func testMasterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func getTestKeyring(t *testing.T, config data.EncryptionConfig) *data.Keyring {
+	keyring, err := data.NewKeyring(config)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+// getTestEncryptedStore returns an EncryptedStore over in-memory stores and the stores it wraps
+func getTestEncryptedStore(t *testing.T) (data.ObjectStore, data.ObjectStore, data.KeyStore) {
+	obs := memstore.NewObjectStore()
+	keys := memstore.NewKeyStore()
+	keyring := getTestKeyring(t, data.EncryptionConfig{MasterKey: testMasterKey(1), MasterKeyID: "first"})
+	return data.NewEncryptedStore(obs, keys, keyring), obs, keys
+}
+
+// readTestEvidence reads the whole content of an evidence
+func readTestEvidence(t *testing.T, obs data.ObjectStore, caseName, name string) ([]byte, error) {
+	file, err := obs.GetEvidence(caseName, name)
+	if err != nil {
+		t.Fatalf("failed to get evidence: %v", err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func TestEncryptedStoreConformance(t *testing.T) {
+	storetest.RunObjectStoreSuite(t, func(t *testing.T) data.ObjectStore {
+		obs, _, _ := getTestEncryptedStore(t)
+		return obs
+	})
+}
+
+func TestEncryptedStoreStoredCiphertextAndReturnedPlaintextHash(t *testing.T) {
+	sizes := []int{0, 1, 64*1024 - 1, 64 * 1024, 64*1024 + 1, 3 * 64 * 1024}
+	for _, size := range sizes {
+		obs, inner, _ := getTestEncryptedStore(t)
+		err := obs.CreateCase(&data.Case{Name: "testcase"})
+		if err != nil {
+			t.Fatalf("failed to create case: %v", err)
+		}
+		content := bytes.Repeat([]byte("sample"), size/6+1)[:size]
+		hash, err := obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("size %d: failed to create evidence: %v", size, err)
+		}
+		sum := sha256.Sum256(content)
+		if want := hex.EncodeToString(sum[:]); hash != want {
+			t.Errorf("size %d: expected plaintext hash %q, got %q", size, want, hash)
+		}
+		got, err := readTestEvidence(t, obs, "testcase", "video")
+		if err != nil {
+			t.Fatalf("size %d: failed to read evidence: %v", size, err)
+		}
+		if !bytes.Equal(content, got) {
+			t.Errorf("size %d: decrypted content doesn't match", size)
+		}
+		raw, err := readTestEvidence(t, inner, "testcase", "video")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a few bytes of plaintext can occur in random ciphertext by chance
+		if size >= 16 && bytes.Contains(raw, content) {
+			t.Errorf("size %d: expected stored object not to contain the plaintext", size)
+		}
+	}
+}
+
+func TestEncryptedStoreDetectedModifiedObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(raw []byte) []byte
+	}{
+		{
+			name: "with a changed byte",
+			modify: func(raw []byte) []byte {
+				raw[len(raw)/2] ^= 1
+				return raw
+			},
+		},
+		{
+			name: "with the last segment removed",
+			modify: func(raw []byte) []byte {
+				return raw[:len(raw)-100]
+			},
+		},
+		{
+			name: "with data appended",
+			modify: func(raw []byte) []byte {
+				return append(raw, 0)
+			},
+		},
+		{
+			name: "without the header",
+			modify: func(raw []byte) []byte {
+				return raw[40:]
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs, inner, _ := getTestEncryptedStore(t)
+			err := obs.CreateCase(&data.Case{Name: "testcase"})
+			if err != nil {
+				t.Fatalf("failed to create case: %v", err)
+			}
+			content := strings.Repeat("sample", 20000)
+			_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", strings.NewReader(content))
+			if err != nil {
+				t.Fatalf("failed to create evidence: %v", err)
+			}
+			raw, err := readTestEvidence(t, inner, "testcase", "video")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = inner.RemoveEvidence(&data.Evidence{Name: "video"}, "testcase")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = inner.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewReader(tt.modify(raw)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = readTestEvidence(t, obs, "testcase", "video")
+			if !errors.Is(err, data.ErrIntegrity) {
+				t.Errorf("expected %v, got %v", data.ErrIntegrity, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoreKeptCasesWithoutKeyInPlaintext(t *testing.T) {
+	obs, inner, _ := getTestEncryptedStore(t)
+	// the case was created before encryption was enabled
+	err := inner.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", strings.NewReader("sample"))
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	raw, err := readTestEvidence(t, inner, "testcase", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "sample" {
+		t.Errorf("expected plaintext %q, got %q", "sample", raw)
+	}
+}
+
+func TestEncryptedStoreRemovedKeyWithCase(t *testing.T) {
+	obs, _, keys := getTestEncryptedStore(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	_, err = keys.GetCaseKey("testcase")
+	if err != nil {
+		t.Fatalf("expected case key to be created, got %v", err)
+	}
+	err = obs.RemoveCase("testcase")
+	if err != nil {
+		t.Fatalf("failed to remove case: %v", err)
+	}
+	_, err = keys.GetCaseKey("testcase")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v after removing case, got %v", data.ErrNotFound, err)
+	}
+}
+
+func TestRotateMasterKeyRewrappedKeysWithoutRewritingObjects(t *testing.T) {
+	obs, inner, keys := getTestEncryptedStore(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", strings.NewReader("sample"))
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	before, err := readTestEvidence(t, inner, "testcase", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the new master key is configured and the old one is kept as previous key
+	rotating := data.NewEncryptedStore(inner, keys, getTestKeyring(t, data.EncryptionConfig{
+		MasterKey:    testMasterKey(2),
+		MasterKeyID:  "second",
+		PreviousKeys: "first:" + testMasterKey(1),
+	}))
+	rotated, err := rotating.(data.KeyRotator).RotateMasterKey()
+	if err != nil {
+		t.Fatalf("failed to rotate master key: %v", err)
+	}
+	if rotated != 1 {
+		t.Errorf("expected 1 rotated key, got %d", rotated)
+	}
+	rotated, err = rotating.(data.KeyRotator).RotateMasterKey()
+	if err != nil || rotated != 0 {
+		t.Errorf("expected no keys to rotate the second time, got %d, %v", rotated, err)
+	}
+	after, err := readTestEvidence(t, inner, "testcase", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("expected stored object not to change")
+	}
+	// the old master key is not needed anymore
+	rotatedStore := data.NewEncryptedStore(inner, keys, getTestKeyring(t, data.EncryptionConfig{
+		MasterKey:   testMasterKey(2),
+		MasterKeyID: "second",
+	}))
+	got, err := readTestEvidence(t, rotatedStore, "testcase", "video")
+	if err != nil {
+		t.Fatalf("failed to read evidence after rotation: %v", err)
+	}
+	if string(got) != "sample" {
+		t.Errorf("expected content %q, got %q", "sample", got)
+	}
+}
+
+func TestNewKeyringFailedWithInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config data.EncryptionConfig
+	}{
+		{
+			name:   "without key id",
+			config: data.EncryptionConfig{MasterKey: testMasterKey(1)},
+		},
+		{
+			name:   "with a short key",
+			config: data.EncryptionConfig{MasterKey: base64.StdEncoding.EncodeToString([]byte("short")), MasterKeyID: "first"},
+		},
+		{
+			name:   "with a key that isn't base64",
+			config: data.EncryptionConfig{MasterKey: "not base64!", MasterKeyID: "first"},
+		},
+		{
+			name:   "with previous key without id",
+			config: data.EncryptionConfig{MasterKey: testMasterKey(1), MasterKeyID: "first", PreviousKeys: testMasterKey(2)},
+		},
+		{
+			name:   "with previous key id used twice",
+			config: data.EncryptionConfig{MasterKey: testMasterKey(1), MasterKeyID: "first", PreviousKeys: "first:" + testMasterKey(2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := data.NewKeyring(tt.config)
+			if !errors.Is(err, data.ErrInvalidRequest) {
+				t.Errorf("expected %v, got %v", data.ErrInvalidRequest, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoreSeekedToPlaintextOffsets(t *testing.T) {
+	size := 3*64*1024 + 100
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	obs, _, _ := getTestEncryptedStore(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	file, err := obs.GetEvidence("testcase", "video")
+	if err != nil {
+		t.Fatalf("failed to get evidence: %v", err)
+	}
+	defer file.Close()
+	seeker, ok := file.(io.ReadSeeker)
+	if !ok {
+		t.Fatalf("expected decrypted evidence to be seekable")
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil || end != int64(size) {
+		t.Fatalf("expected plaintext size %d, got %d, %v", size, end, err)
+	}
+	offsets := []int{0, 1, 64*1024 - 1, 64 * 1024, 64*1024 + 5, 3 * 64 * 1024, size - 1, size}
+	for _, offset := range offsets {
+		_, err = seeker.Seek(int64(offset), io.SeekStart)
+		if err != nil {
+			t.Fatalf("offset %d: failed to seek: %v", offset, err)
+		}
+		got, err := io.ReadAll(io.LimitReader(seeker, 10))
+		if err != nil {
+			t.Fatalf("offset %d: failed to read: %v", offset, err)
+		}
+		want := content[offset:]
+		if len(want) > 10 {
+			want = want[:10]
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("offset %d: expected %v, got %v", offset, want, got)
+		}
+	}
+}
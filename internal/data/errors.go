@@ -9,5 +9,11 @@ var (
 	ErrAlreadyExists      = errors.New("resource already exists")
 	ErrInvalidRequest     = errors.New("invalid request")
 	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("permission denied")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrConflict           = errors.New("request conflicts with the current state")
+	ErrIntegrity          = errors.New("stored data failed the integrity check")
+	ErrLocked             = errors.New("resource is under legal hold")
+	ErrHashMismatch       = errors.New("content doesn't match the declared hash")
+	ErrNoObjectLocking    = errors.New("bucket was created without object locking")
 )
@@ -0,0 +1,364 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// maxFolderPathLength is the length of the folder columns in characters
+const maxFolderPathLength = 1024
+
+// maxEvidenceNameLength is the length of the name column of evidences in characters
+const maxEvidenceNameLength = 255
+
+// Folder is a virtual folder of a case. Folders only exist in the database, the
+// root folder of a case has the empty path and no row.
+type Folder struct {
+	ID        int64     `json:"id"`
+	CaseID    int64     `json:"case_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FolderListing is the content of a folder without the content of its subfolders
+type FolderListing struct {
+	Path      string     `json:"path"`
+	Folders   []Folder   `json:"folders"`
+	Evidences []Evidence `json:"evidences"`
+}
+
+// CleanFolderPath checks a folder path like "Police report/Photos/Scene 1" and
+// returns it without leading and trailing slashes, the root folder is ""
+func CleanFolderPath(path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	if utf8.RuneCountInString(path) > maxFolderPathLength {
+		return "", fmt.Errorf("%w : folder path can be at most %d characters ", ErrInvalidRequest, maxFolderPathLength)
+	}
+	for _, name := range strings.Split(path, "/") {
+		err := validateName("folder", name)
+		if err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// ValidateEvidenceName checks that an evidence name can be stored, names are
+// free-form Unicode like "Scene 1.jpg" but can't contain a forward slash
+func ValidateEvidenceName(name string) error {
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("%w : evidence name can't contain forward slash : %q ", ErrInvalidRequest, name)
+	}
+	return validateName("evidence", name)
+}
+
+// validateName checks the name of a folder or an evidence
+func validateName(kind string, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w : %s name cannot be empty ", ErrInvalidRequest, kind)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("%w : invalid %s name : %q ", ErrInvalidRequest, kind, name)
+	}
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxEvidenceNameLength {
+		return fmt.Errorf("%w : %s name must be valid UTF-8 of at most %d characters ", ErrInvalidRequest, kind, maxEvidenceNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w : %s name contains control characters: %q ", ErrInvalidRequest, kind, name)
+		}
+	}
+	return nil
+}
+
+// FolderParent returns the path of the folder that contains the folder
+func FolderParent(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// folderName returns the last name of a folder path
+func folderName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// folderPaths returns the paths of the folder and all folders it is in, from the top
+func folderPaths(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var paths []string
+	for i, r := range path {
+		if r == '/' {
+			paths = append(paths, path[:i])
+		}
+	}
+	return append(paths, path)
+}
+
+// addFolders adds the folder and the folders it is in that don't exist yet
+func addFolders(tx *sql.Tx, caseID int64, path string) error {
+	for _, p := range folderPaths(path) {
+		_, err := tx.Exec(`INSERT INTO "folders" ("case_id", "path", "parent") VALUES ($1, $2, $3) ON CONFLICT ("case_id", "path") DO NOTHING`,
+			caseID, p, FolderParent(p))
+		if err != nil {
+			return fmt.Errorf("inserting folder : %w", err)
+		}
+	}
+	return nil
+}
+
+// AddFolder adds a folder with the folders it is in and sets its ID and creation
+// time, it returns ErrAlreadyExists when the folder exists
+func (d *DB) AddFolder(folder *Folder) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = addFolders(tx, folder.CaseID, FolderParent(folder.Path))
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`INSERT INTO "folders" ("case_id", "path", "parent") VALUES ($1, $2, $3) ON CONFLICT ("case_id", "path") DO NOTHING RETURNING id, created_at`,
+		folder.CaseID, folder.Path, FolderParent(folder.Path)).Scan(&folder.ID, &folder.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w : folder : %q", ErrAlreadyExists, folder.Path)
+		}
+		return fmt.Errorf("inserting folder : %w", err)
+	}
+	folder.Name = folderName(folder.Path)
+	return tx.Commit()
+}
+
+// GetFolder returns a folder of a case by its path or ErrNotFound
+func (d *DB) GetFolder(caseID int64, path string) (*Folder, error) {
+	row := d.DB.QueryRow(`SELECT "id", "case_id", "path", "created_at" FROM "folders" WHERE case_id = $1 AND path = $2`, caseID, path)
+	folder, err := scanFolder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : folder : %q", ErrNotFound, path)
+	}
+	return folder, err
+}
+
+// ListFolders returns the folders directly in the parent folder ordered by path
+func (d *DB) ListFolders(caseID int64, parent string) ([]Folder, error) {
+	rows, err := d.DB.Query(`SELECT "id", "case_id", "path", "created_at" FROM "folders" WHERE case_id = $1 AND parent = $2 ORDER BY path`, caseID, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var folders []Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, *folder)
+	}
+	return folders, rows.Err()
+}
+
+// MoveEvidence moves the evidence to the folder under the name, the folder is
+// added when it doesn't exist. It returns ErrAlreadyExists when the folder has
+// an evidence with the name.
+func (d *DB) MoveEvidence(evidence *Evidence, folder string, name string) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = addFolders(tx, evidence.CaseID, folder)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`UPDATE "evidences" SET "folder" = $1, "name" = $2 WHERE id = $3 AND case_id = $4`, folder, name, evidence.ID, evidence.CaseID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : evidence %q in folder %q", ErrAlreadyExists, name, folder)
+		}
+		return fmt.Errorf("moving evidence : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : evidence id : %d", ErrNotFound, evidence.ID)
+	}
+	err = addCustodyEvent(tx, evidence.Custody)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	evidence.Folder = folder
+	evidence.Name = name
+	return nil
+}
+
+// MoveFolder changes the path of a folder and of the folders and evidences in it,
+// the folders the new path is in are added when they don't exist. It returns
+// ErrNotFound when the folder doesn't exist and ErrAlreadyExists when the new
+// path does.
+func (d *DB) MoveFolder(caseID int64, from string, to string) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM "folders" WHERE case_id = $1 AND path = $2 FOR UPDATE`, caseID, from).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w : folder : %q", ErrNotFound, from)
+		}
+		return err
+	}
+	err = addFolders(tx, caseID, FolderParent(to))
+	if err != nil {
+		return err
+	}
+	// prefixes are compared with left() instead of LIKE, folder names can contain % and _
+	_, err = tx.Exec(`UPDATE "folders" SET
+		"path" = $3 || substr("path", char_length($2) + 1),
+		"parent" = CASE WHEN "path" = $2 THEN $4 ELSE $3 || substr("parent", char_length($2) + 1) END
+		WHERE case_id = $1 AND ("path" = $2 OR left("path", char_length($2) + 1) = $2 || '/')`,
+		caseID, from, to, FolderParent(to))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : folder : %q", ErrAlreadyExists, to)
+		}
+		return fmt.Errorf("moving folders : %w", err)
+	}
+	_, err = tx.Exec(`UPDATE "evidences" SET "folder" = $3 || substr("folder", char_length($2) + 1)
+		WHERE case_id = $1 AND ("folder" = $2 OR left("folder", char_length($2) + 1) = $2 || '/')`,
+		caseID, from, to)
+	if err != nil {
+		return fmt.Errorf("moving evidences : %w", err)
+	}
+	return tx.Commit()
+}
+
+func scanFolder(row scanner) (*Folder, error) {
+	folder := &Folder{}
+	err := row.Scan(&folder.ID, &folder.CaseID, &folder.Path, &folder.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	folder.Name = folderName(folder.Path)
+	return folder, nil
+}
+
+// CreateFolder adds a folder to the case, the folders it is in are added when
+// they don't exist
+func (s *Stores) CreateFolder(cs *Case, path string) (*Folder, error) {
+	path, err := CleanFolderPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%w : folder path cannot be empty ", ErrInvalidRequest)
+	}
+	folder := &Folder{CaseID: cs.ID, Path: path}
+	err = s.DBStore.AddFolder(folder)
+	if err != nil {
+		return nil, fmt.Errorf("adding folder to DB: %w , folder: %q ", err, path)
+	}
+	return folder, nil
+}
+
+// ListFolder returns the folders and the evidences directly in a folder of the
+// case, evidences are listed like in ListEvidences
+func (s *Stores) ListFolder(cs *Case, path string) (*FolderListing, error) {
+	path, err := CleanFolderPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		_, err = s.DBStore.GetFolder(cs.ID, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	folders, err := s.DBStore.ListFolders(cs.ID, path)
+	if err != nil {
+		return nil, fmt.Errorf("listing folders from DB: %w , folder: %q ", err, path)
+	}
+	evidences, err := s.ListEvidences(cs)
+	if err != nil {
+		return nil, err
+	}
+	listing := &FolderListing{Path: path, Folders: []Folder{}, Evidences: []Evidence{}}
+	listing.Folders = append(listing.Folders, folders...)
+	for _, ev := range evidences {
+		if ev.Folder == path {
+			listing.Evidences = append(listing.Evidences, ev)
+		}
+	}
+	return listing, nil
+}
+
+// MoveEvidence moves the evidence to a folder of its case under a new name, the
+// content of the evidence in the object store is left as it is
+func (s *Stores) MoveEvidence(ev *Evidence, folder string, name string) error {
+	folder, err := CleanFolderPath(folder)
+	if err != nil {
+		return err
+	}
+	err = ValidateEvidenceName(name)
+	if err != nil {
+		return err
+	}
+	event := custodyEvent(ev.Custody, CustodyMove, ev)
+	event.Detail = fmt.Sprintf("moved from %q to %q", path.Join(ev.Folder, ev.Name), path.Join(folder, name))
+	ev.Custody = event
+	err = s.DBStore.MoveEvidence(ev, folder, name)
+	if err != nil {
+		return fmt.Errorf("moving evidence in DB: %w , evidence name: %q ", err, ev.Name)
+	}
+	return nil
+}
+
+// MoveFolder moves or renames a folder of the case together with everything in it
+func (s *Stores) MoveFolder(cs *Case, from string, to string) (*Folder, error) {
+	from, err := CleanFolderPath(from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = CleanFolderPath(to)
+	if err != nil {
+		return nil, err
+	}
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("%w : the root folder can't be moved ", ErrInvalidRequest)
+	}
+	if to == from || strings.HasPrefix(to, from+"/") {
+		return nil, fmt.Errorf("%w : folder %q can't be moved into itself ", ErrInvalidRequest, from)
+	}
+	err = s.DBStore.MoveFolder(cs.ID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("moving folder in DB: %w , folder: %q ", err, from)
+	}
+	return s.DBStore.GetFolder(cs.ID, to)
+}
@@ -0,0 +1,137 @@
+package data_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+func TestCleanFolderPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		want   string
+		wantEr error
+	}{
+		{name: "root is empty", path: "/", want: ""},
+		{name: "slashes around the path are trimmed", path: "/Police report/Photos/", want: "Police report/Photos"},
+		{name: "Cyrillic names with spaces are valid", path: "Записник/Фотографије 1", want: "Записник/Фотографије 1"},
+		{name: "empty segment fails", path: "Police report//Photos", wantEr: data.ErrInvalidRequest},
+		{name: "relative segment fails", path: "Police report/..", wantEr: data.ErrInvalidRequest},
+		{name: "control characters fail", path: "Police\treport", wantEr: data.ErrInvalidRequest},
+		{name: "too long segment fails", path: strings.Repeat("a", 256), wantEr: data.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := data.CleanFolderPath(tt.path)
+			if !errors.Is(err, tt.wantEr) {
+				t.Fatalf("expected error %v, got %v", tt.wantEr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected path %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestListFolderReturnedOnlyDirectChildren(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	err := stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "Scene 1 — north.jpg", Folder: "Police report/Photos", File: strings.NewReader("photo")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	_, err = stores.CreateFolder(cs, "Police report/Photos/Enhanced")
+	if err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+	listing, err := stores.ListFolder(cs, "Police report/Photos")
+	if err != nil {
+		t.Fatalf("failed to list folder: %v", err)
+	}
+	var got []string
+	for _, f := range listing.Folders {
+		got = append(got, f.Path)
+	}
+	for _, ev := range listing.Evidences {
+		got = append(got, ev.Name)
+	}
+	want := []string{"Police report/Photos/Enhanced", "Scene 1 — north.jpg"}
+	if !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	_, err = stores.ListFolder(cs, "Lab results")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected error %v for missing folder, got %v", data.ErrNotFound, err)
+	}
+}
+
+func TestMoveEvidenceKeptItsObject(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	ev, err := stores.DBStore.GetEvidenceByName(cs, "", "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := ev.Object()
+	err = stores.MoveEvidence(ev, "Police report/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Fatalf("failed to move evidence: %v", err)
+	}
+	got, err := stores.DBStore.GetEvidenceByName(cs, "Police report/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Fatalf("moved evidence not found: %v", err)
+	}
+	if got.ID != ev.ID || got.Object() != object {
+		t.Errorf("expected evidence %d stored under %q, got %d under %q", ev.ID, object, got.ID, got.Object())
+	}
+	file, err := stores.DownloadEvidence(got)
+	if err != nil {
+		t.Fatalf("failed to download evidence: %v", err)
+	}
+	defer (*file).Close()
+	content, err := io.ReadAll(*file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "video" {
+		t.Errorf("expected content %q, got %q", "video", content)
+	}
+	picture, err := stores.DBStore.GetEvidenceByName(cs, "", "picture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.MoveEvidence(picture, "Police report/Videos", "Scene 1.mp4")
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected error %v for taken name, got %v", data.ErrAlreadyExists, err)
+	}
+}
+
+func TestMoveFolderMovedEverythingInIt(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	err := stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "Police report/Videos", File: strings.NewReader("video")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	folder, err := stores.MoveFolder(cs, "Police report", "Archive/Police report 2026")
+	if err != nil {
+		t.Fatalf("failed to move folder: %v", err)
+	}
+	if folder.Path != "Archive/Police report 2026" || folder.Name != "Police report 2026" {
+		t.Errorf("unexpected moved folder %+v", folder)
+	}
+	_, err = stores.DBStore.GetEvidenceByName(cs, "Archive/Police report 2026/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Errorf("evidence wasn't moved with its folder: %v", err)
+	}
+	_, err = stores.DBStore.GetFolder(cs.ID, "Police report")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected old folder to be gone, got %v", err)
+	}
+	_, err = stores.MoveFolder(cs, "Archive", "Archive/Old")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected error %v moving folder into itself, got %v", data.ErrInvalidRequest, err)
+	}
+}
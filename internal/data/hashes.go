@@ -0,0 +1,232 @@
+package data
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hash algorithms that can be computed when evidences are ingested, SHA256 is
+// always computed because it is the hash evidences are verified with
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+// DefaultHashAlgorithms are computed when no hash algorithms are configured
+var DefaultHashAlgorithms = []string{HashMD5, HashSHA1, HashSHA256, HashSHA512}
+
+// supportedHashes are the supported algorithms with their hex digest length
+var supportedHashes = map[string]struct {
+	new    func() hash.Hash
+	length int
+}{
+	HashMD5:    {md5.New, md5.Size * 2},
+	HashSHA1:   {sha1.New, sha1.Size * 2},
+	HashSHA256: {sha256.New, sha256.Size * 2},
+	HashSHA512: {sha512.New, sha512.Size * 2},
+}
+
+// SupportedHashAlgorithm reports whether digests of the algorithm can be computed
+func SupportedHashAlgorithm(algorithm string) bool {
+	_, ok := supportedHashes[algorithm]
+	return ok
+}
+
+// Hashes are the hex encoded digests of an evidence by algorithm
+type Hashes map[string]string
+
+// Stored returns the hashes as they are stored with the evidence, only supported
+// algorithms with a digest are kept and SHA256 is the hash of the evidence. It
+// returns nil when there is no digest.
+func (h Hashes) Stored(sha256 string) Hashes {
+	stored := Hashes{}
+	for algorithm, digest := range h {
+		if SupportedHashAlgorithm(algorithm) && digest != "" {
+			stored[algorithm] = digest
+		}
+	}
+	delete(stored, HashSHA256)
+	if sha256 != "" {
+		stored[HashSHA256] = sha256
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	return stored
+}
+
+// algorithms returns the algorithms of the hashes in order
+func (h Hashes) algorithms() []string {
+	algorithms := make([]string, 0, len(h))
+	for algorithm := range h {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// ParseHashAlgorithms reads a comma separated list of hash algorithms, SHA256 is
+// added when it is missing and an empty list selects DefaultHashAlgorithms
+func ParseHashAlgorithms(algorithms string) ([]string, error) {
+	if strings.TrimSpace(algorithms) == "" {
+		return DefaultHashAlgorithms, nil
+	}
+	seen := map[string]bool{HashSHA256: true}
+	parsed := []string{HashSHA256}
+	for _, algorithm := range strings.Split(algorithms, ",") {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if !SupportedHashAlgorithm(algorithm) {
+			return nil, fmt.Errorf("%w : unsupported hash algorithm %q", ErrInvalidRequest, algorithm)
+		}
+		if !seen[algorithm] {
+			seen[algorithm] = true
+			parsed = append(parsed, algorithm)
+		}
+	}
+	return parsed, nil
+}
+
+// HashAlgorithmOf returns the algorithm of a hex encoded digest by its length and
+// the digest in lower case, all supported algorithms have different lengths
+func HashAlgorithmOf(digest string) (string, string, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if _, err := hex.DecodeString(digest); err != nil || digest == "" {
+		return "", "", fmt.Errorf("%w : hash %q is not hex encoded", ErrInvalidRequest, digest)
+	}
+	for algorithm, a := range supportedHashes {
+		if a.length == len(digest) {
+			return algorithm, digest, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w : hash %q has an unsupported length", ErrInvalidRequest, digest)
+}
+
+// digester computes the digests of several algorithms in a single pass over the
+// content written to it
+type digester struct {
+	hashes map[string]hash.Hash
+	w      io.Writer
+}
+
+func newDigester(algorithms []string) *digester {
+	d := &digester{hashes: map[string]hash.Hash{}}
+	var writers []io.Writer
+	for _, algorithm := range algorithms {
+		a, ok := supportedHashes[algorithm]
+		if !ok || d.hashes[algorithm] != nil {
+			continue
+		}
+		h := a.new()
+		d.hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+	d.w = io.MultiWriter(writers...)
+	return d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	return d.w.Write(p)
+}
+
+// Sum returns the hex encoded digests of everything written so far
+func (d *digester) Sum() Hashes {
+	hashes := Hashes{}
+	for algorithm, h := range d.hashes {
+		hashes[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes
+}
+
+// hashAlgorithms returns the configured algorithms computed at ingest
+func (s *Stores) hashAlgorithms() []string {
+	if len(s.HashAlgorithms) == 0 {
+		return DefaultHashAlgorithms
+	}
+	return s.HashAlgorithms
+}
+
+// validateDeclaredHashes checks that every declared digest is a hex digest of its
+// algorithm and returns the digests in lower case
+func validateDeclaredHashes(declared Hashes) (Hashes, error) {
+	if len(declared) == 0 {
+		return nil, nil
+	}
+	valid := Hashes{}
+	for algorithm, digest := range declared {
+		got, digest, err := HashAlgorithmOf(digest)
+		if err != nil {
+			return nil, err
+		}
+		if got != algorithm {
+			return nil, fmt.Errorf("%w : declared hash %q isn't a %s digest", ErrInvalidRequest, digest, algorithm)
+		}
+		valid[algorithm] = digest
+	}
+	return valid, nil
+}
+
+// checkDeclaredHashes returns ErrHashMismatch when a declared digest differs from
+// the computed one
+func checkDeclaredHashes(declared Hashes, computed Hashes) error {
+	for _, algorithm := range declared.algorithms() {
+		if declared[algorithm] != computed[algorithm] {
+			return fmt.Errorf("%w : declared %s %q, computed %q", ErrHashMismatch, algorithm, declared[algorithm], computed[algorithm])
+		}
+	}
+	return nil
+}
+
+// recordDeclaredHashes records in the verification history that the content of
+// the version matched the hashes declared by the client
+func (s *Stores) recordDeclaredHashes(ev *Evidence, version int64) error {
+	if len(ev.DeclaredHashes) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	results := make([]Verification, 0, len(ev.DeclaredHashes))
+	for _, algorithm := range ev.DeclaredHashes.algorithms() {
+		results = append(results, Verification{
+			EvidenceID:   ev.ID,
+			CaseID:       ev.CaseID,
+			Version:      version,
+			Status:       VerificationPassed,
+			ExpectedHash: ev.DeclaredHashes[algorithm],
+			ComputedHash: ev.Hashes[algorithm],
+			Detail:       fmt.Sprintf("matched the %s hash declared at ingest", algorithm),
+			VerifiedBy:   ev.UploadedBy,
+			VerifiedAt:   now,
+		})
+	}
+	ev.VerifiedAt = &now
+	ev.VerificationStatus = VerificationPassed
+	err := s.Verifications.RecordVerification(ev, results)
+	if err != nil {
+		return fmt.Errorf("recording declared hash verification: %w , evidence name: %q ", err, ev.Name)
+	}
+	return nil
+}
+
+// FindEvidencesByHash returns the evidences in all cases with a version that has
+// the digest, the algorithm is recognized by the length of the digest
+func (s *Stores) FindEvidencesByHash(digest string) ([]Evidence, error) {
+	algorithm, digest, err := HashAlgorithmOf(digest)
+	if err != nil {
+		return nil, err
+	}
+	evidences, err := s.DBStore.FindEvidencesByHash(algorithm, digest)
+	if err != nil {
+		return nil, fmt.Errorf("finding evidences by hash in DB: %w , hash: %q ", err, digest)
+	}
+	return evidences, nil
+}
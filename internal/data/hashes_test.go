@@ -0,0 +1,206 @@
+package data_test
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// hashesOf returns the digests of all supported algorithms of the content
+func hashesOf(content string) data.Hashes {
+	md5Sum := md5.Sum([]byte(content))
+	sha1Sum := sha1.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	sha512Sum := sha512.Sum512([]byte(content))
+	return data.Hashes{
+		data.HashMD5:    hex.EncodeToString(md5Sum[:]),
+		data.HashSHA1:   hex.EncodeToString(sha1Sum[:]),
+		data.HashSHA256: hex.EncodeToString(sha256Sum[:]),
+		data.HashSHA512: hex.EncodeToString(sha512Sum[:]),
+	}
+}
+
+func TestParseHashAlgorithms(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithms string
+		want       []string
+		wantErr    error
+	}{
+		{name: "no algorithms select the defaults", want: data.DefaultHashAlgorithms},
+		{name: "SHA256 is always added", algorithms: "MD5", want: []string{data.HashSHA256, data.HashMD5}},
+		{name: "duplicates are removed", algorithms: "sha1, sha256,sha1", want: []string{data.HashSHA256, data.HashSHA1}},
+		{name: "unsupported algorithm fails", algorithms: "md5,crc32", wantErr: data.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := data.ParseHashAlgorithms(tt.algorithms)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestHashAlgorithmOf(t *testing.T) {
+	hashes := hashesOf("video")
+	tests := []struct {
+		name    string
+		digest  string
+		want    string
+		wantErr error
+	}{
+		{name: "MD5 digest", digest: hashes[data.HashMD5], want: data.HashMD5},
+		{name: "SHA1 digest", digest: hashes[data.HashSHA1], want: data.HashSHA1},
+		{name: "upper case SHA256 digest", digest: strings.ToUpper(hashes[data.HashSHA256]), want: data.HashSHA256},
+		{name: "SHA512 digest", digest: hashes[data.HashSHA512], want: data.HashSHA512},
+		{name: "digest that isn't hex fails", digest: "not a digest", wantErr: data.ErrInvalidRequest},
+		{name: "digest with unsupported length fails", digest: "abcd", wantErr: data.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, digest, err := data.HashAlgorithmOf(tt.digest)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected algorithm %q, got %q", tt.want, got)
+			}
+			if err == nil && digest != strings.ToLower(tt.digest) {
+				t.Errorf("expected lower case digest, got %q", digest)
+			}
+		})
+	}
+}
+
+func TestCreateEvidenceComputedConfiguredHashes(t *testing.T) {
+	all := hashesOf("video")
+	tests := []struct {
+		name       string
+		algorithms []string
+		want       data.Hashes
+	}{
+		{name: "default algorithms", want: all},
+		{name: "configured algorithms", algorithms: []string{data.HashSHA256, data.HashMD5}, want: data.Hashes{data.HashMD5: all[data.HashMD5], data.HashSHA256: all[data.HashSHA256]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestHoldStores(t)
+			stores.HashAlgorithms = tt.algorithms
+			ev := &data.Evidence{CaseID: cs.ID, Name: "Scene 1.mp4", File: strings.NewReader("video")}
+			err := stores.CreateEvidence(ev, cs)
+			if err != nil {
+				t.Fatalf("failed to create evidence: %v", err)
+			}
+			got, err := stores.GetEvidenceByID(ev.ID, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tt.want, got.Hashes) {
+				t.Errorf(cmp.Diff(tt.want, got.Hashes))
+			}
+			version, err := stores.GetEvidenceVersion(got, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tt.want, version.Hashes) {
+				t.Errorf(cmp.Diff(tt.want, version.Hashes))
+			}
+		})
+	}
+}
+
+func TestFindEvidencesByHashFoundEvidenceByAnyDigest(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	ev := &data.Evidence{CaseID: cs.ID, Name: "video", File: strings.NewReader("second take")}
+	err := stores.CreateEvidence(ev, cs)
+	if err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	for _, content := range []string{"video", "second take"} {
+		for algorithm, digest := range hashesOf(content) {
+			got, err := stores.FindEvidencesByHash(strings.ToUpper(digest))
+			if err != nil {
+				t.Fatalf("failed to find evidences by %s: %v", algorithm, err)
+			}
+			if len(got) != 1 || got[0].ID != ev.ID {
+				t.Errorf("expected evidence %d by %s of %q, got %v", ev.ID, algorithm, content, got)
+			}
+		}
+	}
+	_, err = stores.FindEvidencesByHash("abcd")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected error %v, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func TestCreateEvidenceCheckedDeclaredHashes(t *testing.T) {
+	hashes := hashesOf("content")
+	tests := []struct {
+		name        string
+		evidence    string
+		declared    data.Hashes
+		want        error
+		wantVersion int64
+	}{
+		{name: "matching hashes are recorded", evidence: "image.dd", declared: data.Hashes{data.HashMD5: hashes[data.HashMD5], data.HashSHA512: strings.ToUpper(hashes[data.HashSHA512])}, wantVersion: 1},
+		{name: "matching hash of a new version is recorded", evidence: "video", declared: data.Hashes{data.HashSHA256: hashes[data.HashSHA256]}, wantVersion: 2},
+		{name: "mismatching hash fails", evidence: "image.dd", declared: data.Hashes{data.HashSHA256: hashesOf("other")[data.HashSHA256]}, want: data.ErrHashMismatch},
+		{name: "mismatching hash of a new version fails", evidence: "video", declared: data.Hashes{data.HashSHA1: hashesOf("other")[data.HashSHA1]}, want: data.ErrHashMismatch},
+		{name: "digest of another algorithm fails", evidence: "image.dd", declared: data.Hashes{data.HashSHA1: hashes[data.HashMD5]}, want: data.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestHoldStores(t)
+			objects, err := stores.ObjectStore.ListEvidences(cs.Bucket())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev := &data.Evidence{CaseID: cs.ID, Name: tt.evidence, File: strings.NewReader("content"), UploadedBy: "clerk", DeclaredHashes: tt.declared}
+			err = stores.CreateEvidence(ev, cs)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected error %v, got %v", tt.want, err)
+			}
+			if tt.want != nil {
+				after, err := stores.ObjectStore.ListEvidences(cs.Bucket())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(after) != len(objects) {
+					t.Errorf("expected the object to be removed, got %d objects instead of %d", len(after), len(objects))
+				}
+				return
+			}
+			verifications, err := stores.ListVerifications(ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(verifications) != len(tt.declared) {
+				t.Fatalf("expected %d verifications, got %d", len(tt.declared), len(verifications))
+			}
+			for _, v := range verifications {
+				if v.Status != data.VerificationPassed || v.Version != tt.wantVersion || v.VerifiedBy != "clerk" || v.ExpectedHash != v.ComputedHash {
+					t.Errorf("unexpected verification %+v", v)
+				}
+			}
+			got, err := stores.GetEvidenceByID(ev.ID, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.VerificationStatus != data.VerificationPassed {
+				t.Errorf("expected evidence to be verified, got %q", got.VerificationStatus)
+			}
+		})
+	}
+}
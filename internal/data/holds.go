@@ -0,0 +1,348 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LegalHold preserves a case, or a single evidence when EvidenceID is set, until
+// it is released or expires. Released holds are kept as a record.
+type LegalHold struct {
+	ID         int64      `json:"id"`
+	CaseID     int64      `json:"case_id"`
+	EvidenceID int64      `json:"evidence_id,omitempty"`
+	Reason     string     `json:"reason"`
+	IssuedBy   string     `json:"issued_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReleasedBy string     `json:"released_by,omitempty"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+}
+
+// Active reports whether the hold still preserves its case or evidence at the given time
+func (h *LegalHold) Active(at time.Time) bool {
+	if h.ReleasedAt != nil {
+		return false
+	}
+	return h.ExpiresAt == nil || at.Before(*h.ExpiresAt)
+}
+
+// Covers reports whether the hold applies to the evidence, holds on the whole
+// case cover all of its evidences
+func (h *LegalHold) Covers(evidenceID int64) bool {
+	return h.EvidenceID == 0 || h.EvidenceID == evidenceID
+}
+
+// HoldStore keeps the legal holds of cases and evidences
+type HoldStore interface {
+	AddHold(hold *LegalHold) error
+	GetHold(id int64) (*LegalHold, error)
+	ListHolds(caseID int64) ([]LegalHold, error)
+	ReleaseHold(hold *LegalHold) error
+}
+
+type Holds struct {
+	DB *sql.DB
+}
+
+func NewHoldStore(db *sql.DB) HoldStore {
+	return &Holds{
+		DB: db,
+	}
+}
+
+// AddHold stores a legal hold and sets its ID and creation time
+func (h *Holds) AddHold(hold *LegalHold) error {
+	err := h.DB.QueryRow(`INSERT INTO "legal_holds" ("case_id", "evidence_id", "reason", "issued_by", "expires_at") VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		hold.CaseID, hold.EvidenceID, hold.Reason, hold.IssuedBy, hold.ExpiresAt).Scan(&hold.ID, &hold.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting legal hold : %w", err)
+	}
+	return nil
+}
+
+// GetHold returns a legal hold by its ID or ErrNotFound
+func (h *Holds) GetHold(id int64) (*LegalHold, error) {
+	row := h.DB.QueryRow(`SELECT "id", "case_id", "evidence_id", "reason", "issued_by", "expires_at", "created_at", "released_by", "released_at" FROM "legal_holds" WHERE id = $1`, id)
+	hold, err := scanHold(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : legal hold id : %d", ErrNotFound, id)
+	}
+	return hold, err
+}
+
+// ListHolds returns all legal holds of a case ordered by ID, including released ones
+func (h *Holds) ListHolds(caseID int64) ([]LegalHold, error) {
+	rows, err := h.DB.Query(`SELECT "id", "case_id", "evidence_id", "reason", "issued_by", "expires_at", "created_at", "released_by", "released_at" FROM "legal_holds" WHERE case_id = $1 ORDER BY id`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var holds []LegalHold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, *hold)
+	}
+	return holds, rows.Err()
+}
+
+// ReleaseHold records who released the hold and when
+func (h *Holds) ReleaseHold(hold *LegalHold) error {
+	result, err := h.DB.Exec(`UPDATE "legal_holds" SET "released_by" = $1, "released_at" = $2 WHERE id = $3`,
+		hold.ReleasedBy, hold.ReleasedAt, hold.ID)
+	if err != nil {
+		return fmt.Errorf("releasing legal hold : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : legal hold id : %d", ErrNotFound, hold.ID)
+	}
+	return nil
+}
+
+func scanHold(row scanner) (*LegalHold, error) {
+	hold := &LegalHold{}
+	var releasedBy sql.NullString
+	err := row.Scan(&hold.ID, &hold.CaseID, &hold.EvidenceID, &hold.Reason, &hold.IssuedBy,
+		&hold.ExpiresAt, &hold.CreatedAt, &releasedBy, &hold.ReleasedAt)
+	if err != nil {
+		return nil, err
+	}
+	hold.ReleasedBy = releasedBy.String
+	return hold, nil
+}
+
+// LegalHolder is implemented by object stores that can put objects under a legal
+// hold of their own, so they can't be removed even by bypassing the registry
+type LegalHolder interface {
+	SetLegalHold(caseName string, objectName string, enabled bool) error
+}
+
+// PlaceHold puts a case or one of its evidences under legal hold and reports
+// whether the hold was mirrored to the objects of the evidences. The hold is
+// added first, as the registry is what refuses the removals. It isn't mirrored
+// when the object store doesn't support legal holds or the bucket of the case was
+// created without object locking.
+func (s *Stores) PlaceHold(hold *LegalHold) (bool, error) {
+	hold.Reason = strings.TrimSpace(hold.Reason)
+	if hold.Reason == "" {
+		return false, fmt.Errorf("%w : legal hold must have a reason", ErrInvalidRequest)
+	}
+	if hold.ExpiresAt != nil && !hold.ExpiresAt.After(time.Now()) {
+		return false, fmt.Errorf("%w : legal hold can't expire in the past", ErrInvalidRequest)
+	}
+	cs, err := s.GetCaseByID(hold.CaseID)
+	if err != nil {
+		return false, err
+	}
+	evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		return false, fmt.Errorf("getting evidences from DB : %w", err)
+	}
+	if hold.EvidenceID != 0 {
+		ev, err := s.GetEvidenceByID(hold.EvidenceID, cs.ID)
+		if err != nil {
+			return false, err
+		}
+		evidences = []Evidence{*ev}
+	}
+	err = s.Holds.AddHold(hold)
+	if err != nil {
+		return false, err
+	}
+	mirrored, err := s.mirrorHolds(cs, evidences, true)
+	if err != nil {
+		return false, fmt.Errorf("legal hold %d is placed but not mirrored : %w", hold.ID, err)
+	}
+	return mirrored, nil
+}
+
+// ReleaseHold releases an active legal hold of a case, the objects stay held in
+// the object store while another hold covers them. The object store legal holds
+// are cleared before the release is saved, so a failure leaves the hold active
+// and the release can be retried.
+func (s *Stores) ReleaseHold(caseID int64, holdID int64, username string) (*LegalHold, error) {
+	hold, err := s.Holds.GetHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.CaseID != caseID {
+		return nil, fmt.Errorf("%w : legal hold id : %d", ErrNotFound, holdID)
+	}
+	if hold.ReleasedAt != nil {
+		return nil, fmt.Errorf("%w : legal hold %d is already released", ErrConflict, holdID)
+	}
+	cs, err := s.GetCaseByID(caseID)
+	if err != nil {
+		return nil, err
+	}
+	evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidences from DB : %w", err)
+	}
+	active, err := s.activeHolds(cs.ID)
+	if err != nil {
+		return nil, err
+	}
+	var holds []LegalHold
+	for _, other := range active {
+		if other.ID != hold.ID {
+			holds = append(holds, other)
+		}
+	}
+	var released []Evidence
+	for _, ev := range evidences {
+		if hold.Covers(ev.ID) && !heldBy(holds, ev.ID) {
+			released = append(released, ev)
+		}
+	}
+	_, err = s.mirrorHolds(cs, released, false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	hold.ReleasedBy = username
+	hold.ReleasedAt = &now
+	err = s.Holds.ReleaseHold(hold)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ListHolds returns all legal holds of a case, including released and expired ones
+func (s *Stores) ListHolds(cs *Case) ([]LegalHold, error) {
+	holds, err := s.Holds.ListHolds(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting legal holds from DB : %w , case id : %d", err, cs.ID)
+	}
+	return holds, nil
+}
+
+// checkCaseHolds fails with ErrLocked when the case or any of its evidences is
+// under an active legal hold
+func (s *Stores) checkCaseHolds(cs *Case) error {
+	holds, err := s.activeHolds(cs.ID)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return fmt.Errorf("%w : case %q is under legal hold %d : %s", ErrLocked, cs.Name, holds[0].ID, holds[0].Reason)
+	}
+	return nil
+}
+
+// checkEvidenceHolds fails with ErrLocked when the evidence or its case is under
+// an active legal hold
+func (s *Stores) checkEvidenceHolds(ev *Evidence) error {
+	holds, err := s.activeHolds(ev.CaseID)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if hold.Covers(ev.ID) {
+			return fmt.Errorf("%w : evidence %q is under legal hold %d : %s", ErrLocked, ev.Name, hold.ID, hold.Reason)
+		}
+	}
+	return nil
+}
+
+// activeHolds returns the legal holds of a case that are neither released nor expired
+func (s *Stores) activeHolds(caseID int64) ([]LegalHold, error) {
+	holds, err := s.Holds.ListHolds(caseID)
+	if err != nil {
+		return nil, fmt.Errorf("getting legal holds from DB : %w , case id : %d", err, caseID)
+	}
+	now := time.Now()
+	var active []LegalHold
+	for _, hold := range holds {
+		if hold.Active(now) {
+			active = append(active, hold)
+		}
+	}
+	return active, nil
+}
+
+// heldBy reports whether any of the holds covers the evidence
+func heldBy(holds []LegalHold, evidenceID int64) bool {
+	for i := range holds {
+		if holds[i].Covers(evidenceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// mirrorHolds sets or clears the object store legal hold on every version of the
+// evidences and reports whether it did. It does nothing when the object store
+// doesn't support legal holds or the bucket of the case has no object locking.
+func (s *Stores) mirrorHolds(cs *Case, evidences []Evidence, enabled bool) (bool, error) {
+	holder, ok := s.ObjectStore.(LegalHolder)
+	if !ok {
+		return false, nil
+	}
+	for i := range evidences {
+		objectNames, err := s.evidenceObjectNames(&evidences[i])
+		if err != nil {
+			return false, err
+		}
+		for _, name := range objectNames {
+			err = holder.SetLegalHold(cs.Bucket(), name, enabled)
+			if errors.Is(err, ErrNoObjectLocking) {
+				return false, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("setting legal hold in object store: %w , evidence name: %q ", err, evidences[i].Name)
+			}
+		}
+	}
+	return true, nil
+}
+
+// holdNewObject sets the object store legal hold on an object added to the
+// evidence when an active hold covers it and reports whether it did. New
+// evidences have no ID yet and are only covered by holds on the whole case.
+func (s *Stores) holdNewObject(cs *Case, evidenceID int64, objectName string) (bool, error) {
+	holder, ok := s.ObjectStore.(LegalHolder)
+	if !ok {
+		return false, nil
+	}
+	holds, err := s.activeHolds(cs.ID)
+	if err != nil {
+		return false, err
+	}
+	if !heldBy(holds, evidenceID) {
+		return false, nil
+	}
+	err = holder.SetLegalHold(cs.Bucket(), objectName, true)
+	if errors.Is(err, ErrNoObjectLocking) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("setting legal hold in object store: %w , object name: %q ", err, objectName)
+	}
+	return true, nil
+}
+
+// liftExpiredHolds clears the object store legal holds that were left by expired
+// holds, so the objects of the evidences can be removed
+func (s *Stores) liftExpiredHolds(cs *Case, evidences []Evidence) error {
+	holds, err := s.Holds.ListHolds(cs.ID)
+	if err != nil {
+		return fmt.Errorf("getting legal holds from DB : %w , case id : %d", err, cs.ID)
+	}
+	if len(holds) == 0 {
+		return nil
+	}
+	_, err = s.mirrorHolds(cs, evidences, false)
+	return err
+}
@@ -0,0 +1,336 @@
+package data_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+// holdingStore records the object store legal holds of an in-memory ObjectStore,
+// setting them fails with err when it is set
+type holdingStore struct {
+	data.ObjectStore
+	held map[string]bool
+	err  error
+}
+
+func (h *holdingStore) SetLegalHold(caseName string, objectName string, enabled bool) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.held[caseName+"/"+objectName] = enabled
+	return nil
+}
+
+// getTestHoldStores returns in-memory stores with a case named test and two
+// evidences, video with ID 1 and picture with ID 2
+func getTestHoldStores(t *testing.T) (data.Stores, *data.Case) {
+	stores := memstore.NewStores()
+	err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.CreateCase(user, "test")
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"video", "picture"} {
+		err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: name, File: strings.NewReader(name)}, cs)
+		if err != nil {
+			t.Fatalf("failed to create evidence: %v", err)
+		}
+	}
+	return stores, cs
+}
+
+// objectOf returns the object name the first version of an evidence in the root
+// folder of the case is stored under
+func objectOf(t *testing.T, stores data.Stores, cs *data.Case, evidenceName string) string {
+	ev, err := stores.DBStore.GetEvidenceByName(cs, "", evidenceName)
+	if err != nil {
+		t.Fatalf("failed to get evidence: %v", err)
+	}
+	return ev.ObjectName
+}
+
+func TestLegalHoldBlockedRemoval(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	released := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name          string
+		hold          data.LegalHold
+		removeVideo   error
+		removePicture error
+		removeCase    error
+	}{
+		{
+			name:          "on the case blocked removing the case and every evidence",
+			hold:          data.LegalHold{Reason: "court order"},
+			removeVideo:   data.ErrLocked,
+			removePicture: data.ErrLocked,
+			removeCase:    data.ErrLocked,
+		},
+		{
+			name:          "on an evidence blocked removing the evidence and the case",
+			hold:          data.LegalHold{EvidenceID: 1, Reason: "court order"},
+			removeVideo:   data.ErrLocked,
+			removePicture: nil,
+			removeCase:    data.ErrLocked,
+		},
+		{
+			name:          "that isn't expired blocked removal",
+			hold:          data.LegalHold{Reason: "court order", ExpiresAt: &future},
+			removeVideo:   data.ErrLocked,
+			removePicture: data.ErrLocked,
+			removeCase:    data.ErrLocked,
+		},
+		{
+			name:          "that expired didn't block removal",
+			hold:          data.LegalHold{Reason: "court order", ExpiresAt: &past},
+			removeVideo:   nil,
+			removePicture: nil,
+			removeCase:    nil,
+		},
+		{
+			name:          "that was released didn't block removal",
+			hold:          data.LegalHold{Reason: "court order", ReleasedBy: "judge", ReleasedAt: &released},
+			removeVideo:   nil,
+			removePicture: nil,
+			removeCase:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestHoldStores(t)
+			hold := tt.hold
+			hold.CaseID = cs.ID
+			err := stores.Holds.AddHold(&hold)
+			if err != nil {
+				t.Fatalf("failed to add hold: %v", err)
+			}
+			for id, want := range map[int64]error{1: tt.removeVideo, 2: tt.removePicture} {
+				ev, err := stores.GetEvidenceByID(id, cs.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = stores.DeleteEvidence(ev)
+				if !errors.Is(err, want) {
+					t.Errorf("removing evidence %d: expected %v, got %v", id, want, err)
+				}
+			}
+			err = stores.RemoveCase(cs.Name)
+			if !errors.Is(err, tt.removeCase) {
+				t.Errorf("removing case: expected %v, got %v", tt.removeCase, err)
+			}
+		})
+	}
+}
+
+func TestLegalHoldBlockedDispositionBeforeDestroyingKey(t *testing.T) {
+	stores, keys := getTestDispositionStores(t)
+	cs, err := stores.DBStore.GetCaseByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stores.PlaceHold(&data.LegalHold{CaseID: cs.ID, EvidenceID: 2, Reason: "court order", IssuedBy: "judge"})
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	_, err = stores.DisposeCase("test", "judge")
+	if !errors.Is(err, data.ErrLocked) {
+		t.Errorf("expected %v, got %v", data.ErrLocked, err)
+	}
+	_, err = keys.GetCaseKey(cs.Bucket())
+	if err != nil {
+		t.Errorf("expected case key to be kept, got %v", err)
+	}
+	_, err = stores.Certificates.GetCertificateByCaseID(cs.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected no certificate to be issued, got %v", err)
+	}
+}
+
+func TestPlaceHoldFailed(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		hold data.LegalHold
+		want error
+	}{
+		{
+			name: "without a reason",
+			hold: data.LegalHold{CaseID: 1, Reason: "  "},
+			want: data.ErrInvalidRequest,
+		},
+		{
+			name: "with expiry in the past",
+			hold: data.LegalHold{CaseID: 1, Reason: "court order", ExpiresAt: &past},
+			want: data.ErrInvalidRequest,
+		},
+		{
+			name: "with case that doesn't exist",
+			hold: data.LegalHold{CaseID: 5, Reason: "court order"},
+			want: data.ErrNotFound,
+		},
+		{
+			name: "with evidence that doesn't exist",
+			hold: data.LegalHold{CaseID: 1, EvidenceID: 5, Reason: "court order"},
+			want: data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, _ := getTestHoldStores(t)
+			_, err := stores.PlaceHold(&tt.hold)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLegalHoldMirroredToObjectStore(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	holder := &holdingStore{ObjectStore: stores.ObjectStore, held: map[string]bool{}}
+	stores.ObjectStore = holder
+	caseHold := &data.LegalHold{CaseID: cs.ID, Reason: "court order", IssuedBy: "judge"}
+	_, err := stores.PlaceHold(caseHold)
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	_, err = stores.PlaceHold(&data.LegalHold{CaseID: cs.ID, EvidenceID: 1, Reason: "appeal", IssuedBy: "judge"})
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	video := cs.Bucket() + "/" + objectOf(t, stores, cs, "video")
+	picture := cs.Bucket() + "/" + objectOf(t, stores, cs, "picture")
+	want := map[string]bool{video: true, picture: true}
+	if !cmp.Equal(want, holder.held) {
+		t.Errorf(cmp.Diff(want, holder.held))
+	}
+	released, err := stores.ReleaseHold(cs.ID, caseHold.ID, "judge")
+	if err != nil {
+		t.Fatalf("failed to release hold: %v", err)
+	}
+	if released.ReleasedBy != "judge" || released.ReleasedAt == nil {
+		t.Errorf("expected release to be recorded, got %+v", released)
+	}
+	// video is still held by the second hold
+	want = map[string]bool{video: true, picture: false}
+	if !cmp.Equal(want, holder.held) {
+		t.Errorf(cmp.Diff(want, holder.held))
+	}
+	_, err = stores.ReleaseHold(cs.ID, caseHold.ID, "judge")
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected %v releasing the hold twice, got %v", data.ErrConflict, err)
+	}
+}
+
+func TestLegalHoldMirroredToEvidencesAddedToHeldCase(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	holder := &holdingStore{ObjectStore: stores.ObjectStore, held: map[string]bool{}}
+	stores.ObjectStore = holder
+	_, err := stores.PlaceHold(&data.LegalHold{CaseID: cs.ID, Reason: "court order", IssuedBy: "judge"})
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	audio := &data.Evidence{CaseID: cs.ID, Name: "audio", File: strings.NewReader("audio")}
+	err = stores.CreateEvidence(audio, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: strings.NewReader("edited video")}, cs)
+	if err != nil {
+		t.Fatalf("failed to add version: %v", err)
+	}
+	video, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := stores.GetEvidenceVersion(video, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range []string{audio.ObjectName, version.ObjectName} {
+		if !holder.held[cs.Bucket()+"/"+object] {
+			t.Errorf("expected object %q added to the held case to be held", object)
+		}
+	}
+}
+
+func TestLegalHoldPlacedOnBucketWithoutObjectLocking(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	holder := &holdingStore{ObjectStore: stores.ObjectStore, held: map[string]bool{}, err: fmt.Errorf("%w : bucket : %q", data.ErrNoObjectLocking, cs.Bucket())}
+	stores.ObjectStore = holder
+	hold := &data.LegalHold{CaseID: cs.ID, Reason: "court order", IssuedBy: "judge"}
+	mirrored, err := stores.PlaceHold(hold)
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	if mirrored {
+		t.Errorf("expected the hold not to be mirrored")
+	}
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.DeleteEvidence(ev)
+	if !errors.Is(err, data.ErrLocked) {
+		t.Errorf("expected %v removing held evidence, got %v", data.ErrLocked, err)
+	}
+	err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "audio", File: strings.NewReader("audio")}, cs)
+	if err != nil {
+		t.Errorf("failed to create evidence in held case: %v", err)
+	}
+	_, err = stores.ReleaseHold(cs.ID, hold.ID, "judge")
+	if err != nil {
+		t.Errorf("failed to release hold: %v", err)
+	}
+}
+
+func TestReleaseHoldKeptHoldWhenObjectStoreFailed(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	holder := &holdingStore{ObjectStore: stores.ObjectStore, held: map[string]bool{}}
+	stores.ObjectStore = holder
+	hold := &data.LegalHold{CaseID: cs.ID, Reason: "court order", IssuedBy: "judge"}
+	_, err := stores.PlaceHold(hold)
+	if err != nil {
+		t.Fatalf("failed to place hold: %v", err)
+	}
+	holder.err = errors.New("object store is unavailable")
+	_, err = stores.ReleaseHold(cs.ID, hold.ID, "judge")
+	if err == nil {
+		t.Fatalf("expected release to fail")
+	}
+	got, err := stores.Holds.GetHold(hold.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ReleasedAt != nil {
+		t.Errorf("expected the hold to stay active, got %+v", got)
+	}
+	holder.err = nil
+	_, err = stores.ReleaseHold(cs.ID, hold.ID, "judge")
+	if err != nil {
+		t.Fatalf("failed to retry the release: %v", err)
+	}
+	video := cs.Bucket() + "/" + objectOf(t, stores, cs, "video")
+	if holder.held[video] {
+		t.Errorf("expected object %q to be released", video)
+	}
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Identity links a user to their subject at an OpenID Connect issuer
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentityStore keeps the identities of users at identity providers
+type IdentityStore interface {
+	AddUserIdentity(user *User, identity *Identity) error
+	GetIdentity(issuer string, subject string) (*Identity, error)
+}
+
+type Identities struct {
+	DB *sql.DB
+}
+
+func NewIdentityStore(db *sql.DB) IdentityStore {
+	return &Identities{
+		DB: db,
+	}
+}
+
+// AddUserIdentity adds the user and links it to the identity in one transaction,
+// so the user isn't added when the identity was linked in the meantime. It sets
+// the IDs of the user and of the identity, a linked identity returns ErrAlreadyExists
+// and a taken username returns ErrConflict.
+func (i *Identities) AddUserIdentity(user *User, identity *Identity) error {
+	if user.Username == "" || user.Password.plaintext == nil {
+		return fmt.Errorf("%w: username and password cannot be empty", ErrInvalidRequest)
+	}
+	tx, err := i.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(`INSERT INTO "users" ("username", "password", "role") VALUES ($1, $2, $3) RETURNING "id"`,
+		user.Username, user.Password.hash, user.Role).Scan(&user.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : username %q is taken by another user", ErrConflict, user.Username)
+		}
+		return fmt.Errorf("inserting user : %w", err)
+	}
+	identity.UserID = user.ID
+	err = tx.QueryRow(`INSERT INTO "user_identities" ("issuer", "subject", "user_id") VALUES ($1, $2, $3) RETURNING "created_at"`,
+		identity.Issuer, identity.Subject, identity.UserID).Scan(&identity.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : identity %q of issuer %q", ErrAlreadyExists, identity.Subject, identity.Issuer)
+		}
+		return fmt.Errorf("inserting identity : %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetIdentity returns the identity of the subject or ErrNotFound
+func (i *Identities) GetIdentity(issuer string, subject string) (*Identity, error) {
+	identity := &Identity{}
+	err := i.DB.QueryRow(`SELECT "issuer", "subject", "user_id", "created_at" FROM "user_identities" WHERE "issuer" = $1 AND "subject" = $2`, issuer, subject).
+		Scan(&identity.Issuer, &identity.Subject, &identity.UserID, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : identity %q of issuer %q", ErrNotFound, subject, issuer)
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+// ProvisionOIDCUser returns the user linked to the identity and updates its role
+// to the mapped one. A user is created and linked to an identity signing in the
+// first time in one transaction, it has a random password so it can only sign in
+// with single sign-on. It returns ErrConflict when the username is taken by a
+// user who isn't linked to the identity.
+func (s *Stores) ProvisionOIDCUser(identity *OIDCIdentity) (*User, error) {
+	err := ValidateRole(identity.Role)
+	if err != nil {
+		return nil, err
+	}
+	linked, err := s.Identities.GetIdentity(identity.Issuer, identity.Subject)
+	if err == nil {
+		return s.linkedOIDCUser(linked, identity.Role)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("getting identity from DB: %w , subject: %q ", err, identity.Subject)
+	}
+	_, err = s.User.GetByUsername(identity.Username)
+	if err == nil {
+		return s.concurrentOIDCUser(identity, fmt.Errorf("%w : username %q is taken by another user", ErrConflict, identity.Username))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("getting user from DB: %w , username: %q ", err, identity.Username)
+	}
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{Username: identity.Username, Role: identity.Role}
+	err = user.Password.Set(base64.RawURLEncoding.EncodeToString(secret))
+	if err != nil {
+		return nil, fmt.Errorf("setting password: %w", err)
+	}
+	link := &Identity{Issuer: identity.Issuer, Subject: identity.Subject}
+	err = s.Identities.AddUserIdentity(user, link)
+	if errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrConflict) {
+		return s.concurrentOIDCUser(identity, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("adding user with identity in DB: %w , username: %q ", err, identity.Username)
+	}
+	user, err = s.User.GetByID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting user from DB: %w , username: %q ", err, identity.Username)
+	}
+	return user, nil
+}
+
+// concurrentOIDCUser returns the user linked to the identity when the identity
+// signed in concurrently and its user was added, otherwise it returns err
+func (s *Stores) concurrentOIDCUser(identity *OIDCIdentity, err error) (*User, error) {
+	linked, errL := s.Identities.GetIdentity(identity.Issuer, identity.Subject)
+	if errL != nil {
+		return nil, err
+	}
+	return s.linkedOIDCUser(linked, identity.Role)
+}
+
+// linkedOIDCUser returns the user linked to the identity with the role updated
+// to the mapped one
+func (s *Stores) linkedOIDCUser(linked *Identity, role string) (*User, error) {
+	user, err := s.User.GetByID(linked.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("getting user from DB: %w , user id: %d ", err, linked.UserID)
+	}
+	if user.Role != role {
+		err = s.User.SetRole(user.ID, role)
+		if err != nil {
+			return nil, fmt.Errorf("setting user role in DB: %w , username: %q ", err, user.Username)
+		}
+		user.Role = role
+	}
+	return user, nil
+}
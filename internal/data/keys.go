@@ -0,0 +1,118 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CaseKey is the data key of a case wrapped by a master key, only the wrapped
+// form is ever stored.
+type CaseKey struct {
+	CaseName    string    `json:"case_name"`
+	WrappedKey  []byte    `json:"-"`
+	MasterKeyID string    `json:"master_key_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// KeyStore keeps the wrapped data keys of cases
+type KeyStore interface {
+	AddCaseKey(key *CaseKey) error
+	GetCaseKey(caseName string) (*CaseKey, error)
+	ListCaseKeys() ([]CaseKey, error)
+	UpdateCaseKey(key *CaseKey) error
+	RemoveCaseKey(caseName string) error
+}
+
+type Keys struct {
+	DB *sql.DB
+}
+
+func NewKeyStore(db *sql.DB) KeyStore {
+	return &Keys{
+		DB: db,
+	}
+}
+
+// AddCaseKey stores a wrapped data key for a case, a case can only have one key
+func (k *Keys) AddCaseKey(key *CaseKey) error {
+	err := k.DB.QueryRow(`INSERT INTO "case_keys" ("case_name", "wrapped_key", "master_key_id") VALUES ($1, $2, $3) RETURNING created_at`,
+		key.CaseName, key.WrappedKey, key.MasterKeyID).Scan(&key.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w : key for case : %q", ErrAlreadyExists, key.CaseName)
+		}
+		return fmt.Errorf("inserting case key : %w", err)
+	}
+	return nil
+}
+
+// GetCaseKey returns the wrapped data key of a case or ErrNotFound
+func (k *Keys) GetCaseKey(caseName string) (*CaseKey, error) {
+	key := &CaseKey{}
+	err := k.DB.QueryRow(`SELECT "case_name", "wrapped_key", "master_key_id", "created_at" FROM "case_keys" WHERE case_name = $1`, caseName).
+		Scan(&key.CaseName, &key.WrappedKey, &key.MasterKeyID, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : key for case : %q", ErrNotFound, caseName)
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListCaseKeys returns the wrapped data keys of all cases
+func (k *Keys) ListCaseKeys() ([]CaseKey, error) {
+	rows, err := k.DB.Query(`SELECT "case_name", "wrapped_key", "master_key_id", "created_at" FROM "case_keys" ORDER BY case_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []CaseKey
+	for rows.Next() {
+		var key CaseKey
+		err = rows.Scan(&key.CaseName, &key.WrappedKey, &key.MasterKeyID, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// UpdateCaseKey replaces the wrapped data key of a case, used when the master key is rotated
+func (k *Keys) UpdateCaseKey(key *CaseKey) error {
+	result, err := k.DB.Exec(`UPDATE "case_keys" SET "wrapped_key" = $1, "master_key_id" = $2 WHERE case_name = $3`,
+		key.WrappedKey, key.MasterKeyID, key.CaseName)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w : key for case : %q", ErrNotFound, key.CaseName)
+	}
+	return nil
+}
+
+// RemoveCaseKey removes the data key of a case, evidences encrypted with it can't be read anymore
+func (k *Keys) RemoveCaseKey(caseName string) error {
+	result, err := k.DB.Exec(`DELETE FROM "case_keys" WHERE case_name = $1`, caseName)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w : key for case : %q", ErrNotFound, caseName)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// tmpDir is the directory inside the storage root where evidences are written
+// before they are moved into their case. It can never collide with a case
+// because case names can't start with a dot.
+const tmpDir = ".tmp"
+
+// LocalFS is an ObjectStore that keeps cases as directories and evidences as
+// files on a local or network mounted path.
+type LocalFS struct {
+	Root string
+}
+
+// NewLocalObjectStore creates an ObjectStore rooted at the given path, the
+// directory is created if it doesn't exist.
+func NewLocalObjectStore(root string) (ObjectStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("%w : storage path cannot be empty", ErrInvalidRequest)
+	}
+	err := os.MkdirAll(filepath.Join(root, tmpDir), 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("creating storage root : %w", err)
+	}
+	return &LocalFS{Root: root}, nil
+}
+
+// CreateCase adds a new case directory to the LocalFS named after the storage key
+// of the case, it follows the same rules as in FS so cases can be moved between drivers.
+func (l *LocalFS) CreateCase(cs *Case) error {
+	err := s3utils.CheckValidBucketNameStrict(cs.Bucket())
+	if err != nil {
+		return fmt.Errorf("%w : %v : %q", ErrInvalidRequest, err, cs.Bucket())
+	}
+	err = os.Mkdir(l.casePath(cs.Bucket()), 0o750)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w : case : %q", ErrAlreadyExists, cs.Bucket())
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveCase removes a case directory from the LocalFS, case must be empty
+func (l *LocalFS) RemoveCase(name string) error {
+	err := l.checkCase(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(l.casePath(name))
+}
+
+// CaseExists returns true if the case directory exists in the LocalFS
+func (l *LocalFS) CaseExists(name string) (bool, error) {
+	if s3utils.CheckValidBucketNameStrict(name) != nil {
+		return false, nil
+	}
+	info, err := os.Stat(l.casePath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// ListCases returns a list of cases in the LocalFS
+func (l *LocalFS) ListCases() ([]Case, error) {
+	var cases []Case
+	entries, err := os.ReadDir(l.Root)
+	if err != nil {
+		return cases, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || s3utils.CheckValidBucketNameStrict(entry.Name()) != nil {
+			continue
+		}
+		cases = append(cases, Case{Name: entry.Name()})
+	}
+	return cases, nil
+}
+
+// CreateEvidence writes a new evidence file in the case directory and returns a SHA256
+// hash of that file. The file is written under the temporary directory first and
+// renamed into place, so a partially written evidence is never visible.
+func (l *LocalFS) CreateEvidence(evidence *Evidence, caseName string, file io.Reader) (string, error) {
+	err := checkEvidenceName(evidence.Name)
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("%w : file can't be nil ", ErrInvalidRequest)
+	}
+	err = l.checkCase(caseName)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Join(l.Root, tmpDir), "evidence-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(tmp, io.TeeReader(file, h))
+	if err != nil {
+		return "", fmt.Errorf("writing evidence : %w", err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return "", fmt.Errorf("syncing evidence : %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), l.evidencePath(caseName, evidence.Name))
+	if err != nil {
+		return "", fmt.Errorf("moving evidence into case : %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// EvidenceExists returns true if the evidence file exists in the case directory
+func (l *LocalFS) EvidenceExists(caseName string, evidenceName string) (bool, error) {
+	err := l.checkCase(caseName)
+	if err != nil {
+		return false, err
+	}
+	if checkEvidenceName(evidenceName) != nil {
+		return false, nil
+	}
+	info, err := os.Stat(l.evidencePath(caseName, evidenceName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// RemoveEvidence removes an evidence file from specific case, removing an evidence
+// that doesn't exist is not an error
+func (l *LocalFS) RemoveEvidence(evidence *Evidence, caseName string) error {
+	err := l.checkCase(caseName)
+	if err != nil {
+		return err
+	}
+	err = checkEvidenceName(evidence.Name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(l.evidencePath(caseName, evidence.Name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ListEvidences returns a list of evidence in the case directory
+func (l *LocalFS) ListEvidences(caseName string) ([]Evidence, error) {
+	var evidence []Evidence
+	err := l.checkCase(caseName)
+	if err != nil {
+		return evidence, err
+	}
+	entries, err := os.ReadDir(l.casePath(caseName))
+	if err != nil {
+		return evidence, err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		evidence = append(evidence, Evidence{Name: entry.Name()})
+	}
+	return evidence, nil
+}
+
+// GetEvidence opens the evidence file for reading, caller must close it
+func (l *LocalFS) GetEvidence(caseName string, evidenceName string) (io.ReadCloser, error) {
+	err := l.checkCase(caseName)
+	if err != nil {
+		return nil, err
+	}
+	err = checkEvidenceName(evidenceName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(l.evidencePath(caseName, evidenceName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w : evidence : %q not found", ErrNotFound, evidenceName)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// checkCase returns ErrNotFound if the case directory doesn't exist
+func (l *LocalFS) checkCase(name string) error {
+	exists, err := l.CaseExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w : case : %q", ErrNotFound, name)
+	}
+	return nil
+}
+
+func (l *LocalFS) casePath(name string) string {
+	return filepath.Join(l.Root, name)
+}
+
+func (l *LocalFS) evidencePath(caseName, evidenceName string) string {
+	return filepath.Join(l.Root, caseName, evidenceName)
+}
+
+// checkEvidenceName validates evidence name with the same rules as FS, and also
+// rejects names that would escape the case directory
+func checkEvidenceName(name string) error {
+	if strings.Contains(name, "/") || strings.Contains(name, " ") {
+		return fmt.Errorf("%w : evidence can't contain forward slash or space : %q ", ErrInvalidRequest, name)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "\\\x00") {
+		return fmt.Errorf("%w : invalid evidence name : %q ", ErrInvalidRequest, name)
+	}
+	return nil
+}
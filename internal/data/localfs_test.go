@@ -0,0 +1,265 @@
+package data_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/storetest"
+)
+
+// getTestLocalFS returns a LocalFS rooted in a temporary directory
+func getTestLocalFS(t *testing.T) data.ObjectStore {
+	obs, err := data.NewLocalObjectStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local object store: %v", err)
+	}
+	return obs
+}
+
+func TestCreateCaseInLocalFS(t *testing.T) {
+	tests := []struct {
+		name    string
+		addCase *data.Case
+		want    error
+	}{
+		{
+			name:    "successful with just letters",
+			addCase: &data.Case{Name: "test"},
+		},
+		{
+			name:    "successful with just letters and supported special characters",
+			addCase: &data.Case{Name: "test-test"},
+		},
+		{
+			name:    "failed with an unsupported special character",
+			addCase: &data.Case{Name: "test/test"},
+			want:    data.ErrInvalidRequest,
+		},
+		{
+			name:    "failed with parent directory name",
+			addCase: &data.Case{Name: ".."},
+			want:    data.ErrInvalidRequest,
+		},
+		{
+			name:    "failed with no name",
+			addCase: &data.Case{Name: ""},
+			want:    data.ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs := getTestLocalFS(t)
+			err := obs.CreateCase(tt.addCase)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+func TestCreateCaseInLocalFSReturnedErrorBecauseCaseAlreadyExists(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	err = obs.CreateCase(&data.Case{Name: "test"})
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v, got %v", data.ErrAlreadyExists, err)
+	}
+}
+func TestRemoveCaseInLocalFS(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "test"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	err = obs.RemoveCase("test2")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for non-existing case, got %v", data.ErrNotFound, err)
+	}
+	err = obs.RemoveCase("test")
+	if err != nil {
+		t.Errorf("failed to remove case: %v", err)
+	}
+	exists, err := obs.CaseExists("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("expected case to be removed")
+	}
+}
+func TestListCasesInLocalFSReturnedAllCases(t *testing.T) {
+	obs := getTestLocalFS(t)
+	want := []data.Case{{Name: "first"}, {Name: "second"}}
+	for _, cs := range want {
+		cs := cs
+		err := obs.CreateCase(&cs)
+		if err != nil {
+			t.Fatalf("failed to add case: %v", err)
+		}
+	}
+	got, err := obs.ListCases()
+	if err != nil {
+		t.Fatalf("failed to list cases: %v", err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+func TestCreateEvidenceInLocalFS(t *testing.T) {
+	tests := []struct {
+		name        string
+		addEvidence *data.Evidence
+		caseName    string
+		file        io.Reader
+		want        error
+	}{
+		{
+			name:        "successful with just letters",
+			addEvidence: &data.Evidence{Name: "test"},
+			caseName:    "testcase",
+			file:        bytes.NewBufferString("s"),
+		},
+		{
+			name:        "failed with forward slash",
+			addEvidence: &data.Evidence{Name: "test/test"},
+			caseName:    "testcase",
+			file:        bytes.NewBufferString("s"),
+			want:        data.ErrInvalidRequest,
+		},
+		{
+			name:        "failed with space",
+			addEvidence: &data.Evidence{Name: "test test"},
+			caseName:    "testcase",
+			file:        bytes.NewBufferString("s"),
+			want:        data.ErrInvalidRequest,
+		},
+		{
+			name:        "failed with parent directory name",
+			addEvidence: &data.Evidence{Name: ".."},
+			caseName:    "testcase",
+			file:        bytes.NewBufferString("s"),
+			want:        data.ErrInvalidRequest,
+		},
+		{
+			name:        "failed with no file",
+			addEvidence: &data.Evidence{Name: "test"},
+			caseName:    "testcase",
+			want:        data.ErrInvalidRequest,
+		},
+		{
+			name:        "failed with case that doesn't exist",
+			addEvidence: &data.Evidence{Name: "test"},
+			caseName:    "missing",
+			file:        bytes.NewBufferString("s"),
+			want:        data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs := getTestLocalFS(t)
+			err := obs.CreateCase(&data.Case{Name: "testcase"})
+			if err != nil {
+				t.Fatalf("failed to add case: %v", err)
+			}
+			_, err = obs.CreateEvidence(tt.addEvidence, tt.caseName, tt.file)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+func TestCreateEvidenceInLocalFSReturnedSHA256AndStoredContent(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	hash, err := obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewBufferString("sample"))
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	want := "af2bdbe1aa9b6ec1e2ade1d694f41fc71a831d0268e9891562113d8a62add1bf"
+	if hash != want {
+		t.Errorf("expected hash %q, got %q", want, hash)
+	}
+	file, err := obs.GetEvidence("testcase", "video")
+	if err != nil {
+		t.Fatalf("failed to get evidence: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "sample" {
+		t.Errorf("expected content %q, got %q", "sample", content)
+	}
+}
+func TestEvidenceExistsInLocalFSReturns(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewBufferString("sample"))
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	exists, err := obs.EvidenceExists("testcase", "video")
+	if err != nil || !exists {
+		t.Errorf("expected existing evidence to exist, got %v, %v", exists, err)
+	}
+	exists, err = obs.EvidenceExists("testcase", "picture")
+	if err != nil || exists {
+		t.Errorf("expected missing evidence not to exist, got %v, %v", exists, err)
+	}
+}
+func TestGetEvidenceInLocalFSThatDoesNotExistReturnedNotFound(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	_, err = obs.GetEvidence("testcase", "video")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v, got %v", data.ErrNotFound, err)
+	}
+}
+func TestRemoveAndListEvidencesInLocalFS(t *testing.T) {
+	obs := getTestLocalFS(t)
+	err := obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	for _, name := range []string{"file1", "file2"} {
+		_, err = obs.CreateEvidence(&data.Evidence{Name: name}, "testcase", bytes.NewBufferString(name))
+		if err != nil {
+			t.Fatalf("failed to create evidence: %v", err)
+		}
+	}
+	err = obs.RemoveEvidence(&data.Evidence{Name: "file1"}, "testcase")
+	if err != nil {
+		t.Fatalf("failed to remove evidence: %v", err)
+	}
+	got, err := obs.ListEvidences("testcase")
+	if err != nil {
+		t.Fatalf("failed to list evidences: %v", err)
+	}
+	want := []data.Evidence{{Name: "file2"}}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	err = obs.RemoveCase("testcase")
+	if err == nil {
+		t.Errorf("expected error removing case that is not empty")
+	}
+}
+func TestLocalFSConformance(t *testing.T) {
+	storetest.RunObjectStoreSuite(t, getTestLocalFS)
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Roles a user can have in a case, each role can do what the roles before it can
+const (
+	CaseViewer      = "viewer"
+	CaseContributor = "contributor"
+	CaseOwner       = "owner"
+)
+
+// caseRoleRanks orders the case roles, a higher rank includes the lower ones
+var caseRoleRanks = map[string]int{
+	CaseViewer:      1,
+	CaseContributor: 2,
+	CaseOwner:       3,
+}
+
+// CaseMember is a user with access to a case, the user who created the case is
+// its owner
+type CaseMember struct {
+	CaseID   int64  `json:"case_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ValidateCaseRole returns ErrInvalidRequest if the role is not a case role
+func ValidateCaseRole(role string) error {
+	if _, ok := caseRoleRanks[role]; !ok {
+		return fmt.Errorf("%w : unknown case role %q, roles are %q", ErrInvalidRequest, role, []string{CaseViewer, CaseContributor, CaseOwner})
+	}
+	return nil
+}
+
+// CaseRoleAllows reports whether the case role includes the needed role
+func CaseRoleAllows(role string, need string) bool {
+	rank, ok := caseRoleRanks[role]
+	return ok && rank >= caseRoleRanks[need]
+}
+
+// AddCaseMember gives the user access to the case with the role, the role of an
+// existing member is changed
+func (d *DB) AddCaseMember(member *CaseMember) error {
+	_, err := d.DB.Exec(`INSERT INTO "user_cases" ("user_id", "case_id", "role") VALUES ($1, $2, $3)
+		ON CONFLICT ("user_id", "case_id") DO UPDATE SET "role" = EXCLUDED."role"`,
+		member.UserID, member.CaseID, member.Role)
+	return err
+}
+
+// GetCaseMember returns the membership of the user in the case or ErrNotFound
+func (d *DB) GetCaseMember(caseID int64, userID int64) (*CaseMember, error) {
+	var m CaseMember
+	err := d.DB.QueryRow(`SELECT uc.case_id, uc.user_id, u.username, uc.role FROM "user_cases" uc
+		JOIN "users" u ON u.id = uc.user_id WHERE uc.case_id = $1 AND uc.user_id = $2`, caseID, userID).
+		Scan(&m.CaseID, &m.UserID, &m.Username, &m.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : user id %d is not a member of case id %d", ErrNotFound, userID, caseID)
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListCaseMembers returns the members of the case ordered by username
+func (d *DB) ListCaseMembers(caseID int64) ([]CaseMember, error) {
+	rows, err := d.DB.Query(`SELECT uc.case_id, uc.user_id, u.username, uc.role FROM "user_cases" uc
+		JOIN "users" u ON u.id = uc.user_id WHERE uc.case_id = $1 ORDER BY u.username`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []CaseMember
+	for rows.Next() {
+		var m CaseMember
+		err = rows.Scan(&m.CaseID, &m.UserID, &m.Username, &m.Role)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// RemoveCaseMember removes the access of the user to the case or returns ErrNotFound
+func (d *DB) RemoveCaseMember(caseID int64, userID int64) error {
+	result, err := d.DB.Exec(`DELETE FROM "user_cases" WHERE case_id = $1 AND user_id = $2`, caseID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : user id %d is not a member of case id %d", ErrNotFound, userID, caseID)
+	}
+	return nil
+}
+
+// CheckCaseAccess returns ErrForbidden unless the user is a member of the case
+// with a role that includes the needed case role. Users whose role grants
+// PermCaseAll can access every case.
+func (s *Stores) CheckCaseAccess(cs *Case, user *User, need string) error {
+	if HasPermission(user.Role, PermCaseAll) {
+		return nil
+	}
+	member, err := s.DBStore.GetCaseMember(cs.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w : user %q is not a member of case %q", ErrForbidden, user.Username, cs.Name)
+		}
+		return fmt.Errorf("getting case member from DB: %w , case id: %d ", err, cs.ID)
+	}
+	if !CaseRoleAllows(member.Role, need) {
+		return fmt.Errorf("%w : user %q is a %s of case %q, %s is needed", ErrForbidden, user.Username, member.Role, cs.Name, need)
+	}
+	return nil
+}
+
+// ListUserCases returns the cases the user is a member of, or every case when
+// the role of the user grants PermCaseAll
+func (s *Stores) ListUserCases(user *User) ([]Case, error) {
+	cases, err := s.ListCases()
+	if err != nil {
+		return nil, err
+	}
+	if HasPermission(user.Role, PermCaseAll) {
+		return cases, nil
+	}
+	memberOf, err := s.DBStore.GetCaseByUserID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list user cases from DB: %w ", err)
+	}
+	ids := make(map[int64]bool, len(memberOf))
+	for _, cs := range memberOf {
+		ids[cs.ID] = true
+	}
+	var list []Case
+	for _, cs := range cases {
+		if ids[cs.ID] {
+			list = append(list, cs)
+		}
+	}
+	return list, nil
+}
+
+// FilterUserEvidences returns the evidences of the cases the user is a member of
+func (s *Stores) FilterUserEvidences(evidences []Evidence, user *User) ([]Evidence, error) {
+	if HasPermission(user.Role, PermCaseAll) {
+		return evidences, nil
+	}
+	var list []Evidence
+	for _, ev := range evidences {
+		_, err := s.DBStore.GetCaseMember(ev.CaseID, user.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting case member from DB: %w , case id: %d ", err, ev.CaseID)
+		}
+		list = append(list, ev)
+	}
+	return list, nil
+}
+
+// SetCaseMember gives the user access to the case with the case role
+func (s *Stores) SetCaseMember(cs *Case, username string, role string) (*CaseMember, error) {
+	err := ValidateCaseRole(role)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+	if role != CaseOwner {
+		err = s.checkOtherOwner(cs, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	member := &CaseMember{CaseID: cs.ID, UserID: user.ID, Username: user.Username, Role: role}
+	err = s.DBStore.AddCaseMember(member)
+	if err != nil {
+		return nil, fmt.Errorf("adding case member in DB: %w , username: %q ", err, username)
+	}
+	return member, nil
+}
+
+// RemoveCaseMember removes the access of the user to the case, the last owner
+// of a case can't be removed
+func (s *Stores) RemoveCaseMember(cs *Case, username string) error {
+	user, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	err = s.checkOtherOwner(cs, user)
+	if err != nil {
+		return err
+	}
+	err = s.DBStore.RemoveCaseMember(cs.ID, user.ID)
+	if err != nil {
+		return fmt.Errorf("removing case member from DB: %w , username: %q ", err, username)
+	}
+	return nil
+}
+
+// ListCaseMembers returns the members of the case
+func (s *Stores) ListCaseMembers(cs *Case) ([]CaseMember, error) {
+	members, err := s.DBStore.ListCaseMembers(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list case members from DB: %w , case id: %d ", err, cs.ID)
+	}
+	return members, nil
+}
+
+// checkOtherOwner returns ErrConflict when the user is the only owner of the
+// case, so the case keeps an owner when the user loses ownership
+func (s *Stores) checkOtherOwner(cs *Case, user *User) error {
+	members, err := s.ListCaseMembers(cs)
+	if err != nil {
+		return err
+	}
+	owners, isOwner := 0, false
+	for _, m := range members {
+		if m.Role == CaseOwner {
+			owners++
+			isOwner = isOwner || m.UserID == user.ID
+		}
+	}
+	if isOwner && owners == 1 {
+		return fmt.Errorf("%w : %q is the last owner of case %q", ErrConflict, user.Username, cs.Name)
+	}
+	return nil
+}
+
+// userByName returns the user or ErrNotFound
+func (s *Stores) userByName(username string) (*User, error) {
+	user, err := s.User.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : user %q", ErrNotFound, username)
+		}
+		return nil, fmt.Errorf("getting user from DB: %w , username: %q ", err, username)
+	}
+	return user, nil
+}
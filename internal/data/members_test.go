@@ -0,0 +1,176 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// getTestMemberStores returns the hold test stores with the clerk owning the
+// case and a user with the role who isn't a member of it
+func getTestMemberStores(t *testing.T, role string) (data.Stores, *data.Case, *data.User) {
+	stores, cs := getTestHoldStores(t)
+	err := stores.CreateUser(&data.UserRequest{Username: "member", Password: "secret", Role: role})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := stores.User.GetByUsername("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stores, cs, user
+}
+
+func TestCheckCaseAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		member  string
+		need    string
+		wantErr error
+	}{
+		{name: "viewer reading allowed", role: data.RoleDefense, member: data.CaseViewer, need: data.CaseViewer},
+		{name: "viewer contributing forbidden", role: data.RoleDefense, member: data.CaseViewer, need: data.CaseContributor, wantErr: data.ErrForbidden},
+		{name: "contributor contributing allowed", role: data.RoleClerk, member: data.CaseContributor, need: data.CaseContributor},
+		{name: "contributor owning forbidden", role: data.RoleClerk, member: data.CaseContributor, need: data.CaseOwner, wantErr: data.ErrForbidden},
+		{name: "owner owning allowed", role: data.RoleJudge, member: data.CaseOwner, need: data.CaseOwner},
+		{name: "user who isn't a member forbidden", role: data.RoleJudge, need: data.CaseViewer, wantErr: data.ErrForbidden},
+		{name: "administrator who isn't a member allowed", role: data.RoleAdministrator, need: data.CaseOwner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs, user := getTestMemberStores(t, tt.role)
+			if tt.member != "" {
+				_, err := stores.SetCaseMember(cs, user.Username, tt.member)
+				if err != nil {
+					t.Fatalf("failed to add member: %v", err)
+				}
+			}
+			err := stores.CheckCaseAccess(cs, user, tt.need)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestListUserCasesReturnedCasesOfMember(t *testing.T) {
+	stores, cs, user := getTestMemberStores(t, data.RoleDefense)
+	err := stores.CreateCase(user, "other")
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	other, err := stores.DBStore.GetCaseByName("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := stores.ListUserCases(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []data.Case{*other}; !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	_, err = stores.SetCaseMember(cs, user.Username, data.CaseViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = stores.ListUserCases(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []data.Case{*cs, *other}; !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func TestCaseMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(stores data.Stores, cs *data.Case) error
+		want    []data.CaseMember
+		wantErr error
+	}{
+		{
+			name: "adding a member successful",
+			change: func(stores data.Stores, cs *data.Case) error {
+				_, err := stores.SetCaseMember(cs, "member", data.CaseContributor)
+				return err
+			},
+			want: []data.CaseMember{
+				{CaseID: 1, UserID: 1, Username: "clerk", Role: data.CaseOwner},
+				{CaseID: 1, UserID: 2, Username: "member", Role: data.CaseContributor},
+			},
+		},
+		{
+			name: "adding a member with an unknown role failed",
+			change: func(stores data.Stores, cs *data.Case) error {
+				_, err := stores.SetCaseMember(cs, "member", data.RoleJudge)
+				return err
+			},
+			wantErr: data.ErrInvalidRequest,
+		},
+		{
+			name: "adding a missing user failed",
+			change: func(stores data.Stores, cs *data.Case) error {
+				_, err := stores.SetCaseMember(cs, "nobody", data.CaseViewer)
+				return err
+			},
+			wantErr: data.ErrNotFound,
+		},
+		{
+			name: "demoting the last owner failed",
+			change: func(stores data.Stores, cs *data.Case) error {
+				_, err := stores.SetCaseMember(cs, "clerk", data.CaseViewer)
+				return err
+			},
+			wantErr: data.ErrConflict,
+		},
+		{
+			name: "removing the last owner failed",
+			change: func(stores data.Stores, cs *data.Case) error {
+				return stores.RemoveCaseMember(cs, "clerk")
+			},
+			wantErr: data.ErrConflict,
+		},
+		{
+			name: "removing an owner after adding another successful",
+			change: func(stores data.Stores, cs *data.Case) error {
+				_, err := stores.SetCaseMember(cs, "member", data.CaseOwner)
+				if err != nil {
+					return err
+				}
+				return stores.RemoveCaseMember(cs, "clerk")
+			},
+			want: []data.CaseMember{{CaseID: 1, UserID: 2, Username: "member", Role: data.CaseOwner}},
+		},
+		{
+			name: "removing a user who isn't a member failed",
+			change: func(stores data.Stores, cs *data.Case) error {
+				return stores.RemoveCaseMember(cs, "member")
+			},
+			wantErr: data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs, _ := getTestMemberStores(t, data.RoleClerk)
+			err := tt.change(stores, cs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			got, err := stores.ListCaseMembers(cs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// CertificateStore is an in-memory data.CertificateStore
+type CertificateStore struct {
+	mu    sync.RWMutex
+	ids   sequence
+	certs []data.DestructionCertificate
+}
+
+// NewCertificateStore creates an empty in-memory CertificateStore
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{}
+}
+
+// AddCertificate stores a certificate and sets its ID, a case can only have one certificate
+func (c *CertificateStore) AddCertificate(cert *data.DestructionCertificate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, stored := range c.certs {
+		if stored.CaseID == cert.CaseID {
+			return fmt.Errorf("inserting destruction certificate : %w : case id : %d", data.ErrAlreadyExists, cert.CaseID)
+		}
+	}
+	cert.ID = c.ids.next()
+	c.certs = append(c.certs, copyCertificate(*cert))
+	return nil
+}
+
+// GetCertificate returns a certificate by its ID or ErrNotFound
+func (c *CertificateStore) GetCertificate(id int64) (*data.DestructionCertificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, cert := range c.certs {
+		if cert.ID == id {
+			cert = copyCertificate(cert)
+			return &cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : certificate id : %d", data.ErrNotFound, id)
+}
+
+// GetCertificateByCaseID returns the certificate of a case or ErrNotFound
+func (c *CertificateStore) GetCertificateByCaseID(caseID int64) (*data.DestructionCertificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, cert := range c.certs {
+		if cert.CaseID == caseID {
+			cert = copyCertificate(cert)
+			return &cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : certificate for case id : %d", data.ErrNotFound, caseID)
+}
+
+// ListCertificates returns all certificates ordered by ID
+func (c *CertificateStore) ListCertificates() ([]data.DestructionCertificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var certs []data.DestructionCertificate
+	for _, cert := range c.certs {
+		certs = append(certs, copyCertificate(cert))
+	}
+	return certs, nil
+}
+
+func copyCertificate(cert data.DestructionCertificate) data.DestructionCertificate {
+	cert.Evidences = append([]data.DestroyedEvidence{}, cert.Evidences...)
+	cert.Signature = append([]byte{}, cert.Signature...)
+	return cert
+}
@@ -0,0 +1,91 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// CustodyStore is an in-memory data.CustodyStore
+type CustodyStore struct {
+	mu          sync.RWMutex
+	ids         sequence
+	checkpoints sequence
+	events      []data.CustodyEvent
+	signed      []data.AuditCheckpoint
+}
+
+// NewCustodyStore creates an empty in-memory CustodyStore
+func NewCustodyStore() *CustodyStore {
+	return &CustodyStore{}
+}
+
+// AddCustodyEvent links the event to the last event of the audit log, stores it
+// and sets its ID
+func (c *CustodyStore) AddCustodyEvent(event *data.CustodyEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var prevSeq int64
+	var prevHash string
+	if n := len(c.events); n > 0 {
+		prevSeq, prevHash = c.events[n-1].Seq, c.events[n-1].EntryHash
+	}
+	event.Link(prevSeq, prevHash)
+	event.ID = c.ids.next()
+	c.events = append(c.events, *event)
+	return nil
+}
+
+// ListCustodyEvents returns the chain of custody of an evidence, oldest first
+func (c *CustodyStore) ListCustodyEvents(evidenceID int64) ([]data.CustodyEvent, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var events []data.CustodyEvent
+	for _, e := range c.events {
+		if e.EvidenceID == evidenceID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// ListAuditLog returns the events of all evidences in the order they were added
+func (c *CustodyStore) ListAuditLog() ([]data.CustodyEvent, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]data.CustodyEvent(nil), c.events...), nil
+}
+
+// LastCustodyEvent returns the last event of the audit log or ErrNotFound when it is empty
+func (c *CustodyStore) LastCustodyEvent() (*data.CustodyEvent, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.events) == 0 {
+		return nil, fmt.Errorf("%w : audit log is empty", data.ErrNotFound)
+	}
+	last := c.events[len(c.events)-1]
+	return &last, nil
+}
+
+// AddCheckpoint stores a signed checkpoint and sets its ID, like DB another
+// checkpoint following the same checkpoint returns ErrConflict
+func (c *CustodyStore) AddCheckpoint(cp *data.AuditCheckpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, signed := range c.signed {
+		if signed.PrevCheckpoint == cp.PrevCheckpoint {
+			return fmt.Errorf("%w : checkpoint %q is already followed by a checkpoint", data.ErrConflict, cp.PrevCheckpoint)
+		}
+	}
+	cp.ID = c.checkpoints.next()
+	c.signed = append(c.signed, *cp)
+	return nil
+}
+
+// ListCheckpoints returns all checkpoints ordered by ID
+func (c *CustodyStore) ListCheckpoints() ([]data.AuditCheckpoint, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]data.AuditCheckpoint(nil), c.signed...), nil
+}
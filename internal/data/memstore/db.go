@@ -0,0 +1,507 @@
+package memstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// errForeignKey is returned where Postgres would fail on a foreign key constraint
+var errForeignKey = errors.New("violates foreign key constraint")
+
+// errUniqueStorageKey is returned where Postgres would fail on the unique storage key of cases
+var errUniqueStorageKey = errors.New("duplicate key value violates unique constraint \"cases_storage_key_key\"")
+
+// errUniqueEvidenceName is returned where Postgres would fail on the unique name of evidences in a folder
+var errUniqueEvidenceName = errors.New("duplicate key value violates unique constraint \"evidences_case_folder_name\"")
+
+type userCase struct {
+	userID int64
+	caseID int64
+	role   string
+}
+
+// DBStore is an in-memory data.DBStore
+type DBStore struct {
+	mu          sync.RWMutex
+	users       *UserStore
+	presigned   *PresignedUploadStore
+	custody     *CustodyStore
+	caseIDs     sequence
+	evidenceIDs sequence
+	commentIDs  sequence
+	folderIDs   sequence
+	cases       []data.Case
+	userCases   []userCase
+	evidences   []data.Evidence
+	versions    []data.EvidenceVersion
+	comments    []data.Comment
+	folders     []data.Folder
+}
+
+// NewDBStore creates an empty in-memory DBStore, users are used to check
+// that cases are added by existing users. Presigned uploads that evidences are
+// completed from are removed from presigned when the evidence is created and
+// the custody events of changes to evidences are added to custody.
+func NewDBStore(users *UserStore, presigned *PresignedUploadStore, custody *CustodyStore) *DBStore {
+	return &DBStore{users: users, presigned: presigned, custody: custody}
+}
+
+// AddCase a new case or return an error, like DB it doesn't set the ID on the given case
+func (d *DBStore) AddCase(cs *data.Case, user *data.User) error {
+	if cs.Name == "" {
+		return fmt.Errorf("%w : case name cannot be empty", data.ErrInvalidRequest)
+	}
+	if d.users != nil && !d.users.exists(user.ID) {
+		return fmt.Errorf("inserting user case : %w", errForeignKey)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.cases {
+		if cs.StorageKey != "" && c.StorageKey == cs.StorageKey {
+			return fmt.Errorf("inserting case : %w", errUniqueStorageKey)
+		}
+	}
+	id := d.caseIDs.next()
+	d.cases = append(d.cases, data.Case{ID: id, Name: cs.Name, Tags: copyTags(cs.Tags), StorageKey: cs.StorageKey})
+	d.userCases = append(d.userCases, userCase{userID: user.ID, caseID: id, role: data.CaseOwner})
+	return nil
+}
+
+// CaseExists returns true if the case exists
+func (d *DBStore) CaseExists(name string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.caseByName(name)
+	return ok, nil
+}
+
+// ListCases all cases
+func (d *DBStore) ListCases() ([]data.Case, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var cases []data.Case
+	for _, cs := range d.cases {
+		cases = append(cases, copyCase(cs))
+	}
+	return cases, nil
+}
+
+// GetCaseByName returns a case by name or sql.ErrNoRows
+func (d *DBStore) GetCaseByName(name string) (*data.Case, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	cs, ok := d.caseByName(name)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := copyCase(cs)
+	return &found, nil
+}
+
+// GetCaseByID returns a case by id or sql.ErrNoRows
+func (d *DBStore) GetCaseByID(id int64) (*data.Case, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, cs := range d.cases {
+		if cs.ID == id {
+			found := copyCase(cs)
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetCaseByUserID returns the cases added by the user
+func (d *DBStore) GetCaseByUserID(userID int64) ([]data.Case, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var cases []data.Case
+	for _, cs := range d.cases {
+		for _, uc := range d.userCases {
+			if uc.caseID == cs.ID && uc.userID == userID {
+				cases = append(cases, copyCase(cs))
+				break
+			}
+		}
+	}
+	return cases, nil
+}
+
+// RemoveCase removes a case, it fails if the case still has evidences
+func (d *DBStore) RemoveCase(cs *data.Case) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, ev := range d.evidences {
+		if ev.CaseID == cs.ID {
+			return fmt.Errorf("deleting case %d : %w", cs.ID, errForeignKey)
+		}
+	}
+	var userCases []userCase
+	for _, uc := range d.userCases {
+		if uc.caseID != cs.ID {
+			userCases = append(userCases, uc)
+		}
+	}
+	d.userCases = userCases
+	var cases []data.Case
+	for _, c := range d.cases {
+		if c.ID != cs.ID {
+			cases = append(cases, c)
+		}
+	}
+	d.cases = cases
+	var folders []data.Folder
+	for _, f := range d.folders {
+		if f.CaseID != cs.ID {
+			folders = append(folders, f)
+		}
+	}
+	d.folders = folders
+	return nil
+}
+
+// FindCaseByTags returns cases that contain all the tags
+func (d *DBStore) FindCaseByTags(tags []string) ([]data.Case, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var cases []data.Case
+	for _, cs := range d.cases {
+		if cs.Tags != nil && containsAll(cs.Tags, tags) {
+			cases = append(cases, copyCase(cs))
+		}
+	}
+	return cases, nil
+}
+
+// CreateEvidence creates a new evidence in specific case with its first version
+// and the folders it is in, it returns the new evidence ID
+func (d *DBStore) CreateEvidence(evidence *data.Evidence) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.caseIDExists(evidence.CaseID) {
+		return 0, fmt.Errorf("inserting evidence : %w", errForeignKey)
+	}
+	if _, ok := d.evidenceByName(evidence.CaseID, evidence.Folder, evidence.Name); ok {
+		return 0, fmt.Errorf("inserting evidence : %w", errUniqueEvidenceName)
+	}
+	err := d.removePresignedUpload(evidence.PresignedUploadID)
+	if err != nil {
+		return 0, err
+	}
+	d.addFolders(evidence.CaseID, evidence.Folder)
+	evidence.ID = d.evidenceIDs.next()
+	d.evidences = append(d.evidences, data.Evidence{
+		ID:             evidence.ID,
+		CaseID:         evidence.CaseID,
+		Name:           evidence.Name,
+		Folder:         evidence.Folder,
+		ObjectName:     evidence.Object(),
+		Hash:           evidence.Hash,
+		Hashes:         evidence.Hashes.Stored(evidence.Hash),
+		TimestampToken: evidence.TimestampToken,
+	})
+	d.versions = append(d.versions, data.EvidenceVersion{
+		EvidenceID:     evidence.ID,
+		Version:        1,
+		Hash:           evidence.Hash,
+		Hashes:         evidence.Hashes.Stored(evidence.Hash),
+		ObjectName:     evidence.Object(),
+		UploadedBy:     evidence.UploadedBy,
+		CreatedAt:      time.Now(),
+		TimestampToken: evidence.TimestampToken,
+	})
+	if evidence.Custody != nil {
+		evidence.Custody.EvidenceID = evidence.ID
+		evidence.Custody.Version = 1
+	}
+	return evidence.ID, d.addCustodyEvent(evidence.Custody)
+}
+
+// GetEvidenceByID returns an evidence by its ID from specific case or sql.ErrNoRows
+func (d *DBStore) GetEvidenceByID(id int64, caseID int64) (*data.Evidence, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, ev := range d.evidences {
+		if ev.ID == id && ev.CaseID == caseID {
+			found := ev
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// EvidenceExists checks if an evidence with the name exists in the evidence folder
+func (d *DBStore) EvidenceExists(evidence *data.Evidence) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.evidenceByName(evidence.CaseID, evidence.Folder, evidence.Name)
+	return ok, nil
+}
+
+// GetEvidenceByName returns an evidence by its name from a folder of specific case or ErrInvalidRequest
+func (d *DBStore) GetEvidenceByName(cs *data.Case, folder string, name string) (*data.Evidence, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ev, ok := d.evidenceByName(cs.ID, folder, name)
+	if !ok {
+		return nil, fmt.Errorf("%w :evidence not found: %q", data.ErrInvalidRequest, name)
+	}
+	return &ev, nil
+}
+
+// RemoveEvidence deletes an evidence and its comments
+func (d *DBStore) RemoveEvidence(evidence *data.Evidence) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var comments []data.Comment
+	for _, cm := range d.comments {
+		if cm.EvidenceID != evidence.ID {
+			comments = append(comments, cm)
+		}
+	}
+	d.comments = comments
+	var evidences []data.Evidence
+	for _, ev := range d.evidences {
+		if ev.ID != evidence.ID || ev.CaseID != evidence.CaseID {
+			evidences = append(evidences, ev)
+		}
+	}
+	d.evidences = evidences
+	var versions []data.EvidenceVersion
+	for _, v := range d.versions {
+		if v.EvidenceID != evidence.ID {
+			versions = append(versions, v)
+		}
+	}
+	d.versions = versions
+	return d.addCustodyEvent(evidence.Custody)
+}
+
+// GetEvidenceByCaseID returns all evidences from specific case
+func (d *DBStore) GetEvidenceByCaseID(CaseID int64) ([]data.Evidence, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var evidences []data.Evidence
+	for _, ev := range d.evidences {
+		if ev.CaseID == CaseID {
+			evidences = append(evidences, ev)
+		}
+	}
+	return evidences, nil
+}
+
+// AddEvidenceVersion adds the next version of an evidence and makes its hash the
+// hash of the evidence
+func (d *DBStore) AddEvidenceVersion(version *data.EvidenceVersion) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	index := -1
+	for i, ev := range d.evidences {
+		if ev.ID == version.EvidenceID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%w : evidence id : %d", data.ErrNotFound, version.EvidenceID)
+	}
+	err := d.removePresignedUpload(version.PresignedUploadID)
+	if err != nil {
+		return err
+	}
+	version.Version = 1
+	for _, v := range d.versions {
+		if v.EvidenceID == version.EvidenceID && v.Version >= version.Version {
+			version.Version = v.Version + 1
+		}
+	}
+	version.CreatedAt = time.Now()
+	stored := *version
+	stored.Hashes = version.Hashes.Stored(version.Hash)
+	d.versions = append(d.versions, stored)
+	d.evidences[index].Hash = version.Hash
+	d.evidences[index].Hashes = version.Hashes.Stored(version.Hash)
+	d.evidences[index].TimestampToken = version.TimestampToken
+	if version.Custody != nil {
+		version.Custody.EvidenceID = version.EvidenceID
+		version.Custody.Version = version.Version
+	}
+	return d.addCustodyEvent(version.Custody)
+}
+
+// GetEvidenceVersion returns a version of an evidence or ErrNotFound
+func (d *DBStore) GetEvidenceVersion(evidenceID int64, version int64) (*data.EvidenceVersion, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, v := range d.versions {
+		if v.EvidenceID == evidenceID && v.Version == version {
+			found := v
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : version %d of evidence id : %d", data.ErrNotFound, version, evidenceID)
+}
+
+// ListEvidenceVersions returns all versions of an evidence from the oldest to the newest
+func (d *DBStore) ListEvidenceVersions(evidenceID int64) ([]data.EvidenceVersion, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var versions []data.EvidenceVersion
+	for _, v := range d.versions {
+		if v.EvidenceID == evidenceID {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// FindEvidencesByHash returns the evidences of all cases with a version whose
+// content has the digest of the algorithm
+func (d *DBStore) FindEvidencesByHash(algorithm string, digest string) ([]data.Evidence, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if !data.SupportedHashAlgorithm(algorithm) {
+		return nil, fmt.Errorf("%w : unsupported hash algorithm %q", data.ErrInvalidRequest, algorithm)
+	}
+	matched := map[int64]bool{}
+	for _, v := range d.versions {
+		if v.Hashes[algorithm] == digest {
+			matched[v.EvidenceID] = true
+		}
+	}
+	var evidences []data.Evidence
+	for _, ev := range d.evidences {
+		if matched[ev.ID] {
+			evidences = append(evidences, ev)
+		}
+	}
+	sort.Slice(evidences, func(i, j int) bool { return evidences[i].ID < evidences[j].ID })
+	return evidences, nil
+}
+
+// AddComment adds a comment to an existing evidence
+func (d *DBStore) AddComment(comment *data.Comment) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := false
+	for _, ev := range d.evidences {
+		if ev.ID == comment.EvidenceID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("inserting comment : %w", errForeignKey)
+	}
+	d.comments = append(d.comments, data.Comment{
+		ID:         d.commentIDs.next(),
+		EvidenceID: comment.EvidenceID,
+		Text:       comment.Text,
+	})
+	return d.addCustodyEvent(comment.Custody)
+}
+
+// GetCommentsByID returns all comments of an evidence
+func (d *DBStore) GetCommentsByID(evidenceID int64) ([]data.Comment, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var comments []data.Comment
+	for _, cm := range d.comments {
+		if cm.EvidenceID == evidenceID {
+			comments = append(comments, cm)
+		}
+	}
+	return comments, nil
+}
+
+// removePresignedUpload removes the presigned upload an evidence or version is
+// completed from, like DB only the first completion finds it
+func (d *DBStore) removePresignedUpload(id string) error {
+	if id == "" {
+		return nil
+	}
+	if d.presigned == nil {
+		return fmt.Errorf("%w : presigned upload id : %q", data.ErrNotFound, id)
+	}
+	return d.presigned.RemovePresignedUpload(id)
+}
+
+// addCustodyEvent adds the custody event of a change with the change, like DB a
+// nil event is not recorded
+func (d *DBStore) addCustodyEvent(event *data.CustodyEvent) error {
+	if event == nil || d.custody == nil {
+		return nil
+	}
+	return d.custody.AddCustodyEvent(event)
+}
+
+func (d *DBStore) caseByName(name string) (data.Case, bool) {
+	for _, cs := range d.cases {
+		if cs.Name == name {
+			return cs, true
+		}
+	}
+	return data.Case{}, false
+}
+
+func (d *DBStore) caseIDExists(id int64) bool {
+	for _, cs := range d.cases {
+		if cs.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DBStore) evidenceByName(caseID int64, folder string, name string) (data.Evidence, bool) {
+	for _, ev := range d.evidences {
+		if ev.CaseID == caseID && ev.Folder == folder && ev.Name == name {
+			return ev, true
+		}
+	}
+	return data.Evidence{}, false
+}
+
+// setVerification updates the verification status and time of an evidence, it
+// reports whether the evidence exists
+func (d *DBStore) setVerification(evidence *data.Evidence) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.evidences {
+		if d.evidences[i].ID == evidence.ID {
+			d.evidences[i].VerifiedAt = copyTime(evidence.VerifiedAt)
+			d.evidences[i].VerificationStatus = evidence.VerificationStatus
+			return true
+		}
+	}
+	return false
+}
+
+func copyCase(cs data.Case) data.Case {
+	cs.Tags = copyTags(cs.Tags)
+	return cs
+}
+
+// containsAll reports whether all the wanted values are in values
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, v := range values {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// AddFolder adds a folder with the folders it is in and sets its ID and creation
+// time, it returns ErrAlreadyExists when the folder exists
+func (d *DBStore) AddFolder(folder *data.Folder) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.caseIDExists(folder.CaseID) {
+		return fmt.Errorf("inserting folder : %w", errForeignKey)
+	}
+	if _, ok := d.folderByPath(folder.CaseID, folder.Path); ok {
+		return fmt.Errorf("%w : folder : %q", data.ErrAlreadyExists, folder.Path)
+	}
+	d.addFolders(folder.CaseID, folder.Path)
+	found, _ := d.folderByPath(folder.CaseID, folder.Path)
+	*folder = found
+	return nil
+}
+
+// GetFolder returns a folder of a case by its path or ErrNotFound
+func (d *DBStore) GetFolder(caseID int64, path string) (*data.Folder, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	folder, ok := d.folderByPath(caseID, path)
+	if !ok {
+		return nil, fmt.Errorf("%w : folder : %q", data.ErrNotFound, path)
+	}
+	return &folder, nil
+}
+
+// ListFolders returns the folders directly in the parent folder ordered by path
+func (d *DBStore) ListFolders(caseID int64, parent string) ([]data.Folder, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var folders []data.Folder
+	for _, f := range d.folders {
+		if f.CaseID == caseID && data.FolderParent(f.Path) == parent {
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Path < folders[j].Path })
+	return folders, nil
+}
+
+// MoveEvidence moves the evidence to the folder under the name, the folder is
+// added when it doesn't exist. It returns ErrAlreadyExists when the folder has
+// an evidence with the name.
+func (d *DBStore) MoveEvidence(evidence *data.Evidence, folder string, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	index := -1
+	for i, ev := range d.evidences {
+		if ev.ID == evidence.ID && ev.CaseID == evidence.CaseID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%w : evidence id : %d", data.ErrNotFound, evidence.ID)
+	}
+	if other, ok := d.evidenceByName(evidence.CaseID, folder, name); ok && other.ID != evidence.ID {
+		return fmt.Errorf("%w : evidence %q in folder %q", data.ErrAlreadyExists, name, folder)
+	}
+	d.addFolders(evidence.CaseID, folder)
+	d.evidences[index].Folder = folder
+	d.evidences[index].Name = name
+	evidence.Folder = folder
+	evidence.Name = name
+	return d.addCustodyEvent(evidence.Custody)
+}
+
+// MoveFolder changes the path of a folder and of the folders and evidences in it,
+// the folders the new path is in are added when they don't exist. It returns
+// ErrNotFound when the folder doesn't exist and ErrAlreadyExists when the new
+// path does.
+func (d *DBStore) MoveFolder(caseID int64, from string, to string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.folderByPath(caseID, from); !ok {
+		return fmt.Errorf("%w : folder : %q", data.ErrNotFound, from)
+	}
+	if _, ok := d.folderByPath(caseID, to); ok {
+		return fmt.Errorf("%w : folder : %q", data.ErrAlreadyExists, to)
+	}
+	d.addFolders(caseID, data.FolderParent(to))
+	for i, f := range d.folders {
+		if f.CaseID == caseID && inFolder(f.Path, from) {
+			d.folders[i].Path = to + strings.TrimPrefix(f.Path, from)
+			d.folders[i].Name = d.folders[i].Path[strings.LastIndex(d.folders[i].Path, "/")+1:]
+		}
+	}
+	for i, ev := range d.evidences {
+		if ev.CaseID == caseID && inFolder(ev.Folder, from) {
+			d.evidences[i].Folder = to + strings.TrimPrefix(ev.Folder, from)
+		}
+	}
+	return nil
+}
+
+// addFolders adds the folder and the folders it is in that don't exist yet, the
+// caller must hold the lock
+func (d *DBStore) addFolders(caseID int64, path string) {
+	if path == "" {
+		return
+	}
+	names := strings.Split(path, "/")
+	for i := range names {
+		p := strings.Join(names[:i+1], "/")
+		if _, ok := d.folderByPath(caseID, p); ok {
+			continue
+		}
+		d.folders = append(d.folders, data.Folder{
+			ID:        d.folderIDs.next(),
+			CaseID:    caseID,
+			Name:      names[i],
+			Path:      p,
+			CreatedAt: time.Now(),
+		})
+	}
+}
+
+func (d *DBStore) folderByPath(caseID int64, path string) (data.Folder, bool) {
+	for _, f := range d.folders {
+		if f.CaseID == caseID && f.Path == path {
+			return f, true
+		}
+	}
+	return data.Folder{}, false
+}
+
+// inFolder reports whether the path is the folder or in it
+func inFolder(path string, folder string) bool {
+	return path == folder || strings.HasPrefix(path, folder+"/")
+}
@@ -0,0 +1,86 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// HoldStore is an in-memory data.HoldStore
+type HoldStore struct {
+	mu    sync.RWMutex
+	ids   sequence
+	holds []data.LegalHold
+}
+
+// NewHoldStore creates an empty in-memory HoldStore
+func NewHoldStore() *HoldStore {
+	return &HoldStore{}
+}
+
+// AddHold stores a legal hold and sets its ID and creation time
+func (h *HoldStore) AddHold(hold *data.LegalHold) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hold.ID = h.ids.next()
+	hold.CreatedAt = time.Now()
+	h.holds = append(h.holds, copyHold(*hold))
+	return nil
+}
+
+// GetHold returns a legal hold by its ID or ErrNotFound
+func (h *HoldStore) GetHold(id int64) (*data.LegalHold, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, hold := range h.holds {
+		if hold.ID == id {
+			hold = copyHold(hold)
+			return &hold, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : legal hold id : %d", data.ErrNotFound, id)
+}
+
+// ListHolds returns all legal holds of a case ordered by ID, including released ones
+func (h *HoldStore) ListHolds(caseID int64) ([]data.LegalHold, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var holds []data.LegalHold
+	for _, hold := range h.holds {
+		if hold.CaseID == caseID {
+			holds = append(holds, copyHold(hold))
+		}
+	}
+	return holds, nil
+}
+
+// ReleaseHold records who released the hold and when
+func (h *HoldStore) ReleaseHold(hold *data.LegalHold) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.holds {
+		if h.holds[i].ID == hold.ID {
+			h.holds[i].ReleasedBy = hold.ReleasedBy
+			h.holds[i].ReleasedAt = copyTime(hold.ReleasedAt)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w : legal hold id : %d", data.ErrNotFound, hold.ID)
+}
+
+func copyHold(hold data.LegalHold) data.LegalHold {
+	hold.ExpiresAt = copyTime(hold.ExpiresAt)
+	hold.ReleasedAt = copyTime(hold.ReleasedAt)
+	return hold
+}
+
+// copyTime copies an optional time keeping nil times nil, as they are scanned from NULL
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
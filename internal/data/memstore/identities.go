@@ -0,0 +1,59 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// IdentityStore is an in-memory data.IdentityStore, users linked to their
+// identity are added to users
+type IdentityStore struct {
+	mu         sync.RWMutex
+	users      *UserStore
+	identities map[identityKey]data.Identity
+}
+
+// identityKey is the primary key of user_identities
+type identityKey struct {
+	issuer  string
+	subject string
+}
+
+// NewIdentityStore creates an empty in-memory IdentityStore that adds users to users
+func NewIdentityStore(users *UserStore) *IdentityStore {
+	return &IdentityStore{users: users, identities: map[identityKey]data.Identity{}}
+}
+
+// AddUserIdentity adds the user and links it to the identity, like DB the user
+// isn't added when the identity is already linked or the username is taken
+func (i *IdentityStore) AddUserIdentity(user *data.User, identity *data.Identity) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	key := identityKey{issuer: identity.Issuer, subject: identity.Subject}
+	if _, ok := i.identities[key]; ok {
+		return fmt.Errorf("%w : identity %q of issuer %q", data.ErrAlreadyExists, identity.Subject, identity.Issuer)
+	}
+	id, err := i.users.add(user)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	identity.UserID = id
+	identity.CreatedAt = time.Now()
+	i.identities[key] = *identity
+	return nil
+}
+
+// GetIdentity returns the identity of the subject or ErrNotFound
+func (i *IdentityStore) GetIdentity(issuer string, subject string) (*data.Identity, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	identity, ok := i.identities[identityKey{issuer: issuer, subject: subject}]
+	if !ok {
+		return nil, fmt.Errorf("%w : identity %q of issuer %q", data.ErrNotFound, subject, issuer)
+	}
+	return &identity, nil
+}
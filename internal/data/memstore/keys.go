@@ -0,0 +1,85 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// KeyStore is an in-memory data.KeyStore
+type KeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]data.CaseKey
+}
+
+// NewKeyStore creates an empty in-memory KeyStore
+func NewKeyStore() *KeyStore {
+	return &KeyStore{keys: map[string]data.CaseKey{}}
+}
+
+// AddCaseKey stores a wrapped data key for a case, a case can only have one key
+func (k *KeyStore) AddCaseKey(key *data.CaseKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[key.CaseName]; ok {
+		return fmt.Errorf("%w : key for case : %q", data.ErrAlreadyExists, key.CaseName)
+	}
+	key.CreatedAt = time.Now()
+	k.keys[key.CaseName] = copyKey(*key)
+	return nil
+}
+
+// GetCaseKey returns the wrapped data key of a case or ErrNotFound
+func (k *KeyStore) GetCaseKey(caseName string) (*data.CaseKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[caseName]
+	if !ok {
+		return nil, fmt.Errorf("%w : key for case : %q", data.ErrNotFound, caseName)
+	}
+	key = copyKey(key)
+	return &key, nil
+}
+
+// ListCaseKeys returns the wrapped data keys of all cases sorted by case name
+func (k *KeyStore) ListCaseKeys() ([]data.CaseKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var keys []data.CaseKey
+	for _, name := range sortedKeys(k.keys) {
+		keys = append(keys, copyKey(k.keys[name]))
+	}
+	return keys, nil
+}
+
+// UpdateCaseKey replaces the wrapped data key of a case
+func (k *KeyStore) UpdateCaseKey(key *data.CaseKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	stored, ok := k.keys[key.CaseName]
+	if !ok {
+		return fmt.Errorf("%w : key for case : %q", data.ErrNotFound, key.CaseName)
+	}
+	stored.WrappedKey = append([]byte{}, key.WrappedKey...)
+	stored.MasterKeyID = key.MasterKeyID
+	k.keys[key.CaseName] = stored
+	return nil
+}
+
+// RemoveCaseKey removes the data key of a case
+func (k *KeyStore) RemoveCaseKey(caseName string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[caseName]; !ok {
+		return fmt.Errorf("%w : key for case : %q", data.ErrNotFound, caseName)
+	}
+	delete(k.keys, caseName)
+	return nil
+}
+
+func copyKey(key data.CaseKey) data.CaseKey {
+	key.WrappedKey = append([]byte{}, key.WrappedKey...)
+	return key
+}
@@ -0,0 +1,90 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// AddCaseMember gives the user access to the case with the role, the role of an
+// existing member is changed
+func (d *DBStore) AddCaseMember(member *data.CaseMember) error {
+	if d.users != nil && !d.users.exists(member.UserID) {
+		return fmt.Errorf("inserting user case : %w", errForeignKey)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.caseIDExists(member.CaseID) {
+		return fmt.Errorf("inserting user case : %w", errForeignKey)
+	}
+	for i, uc := range d.userCases {
+		if uc.caseID == member.CaseID && uc.userID == member.UserID {
+			d.userCases[i].role = member.Role
+			return nil
+		}
+	}
+	d.userCases = append(d.userCases, userCase{userID: member.UserID, caseID: member.CaseID, role: member.Role})
+	return nil
+}
+
+// GetCaseMember returns the membership of the user in the case or ErrNotFound
+func (d *DBStore) GetCaseMember(caseID int64, userID int64) (*data.CaseMember, error) {
+	d.mu.RLock()
+	var found *userCase
+	for _, uc := range d.userCases {
+		if uc.caseID == caseID && uc.userID == userID {
+			found = &uc
+			break
+		}
+	}
+	d.mu.RUnlock()
+	if found == nil {
+		return nil, fmt.Errorf("%w : user id %d is not a member of case id %d", data.ErrNotFound, userID, caseID)
+	}
+	member := d.caseMember(*found)
+	return &member, nil
+}
+
+// ListCaseMembers returns the members of the case ordered by username
+func (d *DBStore) ListCaseMembers(caseID int64) ([]data.CaseMember, error) {
+	d.mu.RLock()
+	var userCases []userCase
+	for _, uc := range d.userCases {
+		if uc.caseID == caseID {
+			userCases = append(userCases, uc)
+		}
+	}
+	d.mu.RUnlock()
+	var members []data.CaseMember
+	for _, uc := range userCases {
+		members = append(members, d.caseMember(uc))
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+// RemoveCaseMember removes the access of the user to the case or returns ErrNotFound
+func (d *DBStore) RemoveCaseMember(caseID int64, userID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, uc := range d.userCases {
+		if uc.caseID == caseID && uc.userID == userID {
+			d.userCases = append(d.userCases[:i], d.userCases[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w : user id %d is not a member of case id %d", data.ErrNotFound, userID, caseID)
+}
+
+// caseMember returns the member with the username of the user, it is called
+// without holding the lock of the store
+func (d *DBStore) caseMember(uc userCase) data.CaseMember {
+	member := data.CaseMember{CaseID: uc.caseID, UserID: uc.userID, Role: uc.role}
+	if d.users != nil {
+		if user, err := d.users.GetByID(uc.userID); err == nil {
+			member.Username = user.Username
+		}
+	}
+	return member
+}
@@ -0,0 +1,55 @@
+// Package memstore provides in-memory implementations of the data.DBStore,
+// data.UserStore, data.ObjectStore, data.UploadStore, data.PresignedUploadStore,
+// data.KeyStore, data.CertificateStore, data.HoldStore, data.VerificationStore,
+// data.CustodyStore, data.SessionStore and data.IdentityStore interfaces. They
+// return the same errors as the Postgres and MinIO stores and are meant for
+// hermetic tests.
+package memstore
+
+import (
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// NewStores creates a new data.Stores object backed by memory only
+func NewStores() data.Stores {
+	users := NewUserStore()
+	presigned := NewPresignedUploadStore()
+	custody := NewCustodyStore()
+	db := NewDBStore(users, presigned, custody)
+	return data.Stores{
+		User:             users,
+		DBStore:          db,
+		ObjectStore:      NewObjectStore(),
+		Uploads:          NewUploadStore(),
+		PresignedUploads: presigned,
+		Certificates:     NewCertificateStore(),
+		Holds:            NewHoldStore(),
+		Verifications:    NewVerificationStore(db),
+		Custody:          custody,
+		Sessions:         NewSessionStore(),
+		Identities:       NewIdentityStore(users),
+	}
+}
+
+// sequence hands out ids starting at 1 like a Postgres SERIAL column
+type sequence struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (s *sequence) next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return s.last
+}
+
+// copyTags copies tags keeping nil tags nil, as they are scanned from NULL
+func copyTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	return append([]string{}, tags...)
+}
@@ -0,0 +1,226 @@
+package memstore_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+	"github.com/miloszizic/der/internal/data/storetest"
+)
+
+// seedUser adds a user to the stores and returns it with its ID
+func seedUser(t *testing.T, stores data.Stores) *data.User {
+	user := &data.User{Username: "test"}
+	err := user.Password.Set("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.User.Add(user)
+	if err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+	got, err := stores.User.GetByUsername("test")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	return got
+}
+
+func TestUserStoreReturnedSameErrorsAsPostgres(t *testing.T) {
+	stores := memstore.NewStores()
+	err := stores.User.Add(&data.User{Username: "test"})
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for user without password, got %v", data.ErrInvalidRequest, err)
+	}
+	_, err = stores.User.GetByUsername("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for missing username, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.User.GetByID(1)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing id, got %v", data.ErrNotFound, err)
+	}
+	err = stores.User.Remove(1)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v removing missing id, got %v", data.ErrNotFound, err)
+	}
+}
+func TestUserStoreAddedUserWithDefaultRoleAndPassword(t *testing.T) {
+	stores := memstore.NewStores()
+	user := seedUser(t, stores)
+	if user.ID != 1 || user.Role != data.DefaultRole {
+		t.Errorf("expected user with id 1 and role %q, got %d and %q", data.DefaultRole, user.ID, user.Role)
+	}
+	match, err := user.Password.Matches("test")
+	if err != nil || !match {
+		t.Errorf("expected password to match, got %v, %v", match, err)
+	}
+}
+func TestDBStoreReturnedSameErrorsAsPostgres(t *testing.T) {
+	stores := memstore.NewStores()
+	user := seedUser(t, stores)
+	err := stores.DBStore.AddCase(&data.Case{Name: ""}, user)
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for case without name, got %v", data.ErrInvalidRequest, err)
+	}
+	err = stores.DBStore.AddCase(&data.Case{Name: "test"}, &data.User{ID: 42})
+	if err == nil {
+		t.Errorf("expected error adding case for user that doesn't exist")
+	}
+	_, err = stores.DBStore.GetCaseByName("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for missing case name, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetCaseByID(1)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for missing case id, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetEvidenceByID(1, 1)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for missing evidence id, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetEvidenceByName(&data.Case{ID: 1}, "", "missing")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for missing evidence name, got %v", data.ErrInvalidRequest, err)
+	}
+	_, err = stores.DBStore.CreateEvidence(&data.Evidence{CaseID: 42, Name: "video"})
+	if err == nil {
+		t.Errorf("expected error creating evidence in case that doesn't exist")
+	}
+}
+func TestDBStoreFoundCasesByTagsAndUser(t *testing.T) {
+	stores := memstore.NewStores()
+	user := seedUser(t, stores)
+	for _, cs := range []*data.Case{
+		{Name: "first", Tags: []string{"murder", "robbery"}},
+		{Name: "second", Tags: []string{"robbery"}},
+		{Name: "third"},
+	} {
+		err := stores.DBStore.AddCase(cs, user)
+		if err != nil {
+			t.Fatalf("failed to add case: %v", err)
+		}
+	}
+	got, err := stores.DBStore.FindCaseByTags([]string{"robbery", "murder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []data.Case{{ID: 1, Name: "first", Tags: []string{"murder", "robbery"}}}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	cases, err := stores.DBStore.GetCaseByUserID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 3 {
+		t.Errorf("expected 3 cases for user, got %d", len(cases))
+	}
+}
+func TestStoresCreatedDownloadedAndDeletedEvidenceInMemory(t *testing.T) {
+	stores := memstore.NewStores()
+	user := seedUser(t, stores)
+	err := stores.CreateCase(user, "testcase")
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	cs, err := stores.DBStore.GetCaseByName("testcase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString("sample")}
+	err = stores.CreateEvidence(ev, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	// uploading the same name again creates the second version
+	err = stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: bytes.NewBufferString("other")}, cs)
+	if err != nil {
+		t.Fatalf("failed to create second version: %v", err)
+	}
+	for version, want := range map[int64]string{0: "other", 1: "sample", 2: "other"} {
+		file, err := stores.DownloadEvidenceVersion(ev, version)
+		if err != nil {
+			t.Fatalf("failed to download version %d: %v", version, err)
+		}
+		content, err := io.ReadAll(*file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("expected %q for version %d, got %q", want, version, content)
+		}
+	}
+	_, err = stores.DownloadEvidenceVersion(ev, 3)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing version, got %v", data.ErrNotFound, err)
+	}
+	err = stores.DeleteEvidence(ev)
+	if err != nil {
+		t.Fatalf("failed to delete evidence: %v", err)
+	}
+	err = stores.RemoveCase("testcase")
+	if err != nil {
+		t.Errorf("failed to remove case: %v", err)
+	}
+}
+func TestObjectStoreReturnedSameErrorsAsMinio(t *testing.T) {
+	obs := memstore.NewObjectStore()
+	err := obs.CreateCase(&data.Case{Name: "Invalid/Name"})
+	if err == nil {
+		t.Errorf("expected error for invalid case name")
+	}
+	err = obs.CreateCase(&data.Case{Name: "testcase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = obs.CreateCase(&data.Case{Name: "testcase"})
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v for duplicate case, got %v", data.ErrAlreadyExists, err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "test test"}, "testcase", bytes.NewBufferString("s"))
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for evidence with space, got %v", data.ErrInvalidRequest, err)
+	}
+	_, err = obs.GetEvidence("testcase", "missing")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing evidence, got %v", data.ErrNotFound, err)
+	}
+	exists, err := obs.EvidenceExists("testcase", "missing")
+	if err != nil || exists {
+		t.Errorf("expected missing evidence not to exist, got %v, %v", exists, err)
+	}
+	_, err = obs.CreateEvidence(&data.Evidence{Name: "video"}, "testcase", bytes.NewBufferString("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = obs.RemoveCase("testcase")
+	if err == nil {
+		t.Errorf("expected error removing case that is not empty")
+	}
+}
+func TestObjectStoreConformance(t *testing.T) {
+	storetest.RunObjectStoreSuite(t, func(t *testing.T) data.ObjectStore {
+		return memstore.NewObjectStore()
+	})
+}
+func TestDBStoreConformance(t *testing.T) {
+	storetest.RunDBStoreSuite(t, func(t *testing.T) data.Stores {
+		return memstore.NewStores()
+	})
+}
+func TestUserStoreConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) data.Stores {
+		return memstore.NewStores()
+	})
+}
+func TestUploadStoreConformance(t *testing.T) {
+	storetest.RunUploadStoreSuite(t, func(t *testing.T) data.Stores {
+		return memstore.NewStores()
+	})
+}
@@ -0,0 +1,177 @@
+package memstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// ObjectStore is an in-memory data.ObjectStore, cases are kept as maps of
+// evidence names to their content.
+type ObjectStore struct {
+	mu    sync.RWMutex
+	cases map[string]map[string][]byte
+}
+
+// NewObjectStore creates an empty in-memory ObjectStore
+func NewObjectStore() *ObjectStore {
+	return &ObjectStore{cases: map[string]map[string][]byte{}}
+}
+
+// CreateCase adds a new case, the storage key of the case must follow the MinIO
+// bucket naming rules
+func (o *ObjectStore) CreateCase(cs *data.Case) error {
+	err := s3utils.CheckValidBucketNameStrict(cs.Bucket())
+	if err != nil {
+		return fmt.Errorf("%w : %v : %q", data.ErrInvalidRequest, err, cs.Bucket())
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.cases[cs.Bucket()]; ok {
+		return fmt.Errorf("%w : case : %q", data.ErrAlreadyExists, cs.Bucket())
+	}
+	o.cases[cs.Bucket()] = map[string][]byte{}
+	return nil
+}
+
+// RemoveCase removes a case, case must exist and be empty
+func (o *ObjectStore) RemoveCase(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	evidences, ok := o.cases[name]
+	if !ok {
+		return fmt.Errorf("%w : case : %q", data.ErrNotFound, name)
+	}
+	if len(evidences) > 0 {
+		return fmt.Errorf("case %q is not empty", name)
+	}
+	delete(o.cases, name)
+	return nil
+}
+
+// CaseExists returns true if the case exists
+func (o *ObjectStore) CaseExists(name string) (bool, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	_, ok := o.cases[name]
+	return ok, nil
+}
+
+// ListCases returns the cases sorted by name
+func (o *ObjectStore) ListCases() ([]data.Case, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var cases []data.Case
+	for _, name := range sortedKeys(o.cases) {
+		cases = append(cases, data.Case{Name: name})
+	}
+	return cases, nil
+}
+
+// CreateEvidence stores the evidence content and returns its SHA256 hash, an
+// existing evidence with the same name is overwritten.
+func (o *ObjectStore) CreateEvidence(evidence *data.Evidence, caseName string, file io.Reader) (string, error) {
+	if strings.Contains(evidence.Name, "/") || strings.Contains(evidence.Name, " ") {
+		return "", fmt.Errorf("%w : evidence can't contain forward slash or space : %q ", data.ErrInvalidRequest, evidence.Name)
+	}
+	if evidence.Name == "" {
+		return "", fmt.Errorf("%w : evidence name can't be empty ", data.ErrInvalidRequest)
+	}
+	if file == nil {
+		return "", fmt.Errorf("%w : file can't be nil ", data.ErrInvalidRequest)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("reading evidence : %w", err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	evidences, ok := o.cases[caseName]
+	if !ok {
+		return "", fmt.Errorf("%w : case : %q", data.ErrNotFound, caseName)
+	}
+	evidences[evidence.Name] = content
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EvidenceExists returns true if the evidence exists in the case, case must exist
+func (o *ObjectStore) EvidenceExists(caseName string, evidenceName string) (bool, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	evidences, ok := o.cases[caseName]
+	if !ok {
+		return false, fmt.Errorf("%w : case : %q", data.ErrNotFound, caseName)
+	}
+	_, ok = evidences[evidenceName]
+	return ok, nil
+}
+
+// RemoveEvidence removes an evidence from the case, removing an evidence that
+// doesn't exist is not an error
+func (o *ObjectStore) RemoveEvidence(evidence *data.Evidence, caseName string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	evidences, ok := o.cases[caseName]
+	if !ok {
+		return fmt.Errorf("%w : case : %q", data.ErrNotFound, caseName)
+	}
+	delete(evidences, evidence.Name)
+	return nil
+}
+
+// ListEvidences returns the evidences in the case sorted by name
+func (o *ObjectStore) ListEvidences(caseName string) ([]data.Evidence, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var evidence []data.Evidence
+	evidences, ok := o.cases[caseName]
+	if !ok {
+		return evidence, fmt.Errorf("%w : case : %q", data.ErrNotFound, caseName)
+	}
+	for _, name := range sortedKeys(evidences) {
+		evidence = append(evidence, data.Evidence{Name: name})
+	}
+	return evidence, nil
+}
+
+// GetEvidence returns a reader over the evidence content
+func (o *ObjectStore) GetEvidence(caseName string, evidenceName string) (io.ReadCloser, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	evidences, ok := o.cases[caseName]
+	if !ok {
+		return nil, fmt.Errorf("%w : case : %q", data.ErrNotFound, caseName)
+	}
+	content, ok := evidences[evidenceName]
+	if !ok {
+		return nil, fmt.Errorf("%w : evidence : %q not found", data.ErrNotFound, evidenceName)
+	}
+	return object{bytes.NewReader(content)}, nil
+}
+
+// object is the content of an evidence, it is seekable like MinIO objects
+type object struct {
+	*bytes.Reader
+}
+
+func (object) Close() error {
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// PresignedUploadStore is an in-memory data.PresignedUploadStore
+type PresignedUploadStore struct {
+	mu      sync.RWMutex
+	uploads map[string]data.PresignedUpload
+}
+
+// NewPresignedUploadStore creates an empty in-memory PresignedUploadStore
+func NewPresignedUploadStore() *PresignedUploadStore {
+	return &PresignedUploadStore{uploads: map[string]data.PresignedUpload{}}
+}
+
+// AddPresignedUpload stores a presigned upload and sets its creation time
+func (p *PresignedUploadStore) AddPresignedUpload(upload *data.PresignedUpload) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.uploads[upload.ID]; ok {
+		return fmt.Errorf("inserting presigned upload : %w : id : %q", data.ErrAlreadyExists, upload.ID)
+	}
+	upload.CreatedAt = time.Now()
+	stored := *upload
+	// the URL is only returned to the client and isn't stored
+	stored.URL = ""
+	p.uploads[upload.ID] = stored
+	return nil
+}
+
+// GetPresignedUpload returns a presigned upload by its ID or ErrNotFound
+func (p *PresignedUploadStore) GetPresignedUpload(id string) (*data.PresignedUpload, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	upload, ok := p.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w : presigned upload id : %q", data.ErrNotFound, id)
+	}
+	return &upload, nil
+}
+
+// ListPresignedUploads returns the presigned uploads of a case, oldest first
+func (p *PresignedUploadStore) ListPresignedUploads(caseID int64) ([]data.PresignedUpload, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var uploads []data.PresignedUpload
+	for _, upload := range p.uploads {
+		if upload.CaseID == caseID {
+			uploads = append(uploads, upload)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].CreatedAt.Before(uploads[j].CreatedAt) })
+	return uploads, nil
+}
+
+// RemovePresignedUpload removes a presigned upload or returns ErrNotFound
+func (p *PresignedUploadStore) RemovePresignedUpload(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.uploads[id]; !ok {
+		return fmt.Errorf("%w : presigned upload id : %q", data.ErrNotFound, id)
+	}
+	delete(p.uploads, id)
+	return nil
+}
@@ -0,0 +1,125 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// SessionStore is an in-memory data.SessionStore
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions []data.Session
+}
+
+// NewSessionStore creates an empty in-memory SessionStore
+func NewSessionStore() *SessionStore {
+	return &SessionStore{}
+}
+
+// AddSession stores the session and sets its creation time
+func (s *SessionStore) AddSession(session *data.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(session)
+}
+
+// GetSession returns the session or ErrNotFound
+func (s *SessionStore) GetSession(id uuid.UUID) (*data.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.index(id)
+	if !ok {
+		return nil, fmt.Errorf("%w : session id : %s", data.ErrNotFound, id)
+	}
+	session := copySession(s.sessions[i])
+	return &session, nil
+}
+
+// ListSessions returns all sessions of the user ordered by creation time,
+// including revoked and expired ones
+func (s *SessionStore) ListSessions(userID int64) ([]data.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var sessions []data.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// RotateSession revokes the active session and adds the next one in its place,
+// it returns ErrConflict when the session was already revoked
+func (s *SessionStore) RotateSession(id uuid.UUID, next *data.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index(id)
+	if !ok || s.sessions[i].RevokedAt != nil {
+		return fmt.Errorf("%w : session id %s is already revoked", data.ErrConflict, id)
+	}
+	if _, ok := s.index(next.ID); ok {
+		return fmt.Errorf("inserting session : %w", errUniqueSessionID)
+	}
+	now := time.Now()
+	replacedBy := next.ID
+	s.sessions[i].RevokedAt = &now
+	s.sessions[i].ReplacedBy = &replacedBy
+	return s.add(next)
+}
+
+// RevokeSession revokes the session, revoking a revoked session keeps its
+// revocation time. It returns ErrNotFound when the session doesn't exist.
+func (s *SessionStore) RevokeSession(id uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index(id)
+	if !ok {
+		return fmt.Errorf("%w : session id : %s", data.ErrNotFound, id)
+	}
+	if s.sessions[i].RevokedAt == nil {
+		s.sessions[i].RevokedAt = &at
+	}
+	return nil
+}
+
+// add stores the session, the caller holds the lock
+func (s *SessionStore) add(session *data.Session) error {
+	if _, ok := s.index(session.ID); ok {
+		return fmt.Errorf("inserting session : %w", errUniqueSessionID)
+	}
+	session.CreatedAt = time.Now()
+	s.sessions = append(s.sessions, copySession(*session))
+	return nil
+}
+
+// index returns the position of the session, the caller holds the lock
+func (s *SessionStore) index(id uuid.UUID) (int, bool) {
+	for i, session := range s.sessions {
+		if session.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// errUniqueSessionID is returned where Postgres would fail on the primary key of sessions
+var errUniqueSessionID = fmt.Errorf("duplicate key value violates unique constraint \"sessions_pkey\"")
+
+func copySession(session data.Session) data.Session {
+	if session.RevokedAt != nil {
+		revokedAt := *session.RevokedAt
+		session.RevokedAt = &revokedAt
+	}
+	if session.ReplacedBy != nil {
+		replacedBy := *session.ReplacedBy
+		session.ReplacedBy = &replacedBy
+	}
+	return session
+}
@@ -0,0 +1,114 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// UploadStore is an in-memory data.UploadStore
+type UploadStore struct {
+	mu      sync.Mutex
+	uploads map[string]data.Upload
+}
+
+// NewUploadStore creates an empty in-memory UploadStore
+func NewUploadStore() *UploadStore {
+	return &UploadStore{uploads: map[string]data.Upload{}}
+}
+
+// CreateUpload creates an empty upload with a new ID
+func (u *UploadStore) CreateUpload(up *data.Upload) error {
+	if up.Length < 0 {
+		return fmt.Errorf("%w : upload length can't be negative", data.ErrInvalidRequest)
+	}
+	up.ID = data.NewUploadID()
+	up.Offset = 0
+	up.HashState = nil
+	up.Parts = nil
+	up.CreatedAt = time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.uploads[up.ID] = copyUpload(*up)
+	return nil
+}
+
+// GetUpload returns the upload state or ErrNotFound
+func (u *UploadStore) GetUpload(id string) (*data.Upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w : upload : %q", data.ErrNotFound, id)
+	}
+	found := copyUpload(up)
+	return &found, nil
+}
+
+// ListUploads returns the uploads in progress in the case, oldest first
+func (u *UploadStore) ListUploads(caseID int64) ([]data.Upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var uploads []data.Upload
+	for _, up := range u.uploads {
+		if up.CaseID == caseID {
+			uploads = append(uploads, copyUpload(up))
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].CreatedAt.Before(uploads[j].CreatedAt) })
+	return uploads, nil
+}
+
+// UpdateUpload stores the state of the upload after a chunk was received at
+// offset, like DB it returns ErrConflict when the upload is no longer at offset
+func (u *UploadStore) UpdateUpload(up *data.Upload, offset int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	current, ok := u.uploads[up.ID]
+	if !ok {
+		return fmt.Errorf("%w : upload : %q", data.ErrNotFound, up.ID)
+	}
+	if current.Offset != offset {
+		return fmt.Errorf("%w : upload offset is %d not %d", data.ErrConflict, current.Offset, offset)
+	}
+	current.Offset = up.Offset
+	current.HashState = up.HashState
+	current.Parts = up.Parts
+	u.uploads[up.ID] = copyUpload(current)
+	return nil
+}
+
+// ClaimUpload removes a complete upload and returns it, it returns ErrNotFound
+// when the upload doesn't exist or isn't complete
+func (u *UploadStore) ClaimUpload(id string) (*data.Upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.uploads[id]
+	if !ok || !up.Complete() {
+		return nil, fmt.Errorf("%w : upload : %q", data.ErrNotFound, id)
+	}
+	delete(u.uploads, id)
+	return &up, nil
+}
+
+// RemoveUpload removes the upload and returns it with the parts received so far
+func (u *UploadStore) RemoveUpload(id string) (*data.Upload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w : upload : %q", data.ErrNotFound, id)
+	}
+	delete(u.uploads, id)
+	return &up, nil
+}
+
+// copyUpload copies the upload so the stored one isn't changed through slices
+func copyUpload(up data.Upload) data.Upload {
+	up.HashState = append([]byte(nil), up.HashState...)
+	up.Parts = copyTags(up.Parts)
+	return up
+}
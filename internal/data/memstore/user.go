@@ -0,0 +1,116 @@
+package memstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// UserStore is an in-memory data.UserStore
+type UserStore struct {
+	mu    sync.RWMutex
+	ids   sequence
+	users []data.User
+}
+
+// NewUserStore creates an empty in-memory UserStore
+func NewUserStore() *UserStore {
+	return &UserStore{}
+}
+
+// Add adds a user if the username and password are not empty and the username
+// isn't taken, like UserDB it doesn't set the ID on the given user.
+func (u *UserStore) Add(user *data.User) error {
+	_, err := u.add(user)
+	return err
+}
+
+// add adds the user like Add and returns its ID
+func (u *UserStore) add(user *data.User) (int64, error) {
+	if user.Username == "" || !user.Password.IsSet() {
+		return 0, fmt.Errorf("%w: username and password cannot be empty", data.ErrInvalidRequest)
+	}
+	if user.Role == "" {
+		user.Role = data.DefaultRole
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, taken := range u.users {
+		if taken.Username == user.Username {
+			return 0, fmt.Errorf("%w : username %q is taken by another user", data.ErrConflict, user.Username)
+		}
+	}
+	stored := data.User{
+		ID:       u.ids.next(),
+		Username: user.Username,
+		Password: user.Password,
+		Role:     user.Role,
+	}
+	u.users = append(u.users, stored)
+	return stored.ID, nil
+}
+
+// GetByID returns a user by ID or ErrNotFound
+func (u *UserStore) GetByID(id int64) (*data.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, user := range u.users {
+		if user.ID == id {
+			return publicUser(user), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: user id: %d", data.ErrNotFound, id)
+}
+
+// GetByUsername returns a user by username or sql.ErrNoRows
+func (u *UserStore) GetByUsername(username string) (*data.User, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, user := range u.users {
+		if user.Username == username {
+			return publicUser(user), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// SetRole changes the role of the user or returns ErrNotFound
+func (u *UserStore) SetRole(id int64, role string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range u.users {
+		if u.users[i].ID == id {
+			u.users[i].Role = role
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: user id: %d", data.ErrNotFound, id)
+}
+
+// Remove removes the user by ID or returns ErrNotFound
+func (u *UserStore) Remove(id int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, user := range u.users {
+		if user.ID == id {
+			u.users = append(u.users[:i], u.users[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: user id: %d", data.ErrNotFound, id)
+}
+
+// exists reports whether a user with the id exists, it is used to enforce
+// the foreign keys that reference users
+func (u *UserStore) exists(id int64) bool {
+	_, err := u.GetByID(id)
+	return !errors.Is(err, data.ErrNotFound)
+}
+
+// publicUser returns a copy of the stored user so callers can't modify it
+func publicUser(user data.User) *data.User {
+	return &user
+}
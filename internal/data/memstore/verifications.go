@@ -0,0 +1,50 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// VerificationStore is an in-memory data.VerificationStore
+type VerificationStore struct {
+	mu            sync.RWMutex
+	ids           sequence
+	evidences     *DBStore
+	verifications []data.Verification
+}
+
+// NewVerificationStore creates an empty in-memory VerificationStore, the
+// verification status of evidences is updated in evidences
+func NewVerificationStore(evidences *DBStore) *VerificationStore {
+	return &VerificationStore{evidences: evidences}
+}
+
+// RecordVerification stores the results and sets their IDs, the verification
+// status and time of the evidence are updated with them
+func (v *VerificationStore) RecordVerification(ev *data.Evidence, results []data.Verification) error {
+	if !v.evidences.setVerification(ev) {
+		return fmt.Errorf("%w : evidence id : %d", data.ErrNotFound, ev.ID)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := range results {
+		results[i].ID = v.ids.next()
+		v.verifications = append(v.verifications, results[i])
+	}
+	return nil
+}
+
+// ListVerifications returns the verification history of an evidence, newest first
+func (v *VerificationStore) ListVerifications(evidenceID int64) ([]data.Verification, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var verifications []data.Verification
+	for i := len(v.verifications) - 1; i >= 0; i-- {
+		if v.verifications[i].EvidenceID == evidenceID {
+			verifications = append(verifications, v.verifications[i])
+		}
+	}
+	return verifications, nil
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"github.com/minio/minio-go/v7"
 	"io"
+	"mime"
+	"net/url"
 	"strings"
+	"time"
 )
 
 // ObjectStore is object-base storage interface for storing and retrieving data from object storage
@@ -32,19 +35,20 @@ type FS struct {
 }
 
 // CreateCase adds a new case to the storeFS, Case name should be unique and must within the
-// following rules:
+// following rules, the bucket is named after the storage key of the case. Buckets
+// are created with object locking, so legal holds are enforced by MinIO:
 // Names must be between 3 and 63 characters long.
 // Names can consist only of lowercase letters, numbers, dots (.), and hyphens (-).
 // Names must begin and end with a letter or number.
 func (f *FS) CreateCase(cs *Case) error {
-	exists, err := f.Minio.BucketExists(context.Background(), cs.Name)
+	exists, err := f.Minio.BucketExists(context.Background(), cs.Bucket())
 	if exists {
-		return fmt.Errorf("%w : case : %q", ErrAlreadyExists, cs.Name)
+		return fmt.Errorf("%w : case : %q", ErrAlreadyExists, cs.Bucket())
 	}
 	if err != nil {
 		return err
 	}
-	err = f.Minio.MakeBucket(context.Background(), cs.Name, minio.MakeBucketOptions{})
+	err = f.Minio.MakeBucket(context.Background(), cs.Bucket(), minio.MakeBucketOptions{ObjectLocking: true})
 	if err != nil {
 		return err
 	}
@@ -103,7 +107,7 @@ func (f *FS) CreateEvidence(evidence *Evidence, caseName string, file io.Reader)
 func (f *FS) EvidenceExists(caseName string, evidenceName string) (bool, error) {
 	_, err := f.Minio.StatObject(context.Background(), caseName, evidenceName, minio.StatObjectOptions{})
 	if err != nil {
-		if err.Error() == "The specified key does not exist." {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return false, nil
 		}
 		return false, err
@@ -111,11 +115,23 @@ func (f *FS) EvidenceExists(caseName string, evidenceName string) (bool, error)
 	return true, nil
 }
 
-// RemoveEvidence removes an evidence from specific case and the storeFS
+// RemoveEvidence removes an evidence from specific case and the storeFS. Object
+// locking turns on versioning, so every version of the object is removed or the
+// content would be kept and the bucket couldn't be removed.
 func (f *FS) RemoveEvidence(evidence *Evidence, caseName string) error {
-	err := f.Minio.RemoveObject(context.Background(), caseName, evidence.Name, minio.RemoveObjectOptions{})
-	if err != nil {
-		return err
+	ctx := context.Background()
+	versions := f.Minio.ListObjects(ctx, caseName, minio.ListObjectsOptions{Prefix: evidence.Name, WithVersions: true})
+	for version := range versions {
+		if version.Err != nil {
+			return version.Err
+		}
+		if version.Key != evidence.Name {
+			continue
+		}
+		err := f.Minio.RemoveObject(ctx, caseName, version.Key, minio.RemoveObjectOptions{VersionID: version.VersionID})
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -139,10 +155,62 @@ func (f *FS) GetEvidence(caseName string, evidenceName string) (io.ReadCloser, e
 	}
 	_, err = object.Stat()
 	if err != nil {
-		if err.Error() == "The specified key does not exist" {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return nil, fmt.Errorf("%w : evidence : %q not found", ErrNotFound, evidenceName)
 		}
 		return nil, err
 	}
 	return object, nil
 }
+
+// SetLegalHold sets or clears the MinIO legal hold of an object. Legal holds need
+// object locking, which can only be enabled when a bucket is created, for buckets
+// without it ErrNoObjectLocking is returned.
+func (f *FS) SetLegalHold(caseName string, objectName string, enabled bool) error {
+	_, _, _, _, err := f.Minio.GetObjectLockConfig(context.Background(), caseName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+			return fmt.Errorf("%w : bucket : %q", ErrNoObjectLocking, caseName)
+		}
+		return err
+	}
+	status := minio.LegalHoldDisabled
+	if enabled {
+		status = minio.LegalHoldEnabled
+	}
+	return f.Minio.PutObjectLegalHold(context.Background(), caseName, objectName, minio.PutObjectLegalHoldOptions{Status: &status})
+}
+
+// CopyObject copies an object within the bucket of a case on the MinIO server,
+// objects larger than 5GiB are copied in parts
+func (f *FS) CopyObject(caseName string, srcName string, dstName string) error {
+	_, err := f.Minio.ComposeObject(context.Background(), minio.CopyDestOptions{Bucket: caseName, Object: dstName}, minio.CopySrcOptions{Bucket: caseName, Object: srcName})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return fmt.Errorf("%w : evidence : %q not found", ErrNotFound, srcName)
+		}
+		return err
+	}
+	return nil
+}
+
+// PresignGet returns a URL that downloads an object without credentials until it
+// expires, the download is named after the filename
+func (f *FS) PresignGet(caseName string, objectName string, filename string, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	u, err := f.Minio.PresignedGetObject(context.Background(), caseName, objectName, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// PresignPut returns a URL that uploads an object without credentials until it expires
+func (f *FS) PresignPut(caseName string, objectName string, expiry time.Duration) (string, error) {
+	u, err := f.Minio.PresignedPutObject(context.Background(), caseName, objectName, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
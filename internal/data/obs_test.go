@@ -1,7 +1,10 @@
+//go:build integration
+
 package data_test
 
 import (
 	"bytes"
+	"errors"
 	"github.com/miloszizic/der/internal/data"
 	"io"
 	"strings"
@@ -294,6 +297,77 @@ func TestRemoveEvidenceInOBSSuccessful(t *testing.T) {
 		t.Errorf("failed to remove evidence: %v", err)
 	}
 }
+func TestLegalHoldInOBSBlockedRemovingEvidence(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("failed to get test stores: %v", err)
+	}
+	testCase := &data.Case{Name: "test"}
+	testEvidence := &data.Evidence{Name: "test"}
+	err = store.ObjectStore.CreateCase(testCase)
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	_, err = store.ObjectStore.CreateEvidence(testEvidence, testCase.Name, bytes.NewBufferString("s"))
+	if err != nil {
+		t.Fatalf("failed to add evidence: %v", err)
+	}
+	holder := store.ObjectStore.(data.LegalHolder)
+	err = holder.SetLegalHold(testCase.Name, testEvidence.Name, true)
+	if err != nil {
+		t.Fatalf("failed to set legal hold: %v", err)
+	}
+	err = store.ObjectStore.RemoveEvidence(testEvidence, testCase.Name)
+	if err == nil {
+		t.Errorf("expected removing a held evidence to fail")
+	}
+	err = holder.SetLegalHold(testCase.Name, testEvidence.Name, false)
+	if err != nil {
+		t.Fatalf("failed to clear legal hold: %v", err)
+	}
+	err = store.ObjectStore.RemoveEvidence(testEvidence, testCase.Name)
+	if err != nil {
+		t.Errorf("failed to remove evidence: %v", err)
+	}
+	// every version of the object is gone, so the bucket can be removed
+	err = store.ObjectStore.RemoveCase(testCase.Name)
+	if err != nil {
+		t.Errorf("failed to remove case: %v", err)
+	}
+}
+func TestCopyObjectInOBSCopiedContent(t *testing.T) {
+	store, err := GetTestStores(t)
+	if err != nil {
+		t.Fatalf("failed to get test stores: %v", err)
+	}
+	testCase := &data.Case{Name: "test"}
+	err = store.ObjectStore.CreateCase(testCase)
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	_, err = store.ObjectStore.CreateEvidence(&data.Evidence{Name: "uploaded"}, testCase.Name, bytes.NewBufferString("sample"))
+	if err != nil {
+		t.Fatalf("failed to add evidence: %v", err)
+	}
+	copier := store.ObjectStore.(data.ObjectCopier)
+	err = copier.CopyObject(testCase.Name, "uploaded", "copy")
+	if err != nil {
+		t.Fatalf("failed to copy object: %v", err)
+	}
+	file, err := store.ObjectStore.GetEvidence(testCase.Name, "copy")
+	if err != nil {
+		t.Fatalf("failed to get copy: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil || string(content) != "sample" {
+		t.Errorf("expected copy with content %q, got %q, %v", "sample", content, err)
+	}
+	err = copier.CopyObject(testCase.Name, "missing", "copy")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v copying a missing object, got %v", data.ErrNotFound, err)
+	}
+}
 func TestListCasesInOBSReturnedAllCasesInOBS(t *testing.T) {
 	store, err := GetTestStores(t)
 	if err != nil {
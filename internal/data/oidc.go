@@ -0,0 +1,384 @@
+package data
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the OIDCConfig
+const (
+	DefaultOIDCScopes        = "openid profile email"
+	DefaultOIDCUsernameClaim = "preferred_username"
+	DefaultOIDCGroupsClaim   = "groups"
+)
+
+// maxOIDCResponse limits the size of a response read from the identity provider
+const maxOIDCResponse = 1 << 20
+
+// OIDCIdentity is a user signed in at the identity provider, Role is mapped from
+// the groups of the user
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Groups   []string
+	Role     string
+}
+
+// roleMapping maps a group of the identity provider to a role
+type roleMapping struct {
+	group string
+	role  string
+}
+
+// OIDCProvider signs users in with the authorization code flow with PKCE of an
+// OpenID Connect identity provider. The endpoints and keys of the provider are
+// discovered from the issuer on first use.
+type OIDCProvider struct {
+	config   OIDCConfig
+	scopes   string
+	mappings []roleMapping
+	client   *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// oidcDiscovery is the part of the provider metadata the login uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider creates an OIDCProvider from the config, the role mapping is a
+// comma separated list of group:role pairs
+func NewOIDCProvider(config OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("%w : oidc issuer, client id and redirect url are required", ErrInvalidRequest)
+	}
+	p := &OIDCProvider{config: config, client: client}
+	if p.config.UsernameClaim == "" {
+		p.config.UsernameClaim = DefaultOIDCUsernameClaim
+	}
+	if p.config.GroupsClaim == "" {
+		p.config.GroupsClaim = DefaultOIDCGroupsClaim
+	}
+	p.scopes = config.Scopes
+	if p.scopes == "" {
+		p.scopes = DefaultOIDCScopes
+	}
+	if !containsString(strings.Fields(p.scopes), "openid") {
+		p.scopes = "openid " + p.scopes
+	}
+	for _, pair := range strings.Split(config.RoleMapping, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, ":")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("%w : oidc role mapping must be group:role pairs", ErrInvalidRequest)
+		}
+		err := ValidateRole(role)
+		if err != nil {
+			return nil, err
+		}
+		p.mappings = append(p.mappings, roleMapping{group: group, role: role})
+	}
+	if config.DefaultRole != "" {
+		err := ValidateRole(config.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// FromOIDCConfig creates the OIDCProvider when an issuer is configured, otherwise it returns nil
+func FromOIDCConfig(config Config) (*OIDCProvider, error) {
+	if config.OIDC.Issuer == "" {
+		return nil, nil
+	}
+	return NewOIDCProvider(config.OIDC, &http.Client{Timeout: 30 * time.Second})
+}
+
+// Role returns the role of the first mapping with a group of the user, or the
+// default role. It returns ErrForbidden when no role is mapped.
+func (p *OIDCProvider) Role(groups []string) (string, error) {
+	for _, m := range p.mappings {
+		if containsString(groups, m.group) {
+			return m.role, nil
+		}
+	}
+	if p.config.DefaultRole == "" {
+		return "", fmt.Errorf("%w : no role is mapped to the groups %q", ErrForbidden, groups)
+	}
+	return p.config.DefaultRole, nil
+}
+
+// PKCEChallenge returns the S256 code challenge of the code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the identity provider the user signs in at, the
+// state and nonce are checked in the callback and the ID token
+func (p *OIDCProvider) AuthCodeURL(state string, nonce string, verifier string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {p.scopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code with the code verifier and returns the
+// identity of the verified ID token. It returns ErrUnauthorized when the provider
+// rejects the code or the ID token isn't valid, and ErrForbidden when no role is
+// mapped to the user.
+func (p *OIDCProvider) Exchange(code string, verifier string, nonce string) (*OIDCIdentity, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting oidc tokens : %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w : identity provider rejected the code with status %d", ErrUnauthorized, resp.StatusCode)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponse)).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("reading oidc tokens : %w", err)
+	}
+	claims, err := p.verifyIDToken(tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity := &OIDCIdentity{Issuer: p.config.Issuer, Groups: stringsClaim(claims[p.config.GroupsClaim])}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Username, _ = claims[p.config.UsernameClaim].(string)
+	if identity.Subject == "" || identity.Username == "" {
+		return nil, fmt.Errorf("%w : id token has no subject or %s claim", ErrUnauthorized, p.config.UsernameClaim)
+	}
+	identity.Role, err = p.Role(identity.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// verifyIDToken checks the RS256 signature and the claims of the ID token and
+// returns its claims
+func (p *OIDCProvider) verifyIDToken(token string, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w : id token is malformed", ErrUnauthorized)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil || header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w : id token must be signed with RS256", ErrUnauthorized)
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w : id token is malformed", ErrUnauthorized)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w : id token signature is invalid", ErrUnauthorized)
+	}
+	var claims map[string]interface{}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w : id token is malformed", ErrUnauthorized)
+	}
+	if claims["iss"] != p.config.Issuer {
+		return nil, fmt.Errorf("%w : id token was issued by %v", ErrUnauthorized, claims["iss"])
+	}
+	audience := stringsClaim(claims["aud"])
+	if !containsString(audience, p.config.ClientID) {
+		return nil, fmt.Errorf("%w : id token isn't issued to the client", ErrUnauthorized)
+	}
+	azp, hasAzp := claims["azp"].(string)
+	if (hasAzp || len(audience) > 1) && azp != p.config.ClientID {
+		return nil, fmt.Errorf("%w : id token is authorized for another party", ErrUnauthorized)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("%w : id token has expired", ErrUnauthorized)
+	}
+	claimNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(claimNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w : id token nonce doesn't match the login", ErrUnauthorized)
+	}
+	return claims, nil
+}
+
+// discover fetches the provider metadata of the issuer once
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d oidcDiscovery
+	err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, fmt.Errorf("discovering oidc provider : %w", err)
+	}
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovering oidc provider : issuer %q doesn't match the config", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering oidc provider : endpoints are missing")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the signing key of the provider with the key id, the keys are
+// fetched again for an unknown id so rotated keys are picked up
+func (p *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err = p.getJSON(d.JWKSURI, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching oidc keys : %w", err)
+	}
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w : id token is signed with unknown key %q", ErrUnauthorized, kid)
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponse)).Decode(v)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringsClaim returns a claim that is a string or a list of strings as a list
+func stringsClaim(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		var values []string
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
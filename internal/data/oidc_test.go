@@ -0,0 +1,302 @@
+package data_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+	"github.com/miloszizic/der/internal/data/oidctest"
+)
+
+// testOIDCConfig returns the config of a client of the IdP mapping judges and
+// clerks to their roles
+func testOIDCConfig(idp *oidctest.IdP) data.OIDCConfig {
+	return data.OIDCConfig{
+		Issuer:      idp.Issuer(),
+		ClientID:    idp.ClientID,
+		RedirectURL: "https://der.example.gov/oidc/callback",
+		RoleMapping: "judges:judge,clerks:clerk",
+	}
+}
+
+// signInAt signs the identity in at the IdP and returns the code it redirected
+// back with for the verifier and nonce
+func signInAt(t *testing.T, idp *oidctest.IdP, provider *data.OIDCProvider, identity oidctest.Identity, verifier string, nonce string) string {
+	idp.SignIn(identity)
+	authURL, err := provider.AuthCodeURL("state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("failed to create authorization url: %v", err)
+	}
+	callback := idp.Authorize(t, authURL)
+	if callback.Query().Get("state") != "state" || callback.Query().Get("code") == "" {
+		t.Fatalf("expected a code with the state, got %s", callback)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	judge := oidctest.Identity{Subject: "1001", Username: "judge.dredd", Groups: []string{"staff", "judges"}}
+	tests := []struct {
+		name         string
+		identity     oidctest.Identity
+		secret       string
+		modifyClaims func(claims map[string]interface{})
+		verifier     string
+		nonce        string
+		want         *data.OIDCIdentity
+		wantErr      error
+	}{
+		{
+			name:     "judge signed in",
+			identity: judge,
+			want:     &data.OIDCIdentity{Subject: "1001", Username: "judge.dredd", Groups: []string{"staff", "judges"}, Role: data.RoleJudge},
+		},
+		{
+			name:     "confidential client signed in",
+			identity: judge,
+			secret:   "secret",
+			want:     &data.OIDCIdentity{Subject: "1001", Username: "judge.dredd", Groups: []string{"staff", "judges"}, Role: data.RoleJudge},
+		},
+		{
+			name:     "user without a mapped group forbidden",
+			identity: oidctest.Identity{Subject: "1002", Username: "visitor", Groups: []string{"staff"}},
+			wantErr:  data.ErrForbidden,
+		},
+		{
+			name:     "code redeemed with another verifier rejected",
+			identity: judge,
+			verifier: "another-verifier-of-at-least-forty-three-characters",
+			wantErr:  data.ErrUnauthorized,
+		},
+		{
+			name:     "id token of another login rejected",
+			identity: judge,
+			nonce:    "another-nonce",
+			wantErr:  data.ErrUnauthorized,
+		},
+		{
+			name:         "id token for another client rejected",
+			identity:     judge,
+			modifyClaims: func(claims map[string]interface{}) { claims["aud"] = "other" },
+			wantErr:      data.ErrUnauthorized,
+		},
+		{
+			name:         "id token of another issuer rejected",
+			identity:     judge,
+			modifyClaims: func(claims map[string]interface{}) { claims["iss"] = "https://id.example.com" },
+			wantErr:      data.ErrUnauthorized,
+		},
+		{
+			name:         "expired id token rejected",
+			identity:     judge,
+			modifyClaims: func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			wantErr:      data.ErrUnauthorized,
+		},
+		{
+			name:         "id token without username rejected",
+			identity:     judge,
+			modifyClaims: func(claims map[string]interface{}) { delete(claims, "preferred_username") },
+			wantErr:      data.ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewIdP(t, "der")
+			idp.ClientSecret = tt.secret
+			idp.ModifyClaims = tt.modifyClaims
+			config := testOIDCConfig(idp)
+			config.ClientSecret = tt.secret
+			provider, err := data.NewOIDCProvider(config, http.DefaultClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := "verifier-of-the-login-with-at-least-forty-three-characters"
+			code := signInAt(t, idp, provider, tt.identity, verifier, "nonce")
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			got, err := provider.Exchange(code, verifier, nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.want != nil {
+				tt.want.Issuer = idp.Issuer()
+			}
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf(cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestOIDCProviderRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		mapping     string
+		defaultRole string
+		groups      []string
+		want        string
+		wantErr     error
+	}{
+		{name: "first mapped group gave the role", mapping: "judges:judge,clerks:clerk", groups: []string{"clerks", "judges"}, want: data.RoleJudge},
+		{name: "default role given without a mapped group", mapping: "judges:judge", defaultRole: data.RoleDefense, groups: []string{"lawyers"}, want: data.RoleDefense},
+		{name: "no role without a mapped group or default", mapping: "judges:judge", groups: []string{"lawyers"}, wantErr: data.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := data.NewOIDCProvider(data.OIDCConfig{
+				Issuer:      "https://id.example.gov",
+				ClientID:    "der",
+				RedirectURL: "https://der.example.gov/oidc/callback",
+				RoleMapping: tt.mapping,
+				DefaultRole: tt.defaultRole,
+			}, http.DefaultClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := provider.Role(tt.groups)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected role %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewOIDCProviderWithInvalidConfigFailed(t *testing.T) {
+	valid := data.OIDCConfig{Issuer: "https://id.example.gov", ClientID: "der", RedirectURL: "https://der.example.gov/oidc/callback"}
+	tests := []struct {
+		name   string
+		change func(config *data.OIDCConfig)
+	}{
+		{name: "missing client id", change: func(config *data.OIDCConfig) { config.ClientID = "" }},
+		{name: "missing redirect url", change: func(config *data.OIDCConfig) { config.RedirectURL = "" }},
+		{name: "mapping without a group", change: func(config *data.OIDCConfig) { config.RoleMapping = "judge" }},
+		{name: "mapping to an unknown role", change: func(config *data.OIDCConfig) { config.RoleMapping = "judges:magistrate" }},
+		{name: "unknown default role", change: func(config *data.OIDCConfig) { config.DefaultRole = "magistrate" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			_, err := data.NewOIDCProvider(config, http.DefaultClient)
+			if !errors.Is(err, data.ErrInvalidRequest) {
+				t.Errorf("expected error %v, got %v", data.ErrInvalidRequest, err)
+			}
+		})
+	}
+}
+
+func TestProvisionOIDCUser(t *testing.T) {
+	stores := memstore.NewStores()
+	identity := &data.OIDCIdentity{Issuer: "https://id.example.gov", Subject: "1001", Username: "clerk", Role: data.RoleClerk}
+	user, err := stores.ProvisionOIDCUser(identity)
+	if err != nil {
+		t.Fatalf("failed to provision user: %v", err)
+	}
+	if user.ID == 0 || user.Username != "clerk" || user.Role != data.RoleClerk {
+		t.Fatalf("expected the provisioned clerk, got %+v", user)
+	}
+	// the user was moved to the judges group at the identity provider
+	identity.Role = data.RoleJudge
+	again, err := stores.ProvisionOIDCUser(identity)
+	if err != nil {
+		t.Fatalf("failed to sign in the provisioned user: %v", err)
+	}
+	if again.ID != user.ID || again.Role != data.RoleJudge {
+		t.Errorf("expected the same user with the new role, got %+v", again)
+	}
+	stored, err := stores.User.GetByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Role != data.RoleJudge {
+		t.Errorf("expected the stored role %q, got %q", data.RoleJudge, stored.Role)
+	}
+	_, err = stores.ProvisionOIDCUser(&data.OIDCIdentity{Issuer: "https://id.example.gov", Subject: "1002", Username: "clerk", Role: data.RoleClerk})
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected error %v for a taken username, got %v", data.ErrConflict, err)
+	}
+}
+
+func TestProvisionOIDCUserConcurrentlyAddedOneUser(t *testing.T) {
+	stores := memstore.NewStores()
+	identity := data.OIDCIdentity{Issuer: "https://id.example.gov", Subject: "1001", Username: "clerk", Role: data.RoleClerk}
+	users := make([]*data.User, 4)
+	errs := make([]error, len(users))
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			identity := identity
+			users[i], errs[i] = stores.ProvisionOIDCUser(&identity)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("failed to provision user: %v", err)
+		}
+		if users[i].ID != users[0].ID {
+			t.Errorf("expected every login to get user %d, got %d", users[0].ID, users[i].ID)
+		}
+	}
+	_, err := stores.User.GetByID(users[0].ID + 1)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected only one user to be added, got %v", err)
+	}
+}
+
+func TestAddUserIdentityOfLinkedIdentityAddedNoUser(t *testing.T) {
+	stores := memstore.NewStores()
+	_, err := stores.ProvisionOIDCUser(&data.OIDCIdentity{Issuer: "https://id.example.gov", Subject: "1001", Username: "clerk", Role: data.RoleClerk})
+	if err != nil {
+		t.Fatalf("failed to provision user: %v", err)
+	}
+	user := &data.User{Username: "other", Role: data.RoleClerk}
+	err = user.Password.Set("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.Identities.AddUserIdentity(user, &data.Identity{Issuer: "https://id.example.gov", Subject: "1001"})
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected error %v, got %v", data.ErrAlreadyExists, err)
+	}
+	_, err = stores.User.GetByUsername("other")
+	if err == nil {
+		t.Errorf("expected the user not to be added")
+	}
+}
+
+func TestAddUserIdentityWithTakenUsernameLinkedNoIdentity(t *testing.T) {
+	stores := memstore.NewStores()
+	_, err := stores.ProvisionOIDCUser(&data.OIDCIdentity{Issuer: "https://id.example.gov", Subject: "1001", Username: "clerk", Role: data.RoleClerk})
+	if err != nil {
+		t.Fatalf("failed to provision user: %v", err)
+	}
+	user := &data.User{Username: "clerk", Role: data.RoleClerk}
+	err = user.Password.Set("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.Identities.AddUserIdentity(user, &data.Identity{Issuer: "https://id.example.gov", Subject: "1002"})
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected error %v, got %v", data.ErrConflict, err)
+	}
+	_, err = stores.Identities.GetIdentity("https://id.example.gov", "1002")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected the identity not to be linked, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+// Package oidctest provides a local OpenID Connect identity provider to test the
+// single sign-on login against. It implements discovery, the keys and the
+// authorization code flow with PKCE, signing RS256 ID tokens.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyID is the kid of the signing key of the IdP
+const keyID = "idp-1"
+
+// Identity is the user who signs in at the IdP
+type Identity struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// IdP is a local identity provider, it approves every authorization as the
+// identity that signed in last
+type IdP struct {
+	Server   *httptest.Server
+	ClientID string
+	// ClientSecret is required from the client at the token endpoint when set
+	ClientSecret string
+	// ModifyClaims changes the claims of ID tokens before they are signed
+	ModifyClaims func(claims map[string]interface{})
+
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	identity *Identity
+	codes    map[string]authorization
+}
+
+// authorization is a code handed out to the client with what it was issued for
+type authorization struct {
+	identity    Identity
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewIdP starts an IdP for the client, it is closed when the test ends
+func NewIdP(t *testing.T, clientID string) *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &IdP{ClientID: clientID, key: key, codes: map[string]authorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+	return p
+}
+
+// Issuer returns the issuer URL of the IdP
+func (p *IdP) Issuer() string {
+	return p.Server.URL
+}
+
+// SignIn signs the identity in, the next authorizations are approved as it
+func (p *IdP) SignIn(identity Identity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = &identity
+}
+
+// Authorize follows the authorization URL as the signed in identity and returns
+// the URL the IdP redirects back to
+func (p *IdP) Authorize(t *testing.T, authURL string) *url.URL {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected the IdP to redirect, got status %d", resp.StatusCode)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func (p *IdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *IdP) keys(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" || query.Get("client_id") != p.ClientID {
+		http.Error(w, "unknown client or redirect uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("state", query.Get("state"))
+	p.mu.Lock()
+	switch {
+	case query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		values.Set("error", "invalid_request")
+	case p.identity == nil:
+		values.Set("error", "access_denied")
+	default:
+		code := randomString()
+		p.codes[code] = authorization{
+			identity:    *p.identity,
+			redirectURI: query.Get("redirect_uri"),
+			challenge:   query.Get("code_challenge"),
+			nonce:       query.Get("nonce"),
+		}
+		values.Set("code", code)
+	}
+	p.mu.Unlock()
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := p.idToken(auth)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// idToken signs the ID token of the authorization
+func (p *IdP) idToken(auth authorization) (string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                p.Issuer(),
+		"sub":                auth.identity.Subject,
+		"aud":                p.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              auth.nonce,
+		"preferred_username": auth.identity.Username,
+		"groups":             auth.identity.Groups,
+	}
+	if p.ModifyClaims != nil {
+		p.ModifyClaims(claims)
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
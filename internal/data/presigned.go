@@ -0,0 +1,348 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultPresignExpiry is used when no expiry is configured for presigned URLs
+const DefaultPresignExpiry = 15 * time.Minute
+
+// maxPresignExpiry is the longest expiry MinIO accepts for presigned URLs
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// Presigner is implemented by object stores that can hand out short-lived URLs
+// for a single object, so clients transfer evidences without the API in between
+type Presigner interface {
+	PresignGet(caseName string, objectName string, filename string, expiry time.Duration) (string, error)
+	PresignPut(caseName string, objectName string, expiry time.Duration) (string, error)
+}
+
+// ObjectCopier is implemented by object stores that copy an object in the bucket of
+// a case without the content passing through the API
+type ObjectCopier interface {
+	CopyObject(caseName string, srcName string, dstName string) error
+}
+
+// storedObject is the content of an object that is already in the bucket of the
+// case. createObject copies it with the ObjectCopier of the object store, other
+// object stores read it like any content.
+type storedObject struct {
+	objects ObjectStore
+	bucket  string
+	name    string
+	file    io.ReadCloser
+}
+
+func (o *storedObject) Read(p []byte) (int, error) {
+	if o.file == nil {
+		file, err := o.objects.GetEvidence(o.bucket, o.name)
+		if err != nil {
+			return 0, fmt.Errorf("getting evidence in object store: %w , object name: %q ", err, o.name)
+		}
+		o.file = file
+	}
+	return o.file.Read(p)
+}
+
+func (o *storedObject) Close() error {
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
+
+// PresignedURL is a short-lived URL for a single evidence object
+type PresignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PresignedUpload is an evidence that a client uploads directly to the object
+// store, the evidence is created when the upload is completed
+type PresignedUpload struct {
+	ID         string    `json:"id"`
+	CaseID     int64     `json:"case_id"`
+	Name       string    `json:"name"`
+	Folder     string    `json:"folder"`
+	ObjectName string    `json:"-"`
+	Username   string    `json:"username"`
+	URL        string    `json:"url,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PresignedUploadStore keeps presigned uploads until they are completed
+type PresignedUploadStore interface {
+	AddPresignedUpload(upload *PresignedUpload) error
+	GetPresignedUpload(id string) (*PresignedUpload, error)
+	ListPresignedUploads(caseID int64) ([]PresignedUpload, error)
+	RemovePresignedUpload(id string) error
+}
+
+type PresignedUploads struct {
+	DB *sql.DB
+}
+
+func NewPresignedUploadStore(db *sql.DB) PresignedUploadStore {
+	return &PresignedUploads{
+		DB: db,
+	}
+}
+
+// AddPresignedUpload stores a presigned upload and sets its creation time
+func (p *PresignedUploads) AddPresignedUpload(upload *PresignedUpload) error {
+	err := p.DB.QueryRow(`INSERT INTO "presigned_uploads" ("id", "case_id", "name", "folder", "object_name", "username", "expires_at") VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at`,
+		upload.ID, upload.CaseID, upload.Name, upload.Folder, upload.ObjectName, upload.Username, upload.ExpiresAt).Scan(&upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting presigned upload : %w", err)
+	}
+	return nil
+}
+
+// GetPresignedUpload returns a presigned upload by its ID or ErrNotFound
+func (p *PresignedUploads) GetPresignedUpload(id string) (*PresignedUpload, error) {
+	upload := &PresignedUpload{}
+	err := p.DB.QueryRow(`SELECT "id", "case_id", "name", "folder", "object_name", "username", "expires_at", "created_at" FROM "presigned_uploads" WHERE id = $1`, id).
+		Scan(&upload.ID, &upload.CaseID, &upload.Name, &upload.Folder, &upload.ObjectName, &upload.Username, &upload.ExpiresAt, &upload.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : presigned upload id : %q", ErrNotFound, id)
+		}
+		return nil, err
+	}
+	return upload, nil
+}
+
+// ListPresignedUploads returns the presigned uploads of a case that weren't completed
+func (p *PresignedUploads) ListPresignedUploads(caseID int64) ([]PresignedUpload, error) {
+	rows, err := p.DB.Query(`SELECT "id", "case_id", "name", "folder", "object_name", "username", "expires_at", "created_at" FROM "presigned_uploads" WHERE case_id = $1 ORDER BY created_at`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var uploads []PresignedUpload
+	for rows.Next() {
+		var upload PresignedUpload
+		err = rows.Scan(&upload.ID, &upload.CaseID, &upload.Name, &upload.Folder, &upload.ObjectName, &upload.Username, &upload.ExpiresAt, &upload.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// RemovePresignedUpload removes a presigned upload or returns ErrNotFound
+func (p *PresignedUploads) RemovePresignedUpload(id string) error {
+	result, err := p.DB.Exec(`DELETE FROM "presigned_uploads" WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("removing presigned upload : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : presigned upload id : %q", ErrNotFound, id)
+	}
+	return nil
+}
+
+// removePresignedUpload removes the presigned upload an evidence or version is
+// completed from in the transaction that creates it. The row is locked until the
+// transaction ends, so of concurrent completions only the first one finds it and
+// the others fail with ErrNotFound.
+func removePresignedUpload(tx *sql.Tx, id string) error {
+	if id == "" {
+		return nil
+	}
+	result, err := tx.Exec(`DELETE FROM "presigned_uploads" WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("removing presigned upload : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : presigned upload id : %q", ErrNotFound, id)
+	}
+	return nil
+}
+
+// presigner returns the Presigner of the object store, expiry must be within the
+// limits of presigned URLs
+func (s *Stores) presigner(expiry time.Duration) (Presigner, time.Duration, error) {
+	presigner, ok := s.ObjectStore.(Presigner)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w : object store doesn't support presigned URLs", ErrInvalidRequest)
+	}
+	if expiry <= 0 {
+		expiry = DefaultPresignExpiry
+	}
+	if expiry > maxPresignExpiry {
+		return nil, 0, fmt.Errorf("%w : presigned URLs can't be valid longer than %v", ErrInvalidRequest, maxPresignExpiry)
+	}
+	return presigner, expiry, nil
+}
+
+// PresignDownload returns a URL that downloads a version of the evidence directly
+// from the object store, version zero is the latest version
+func (s *Stores) PresignDownload(ev *Evidence, version int64, expiry time.Duration) (*PresignedURL, error) {
+	presigner, expiry, err := s.presigner(expiry)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.GetCaseByID(ev.CaseID)
+	if err != nil {
+		return nil, err
+	}
+	objectName, err := s.versionObjectName(ev, version)
+	if err != nil {
+		return nil, err
+	}
+	url, err := presigner.PresignGet(cs.Bucket(), objectName, ev.Name, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("presigning download: %w , evidence name: %q ", err, ev.Name)
+	}
+	return &PresignedURL{URL: url, ExpiresAt: time.Now().Add(expiry).UTC()}, nil
+}
+
+// CreatePresignedUpload returns a URL the client uploads the evidence to under a
+// generated object name, the evidence, or a new version of the evidence with the
+// same name in the folder, is only created by CompletePresignedUpload.
+func (s *Stores) CreatePresignedUpload(upload *PresignedUpload, expiry time.Duration) error {
+	presigner, expiry, err := s.presigner(expiry)
+	if err != nil {
+		return err
+	}
+	err = ValidateEvidenceName(upload.Name)
+	if err != nil {
+		return err
+	}
+	upload.Folder, err = CleanFolderPath(upload.Folder)
+	if err != nil {
+		return err
+	}
+	cs, err := s.GetCaseByID(upload.CaseID)
+	if err != nil {
+		return err
+	}
+	upload.ObjectName = NewEvidenceObjectName()
+	upload.ID = NewUploadID()
+	upload.ExpiresAt = time.Now().Add(expiry).UTC()
+	upload.URL, err = presigner.PresignPut(cs.Bucket(), upload.ObjectName, expiry)
+	if err != nil {
+		return fmt.Errorf("presigning upload: %w , evidence name: %q ", err, upload.Name)
+	}
+	err = s.PresignedUploads.AddPresignedUpload(upload)
+	if err != nil {
+		return fmt.Errorf("adding presigned upload: %w , evidence name: %q ", err, upload.Name)
+	}
+	return nil
+}
+
+// CompletePresignedUpload creates the evidence, or its new version, from an object
+// uploaded with a presigned URL. The object is copied to a new object name in the
+// object store, its hashes are computed from the copy and the uploaded object is
+// removed, so content written with the still valid URL after the completion never
+// becomes part of the evidence. When the client declared a SHA256 hash the copy
+// must match it. An upload is completed only once and only by the user who
+// created it, the presigned upload is removed in the transaction that creates the
+// evidence. It can't be completed after the URL expired and a failed completion
+// removes the upload and its object. The actor is who completed the upload, it is
+// recorded in the chain of custody.
+func (s *Stores) CompletePresignedUpload(caseID int64, id string, username string, expectedHash string, actor *CustodyEvent) (*Evidence, error) {
+	upload, err := s.PresignedUploads.GetPresignedUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.CaseID != caseID || upload.Username != username {
+		return nil, fmt.Errorf("%w : presigned upload id : %q", ErrNotFound, id)
+	}
+	var declared Hashes
+	if expectedHash != "" {
+		declared, err = validateDeclaredHashes(Hashes{HashSHA256: expectedHash})
+		if err != nil {
+			return nil, err
+		}
+	}
+	cs, err := s.GetCaseByID(upload.CaseID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, s.discardPresignedUpload(cs, upload, fmt.Errorf("%w : presigned upload %q expired at %v", ErrInvalidRequest, upload.ID, upload.ExpiresAt))
+	}
+	exist, err := s.ObjectStore.EvidenceExists(cs.Bucket(), upload.ObjectName)
+	if err != nil {
+		return nil, fmt.Errorf("chaking evidence in object store: %w , evidence name: %q ", err, upload.Name)
+	}
+	if !exist {
+		return nil, fmt.Errorf("%w : evidence %q wasn't uploaded", ErrInvalidRequest, upload.Name)
+	}
+	file := &storedObject{objects: s.ObjectStore, bucket: cs.Bucket(), name: upload.ObjectName}
+	defer file.Close()
+	ev := &Evidence{
+		CaseID:            cs.ID,
+		Name:              upload.Name,
+		Folder:            upload.Folder,
+		File:              file,
+		UploadedBy:        upload.Username,
+		DeclaredHashes:    declared,
+		PresignedUploadID: upload.ID,
+		Custody:           withDetail(actor, "presigned upload"),
+	}
+	err = s.CreateEvidence(ev, cs)
+	if err != nil {
+		return nil, s.discardPresignedUpload(cs, upload, err)
+	}
+	err = s.ObjectStore.RemoveEvidence(&Evidence{CaseID: cs.ID, Name: upload.ObjectName}, cs.Bucket())
+	if err != nil {
+		return nil, fmt.Errorf("removing uploaded object from object store: %w , object name: %q ", err, upload.ObjectName)
+	}
+	return ev, nil
+}
+
+// discardPresignedUpload removes the uploaded object and the presigned upload
+// after its completion failed and returns the error of the completion
+func (s *Stores) discardPresignedUpload(cs *Case, upload *PresignedUpload, err error) error {
+	errR := s.ObjectStore.RemoveEvidence(&Evidence{CaseID: cs.ID, Name: upload.ObjectName}, cs.Bucket())
+	if errR != nil {
+		return fmt.Errorf("%w, removing uploaded object from object store : %v ", err, errR)
+	}
+	errR = s.PresignedUploads.RemovePresignedUpload(upload.ID)
+	if errR != nil && !errors.Is(errR, ErrNotFound) {
+		return fmt.Errorf("%w, removing presigned upload : %v ", err, errR)
+	}
+	return err
+}
+
+// objectHash returns the SHA256 hash of an object in the object store
+func (s *Stores) objectHash(cs *Case, objectName string) (string, error) {
+	hashes, err := s.objectHashes(cs, objectName, []string{HashSHA256})
+	if err != nil {
+		return "", err
+	}
+	return hashes[HashSHA256], nil
+}
+
+// objectHashes reads an object in the object store once and returns its hashes
+// of the algorithms, the SHA256 hash is always computed
+func (s *Stores) objectHashes(cs *Case, objectName string, algorithms []string) (Hashes, error) {
+	file, err := s.ObjectStore.GetEvidence(cs.Bucket(), objectName)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidence in object store: %w , object name: %q ", err, objectName)
+	}
+	defer file.Close()
+	d := newDigester(append([]string{HashSHA256}, algorithms...))
+	_, err = io.Copy(d, file)
+	if err != nil {
+		return nil, fmt.Errorf("hashing evidence : %w , object name: %q ", err, objectName)
+	}
+	return d.Sum(), nil
+}
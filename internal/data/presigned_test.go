@@ -0,0 +1,332 @@
+package data_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// presigningStore hands out fake presigned URLs for an in-memory ObjectStore and
+// counts the objects it copied
+type presigningStore struct {
+	data.ObjectStore
+	copies int
+}
+
+func (p *presigningStore) PresignGet(caseName string, objectName string, filename string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage/%s/%s?filename=%s", caseName, objectName, filename), nil
+}
+
+func (p *presigningStore) PresignPut(caseName string, objectName string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage/%s/%s", caseName, objectName), nil
+}
+
+func (p *presigningStore) CopyObject(caseName string, srcName string, dstName string) error {
+	file, err := p.GetEvidence(caseName, srcName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = p.CreateEvidence(&data.Evidence{Name: dstName}, caseName, file)
+	if err != nil {
+		return err
+	}
+	p.copies++
+	return nil
+}
+
+// upload stores content under the object name the way a client does with a presigned URL
+func (p *presigningStore) upload(t *testing.T, caseName string, objectName string, content string) {
+	_, err := p.CreateEvidence(&data.Evidence{Name: objectName}, caseName, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to upload object: %v", err)
+	}
+}
+
+// getTestPresignStores returns the stores of getTestHoldStores with a presigning object store
+func getTestPresignStores(t *testing.T) (data.Stores, *data.Case, *presigningStore) {
+	stores, cs := getTestHoldStores(t)
+	presigner := &presigningStore{ObjectStore: stores.ObjectStore}
+	stores.ObjectStore = presigner
+	return stores, cs, presigner
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCompletePresignedUploadCreatedEvidence(t *testing.T) {
+	stores, cs, presigner := getTestPresignStores(t)
+	upload := &data.PresignedUpload{CaseID: cs.ID, Name: "audio", Username: "clerk"}
+	err := stores.CreatePresignedUpload(upload, 0)
+	if err != nil {
+		t.Fatalf("failed to create presigned upload: %v", err)
+	}
+	if upload.URL != "https://storage/"+cs.Bucket()+"/"+upload.ObjectName {
+		t.Errorf("unexpected upload URL %q", upload.URL)
+	}
+	if upload.ExpiresAt.Before(time.Now().Add(data.DefaultPresignExpiry - time.Minute)) {
+		t.Errorf("expected the default expiry, got %v", upload.ExpiresAt)
+	}
+	presigner.upload(t, cs.Bucket(), upload.ObjectName, "audio")
+	ev, err := stores.CompletePresignedUpload(cs.ID, upload.ID, "clerk", sha256Hex("audio"), nil)
+	if err != nil {
+		t.Fatalf("failed to complete presigned upload: %v", err)
+	}
+	got, err := stores.GetEvidenceByID(ev.ID, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ObjectName == upload.ObjectName || presigner.copies != 1 {
+		t.Errorf("expected the evidence to be copied in the object store from the uploaded object %q, got %d copies", upload.ObjectName, presigner.copies)
+	}
+	want := data.Evidence{ID: ev.ID, CaseID: cs.ID, Name: "audio", ObjectName: got.ObjectName, Hash: sha256Hex("audio"), Hashes: hashesOf("audio"), VerifiedAt: got.VerifiedAt, VerificationStatus: data.VerificationPassed}
+	if !cmp.Equal(want, *got) {
+		t.Errorf(cmp.Diff(want, *got))
+	}
+	// the presigned URL can't change the evidence after it was hashed
+	exist, err := stores.ObjectStore.EvidenceExists(cs.Bucket(), upload.ObjectName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Errorf("expected the uploaded object %q to be removed", upload.ObjectName)
+	}
+	version, err := stores.GetEvidenceVersion(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != 1 || version.UploadedBy != "clerk" {
+		t.Errorf("unexpected first version %+v", version)
+	}
+	_, err = stores.CompletePresignedUpload(cs.ID, upload.ID, "clerk", "", nil)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v completing the upload twice, got %v", data.ErrNotFound, err)
+	}
+}
+
+func TestCompletePresignedUploadCompletedOnce(t *testing.T) {
+	stores, cs, presigner := getTestPresignStores(t)
+	upload := &data.PresignedUpload{CaseID: cs.ID, Name: "audio", Username: "clerk"}
+	err := stores.CreatePresignedUpload(upload, 0)
+	if err != nil {
+		t.Fatalf("failed to create presigned upload: %v", err)
+	}
+	presigner.upload(t, cs.Bucket(), upload.ObjectName, "audio")
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = stores.CompletePresignedUpload(cs.ID, upload.ID, "clerk", "", nil)
+		}(i)
+	}
+	wg.Wait()
+	completed := 0
+	for _, err := range errs {
+		if err == nil {
+			completed++
+		}
+	}
+	if completed != 1 {
+		t.Errorf("expected the upload to be completed once, got %d completions: %v", completed, errs)
+	}
+	ev, err := stores.DBStore.GetEvidenceByName(cs, "", "audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := stores.ListEvidenceVersions(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("expected one version of the evidence, got %d", len(versions))
+	}
+}
+
+func TestCompletePresignedUploadAddedVersionToExistingEvidence(t *testing.T) {
+	stores, cs, presigner := getTestPresignStores(t)
+	upload := &data.PresignedUpload{CaseID: cs.ID, Name: "video", Username: "clerk"}
+	err := stores.CreatePresignedUpload(upload, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create presigned upload: %v", err)
+	}
+	if upload.ObjectName == objectOf(t, stores, cs, "video") {
+		t.Fatalf("expected a new object name, got %q", upload.ObjectName)
+	}
+	presigner.upload(t, cs.Bucket(), upload.ObjectName, "edited video")
+	_, err = stores.CompletePresignedUpload(cs.ID, upload.ID, "clerk", "", nil)
+	if err != nil {
+		t.Fatalf("failed to complete presigned upload: %v", err)
+	}
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := stores.DownloadEvidenceVersion(ev, 0)
+	if err != nil {
+		t.Fatalf("failed to download evidence: %v", err)
+	}
+	content, err := io.ReadAll(*file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "edited video" {
+		t.Errorf("expected the latest version to be the uploaded one, got %q", content)
+	}
+}
+
+func TestCompletePresignedUploadFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		uploaded bool
+		hash     string
+		expiry   time.Duration
+		caseID   int64
+		username string
+		want     error
+	}{
+		{
+			name:     "with hash that doesn't match",
+			content:  "audio",
+			uploaded: true,
+			hash:     sha256Hex("other audio"),
+			caseID:   1,
+			want:     data.ErrHashMismatch,
+		},
+		{
+			name:     "without uploaded object",
+			uploaded: false,
+			caseID:   1,
+			want:     data.ErrInvalidRequest,
+		},
+		{
+			name:     "after the URL expired",
+			content:  "audio",
+			uploaded: true,
+			expiry:   time.Millisecond,
+			caseID:   1,
+			want:     data.ErrInvalidRequest,
+		},
+		{
+			name:     "with upload of another case",
+			content:  "audio",
+			uploaded: true,
+			caseID:   2,
+			want:     data.ErrNotFound,
+		},
+		{
+			name:     "by another user",
+			content:  "audio",
+			uploaded: true,
+			caseID:   1,
+			username: "judge",
+			want:     data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs, presigner := getTestPresignStores(t)
+			upload := &data.PresignedUpload{CaseID: cs.ID, Name: "audio", Username: "clerk"}
+			err := stores.CreatePresignedUpload(upload, tt.expiry)
+			if err != nil {
+				t.Fatalf("failed to create presigned upload: %v", err)
+			}
+			if tt.uploaded {
+				presigner.upload(t, cs.Bucket(), upload.ObjectName, tt.content)
+			}
+			time.Sleep(tt.expiry)
+			username := "clerk"
+			if tt.username != "" {
+				username = tt.username
+			}
+			_, err = stores.CompletePresignedUpload(tt.caseID, upload.ID, username, tt.hash, nil)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+			// an upload that failed the hash check or expired must not be kept
+			discarded := tt.want == data.ErrHashMismatch || tt.expiry != 0
+			exist, err := stores.ObjectStore.EvidenceExists(cs.Bucket(), upload.ObjectName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.uploaded && !discarded; exist != want {
+				t.Errorf("expected object to exist %v, got %v", want, exist)
+			}
+			_, err = stores.PresignedUploads.GetPresignedUpload(upload.ID)
+			if kept := err == nil; kept == discarded {
+				t.Errorf("expected presigned upload to be kept %v, got %v", !discarded, err)
+			}
+		})
+	}
+}
+
+func TestPresignRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		stores func(t *testing.T) data.Stores
+		expiry time.Duration
+		want   error
+	}{
+		{
+			name: "by an object store without presigned URLs",
+			stores: func(t *testing.T) data.Stores {
+				stores, _ := getTestHoldStores(t)
+				return stores
+			},
+			want: data.ErrInvalidRequest,
+		},
+		{
+			name: "for expiry longer than a week",
+			stores: func(t *testing.T) data.Stores {
+				stores, _, _ := getTestPresignStores(t)
+				return stores
+			},
+			expiry: 8 * 24 * time.Hour,
+			want:   data.ErrInvalidRequest,
+		},
+		{
+			name: "for an encrypted case",
+			stores: func(t *testing.T) data.Stores {
+				stores, _ := getTestDispositionStores(t)
+				encrypted := stores.ObjectStore.(*data.EncryptedStore)
+				encrypted.ObjectStore = &presigningStore{ObjectStore: encrypted.ObjectStore}
+				return stores
+			},
+			want: data.ErrConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := tt.stores(t)
+			cs, err := stores.DBStore.GetCaseByName("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := stores.GetEvidenceByID(1, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = stores.PresignDownload(ev, 0, tt.expiry)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v presigning download, got %v", tt.want, err)
+			}
+			err = stores.CreatePresignedUpload(&data.PresignedUpload{CaseID: cs.ID, Name: "video"}, tt.expiry)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v presigning upload, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReceiptStatement is the signed content of an ingestion receipt, it states
+// exactly what was deposited, by whom and when the server received it
+type ReceiptStatement struct {
+	CaseID     int64     `json:"case_id"`
+	EvidenceID int64     `json:"evidence_id"`
+	Folder     string    `json:"folder,omitempty"`
+	Name       string    `json:"name"`
+	Hashes     Hashes    `json:"hashes"`
+	UploadedBy string    `json:"uploaded_by"`
+	ReceivedAt time.Time `json:"received_at"`
+	KeyID      string    `json:"key_id"`
+}
+
+// Receipt proves to the submitter what was deposited. Statement is the exact JSON
+// that was signed and Signature is its detached Ed25519 signature, it can be
+// verified with the public key of the signing key named in the statement.
+type Receipt struct {
+	ReceiptStatement
+	Statement string `json:"statement"`
+	Signature []byte `json:"signature"`
+}
+
+// parseStatement fills the receipt fields from the signed statement
+func (r *Receipt) parseStatement() error {
+	err := json.Unmarshal([]byte(r.Statement), &r.ReceiptStatement)
+	if err != nil {
+		return fmt.Errorf("%w : reading receipt statement : %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+// NewReceipt signs the statement and returns the receipt
+func NewReceipt(statement ReceiptStatement, signer *Signer) (*Receipt, error) {
+	statement.KeyID = signer.KeyID()
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{
+		Statement: string(body),
+		Signature: signer.Sign(body),
+	}
+	err = receipt.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// IssueReceipt signs a receipt for an evidence that was just ingested, it covers
+// the hashes of the content that was received
+func (s *Stores) IssueReceipt(ev *Evidence) (*Receipt, error) {
+	if s.Signer == nil {
+		return nil, fmt.Errorf("%w : signing key is not configured", ErrInvalidRequest)
+	}
+	receipt, err := NewReceipt(ReceiptStatement{
+		CaseID:     ev.CaseID,
+		EvidenceID: ev.ID,
+		Folder:     ev.Folder,
+		Name:       ev.Name,
+		Hashes:     ev.Hashes.Stored(ev.Hash),
+		UploadedBy: ev.UploadedBy,
+		ReceivedAt: time.Now().UTC(),
+	}, s.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("signing receipt: %w , evidence name: %q ", err, ev.Name)
+	}
+	return receipt, nil
+}
+
+// VerifyReceipt reports whether the statement of the receipt was signed by the
+// signing key of the server named in it, the current key or a previous one, and
+// fills the receipt fields from it
+func (s *Stores) VerifyReceipt(receipt *Receipt) (bool, error) {
+	if s.Signer == nil {
+		return false, fmt.Errorf("%w : signing key is not configured", ErrInvalidRequest)
+	}
+	err := receipt.parseStatement()
+	if err != nil {
+		return false, err
+	}
+	return s.Signer.VerifyKey(receipt.KeyID, []byte(receipt.Statement), receipt.Signature), nil
+}
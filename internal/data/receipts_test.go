@@ -0,0 +1,140 @@
+package data_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+func TestIssueReceiptCoveredIngestedEvidence(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	stores.Signer = getTestSigner(t)
+	ev := &data.Evidence{CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "videos", File: strings.NewReader("video"), UploadedBy: "clerk"}
+	err := stores.CreateEvidence(ev, cs)
+	if err != nil {
+		t.Fatalf("failed to create evidence: %v", err)
+	}
+	receipt, err := stores.IssueReceipt(ev)
+	if err != nil {
+		t.Fatalf("failed to issue receipt: %v", err)
+	}
+	want := data.ReceiptStatement{
+		CaseID:     cs.ID,
+		EvidenceID: ev.ID,
+		Folder:     "videos",
+		Name:       "Scene 1.mp4",
+		Hashes:     hashesOf("video"),
+		UploadedBy: "clerk",
+		ReceivedAt: receipt.ReceivedAt,
+		KeyID:      "test",
+	}
+	if !cmp.Equal(want, receipt.ReceiptStatement) {
+		t.Errorf(cmp.Diff(want, receipt.ReceiptStatement))
+	}
+	if receipt.ReceivedAt.IsZero() {
+		t.Errorf("expected receipt with the server time")
+	}
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(receipt *data.Receipt)
+		want    bool
+		wantErr error
+	}{
+		{
+			name:   "untouched receipt is valid",
+			change: func(receipt *data.Receipt) {},
+			want:   true,
+		},
+		{
+			name: "changed statement is invalid",
+			change: func(receipt *data.Receipt) {
+				receipt.Statement = strings.Replace(receipt.Statement, `"uploaded_by":"clerk"`, `"uploaded_by":"judge"`, 1)
+			},
+		},
+		{
+			name: "statement of another key is invalid",
+			change: func(receipt *data.Receipt) {
+				receipt.Statement = strings.Replace(receipt.Statement, `"key_id":"test"`, `"key_id":"other"`, 1)
+			},
+		},
+		{
+			name: "statement that isn't JSON fails",
+			change: func(receipt *data.Receipt) {
+				receipt.Statement = "receipt"
+			},
+			wantErr: data.ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestHoldStores(t)
+			stores.Signer = getTestSigner(t)
+			ev, err := stores.GetEvidenceByID(1, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev.UploadedBy = "clerk"
+			issued, err := stores.IssueReceipt(ev)
+			if err != nil {
+				t.Fatalf("failed to issue receipt: %v", err)
+			}
+			receipt := &data.Receipt{Statement: issued.Statement, Signature: issued.Signature}
+			tt.change(receipt)
+			got, err := stores.VerifyReceipt(receipt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected valid %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifyReceiptOfPreviousKey(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	stores.Signer = getTestSigner(t)
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := stores.IssueReceipt(ev)
+	if err != nil {
+		t.Fatalf("failed to issue receipt: %v", err)
+	}
+	previous := "test:" + base64.StdEncoding.EncodeToString(stores.Signer.PublicKey())
+	tests := []struct {
+		name         string
+		previousKeys string
+		want         bool
+	}{
+		{name: "kept as previous key is valid", previousKeys: previous, want: true},
+		{name: "removed from the keys is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores.Signer, err = data.NewSigner(data.SigningConfig{
+				PrivateKey:   "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+				KeyID:        "other",
+				PreviousKeys: tt.previousKeys,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := stores.VerifyReceipt(&data.Receipt{Statement: issued.Statement, Signature: issued.Signature})
+			if err != nil {
+				t.Fatalf("failed to verify receipt: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected valid %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of drift between the database and the object store
+const (
+	DriftOrphanCase    = "orphan_case"
+	DriftMissingCase   = "missing_case"
+	DriftOrphanObject  = "orphan_object"
+	DriftMissingObject = "missing_object"
+	DriftHashMismatch  = "hash_mismatch"
+	// DriftPlaintextCase is a case without a data key while encryption is
+	// enabled, it was created before and its evidences are stored in plaintext
+	DriftPlaintextCase = "plaintext_case"
+)
+
+// QuarantinePrefix is prepended to the names of orphaned objects that are
+// quarantined, quarantined objects are not reported again
+const QuarantinePrefix = "quarantine-"
+
+// ReconcilerName is recorded as the verifier of rows marked by reconciliation
+const ReconcilerName = "reconciler"
+
+// ReconcileOptions selects the optional checks and repairs of a reconciliation,
+// without them the stores are only compared and nothing is changed
+type ReconcileOptions struct {
+	// VerifyHashes recomputes the hash of every object that has a row
+	VerifyHashes bool `json:"verify_hashes"`
+	// Quarantine renames orphaned objects with the QuarantinePrefix
+	Quarantine bool `json:"quarantine"`
+	// MarkRows records a verification for evidences with missing or mismatched
+	// objects, so their verification status shows the drift
+	MarkRows bool `json:"mark_rows"`
+}
+
+// Drift is a single difference between the database and the object store
+type Drift struct {
+	Kind         string `json:"kind"`
+	CaseID       int64  `json:"case_id,omitempty"`
+	CaseName     string `json:"case_name,omitempty"`
+	StorageKey   string `json:"storage_key,omitempty"`
+	EvidenceID   int64  `json:"evidence_id,omitempty"`
+	Version      int64  `json:"version,omitempty"`
+	ObjectName   string `json:"object_name,omitempty"`
+	ExpectedHash string `json:"expected_hash,omitempty"`
+	ComputedHash string `json:"computed_hash,omitempty"`
+	Repair       string `json:"repair,omitempty"`
+}
+
+// DriftReport is the result of a reconciliation
+type DriftReport struct {
+	Options    ReconcileOptions `json:"options"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Cases      int              `json:"cases"`
+	Evidences  int              `json:"evidences"`
+	Objects    int              `json:"objects"`
+	Drifts     []Drift          `json:"drifts"`
+}
+
+// versionObject is a version of an evidence that is expected in the object store
+type versionObject struct {
+	evidence *Evidence
+	version  EvidenceVersion
+}
+
+// Reconcile compares the cases and evidences in the database with the buckets and
+// objects in the object store and reports every difference. Repairs are only made
+// when they are enabled in the options.
+func (s *Stores) Reconcile(opts ReconcileOptions) (*DriftReport, error) {
+	report := &DriftReport{Options: opts, StartedAt: time.Now().UTC(), Drifts: []Drift{}}
+	casesDB, err := s.DBStore.ListCases()
+	if err != nil {
+		return nil, fmt.Errorf("list cases from DB: %w ", err)
+	}
+	casesFS, err := s.ObjectStore.ListCases()
+	if err != nil {
+		return nil, fmt.Errorf("list cases from object storage: %w ", err)
+	}
+	buckets := make(map[string]bool, len(casesFS))
+	for _, cs := range casesFS {
+		buckets[cs.Name] = true
+	}
+	for i := range casesDB {
+		cs := &casesDB[i]
+		report.Cases++
+		exists := buckets[cs.Bucket()]
+		delete(buckets, cs.Bucket())
+		if !exists {
+			report.Drifts = append(report.Drifts, Drift{Kind: DriftMissingCase, CaseID: cs.ID, CaseName: cs.Name, StorageKey: cs.Bucket()})
+		}
+		err = s.reconcileEncryption(cs, report)
+		if err != nil {
+			return nil, err
+		}
+		err = s.reconcileCase(cs, exists, opts, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var orphans []string
+	for name := range buckets {
+		orphans = append(orphans, name)
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		report.Drifts = append(report.Drifts, Drift{Kind: DriftOrphanCase, StorageKey: name})
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// reconcileEncryption reports the case when encryption is enabled and the case
+// has no data key
+func (s *Stores) reconcileEncryption(cs *Case, report *DriftReport) error {
+	shredder, ok := s.ObjectStore.(KeyShredder)
+	if !ok {
+		return nil
+	}
+	keyID, err := shredder.CaseKeyID(cs.Bucket())
+	if err != nil {
+		return fmt.Errorf("getting case key: %w , case ID: %d ", err, cs.ID)
+	}
+	if keyID == "" {
+		report.Drifts = append(report.Drifts, Drift{Kind: DriftPlaintextCase, CaseID: cs.ID, CaseName: cs.Name, StorageKey: cs.Bucket()})
+	}
+	return nil
+}
+
+// reconcileCase compares the evidences of a case with the objects in its bucket
+func (s *Stores) reconcileCase(cs *Case, bucketExists bool, opts ReconcileOptions, report *DriftReport) error {
+	evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		return fmt.Errorf("getting evidences from DB: %w , case ID: %d ", err, cs.ID)
+	}
+	start := len(report.Drifts)
+	expected := map[string]versionObject{}
+	var names []string
+	for i := range evidences {
+		ev := &evidences[i]
+		report.Evidences++
+		versions, err := s.DBStore.ListEvidenceVersions(ev.ID)
+		if err != nil {
+			return fmt.Errorf("getting evidence versions from DB: %w , evidence id: %d ", err, ev.ID)
+		}
+		if len(versions) == 0 {
+			versions = []EvidenceVersion{{EvidenceID: ev.ID, Hash: ev.Hash, ObjectName: ev.Object()}}
+		}
+		for _, v := range versions {
+			expected[v.ObjectName] = versionObject{evidence: ev, version: v}
+			names = append(names, v.ObjectName)
+		}
+	}
+	objects := map[string]bool{}
+	if bucketExists {
+		list, err := s.ObjectStore.ListEvidences(cs.Bucket())
+		if err != nil {
+			return fmt.Errorf("getting evidences from object store: %w , case ID: %d ", err, cs.ID)
+		}
+		for _, object := range list {
+			objects[object.Name] = true
+		}
+		report.Objects += len(list)
+	}
+	drifted := map[int64]*Evidence{}
+	for _, name := range names {
+		object := expected[name]
+		drift := Drift{
+			CaseID:       cs.ID,
+			CaseName:     cs.Name,
+			EvidenceID:   object.evidence.ID,
+			Version:      object.version.Version,
+			ObjectName:   name,
+			ExpectedHash: object.version.Hash,
+		}
+		if !objects[name] {
+			drift.Kind = DriftMissingObject
+			report.Drifts = append(report.Drifts, drift)
+			drifted[object.evidence.ID] = object.evidence
+			continue
+		}
+		if !opts.VerifyHashes {
+			continue
+		}
+		hash, err := s.objectHash(cs, name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			drift.Kind = DriftMissingObject
+		case errors.Is(err, ErrIntegrity):
+			// an encrypted object that can't be decrypted was changed
+			drift.Kind = DriftHashMismatch
+		case err != nil:
+			return err
+		case hash != object.version.Hash:
+			drift.Kind = DriftHashMismatch
+			drift.ComputedHash = hash
+		default:
+			continue
+		}
+		report.Drifts = append(report.Drifts, drift)
+		drifted[object.evidence.ID] = object.evidence
+	}
+	pending, err := s.pendingUploadObjects(cs)
+	if err != nil {
+		return err
+	}
+	var orphans []string
+	for name := range objects {
+		if _, ok := expected[name]; !ok && !pending[name] && !strings.HasPrefix(name, QuarantinePrefix) {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		drift := Drift{Kind: DriftOrphanObject, CaseID: cs.ID, CaseName: cs.Name, ObjectName: name}
+		if opts.Quarantine {
+			drift.Repair = s.quarantineObject(cs, name)
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+	if opts.MarkRows {
+		s.markDrifted(drifted, report.Drifts[start:])
+	}
+	return nil
+}
+
+// pendingUploadObjects returns the objects of the uploads in progress in the case,
+// the parts of resumable uploads and the objects of presigned uploads that can
+// still be completed. They have no evidence yet but aren't orphans.
+func (s *Stores) pendingUploadObjects(cs *Case) (map[string]bool, error) {
+	pending := map[string]bool{}
+	uploads, err := s.Uploads.ListUploads(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting uploads from DB: %w , case ID: %d ", err, cs.ID)
+	}
+	for _, upload := range uploads {
+		for _, part := range upload.Parts {
+			pending[part] = true
+		}
+	}
+	presigned, err := s.PresignedUploads.ListPresignedUploads(cs.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting presigned uploads from DB: %w , case ID: %d ", err, cs.ID)
+	}
+	now := time.Now()
+	for _, upload := range presigned {
+		if now.Before(upload.ExpiresAt) {
+			pending[upload.ObjectName] = true
+		}
+	}
+	return pending, nil
+}
+
+// quarantineObject renames an orphaned object with the QuarantinePrefix and
+// describes the result for the drift report
+func (s *Stores) quarantineObject(cs *Case, name string) string {
+	target := QuarantinePrefix + name
+	exist, err := s.ObjectStore.EvidenceExists(cs.Bucket(), target)
+	if err != nil {
+		return fmt.Sprintf("quarantine failed: %v", err)
+	}
+	if exist {
+		return fmt.Sprintf("quarantine failed: %q already exists", target)
+	}
+	file, err := s.ObjectStore.GetEvidence(cs.Bucket(), name)
+	if err != nil {
+		return fmt.Sprintf("quarantine failed: %v", err)
+	}
+	_, err = s.ObjectStore.CreateEvidence(&Evidence{Name: target}, cs.Bucket(), file)
+	file.Close()
+	if err != nil {
+		return fmt.Sprintf("quarantine failed: %v", err)
+	}
+	err = s.ObjectStore.RemoveEvidence(&Evidence{Name: name}, cs.Bucket())
+	if err != nil {
+		return fmt.Sprintf("quarantined as %q, removing the orphan failed: %v", target, err)
+	}
+	return fmt.Sprintf("quarantined as %q", target)
+}
+
+// markDrifted verifies the drifted evidences once so their verification status
+// records the missing or mismatched objects, the result is added to the drifts
+func (s *Stores) markDrifted(drifted map[int64]*Evidence, drifts []Drift) {
+	marked := map[int64]string{}
+	for i := range drifts {
+		drift := &drifts[i]
+		ev, ok := drifted[drift.EvidenceID]
+		if !ok {
+			continue
+		}
+		repair, ok := marked[ev.ID]
+		if !ok {
+			_, err := s.VerifyEvidence(ev, ReconcilerName)
+			if err != nil {
+				repair = fmt.Sprintf("marking failed: %v", err)
+			} else {
+				repair = fmt.Sprintf("marked %s", ev.VerificationStatus)
+			}
+			marked[ev.ID] = repair
+		}
+		drift.Repair = repair
+	}
+}
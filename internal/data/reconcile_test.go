@@ -0,0 +1,208 @@
+package data_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// getTestDriftedStores returns the stores of getTestHoldStores with every kind of
+// drift: the video object was changed, the picture object removed, a stray object
+// added to the test case, a case named gone has no bucket and bucket lost no case
+func getTestDriftedStores(t *testing.T) (data.Stores, *data.Case) {
+	stores, cs := getTestHoldStores(t)
+	replaceObject(t, stores, cs, "video", "edited video")
+	err := stores.ObjectStore.RemoveEvidence(&data.Evidence{Name: objectOf(t, stores, cs, "picture")}, cs.Bucket())
+	if err != nil {
+		t.Fatalf("failed to remove object: %v", err)
+	}
+	_, err = stores.ObjectStore.CreateEvidence(&data.Evidence{Name: "stray"}, cs.Bucket(), strings.NewReader("stray"))
+	if err != nil {
+		t.Fatalf("failed to create object: %v", err)
+	}
+	err = stores.DBStore.AddCase(&data.Case{Name: "gone"}, &data.User{ID: 1})
+	if err != nil {
+		t.Fatalf("failed to add case: %v", err)
+	}
+	err = stores.ObjectStore.CreateCase(&data.Case{Name: "lost"})
+	if err != nil {
+		t.Fatalf("failed to create bucket: %v", err)
+	}
+	return stores, cs
+}
+
+func TestReconcileReportedDrift(t *testing.T) {
+	tests := []struct {
+		name string
+		opts data.ReconcileOptions
+		want []string
+	}{
+		{
+			name: "without options found missing and orphaned objects and cases",
+			want: []string{"missing picture", "stray object", "gone case", "lost case"},
+		},
+		{
+			name: "with hash verification also found changed objects",
+			opts: data.ReconcileOptions{VerifyHashes: true},
+			want: []string{"changed video", "missing picture", "stray object", "gone case", "lost case"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestDriftedStores(t)
+			drifts := map[string]data.Drift{
+				"missing picture": {Kind: data.DriftMissingObject, CaseID: 1, CaseName: "test", EvidenceID: 2, Version: 1, ObjectName: objectOf(t, stores, cs, "picture"), ExpectedHash: sha256Hex("picture")},
+				"changed video":   {Kind: data.DriftHashMismatch, CaseID: 1, CaseName: "test", EvidenceID: 1, Version: 1, ObjectName: objectOf(t, stores, cs, "video"), ExpectedHash: sha256Hex("video"), ComputedHash: sha256Hex("edited video")},
+				"stray object":    {Kind: data.DriftOrphanObject, CaseID: 1, CaseName: "test", ObjectName: "stray"},
+				// gone was added without a storage key, so it is stored under its name
+				"gone case": {Kind: data.DriftMissingCase, CaseID: 2, CaseName: "gone", StorageKey: "gone"},
+				"lost case": {Kind: data.DriftOrphanCase, StorageKey: "lost"},
+			}
+			var want []data.Drift
+			for _, name := range tt.want {
+				want = append(want, drifts[name])
+			}
+			report, err := stores.Reconcile(tt.opts)
+			if err != nil {
+				t.Fatalf("failed to reconcile: %v", err)
+			}
+			if !cmp.Equal(want, report.Drifts) {
+				t.Errorf(cmp.Diff(want, report.Drifts))
+			}
+			if report.Cases != 2 || report.Evidences != 2 || report.Objects != 2 {
+				t.Errorf("expected 2 cases, evidences and objects to be checked, got %+v", report)
+			}
+			// nothing is repaired without repair options
+			exist, err := stores.ObjectStore.EvidenceExists(cs.Bucket(), "stray")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exist {
+				t.Errorf("expected the stray object to be kept")
+			}
+			ev, err := stores.GetEvidenceByID(2, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.VerificationStatus != "" {
+				t.Errorf("expected the picture not to be marked, got %q", ev.VerificationStatus)
+			}
+		})
+	}
+}
+
+func TestReconcileRepairedDrift(t *testing.T) {
+	stores, cs := getTestDriftedStores(t)
+	evidences := map[string]string{objectOf(t, stores, cs, "video"): "video", objectOf(t, stores, cs, "picture"): "picture"}
+	report, err := stores.Reconcile(data.ReconcileOptions{VerifyHashes: true, Quarantine: true, MarkRows: true})
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	got := map[string]string{}
+	for _, drift := range report.Drifts {
+		name := drift.ObjectName + drift.StorageKey
+		if evidence, ok := evidences[drift.ObjectName]; ok {
+			name = evidence
+		}
+		got[drift.Kind+" "+name] = drift.Repair
+	}
+	want := map[string]string{
+		"hash_mismatch video":    "marked mismatch",
+		"missing_object picture": "marked missing",
+		"orphan_object stray":    `quarantined as "quarantine-stray"`,
+		"missing_case gone":      "",
+		"orphan_case lost":       "",
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	for id, status := range map[int64]string{1: data.VerificationMismatch, 2: data.VerificationMissing} {
+		ev, err := stores.GetEvidenceByID(id, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.VerificationStatus != status {
+			t.Errorf("expected evidence %d to be marked %q, got %q", id, status, ev.VerificationStatus)
+		}
+	}
+	// quarantined objects are not reported again
+	report, err = stores.Reconcile(data.ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	var kinds []string
+	for _, drift := range report.Drifts {
+		kinds = append(kinds, drift.Kind)
+	}
+	wantKinds := []string{data.DriftMissingObject, data.DriftMissingCase, data.DriftOrphanCase}
+	if !cmp.Equal(wantKinds, kinds) {
+		t.Errorf(cmp.Diff(wantKinds, kinds))
+	}
+}
+
+func TestReconcileReportedCaseCreatedBeforeEncryption(t *testing.T) {
+	stores, _ := getTestDispositionStores(t)
+	encrypted := stores.ObjectStore.(*data.EncryptedStore)
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := stores
+	plaintext.ObjectStore = encrypted.ObjectStore
+	err = plaintext.CreateCase(user, "old")
+	if err != nil {
+		t.Fatalf("failed to create case: %v", err)
+	}
+	cs, err := stores.DBStore.GetCaseByName("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := stores.Reconcile(data.ReconcileOptions{VerifyHashes: true})
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	want := []data.Drift{{Kind: data.DriftPlaintextCase, CaseID: cs.ID, CaseName: "old", StorageKey: cs.Bucket()}}
+	if !cmp.Equal(want, report.Drifts) {
+		t.Errorf(cmp.Diff(want, report.Drifts))
+	}
+}
+
+func TestReconcileKeptObjectsOfUploadsInProgress(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	upload := mustCreateUpload(t, stores, cs, "audio", 6)
+	upload, err := stores.AppendUpload(upload, cs, 0, strings.NewReader("sam"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	// the objects of presigned uploads are put by the client
+	for name, expiresAt := range map[string]time.Time{"pending": time.Now().Add(time.Hour), "expired": time.Now().Add(-time.Hour)} {
+		err = stores.PresignedUploads.AddPresignedUpload(&data.PresignedUpload{ID: data.NewUploadID(), CaseID: cs.ID, Name: name, ObjectName: name, Username: "clerk", ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatalf("failed to add presigned upload: %v", err)
+		}
+		_, err = stores.ObjectStore.CreateEvidence(&data.Evidence{Name: name}, cs.Bucket(), strings.NewReader(name))
+		if err != nil {
+			t.Fatalf("failed to create object: %v", err)
+		}
+	}
+	report, err := stores.Reconcile(data.ReconcileOptions{Quarantine: true})
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	// an expired presigned upload can't be completed anymore
+	want := []data.Drift{{Kind: data.DriftOrphanObject, CaseID: cs.ID, CaseName: cs.Name, ObjectName: "expired", Repair: `quarantined as "quarantine-expired"`}}
+	if !cmp.Equal(want, report.Drifts) {
+		t.Errorf(cmp.Diff(want, report.Drifts))
+	}
+	upload, err = stores.AppendUpload(upload, cs, 3, strings.NewReader("ple"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	_, err = stores.CompleteUpload(upload, cs, nil)
+	if err != nil {
+		t.Errorf("failed to complete upload after reconcile: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Permissions the routes require, a user has the permissions of their role
+const (
+	PermCaseCreate  = "case:create"
+	PermCaseRead    = "case:read"
+	PermCaseDelete  = "case:delete"
+	PermCaseDispose = "case:dispose"
+	// PermCaseAll grants owner access to every case without being its member
+	PermCaseAll          = "case:all"
+	PermHoldManage       = "hold:manage"
+	PermFolderManage     = "folder:manage"
+	PermEvidenceRead     = "evidence:read"
+	PermEvidenceUpload   = "evidence:upload"
+	PermEvidenceDownload = "evidence:download"
+	PermEvidenceMove     = "evidence:move"
+	PermEvidenceDelete   = "evidence:delete"
+	PermEvidenceComment  = "evidence:comment"
+	PermEvidenceVerify   = "evidence:verify"
+	PermCertificateRead  = "certificate:read"
+	PermAuditRead        = "audit:read"
+	PermAuditManage      = "audit:manage"
+	PermKeyManage        = "key:manage"
+	PermStorageReconcile = "storage:reconcile"
+	PermUserManage       = "user:manage"
+)
+
+// Roles users can be assigned
+const (
+	RoleClerk         = "clerk"
+	RoleJudge         = "judge"
+	RoleProsecutor    = "prosecutor"
+	RoleDefense       = "defense"
+	RoleAuditor       = "auditor"
+	RoleAdministrator = "administrator"
+	// RoleAdmin is the role of users added before roles were introduced, it has
+	// the permissions of an administrator
+	RoleAdmin = "admin"
+)
+
+// DefaultRole is assigned to users registered or added without a role
+const DefaultRole = RoleClerk
+
+// rolePermissions are the permissions of each role
+var rolePermissions = map[string][]string{
+	RoleClerk: {
+		PermCaseCreate, PermCaseRead, PermFolderManage, PermEvidenceRead, PermEvidenceUpload,
+		PermEvidenceDownload, PermEvidenceMove, PermEvidenceComment, PermEvidenceVerify,
+	},
+	RoleJudge: {
+		PermCaseRead, PermCaseDispose, PermHoldManage, PermEvidenceRead, PermEvidenceDownload,
+		PermEvidenceComment, PermEvidenceVerify, PermCertificateRead,
+	},
+	RoleProsecutor: {
+		PermCaseRead, PermEvidenceRead, PermEvidenceUpload, PermEvidenceDownload, PermEvidenceComment,
+	},
+	RoleDefense: {
+		PermCaseRead, PermEvidenceRead, PermEvidenceDownload, PermEvidenceComment,
+	},
+	RoleAuditor: {
+		PermCaseRead, PermEvidenceRead, PermEvidenceVerify, PermCertificateRead, PermAuditRead,
+	},
+	RoleAdministrator: {
+		PermCaseCreate, PermCaseRead, PermCaseDelete, PermCaseDispose, PermHoldManage, PermFolderManage,
+		PermEvidenceRead, PermEvidenceUpload, PermEvidenceDownload, PermEvidenceMove, PermEvidenceDelete,
+		PermEvidenceComment, PermEvidenceVerify, PermCertificateRead, PermAuditRead, PermAuditManage,
+		PermKeyManage, PermStorageReconcile, PermUserManage, PermCaseAll,
+	},
+}
+
+// Permissions returns the permissions of the role, unknown roles have none
+func Permissions(role string) []string {
+	if role == RoleAdmin {
+		role = RoleAdministrator
+	}
+	return append([]string(nil), rolePermissions[role]...)
+}
+
+// HasPermission reports whether the role grants the permission
+func HasPermission(role string, permission string) bool {
+	for _, p := range Permissions(role) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns the roles that can be assigned with their permissions
+func Roles() map[string][]string {
+	roles := make(map[string][]string, len(rolePermissions))
+	for role := range rolePermissions {
+		roles[role] = Permissions(role)
+	}
+	return roles
+}
+
+// ValidateRole returns ErrInvalidRequest if the role can't be assigned
+func ValidateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		names := make([]string, 0, len(rolePermissions))
+		for name := range rolePermissions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%w : unknown role %q, roles are %q", ErrInvalidRequest, role, names)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		permission string
+		want       bool
+	}{
+		{name: "administrator manages users", role: data.RoleAdministrator, permission: data.PermUserManage, want: true},
+		{name: "legacy admin has the administrator permissions", role: data.RoleAdmin, permission: data.PermCaseDelete, want: true},
+		{name: "clerk creates cases", role: data.RoleClerk, permission: data.PermCaseCreate, want: true},
+		{name: "clerk doesn't delete cases", role: data.RoleClerk, permission: data.PermCaseDelete},
+		{name: "judge disposes cases", role: data.RoleJudge, permission: data.PermCaseDispose, want: true},
+		{name: "defense downloads evidences", role: data.RoleDefense, permission: data.PermEvidenceDownload, want: true},
+		{name: "defense doesn't upload evidences", role: data.RoleDefense, permission: data.PermEvidenceUpload},
+		{name: "auditor reads the audit log", role: data.RoleAuditor, permission: data.PermAuditRead, want: true},
+		{name: "auditor doesn't download evidences", role: data.RoleAuditor, permission: data.PermEvidenceDownload},
+		{name: "unknown role has no permissions", role: "user", permission: data.PermCaseRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := data.HasPermission(tt.role, tt.permission)
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		role     string
+		wantErr  error
+	}{
+		{name: "assigning a role successful", username: "clerk", role: data.RoleJudge},
+		{name: "assigning an unknown role failed", username: "clerk", role: "admin", wantErr: data.ErrInvalidRequest},
+		{name: "assigning a role to a missing user failed", username: "nobody", role: data.RoleJudge, wantErr: data.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := memstore.NewStores()
+			err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+			if err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+			_, err = stores.SetUserRole(tt.username, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			want := data.DefaultRole
+			if err == nil {
+				want = tt.role
+			}
+			user, err := stores.User.GetByUsername("clerk")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != want {
+				t.Errorf("expected role %q, got %q", want, user.Role)
+			}
+		})
+	}
+}
+
+func TestCreateUserWithUnknownRoleFailed(t *testing.T) {
+	stores := memstore.NewStores()
+	err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret", Role: "superuser"})
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected error %v, got %v", data.ErrInvalidRequest, err)
+	}
+}
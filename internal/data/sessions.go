@@ -0,0 +1,298 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRefreshTokenDuration is used when no refresh token duration is configured
+const DefaultRefreshTokenDuration = 24 * time.Hour
+
+// Session is a login of a user, it is keyed by the ID of its refresh token. A
+// refresh rotates the session into a new one with a new refresh token and the
+// old session is revoked with ReplacedBy set. The access tokens of a session
+// are valid while the session is active.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Username   string     `json:"username"`
+	UserAgent  string     `json:"user_agent"`
+	ClientIP   string     `json:"client_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+}
+
+// Active reports whether the session is neither revoked nor expired at the time
+func (s *Session) Active(at time.Time) bool {
+	return s.RevokedAt == nil && at.Before(s.ExpiresAt)
+}
+
+// SessionStore keeps the sessions of users
+type SessionStore interface {
+	AddSession(session *Session) error
+	GetSession(id uuid.UUID) (*Session, error)
+	ListSessions(userID int64) ([]Session, error)
+	// RotateSession revokes the active session and adds the next one in its
+	// place, it returns ErrConflict when the session was already revoked
+	RotateSession(id uuid.UUID, next *Session) error
+	RevokeSession(id uuid.UUID, at time.Time) error
+}
+
+type Sessions struct {
+	DB *sql.DB
+}
+
+func NewSessionStore(db *sql.DB) SessionStore {
+	return &Sessions{
+		DB: db,
+	}
+}
+
+// sessionColumns are the columns scanned into a Session by scanSession
+const sessionColumns = `"id", "user_id", "username", "user_agent", "client_ip", "created_at", "expires_at", "revoked_at", "replaced_by"`
+
+func scanSession(row scanner) (*Session, error) {
+	var s Session
+	err := row.Scan(&s.ID, &s.UserID, &s.Username, &s.UserAgent, &s.ClientIP, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt, &s.ReplacedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// AddSession stores the session and sets its creation time
+func (s *Sessions) AddSession(session *Session) error {
+	err := s.DB.QueryRow(`INSERT INTO "sessions" ("id", "user_id", "username", "user_agent", "client_ip", "expires_at") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "created_at"`,
+		session.ID, session.UserID, session.Username, session.UserAgent, session.ClientIP, session.ExpiresAt).Scan(&session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting session : %w", err)
+	}
+	return nil
+}
+
+// GetSession returns the session or ErrNotFound
+func (s *Sessions) GetSession(id uuid.UUID) (*Session, error) {
+	session, err := scanSession(s.DB.QueryRow(`SELECT `+sessionColumns+` FROM "sessions" WHERE "id" = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w : session id : %s", ErrNotFound, id)
+	}
+	return session, err
+}
+
+// ListSessions returns all sessions of the user ordered by creation time,
+// including revoked and expired ones
+func (s *Sessions) ListSessions(userID int64) ([]Session, error) {
+	rows, err := s.DB.Query(`SELECT `+sessionColumns+` FROM "sessions" WHERE "user_id" = $1 ORDER BY "created_at"`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// RotateSession revokes the active session and adds the next one in its place,
+// it returns ErrConflict when the session was already revoked
+func (s *Sessions) RotateSession(id uuid.UUID, next *Session) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`UPDATE "sessions" SET "revoked_at" = now(), "replaced_by" = $2 WHERE "id" = $1 AND "revoked_at" IS NULL`, id, next.ID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : session id %s is already revoked", ErrConflict, id)
+	}
+	err = tx.QueryRow(`INSERT INTO "sessions" ("id", "user_id", "username", "user_agent", "client_ip", "expires_at") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "created_at"`,
+		next.ID, next.UserID, next.Username, next.UserAgent, next.ClientIP, next.ExpiresAt).Scan(&next.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting session : %w", err)
+	}
+	return tx.Commit()
+}
+
+// RevokeSession revokes the session, revoking a revoked session keeps its
+// revocation time. It returns ErrNotFound when the session doesn't exist.
+func (s *Sessions) RevokeSession(id uuid.UUID, at time.Time) error {
+	result, err := s.DB.Exec(`UPDATE "sessions" SET "revoked_at" = COALESCE("revoked_at", $2) WHERE "id" = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : session id : %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+// StartSession adds a session of the user, id is the ID of the refresh token of
+// the session and expiresAt its expiry
+func (s *Stores) StartSession(id uuid.UUID, user *User, userAgent string, clientIP string, expiresAt time.Time) (*Session, error) {
+	session := &Session{
+		ID:        id,
+		UserID:    user.ID,
+		Username:  user.Username,
+		UserAgent: userAgent,
+		ClientIP:  clientIP,
+		ExpiresAt: expiresAt,
+	}
+	err := s.Sessions.AddSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("adding session in DB: %w , username: %q ", err, user.Username)
+	}
+	return session, nil
+}
+
+// CheckSession returns ErrUnauthorized unless the session is active
+func (s *Stores) CheckSession(id uuid.UUID) (*Session, error) {
+	session, err := s.Sessions.GetSession(id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w : unknown session", ErrUnauthorized)
+		}
+		return nil, fmt.Errorf("getting session from DB: %w , session id: %s ", err, id)
+	}
+	if !session.Active(time.Now()) {
+		return nil, fmt.Errorf("%w : session is revoked or expired", ErrUnauthorized)
+	}
+	return session, nil
+}
+
+// RefreshSession rotates the active session into a new one with the ID of the
+// next refresh token, the new session keeps the expiry of the login. Refreshing
+// with the token of a rotated session means the token was stolen or replayed,
+// so every session it was rotated into is revoked.
+func (s *Stores) RefreshSession(id uuid.UUID, nextID uuid.UUID, userAgent string, clientIP string) (*Session, error) {
+	session, err := s.CheckSession(id)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthorized) {
+			return nil, err
+		}
+		revokeErr := s.revokeReplacements(id)
+		if revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, err
+	}
+	next := &Session{
+		ID:        nextID,
+		UserID:    session.UserID,
+		Username:  session.Username,
+		UserAgent: userAgent,
+		ClientIP:  clientIP,
+		ExpiresAt: session.ExpiresAt,
+	}
+	err = s.Sessions.RotateSession(id, next)
+	if err != nil {
+		if errors.Is(err, ErrConflict) {
+			return nil, fmt.Errorf("%w : session is revoked", ErrUnauthorized)
+		}
+		return nil, fmt.Errorf("rotating session in DB: %w , session id: %s ", err, id)
+	}
+	return next, nil
+}
+
+// revokeReplacements revokes the sessions the session was rotated into
+func (s *Stores) revokeReplacements(id uuid.UUID) error {
+	session, err := s.Sessions.GetSession(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	for err == nil && session.ReplacedBy != nil {
+		err = s.Sessions.RevokeSession(*session.ReplacedBy, time.Now())
+		if err != nil {
+			break
+		}
+		session, err = s.Sessions.GetSession(*session.ReplacedBy)
+	}
+	if err != nil {
+		return fmt.Errorf("revoking rotated sessions in DB: %w , session id: %s ", err, id)
+	}
+	return nil
+}
+
+// RevokeSession revokes the session, a revoked session can't be refreshed and
+// its access tokens are rejected
+func (s *Stores) RevokeSession(id uuid.UUID) error {
+	err := s.Sessions.RevokeSession(id, time.Now())
+	if err != nil {
+		return fmt.Errorf("revoking session in DB: %w , session id: %s ", err, id)
+	}
+	return nil
+}
+
+// ListActiveSessions returns the active sessions of the user
+func (s *Stores) ListActiveSessions(username string) ([]Session, error) {
+	user, err := s.userByName(username)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.Sessions.ListSessions(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions from DB: %w , username: %q ", err, username)
+	}
+	now := time.Now()
+	var active []Session
+	for _, session := range sessions {
+		if session.Active(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// RevokeUserSession revokes the session of the user, it returns ErrNotFound
+// when the user has no such session
+func (s *Stores) RevokeUserSession(username string, id uuid.UUID) error {
+	user, err := s.userByName(username)
+	if err != nil {
+		return err
+	}
+	session, err := s.Sessions.GetSession(id)
+	if err != nil {
+		return fmt.Errorf("getting session from DB: %w , session id: %s ", err, id)
+	}
+	if session.UserID != user.ID {
+		return fmt.Errorf("%w : session of user %q", ErrNotFound, username)
+	}
+	return s.RevokeSession(id)
+}
+
+// RevokeUserSessions revokes all active sessions of the user and returns how
+// many were revoked
+func (s *Stores) RevokeUserSessions(username string) (int, error) {
+	sessions, err := s.ListActiveSessions(username)
+	if err != nil {
+		return 0, err
+	}
+	for _, session := range sessions {
+		err = s.RevokeSession(session.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
@@ -0,0 +1,148 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miloszizic/der/internal/data"
+	"github.com/miloszizic/der/internal/data/memstore"
+)
+
+// getTestSessionStores returns stores with the clerk logged in once
+func getTestSessionStores(t *testing.T) (data.Stores, *data.Session) {
+	stores := memstore.NewStores()
+	err := stores.CreateUser(&data.UserRequest{Username: "clerk", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := stores.StartSession(uuid.New(), user, "forensics/1.0", "192.0.2.1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	return stores, session
+}
+
+func TestRefreshSession(t *testing.T) {
+	stores, session := getTestSessionStores(t)
+	next, err := stores.RefreshSession(session.ID, uuid.New(), "forensics/1.1", "192.0.2.2")
+	if err != nil {
+		t.Fatalf("failed to refresh session: %v", err)
+	}
+	if !next.ExpiresAt.Equal(session.ExpiresAt) || next.UserID != session.UserID {
+		t.Errorf("expected the next session to keep the user and expiry, got %+v", next)
+	}
+	_, err = stores.CheckSession(session.ID)
+	if !errors.Is(err, data.ErrUnauthorized) {
+		t.Errorf("expected rotated session to be revoked, got %v", err)
+	}
+	_, err = stores.CheckSession(next.ID)
+	if err != nil {
+		t.Errorf("expected the next session to be active, got %v", err)
+	}
+	// the rotated refresh token is replayed
+	_, err = stores.RefreshSession(session.ID, uuid.New(), "attacker", "198.51.100.1")
+	if !errors.Is(err, data.ErrUnauthorized) {
+		t.Fatalf("expected error %v refreshing a rotated session, got %v", data.ErrUnauthorized, err)
+	}
+	_, err = stores.CheckSession(next.ID)
+	if !errors.Is(err, data.ErrUnauthorized) {
+		t.Errorf("expected the session it was rotated into to be revoked, got %v", err)
+	}
+}
+
+func TestCheckSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, stores data.Stores, session *data.Session) uuid.UUID
+		wantErr error
+	}{
+		{
+			name:   "active session is accepted",
+			change: func(t *testing.T, stores data.Stores, session *data.Session) uuid.UUID { return session.ID },
+		},
+		{
+			name: "revoked session is rejected",
+			change: func(t *testing.T, stores data.Stores, session *data.Session) uuid.UUID {
+				err := stores.RevokeSession(session.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return session.ID
+			},
+			wantErr: data.ErrUnauthorized,
+		},
+		{
+			name: "expired session is rejected",
+			change: func(t *testing.T, stores data.Stores, session *data.Session) uuid.UUID {
+				user, err := stores.User.GetByUsername("clerk")
+				if err != nil {
+					t.Fatal(err)
+				}
+				expired, err := stores.StartSession(uuid.New(), user, "", "", time.Now().Add(-time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return expired.ID
+			},
+			wantErr: data.ErrUnauthorized,
+		},
+		{
+			name:    "unknown session is rejected",
+			change:  func(t *testing.T, stores data.Stores, session *data.Session) uuid.UUID { return uuid.New() },
+			wantErr: data.ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, session := getTestSessionStores(t)
+			_, err := stores.CheckSession(tt.change(t, stores, session))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	stores, session := getTestSessionStores(t)
+	user, err := stores.User.GetByUsername("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := stores.StartSession(uuid.New(), user, "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := stores.ListActiveSessions("clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("expected 2 active sessions, got %d", len(active))
+	}
+	err = stores.RevokeUserSession("clerk", other.ID)
+	if err != nil {
+		t.Fatalf("failed to revoke session: %v", err)
+	}
+	revoked, err := stores.RevokeUserSessions("clerk")
+	if err != nil {
+		t.Fatalf("failed to revoke sessions: %v", err)
+	}
+	if revoked != 1 {
+		t.Errorf("expected 1 revoked session, got %d", revoked)
+	}
+	_, err = stores.CheckSession(session.ID)
+	if !errors.Is(err, data.ErrUnauthorized) {
+		t.Errorf("expected revoked session, got %v", err)
+	}
+	err = stores.RevokeUserSession("nobody", session.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected error %v for a missing user, got %v", data.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Signer signs documents the registry issues, like destruction certificates,
+// with an Ed25519 key from the config. Documents signed by retired keys are
+// verified with their public keys.
+type Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+	keys  map[string]ed25519.PublicKey
+}
+
+// NewSigner creates a Signer from the signing config, the private key is a
+// base64 encoded 32 byte Ed25519 seed and the previous keys are base64 encoded
+// public keys.
+func NewSigner(config SigningConfig) (*Signer, error) {
+	if config.KeyID == "" {
+		return nil, fmt.Errorf("%w : signing key id is missing", ErrInvalidRequest)
+	}
+	seed, err := base64.StdEncoding.DecodeString(config.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w : signing key must be a 32 byte base64 encoded seed", ErrInvalidRequest)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	s := &Signer{
+		keyID: config.KeyID,
+		key:   key,
+		keys:  map[string]ed25519.PublicKey{config.KeyID: key.Public().(ed25519.PublicKey)},
+	}
+	for _, pair := range strings.Split(config.PreviousKeys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w : previous signing keys must be id:key pairs", ErrInvalidRequest)
+		}
+		if _, exists := s.keys[id]; exists {
+			return nil, fmt.Errorf("%w : signing key id %q is used twice", ErrInvalidRequest, id)
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w : signing key %q must be a 32 byte base64 encoded public key", ErrInvalidRequest, id)
+		}
+		s.keys[id] = publicKey
+	}
+	return s, nil
+}
+
+// FromSigningConfig creates the Signer when a signing key is configured, otherwise it returns nil
+func FromSigningConfig(config Config) (*Signer, error) {
+	if config.Signing.PrivateKey == "" {
+		return nil, nil
+	}
+	return NewSigner(config.Signing)
+}
+
+// KeyID returns the id of the signing key
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey returns the public key that verifies the signatures
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// PublicKeys returns the public keys of the current and the previous signing
+// keys by their id
+func (s *Signer) PublicKeys() map[string]ed25519.PublicKey {
+	keys := make(map[string]ed25519.PublicKey, len(s.keys))
+	for id, key := range s.keys {
+		keys[id] = key
+	}
+	return keys
+}
+
+// Sign signs the message
+func (s *Signer) Sign(message []byte) []byte {
+	return ed25519.Sign(s.key, message)
+}
+
+// Verify returns true if the signature of the message was made by this signer
+func (s *Signer) Verify(message, signature []byte) bool {
+	return ed25519.Verify(s.PublicKey(), message, signature)
+}
+
+// VerifyKey returns true if the signature of the message was made by the signing
+// key with the id, the current one or a previous one
+func (s *Signer) VerifyKey(keyID string, message, signature []byte) bool {
+	publicKey, ok := s.keys[keyID]
+	if !ok {
+		return false
+	}
+	return ed25519.Verify(publicKey, message, signature)
+}
@@ -4,26 +4,60 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Stores struct {
-	User        UserStore
-	DBStore     DBStore
-	ObjectStore ObjectStore
+	User             UserStore
+	DBStore          DBStore
+	ObjectStore      ObjectStore
+	Uploads          UploadStore
+	PresignedUploads PresignedUploadStore
+	Certificates     CertificateStore
+	Holds            HoldStore
+	Verifications    VerificationStore
+	Custody          CustodyStore
+	Sessions         SessionStore
+	Identities       IdentityStore
+	Signer           *Signer
+	// Timestamper requests RFC 3161 tokens for ingested evidences, nil disables it
+	Timestamper Timestamper
+	// HashAlgorithms are computed at ingest, DefaultHashAlgorithms when empty
+	HashAlgorithms []string
+	// OIDC signs users in at the identity provider, nil disables single sign-on
+	OIDC *OIDCProvider
 }
 
 // NewStores creates a new Stores object
-func NewStores(db *sql.DB, client *minio.Client) Stores {
+func NewStores(db *sql.DB, obs ObjectStore) Stores {
 	return Stores{
-		User:        NewUserStore(db),
-		DBStore:     NewDBStore(db),
-		ObjectStore: NewObjectStore(client),
+		User:             NewUserStore(db),
+		DBStore:          NewDBStore(db),
+		ObjectStore:      obs,
+		Uploads:          NewUploadStore(db),
+		PresignedUploads: NewPresignedUploadStore(db),
+		Certificates:     NewCertificateStore(db),
+		Holds:            NewHoldStore(db),
+		Verifications:    NewVerificationStore(db),
+		Custody:          NewCustodyStore(db),
+		Sessions:         NewSessionStore(db),
+		Identities:       NewIdentityStore(db),
 	}
 }
+
+// CreateCase creates a case in the database and the object store, the name is a
+// free-form display name and the case is stored under a generated storage key
 func (s *Stores) CreateCase(user *User, name string) error {
+	err := ValidateCaseName(name)
+	if err != nil {
+		return err
+	}
 	exists, err := s.DBStore.CaseExists(name)
 	if err != nil {
 		return err
@@ -33,24 +67,18 @@ func (s *Stores) CreateCase(user *User, name string) error {
 	}
 	// create case struct
 	cs := &Case{
-		Name: name,
+		Name:       name,
+		StorageKey: NewStorageKey(),
 	}
 	// create case in ObjectStore
 	err = s.ObjectStore.CreateCase(cs)
 	if err != nil {
-		switch {
-		case err.Error() == "Bucket name contains invalid characters":
-			return fmt.Errorf("%w : case contains invalid characters: %q ", ErrInvalidRequest, cs.Name)
-		case err.Error() == "Bucket name cannot be empty":
-			return fmt.Errorf("%w : case name cannot be empty ", ErrInvalidRequest)
-		default:
-			return fmt.Errorf("creating case in objects store : %w", err)
-		}
+		return fmt.Errorf("creating case in objects store : %w", err)
 	}
 	// create case in database
 	err = s.DBStore.AddCase(cs, user)
 	if err != nil {
-		errR := s.ObjectStore.RemoveCase(name)
+		errR := s.ObjectStore.RemoveCase(cs.Bucket())
 		if errR != nil {
 			return fmt.Errorf("creating case in DB : %w, removing case from object store : %v ", err, errR)
 		}
@@ -58,6 +86,33 @@ func (s *Stores) CreateCase(user *User, name string) error {
 	}
 	return nil
 }
+
+// maxCaseNameLength is the length of the name column of cases in characters
+const maxCaseNameLength = 255
+
+// ValidateCaseName checks that a case name can be stored, names are free-form
+// Unicode like "К 123/2026" but can't be blank or contain control characters
+func ValidateCaseName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w : case name cannot be empty ", ErrInvalidRequest)
+	}
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxCaseNameLength {
+		return fmt.Errorf("%w : case name must be valid UTF-8 of at most %d characters ", ErrInvalidRequest, maxCaseNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w : case name contains control characters: %q ", ErrInvalidRequest, name)
+		}
+	}
+	return nil
+}
+
+// NewStorageKey returns a key to store a new case under, it is a valid bucket name
+// that doesn't depend on the case name so cases can be renamed
+func NewStorageKey() string {
+	return "case-" + uuid.New().String()
+}
+
 func (s *Stores) GetCaseByID(id int64) (*Case, error) {
 	cs, err := s.DBStore.GetCaseByID(id)
 	if err != nil {
@@ -82,16 +137,40 @@ func (s *Stores) RemoveCase(name string) error {
 	if err != nil {
 		return fmt.Errorf(" getting case in DB :%w, case name: %q  ", err, name)
 	}
+	// cases under legal hold can't be removed
+	err = s.checkCaseHolds(cs)
+	if err != nil {
+		return err
+	}
 	// check if case exists in the ObjectStore
-	exist, err = s.ObjectStore.CaseExists(cs.Name)
+	exist, err = s.ObjectStore.CaseExists(cs.Bucket())
 	if err != nil {
 		return fmt.Errorf(" checking case in object store :%w, case name: %q  ", err, name)
 	}
 	if !exist {
 		return fmt.Errorf(" %w: case name: %q ", ErrNotFound, name)
 	}
+	evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		return fmt.Errorf("getting evidences from DB : %w , case name: %q ", err, name)
+	}
+	err = s.liftExpiredHolds(cs, evidences)
+	if err != nil {
+		return err
+	}
+	// uploads in progress have parts in the bucket
+	uploads, err := s.Uploads.ListUploads(cs.ID)
+	if err != nil {
+		return fmt.Errorf("getting uploads from DB : %w , case name: %q ", err, name)
+	}
+	for i := range uploads {
+		err = s.RemoveUpload(&uploads[i], cs)
+		if err != nil {
+			return err
+		}
+	}
 	// remove case from ObjectStore
-	err = s.ObjectStore.RemoveCase(cs.Name)
+	err = s.ObjectStore.RemoveCase(cs.Bucket())
 	if err != nil {
 		return fmt.Errorf("%w : removing case from object store: %q ", err, cs.Name)
 	}
@@ -117,7 +196,7 @@ func (s *Stores) ListCases() ([]Case, error) {
 	var List []Case
 	for _, caseDB := range casesDB {
 		for _, caseFS := range casesFS {
-			if caseDB.Name == caseFS.Name {
+			if caseDB.Bucket() == caseFS.Name {
 				List = append(List, caseDB)
 			}
 		}
@@ -125,42 +204,177 @@ func (s *Stores) ListCases() ([]Case, error) {
 	return List, nil
 }
 
-// CreateEvidence creates an evidence in the database and the FS
+// CreateEvidence creates an evidence in its folder in the database and in the FS
+// under a generated object name, when an evidence with the same name exists in
+// the folder a new version of it is created. If the evidence has an expected hash,
+// the stored content must match it. Hashes declared by the client must match the
+// content too and the match is recorded in the verification history. The upload
+// is recorded in the chain of custody with the evidence, ev.Custody holds who
+// uploaded it.
 func (s *Stores) CreateEvidence(ev *Evidence, cs *Case) error {
+	err := ValidateEvidenceName(ev.Name)
+	if err != nil {
+		return err
+	}
+	ev.Folder, err = CleanFolderPath(ev.Folder)
+	if err != nil {
+		return err
+	}
+	ev.DeclaredHashes, err = validateDeclaredHashes(ev.DeclaredHashes)
+	if err != nil {
+		return err
+	}
 	// check if the evidence already exists in the database
 	exist, err := s.DBStore.EvidenceExists(ev)
 	if err != nil {
 		return fmt.Errorf("chaking evidence in DB: %w , evidence name: %q ", err, ev.Name)
 	}
 	if exist {
-		return fmt.Errorf(" %w in DB: evidence name: %q ", ErrAlreadyExists, ev.Name)
+		return s.createEvidenceVersion(ev, cs)
 	}
-	//check if the evidence already exists in the ObjectStore
-	exist, err = s.ObjectStore.EvidenceExists(cs.Name, ev.Name)
+	// create the evidence in ObjectStore and generate hashes
+	ev.ObjectName = NewEvidenceObjectName()
+	hashes, err := s.createObject(ev, ev.ObjectName, cs)
 	if err != nil {
-		return fmt.Errorf("chaking evidence in object store: %w , evidence name: %q ", err, ev.Name)
-	}
-	if exist {
-		return fmt.Errorf(" %w in object storage: evidence name: %q ", ErrAlreadyExists, ev.Name)
+		return err
 	}
-	// create the evidence in ObjectStore and generate hash
-	hash, err := s.ObjectStore.CreateEvidence(ev, cs.Name, ev.File)
+	held, err := s.holdNewObject(cs, 0, ev.ObjectName)
 	if err != nil {
-		return err
+		return s.removeNewObject(cs, ev.ObjectName, false, err)
 	}
 	// create the evidence in DB
-	ev.Hash = hash
+	ev.Hash = hashes[HashSHA256]
+	ev.Hashes = hashes
+	ev.Custody = custodyEvent(ev.Custody, CustodyUpload, ev)
 	id, err := s.DBStore.CreateEvidence(ev)
 	if err != nil {
-		errR := s.ObjectStore.RemoveEvidence(ev, cs.Name)
+		return s.removeNewObject(cs, ev.ObjectName, held, fmt.Errorf("creating evidence in DB: %w , evidence name: %q ", err, ev.Name))
+	}
+	ev.ID = id
+	return s.recordDeclaredHashes(ev, 1)
+}
+
+// createEvidenceVersion stores the evidence as the next version of the existing
+// evidence with the same name
+func (s *Stores) createEvidenceVersion(ev *Evidence, cs *Case) error {
+	existing, err := s.DBStore.GetEvidenceByName(cs, ev.Folder, ev.Name)
+	if err != nil {
+		return fmt.Errorf("getting evidence from DB: %w , evidence name: %q ", err, ev.Name)
+	}
+	objectName := NewVersionObjectName()
+	hashes, err := s.createObject(ev, objectName, cs)
+	if err != nil {
+		return err
+	}
+	held, err := s.holdNewObject(cs, existing.ID, objectName)
+	if err != nil {
+		return s.removeNewObject(cs, objectName, false, err)
+	}
+	version := &EvidenceVersion{
+		EvidenceID:        existing.ID,
+		Hash:              hashes[HashSHA256],
+		Hashes:            hashes,
+		ObjectName:        objectName,
+		UploadedBy:        ev.UploadedBy,
+		TimestampToken:    ev.TimestampToken,
+		PresignedUploadID: ev.PresignedUploadID,
+	}
+	version.Custody = custodyEvent(ev.Custody, CustodyUpload, &Evidence{ID: existing.ID, CaseID: existing.CaseID, Hash: version.Hash, UploadedBy: ev.UploadedBy})
+	err = s.DBStore.AddEvidenceVersion(version)
+	if err != nil {
+		return s.removeNewObject(cs, objectName, held, fmt.Errorf("adding evidence version in DB: %w , evidence name: %q ", err, ev.Name))
+	}
+	ev.ID = existing.ID
+	ev.ObjectName = existing.ObjectName
+	ev.Hash = hashes[HashSHA256]
+	ev.Hashes = hashes
+	ev.Custody = version.Custody
+	return s.recordDeclaredHashes(ev, version.Version)
+}
+
+// removeNewObject removes an object that was written for an evidence that
+// couldn't be created and returns the error it failed with, the legal hold set
+// on the object by holdNewObject is cleared first
+func (s *Stores) removeNewObject(cs *Case, objectName string, held bool, err error) error {
+	if held {
+		errR := s.ObjectStore.(LegalHolder).SetLegalHold(cs.Bucket(), objectName, false)
 		if errR != nil {
-			return fmt.Errorf("creating evidence in DB : %w, removing evidence from object store : %v ", err, errR)
+			return fmt.Errorf("%w, clearing legal hold in object store : %v ", err, errR)
 		}
-		return fmt.Errorf("creating evidence in DB: %w , evidence name: %q ", err, ev.Name)
 	}
-	ev.ID = id
-	return nil
+	errR := s.ObjectStore.RemoveEvidence(&Evidence{Name: objectName}, cs.Bucket())
+	if errR != nil {
+		return fmt.Errorf("%w, removing evidence from object store : %v ", err, errR)
+	}
+	return err
+}
+
+// createObject writes the evidence content under the object name and returns its
+// hashes, computed while the content is written. Content that is an object already
+// stored in the case is copied by the object store when it can, and the hashes
+// are computed by reading the copy once. The object is removed when it
+// doesn't match the expected hash or the declared hashes. When time-stamping is
+// configured the token of the SHA256 hash is set on the evidence, the object is
+// removed when the token can't be obtained.
+func (s *Stores) createObject(ev *Evidence, objectName string, cs *Case) (Hashes, error) {
+	object := &Evidence{ID: ev.ID, CaseID: ev.CaseID, Name: objectName}
+	file := ev.File
+	algorithms := append([]string{}, s.hashAlgorithms()...)
+	for algorithm := range ev.DeclaredHashes {
+		algorithms = append(algorithms, algorithm)
+	}
+	var hashes Hashes
+	var hash string
+	var err error
+	stored, ok := file.(*storedObject)
+	if copier, isCopier := s.ObjectStore.(ObjectCopier); ok && isCopier {
+		// the copy is hashed, so the hashes are those of the stored content
+		err = copier.CopyObject(cs.Bucket(), stored.name, objectName)
+		if err != nil {
+			return nil, fmt.Errorf("copying object in object store: %w , object name: %q ", err, stored.name)
+		}
+		hashes, err = s.objectHashes(cs, objectName, algorithms)
+		if err != nil {
+			return nil, s.removeNewObject(cs, objectName, false, err)
+		}
+		hash = hashes[HashSHA256]
+	} else {
+		d := newDigester(algorithms)
+		if file != nil {
+			file = io.TeeReader(file, d)
+		}
+		hash, err = s.ObjectStore.CreateEvidence(object, cs.Bucket(), file)
+		if err != nil {
+			return nil, err
+		}
+		hashes = d.Sum().Stored(hash)
+	}
+	if ev.ExpectedHash != "" && ev.ExpectedHash != hash {
+		errR := s.ObjectStore.RemoveEvidence(object, cs.Bucket())
+		if errR != nil {
+			return nil, fmt.Errorf("%w : expected hash %q, stored %q, removing evidence from object store : %v ", ErrHashMismatch, ev.ExpectedHash, hash, errR)
+		}
+		return nil, fmt.Errorf("%w : expected hash %q, stored %q ", ErrHashMismatch, ev.ExpectedHash, hash)
+	}
+	err = checkDeclaredHashes(ev.DeclaredHashes, hashes)
+	if err != nil {
+		errR := s.ObjectStore.RemoveEvidence(object, cs.Bucket())
+		if errR != nil {
+			return nil, fmt.Errorf("%w, removing evidence from object store : %v ", err, errR)
+		}
+		return nil, err
+	}
+	ev.TimestampToken, err = s.timestamp(hash)
+	if err != nil {
+		errR := s.ObjectStore.RemoveEvidence(object, cs.Bucket())
+		if errR != nil {
+			return nil, fmt.Errorf("time-stamping evidence : %w, removing evidence from object store : %v ", err, errR)
+		}
+		return nil, fmt.Errorf("time-stamping evidence: %w , evidence name: %q ", err, ev.Name)
+	}
+	return hashes, nil
 }
+
 func (s *Stores) GetEvidenceByID(id int64, csID int64) (*Evidence, error) {
 	ev, err := s.DBStore.GetEvidenceByID(id, csID)
 	if err != nil {
@@ -171,7 +385,15 @@ func (s *Stores) GetEvidenceByID(id int64, csID int64) (*Evidence, error) {
 	}
 	return ev, nil
 }
+
+// DownloadEvidence returns the content of the latest version of the evidence
 func (s *Stores) DownloadEvidence(ev *Evidence) (*io.ReadCloser, error) {
+	return s.DownloadEvidenceVersion(ev, 0)
+}
+
+// DownloadEvidenceVersion returns the content of a version of the evidence, version
+// zero is the latest version
+func (s *Stores) DownloadEvidenceVersion(ev *Evidence, version int64) (*io.ReadCloser, error) {
 	// check if the evidence exists in the database
 	cs, err := s.DBStore.GetCaseByID(ev.CaseID)
 	if err != nil {
@@ -180,22 +402,77 @@ func (s *Stores) DownloadEvidence(ev *Evidence) (*io.ReadCloser, error) {
 		}
 		return nil, fmt.Errorf("getting case by ID from DB: %w , evidence id: %d ", err, ev.CaseID)
 	}
+	objectName, err := s.versionObjectName(ev, version)
+	if err != nil {
+		return nil, err
+	}
 	// check if the evidence exists in the ObjectStore
-	exist, err := s.ObjectStore.EvidenceExists(cs.Name, ev.Name)
+	exist, err := s.ObjectStore.EvidenceExists(cs.Bucket(), objectName)
 	if err != nil {
 		return nil, fmt.Errorf("chaking evidence in object store: %w , evidence name: %q ", err, ev.Name)
 	}
 	if !exist {
 		return nil, fmt.Errorf(" %w in object storage: evidence name: %q ", ErrNotFound, ev.Name)
 	}
-	evidence, err := s.ObjectStore.GetEvidence(cs.Name, ev.Name)
+	evidence, err := s.ObjectStore.GetEvidence(cs.Bucket(), objectName)
 	if err != nil {
 		return nil, fmt.Errorf("getting evidence in object store: %w , evidence name: %q ", err, ev.Name)
 	}
 	return &evidence, nil
 }
 
-// DeleteEvidence deletes the evidence from the database and the FS
+// ListEvidenceVersions returns the revision history of the evidence
+func (s *Stores) ListEvidenceVersions(ev *Evidence) ([]EvidenceVersion, error) {
+	versions, err := s.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidence versions from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	return versions, nil
+}
+
+// GetEvidenceVersion returns a version of the evidence, version zero is the latest
+// version. Evidences without versions have their content as the latest version.
+func (s *Stores) GetEvidenceVersion(ev *Evidence, version int64) (*EvidenceVersion, error) {
+	if version > 0 {
+		return s.DBStore.GetEvidenceVersion(ev.ID, version)
+	}
+	versions, err := s.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidence versions from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	if len(versions) == 0 {
+		return &EvidenceVersion{EvidenceID: ev.ID, Hash: ev.Hash, ObjectName: ev.Object()}, nil
+	}
+	return &versions[len(versions)-1], nil
+}
+
+// versionObjectName returns the name of the object that holds a version of the
+// evidence, version zero is the latest version
+func (s *Stores) versionObjectName(ev *Evidence, version int64) (string, error) {
+	v, err := s.GetEvidenceVersion(ev, version)
+	if err != nil {
+		return "", err
+	}
+	return v.ObjectName, nil
+}
+
+// evidenceObjectNames returns the names of the objects of all versions of the evidence
+func (s *Stores) evidenceObjectNames(ev *Evidence) ([]string, error) {
+	versions, err := s.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidence versions from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	names := []string{ev.Object()}
+	for _, v := range versions {
+		if v.ObjectName != ev.Object() {
+			names = append(names, v.ObjectName)
+		}
+	}
+	return names, nil
+}
+
+// DeleteEvidence deletes the evidence with all its versions from the database and the FS,
+// the deletion is recorded in the chain of custody as made by ev.Custody
 func (s *Stores) DeleteEvidence(ev *Evidence) error {
 	// check if the evidence exists in the database
 	exist, err := s.DBStore.EvidenceExists(ev)
@@ -210,23 +487,39 @@ func (s *Stores) DeleteEvidence(ev *Evidence) error {
 	if err != nil {
 		return fmt.Errorf("getting case by ID in DB store: %w , case ID: %d and evidence name : %q ", err, ev.CaseID, ev.Name)
 	}
+	// evidences under legal hold can't be removed
+	err = s.checkEvidenceHolds(ev)
+	if err != nil {
+		return err
+	}
 	// check if the evidence exists in the ObjectStore
-	exist, err = s.ObjectStore.EvidenceExists(cs.Name, ev.Name)
+	exist, err = s.ObjectStore.EvidenceExists(cs.Bucket(), ev.Object())
 	if err != nil {
 		return fmt.Errorf("chaking evidence in object store: %w , evidence name: %q ", err, ev.Name)
 	}
 	if !exist {
 		return fmt.Errorf(" %w in object storage: evidence name: %q ", ErrNotFound, ev.Name)
 	}
+	objectNames, err := s.evidenceObjectNames(ev)
+	if err != nil {
+		return err
+	}
+	err = s.liftExpiredHolds(cs, []Evidence{*ev})
+	if err != nil {
+		return err
+	}
 	// delete evidence from the database
+	ev.Custody = custodyEvent(ev.Custody, CustodyDelete, ev)
 	err = s.DBStore.RemoveEvidence(ev)
 	if err != nil {
 		return fmt.Errorf("removing evidence from DB: %w , evidence name: %q ", err, ev.Name)
 	}
-	// delete evidence from the ObjectStore
-	err = s.ObjectStore.RemoveEvidence(ev, cs.Name)
-	if err != nil {
-		return fmt.Errorf("removing evidence from object store: %w , evidence name: %q ", err, ev.Name)
+	// delete all versions of the evidence from the ObjectStore
+	for _, name := range objectNames {
+		err = s.ObjectStore.RemoveEvidence(&Evidence{ID: ev.ID, CaseID: ev.CaseID, Name: name}, cs.Bucket())
+		if err != nil {
+			return fmt.Errorf("removing evidence from object store: %w , evidence name: %q ", err, ev.Name)
+		}
 	}
 	return nil
 }
@@ -240,7 +533,7 @@ func (s *Stores) ListEvidences(cs *Case) ([]Evidence, error) {
 		return nil, fmt.Errorf("getting evidences from DB: %w , case ID: %d ", err, cs.ID)
 	}
 	// list evidences in ObjectStore
-	evidencesFS, err := s.ObjectStore.ListEvidences(cs.Name)
+	evidencesFS, err := s.ObjectStore.ListEvidences(cs.Bucket())
 	if err != nil {
 		return nil, fmt.Errorf("getting evidences from object store: %w , case ID: %d ", err, cs.ID)
 	}
@@ -248,7 +541,7 @@ func (s *Stores) ListEvidences(cs *Case) ([]Evidence, error) {
 	var result []Evidence
 	for _, evDB := range evidencesDB {
 		for _, evFS := range evidencesFS {
-			if evDB.Name == evFS.Name {
+			if evDB.Object() == evFS.Name {
 				result = append(result, evDB)
 			}
 		}
@@ -256,17 +549,168 @@ func (s *Stores) ListEvidences(cs *Case) ([]Evidence, error) {
 	return result, nil
 }
 
+// CreateUpload starts a resumable upload of an evidence, when the evidence exists
+// in the case the upload becomes its next version. The name and folder are
+// checked before any chunk is received.
+func (s *Stores) CreateUpload(upload *Upload) error {
+	err := ValidateEvidenceName(upload.Name)
+	if err != nil {
+		return err
+	}
+	upload.Folder, err = CleanFolderPath(upload.Folder)
+	if err != nil {
+		return err
+	}
+	err = s.Uploads.CreateUpload(upload)
+	if err != nil {
+		return fmt.Errorf("creating upload: %w , evidence name: %q ", err, upload.Name)
+	}
+	return nil
+}
+
+// AppendUpload stores the chunk as the next part of the upload, offset must be
+// the current upload offset. The part is written to the bucket of the case while
+// it is hashed, so chunks are never kept on the API host. Of chunks received
+// concurrently at the same offset only one is added, the others fail with
+// ErrConflict. A chunk that fails while it is received isn't added and the
+// client resumes from the returned upload.
+func (s *Stores) AppendUpload(upload *Upload, cs *Case, offset int64, chunk io.Reader) (*Upload, error) {
+	if offset != upload.Offset {
+		return nil, fmt.Errorf("%w : upload offset is %d not %d", ErrConflict, upload.Offset, offset)
+	}
+	h, err := UnmarshalUploadHash(upload.HashState)
+	if err != nil {
+		return nil, err
+	}
+	var received byteCounter
+	part := NewUploadPartObjectName()
+	body := io.TeeReader(io.LimitReader(chunk, upload.Length-upload.Offset), io.MultiWriter(h, &received))
+	_, err = s.ObjectStore.CreateEvidence(&Evidence{CaseID: cs.ID, Name: part}, cs.Bucket(), body)
+	if err != nil {
+		return upload, fmt.Errorf("storing upload part: %w , upload id: %q ", err, upload.ID)
+	}
+	chunkErr := checkChunkEnd(chunk)
+	if received == 0 {
+		err = s.ObjectStore.RemoveEvidence(&Evidence{CaseID: cs.ID, Name: part}, cs.Bucket())
+		if err != nil {
+			return nil, fmt.Errorf("removing upload part from object store: %w , upload id: %q ", err, upload.ID)
+		}
+		return upload, chunkErr
+	}
+	next := *upload
+	next.Offset += int64(received)
+	next.HashState, err = MarshalUploadHash(h)
+	if err != nil {
+		return nil, err
+	}
+	next.Parts = append(append([]string{}, upload.Parts...), part)
+	err = s.Uploads.UpdateUpload(&next, offset)
+	if err != nil {
+		errR := s.ObjectStore.RemoveEvidence(&Evidence{CaseID: cs.ID, Name: part}, cs.Bucket())
+		if errR != nil {
+			return nil, fmt.Errorf("updating upload: %w , removing upload part from object store : %v ", err, errR)
+		}
+		return nil, fmt.Errorf("updating upload: %w , upload id: %q ", err, upload.ID)
+	}
+	return &next, chunkErr
+}
+
+// CompleteUpload creates the evidence from a complete upload and removes the upload
+// with its parts. The upload is claimed first, so it is completed only once, and
+// a failed completion removes it. The hash computed by the ObjectStore must match
+// the hash computed while the chunks were received. The actor is who completed
+// the upload, it is recorded in the chain of custody.
+func (s *Stores) CompleteUpload(upload *Upload, cs *Case, actor *CustodyEvent) (*Evidence, error) {
+	if !upload.Complete() {
+		return nil, fmt.Errorf("%w : upload %q is not complete", ErrInvalidRequest, upload.ID)
+	}
+	claimed, err := s.Uploads.ClaimUpload(upload.ID)
+	if err != nil {
+		return nil, fmt.Errorf("claiming upload: %w , upload id: %q ", err, upload.ID)
+	}
+	want, err := UploadHash(claimed)
+	if err != nil {
+		return nil, s.removeUploadParts(claimed, cs, err)
+	}
+	file := &uploadReader{objects: s.ObjectStore, bucket: cs.Bucket(), parts: claimed.Parts}
+	defer file.Close()
+	ev := &Evidence{
+		CaseID:       cs.ID,
+		Name:         claimed.Name,
+		Folder:       claimed.Folder,
+		File:         file,
+		UploadedBy:   claimed.Username,
+		ExpectedHash: want,
+		Custody:      withDetail(actor, "resumable upload"),
+	}
+	err = s.CreateEvidence(ev, cs)
+	err = s.removeUploadParts(claimed, cs, err)
+	if err != nil {
+		return nil, err
+	}
+	ev.File = nil
+	return ev, nil
+}
+
+// RemoveUpload terminates the upload and removes the parts received so far
+func (s *Stores) RemoveUpload(upload *Upload, cs *Case) error {
+	removed, err := s.Uploads.RemoveUpload(upload.ID)
+	if err != nil {
+		return fmt.Errorf("removing upload: %w , upload id: %q ", err, upload.ID)
+	}
+	return s.removeUploadParts(removed, cs, nil)
+}
+
+// removeUploadParts removes the parts of a removed upload from the object store
+// and returns the error the upload was removed with
+func (s *Stores) removeUploadParts(upload *Upload, cs *Case, err error) error {
+	for _, part := range upload.Parts {
+		errR := s.ObjectStore.RemoveEvidence(&Evidence{CaseID: cs.ID, Name: part}, cs.Bucket())
+		if errR != nil && err != nil {
+			return fmt.Errorf("%w, removing upload part from object store : %v ", err, errR)
+		}
+		if errR != nil {
+			return fmt.Errorf("removing upload part from object store: %w , upload id: %q ", errR, upload.ID)
+		}
+	}
+	return err
+}
+
+// RotateMasterKey wraps the data keys of all cases with the current master key,
+// it fails when evidences are not encrypted
+func (s *Stores) RotateMasterKey() (int, error) {
+	rotator, ok := s.ObjectStore.(KeyRotator)
+	if !ok {
+		return 0, fmt.Errorf("%w : evidence encryption is not enabled", ErrInvalidRequest)
+	}
+	rotated, err := rotator.RotateMasterKey()
+	if err != nil {
+		return rotated, fmt.Errorf("rotating master key : %w", err)
+	}
+	return rotated, nil
+}
+
 type UserRequest struct {
 	Username string `json:"username" binding:"required,alphanum"`
 	Password string `json:"password" binding:"required,min=6"`
+	Role     string `json:"role,omitempty"`
 }
 
-// CreateUser creates a new user in the database.
+// CreateUser creates a new user in the database with the role of the request,
+// or DefaultRole when it has none.
 func (s *Stores) CreateUser(request *UserRequest) error {
 	usr := &User{
 		Username: request.Username,
+		Role:     request.Role,
+	}
+	if usr.Role == "" {
+		usr.Role = DefaultRole
+	}
+	err := ValidateRole(usr.Role)
+	if err != nil {
+		return err
 	}
-	err := usr.Password.Set(request.Password)
+	err = usr.Password.Set(request.Password)
 	if err != nil {
 		return fmt.Errorf("setting password: %w", err)
 	}
@@ -278,8 +722,34 @@ func (s *Stores) CreateUser(request *UserRequest) error {
 	return nil
 }
 
-// AddEvidenceComment adds comment to existing evidence
-func (s *Stores) AddEvidenceComment(comment *Comment) error {
+// SetUserRole assigns the role to the user and returns the user
+func (s *Stores) SetUserRole(username string, role string) (*User, error) {
+	err := ValidateRole(role)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.User.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : user %q", ErrNotFound, username)
+		}
+		return nil, fmt.Errorf("getting user from DB: %w , username: %q ", err, username)
+	}
+	err = s.User.SetRole(user.ID, role)
+	if err != nil {
+		return nil, fmt.Errorf("setting user role in DB: %w , username: %q ", err, username)
+	}
+	user.Role = role
+	return user, nil
+}
+
+// AddEvidenceComment adds comment to existing evidence, the comment is recorded
+// in the chain of custody of the evidence as made by comment.Custody
+func (s *Stores) AddEvidenceComment(ev *Evidence, comment *Comment) error {
+	comment.EvidenceID = ev.ID
+	event := custodyEvent(comment.Custody, CustodyComment, ev)
+	event.Detail = comment.Text
+	comment.Custody = event
 	err := s.DBStore.AddComment(comment)
 	if err != nil {
 		return fmt.Errorf("adding comment to DB: %w", err)
@@ -287,6 +757,19 @@ func (s *Stores) AddEvidenceComment(comment *Comment) error {
 	return nil
 }
 
+// NewVersionObjectName returns a new object name for an evidence version, it
+// can't collide with evidence names that are stored under their own name
+func NewVersionObjectName() string {
+	return "version-" + uuid.New().String()
+}
+
+// NewEvidenceObjectName returns a new object name for the first version of an
+// evidence, names and folders of evidences never reach the object store so they
+// can be any Unicode and change without moving objects
+func NewEvidenceObjectName() string {
+	return "evidence-" + uuid.New().String()
+}
+
 // FromPostgresDB opens a connection to a Postgres database.
 func FromPostgresDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", dsn)
@@ -306,3 +789,36 @@ func FromMinio(endpoint, accessKeyID, secretAccessKey string) (*minio.Client, er
 	}
 	return minioClient, nil
 }
+
+// FromStorageConfig creates the ObjectStore selected by the storage driver in the config.
+func FromStorageConfig(config Config) (ObjectStore, error) {
+	switch config.Storage.Driver {
+	case "", StorageDriverMinio:
+		minioClient, err := FromMinio(
+			config.Minio.Endpoint,
+			config.Minio.AccessKey,
+			config.Minio.SecretKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return NewObjectStore(minioClient), nil
+	case StorageDriverLocal:
+		return NewLocalObjectStore(config.Storage.Path)
+	default:
+		return nil, fmt.Errorf("%w : unknown storage driver : %q", ErrInvalidRequest, config.Storage.Driver)
+	}
+}
+
+// FromEncryptionConfig wraps the ObjectStore with envelope encryption when a master
+// key is configured, otherwise the ObjectStore is returned unchanged.
+func FromEncryptionConfig(config Config, obs ObjectStore, keys KeyStore) (ObjectStore, error) {
+	if config.Encryption.MasterKey == "" {
+		return obs, nil
+	}
+	keyring, err := NewKeyring(config.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedStore(obs, keys, keyring), nil
+}
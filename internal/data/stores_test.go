@@ -1,3 +1,5 @@
+//go:build integration
+
 package data_test
 
 import (
@@ -35,12 +37,15 @@ func GetTestStores(t *testing.T) (data.Stores, error) {
 	}
 	restartTestMinio(minioClient, t)
 
-	newStores := data.NewStores(db, minioClient)
+	newStores := data.NewStores(db, data.NewObjectStore(minioClient))
 
 	return newStores, nil
 }
 func resetTestPostgresDB(sqlDB *sql.DB, t *testing.T) {
-	if _, err := sqlDB.Exec("TRUNCATE TABLE users,user_cases,evidences,cases,comments CASCADE;"); err != nil {
+	if _, err := sqlDB.Exec("TRUNCATE TABLE users,user_cases,evidences,cases,comments,case_keys,destruction_certificates,evidence_versions,legal_holds,presigned_uploads,verifications,folders,custody_events,audit_checkpoints,uploads CASCADE;"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlDB.Exec(`UPDATE "custody_chain_head" SET "seq" = 0, "entry_hash" = '';`); err != nil {
 		t.Fatal(err)
 	}
 	if _, err := sqlDB.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1;"); err != nil {
@@ -152,9 +157,9 @@ func TestCreateCaseInDBAndOBS(t *testing.T) {
 			want: data.ErrInvalidRequest,
 		},
 		{
-			name: "with not allowed special characters fails",
+			name: "with control characters fails",
 			cs: &data.Case{
-				Name: "test/test",
+				Name: "test\ttest",
 			},
 			want: data.ErrInvalidRequest,
 		},
@@ -472,7 +477,7 @@ func TestCreateEvidenceRemovesEvidenceFromOBSIfAddingToDBFails(t *testing.T) {
 	}
 
 }
-func TestCreateEvidenceFailsIfEvidenceExistsInDB(t *testing.T) {
+func TestCreateEvidenceAddedVersionIfEvidenceExistsInDB(t *testing.T) {
 	stores, err := GetTestStores(t)
 	if err != nil {
 		t.Errorf("Error getting test stores: %v", err)
@@ -508,15 +513,22 @@ func TestCreateEvidenceFailsIfEvidenceExistsInDB(t *testing.T) {
 		t.Errorf("Error creating evidence: %v", err)
 	}
 	err = stores.CreateEvidence(ev, cs)
-	if err == nil {
-		t.Errorf("Expected error creating evidence, but got none")
+	if err != nil {
+		t.Errorf("Error creating evidence version: %v", err)
+	}
+	versions, err := stores.ListEvidenceVersions(ev)
+	if err != nil {
+		t.Errorf("Error listing evidence versions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Expected 2 versions, got %d", len(versions))
 	}
-	exists, err := stores.ObjectStore.EvidenceExists(cs.Name, ev.Name)
+	exists, err := stores.ObjectStore.EvidenceExists(cs.Name, versions[1].ObjectName)
 	if err != nil {
 		t.Errorf("Error checking evidence exists: %v", err)
 	}
-	if exists {
-		t.Errorf("Expected evidence to not exist, but it does")
+	if !exists {
+		t.Errorf("Expected evidence version to exist, but it doesn't")
 	}
 
 }
@@ -884,7 +896,7 @@ func TestAddEvidenceCommentAddedSuccessfully(t *testing.T) {
 		EvidenceID: 1,
 		Text:       "text comment text",
 	}
-	err = stores.AddEvidenceComment(&comment)
+	err = stores.AddEvidenceComment(&evs, &comment)
 	if err != nil {
 		t.Errorf("Error adding comment: %v", err)
 	}
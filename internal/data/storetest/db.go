@@ -0,0 +1,635 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// StoresFactory returns Stores with an empty DBStore and UserStore, it is
+// called for every test
+type StoresFactory func(t *testing.T) data.Stores
+
+// RunDBStoreSuite runs the DBStore conformance tests against the stores
+// created by the factory.
+func RunDBStoreSuite(t *testing.T, factory StoresFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, stores data.Stores)
+	}{
+		{"AddCase with empty name returned ErrInvalidRequest", testAddCaseEmptyName},
+		{"AddCase added case that can be found by name and ID", testAddCase},
+		{"AddCase stored the Unicode name and storage key", testAddCaseStorageKey},
+		{"missing case returned sql.ErrNoRows", testMissingCase},
+		{"ListCases returned all cases", testDBListCases},
+		{"GetCaseByUserID returned cases of the user", testGetCaseByUserID},
+		{"FindCaseByTags returned cases with all tags", testFindCaseByTags},
+		{"RemoveCase removed the case", testDBRemoveCase},
+		{"case members were added with a role, changed and removed", testCaseMembers},
+		{"CreateEvidence set the evidence ID", testDBCreateEvidence},
+		{"missing evidence returned sql.ErrNoRows by ID and ErrInvalidRequest by name", testMissingEvidence},
+		{"EvidenceExists returned false without error for missing evidence", testDBEvidenceExists},
+		{"GetEvidenceByCaseID returned only evidences of the case", testGetEvidenceByCaseID},
+		{"RemoveEvidence removed the evidence and its comments", testDBRemoveEvidence},
+		{"CreateEvidence added the first version", testCreateEvidenceFirstVersion},
+		{"AddEvidenceVersion numbered versions and updated the evidence hash", testAddEvidenceVersion},
+		{"missing version returned ErrNotFound", testMissingEvidenceVersion},
+		{"FindEvidencesByHash matched evidences and their versions", testFindEvidencesByHash},
+		{"AddFolder added the folder with the folders it is in", testAddFolder},
+		{"MoveEvidence moved and renamed the evidence", testMoveEvidence},
+		{"MoveFolder moved the folder with everything in it", testMoveFolder},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+// ignoreCreatedAt ignores the creation time set by the store
+var ignoreCreatedAt = cmpopts.IgnoreFields(data.EvidenceVersion{}, "CreatedAt")
+
+// mustAddUser adds a user to the UserStore and returns it with its ID
+func mustAddUser(t *testing.T, users data.UserStore, username string) *data.User {
+	t.Helper()
+	user := &data.User{Username: username}
+	err := user.Password.Set("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.Add(user)
+	if err != nil {
+		t.Fatalf("adding user %q: %v", username, err)
+	}
+	got, err := users.GetByUsername(username)
+	if err != nil {
+		t.Fatalf("getting user %q: %v", username, err)
+	}
+	return got
+}
+
+// mustAddCase adds a case to the DBStore and returns it with its ID
+func mustAddCase(t *testing.T, stores data.Stores, user *data.User, cs *data.Case) *data.Case {
+	t.Helper()
+	err := stores.DBStore.AddCase(cs, user)
+	if err != nil {
+		t.Fatalf("adding case %q: %v", cs.Name, err)
+	}
+	got, err := stores.DBStore.GetCaseByName(cs.Name)
+	if err != nil {
+		t.Fatalf("getting case %q: %v", cs.Name, err)
+	}
+	return got
+}
+
+// mustAddEvidence adds an evidence to the case in the DBStore
+func mustAddEvidence(t *testing.T, stores data.Stores, cs *data.Case, name string) *data.Evidence {
+	t.Helper()
+	ev := &data.Evidence{CaseID: cs.ID, Name: name, ObjectName: "object-" + name, Hash: "hash-" + name,
+		Hashes: data.Hashes{data.HashMD5: "md5-" + name, data.HashSHA256: "hash-" + name}}
+	_, err := stores.DBStore.CreateEvidence(ev)
+	if err != nil {
+		t.Fatalf("creating evidence %q: %v", name, err)
+	}
+	return ev
+}
+
+func testAddCaseEmptyName(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	err := stores.DBStore.AddCase(&data.Case{}, user)
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func testAddCase(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test", Tags: []string{"robbery"}})
+	if cs.ID < 1 {
+		t.Errorf("expected case to have an ID, got %d", cs.ID)
+	}
+	exists, err := stores.DBStore.CaseExists("test")
+	if err != nil || !exists {
+		t.Errorf("expected case to exist, got %v, %v", exists, err)
+	}
+	got, err := stores.DBStore.GetCaseByID(cs.ID)
+	if err != nil {
+		t.Fatalf("getting case by ID: %v", err)
+	}
+	want := &data.Case{ID: cs.ID, Name: "test", Tags: []string{"robbery"}}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func testAddCaseStorageKey(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "К 123/2026", StorageKey: "case-1"})
+	got, err := stores.DBStore.GetCaseByName("К 123/2026")
+	if err != nil {
+		t.Fatalf("getting case by name: %v", err)
+	}
+	want := &data.Case{ID: cs.ID, Name: "К 123/2026", StorageKey: "case-1"}
+	if !cmp.Equal(want, got, cmpopts.EquateEmpty()) {
+		t.Errorf(cmp.Diff(want, got, cmpopts.EquateEmpty()))
+	}
+	if got.Bucket() != "case-1" {
+		t.Errorf("expected case to be stored in bucket %q, got %q", "case-1", got.Bucket())
+	}
+}
+
+func testMissingCase(t *testing.T, stores data.Stores) {
+	exists, err := stores.DBStore.CaseExists("missing")
+	if err != nil || exists {
+		t.Errorf("expected missing case not to exist, got %v, %v", exists, err)
+	}
+	_, err = stores.DBStore.GetCaseByName("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v by name, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetCaseByID(1_000_000)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v by ID, got %v", sql.ErrNoRows, err)
+	}
+}
+
+func testDBListCases(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	first := mustAddCase(t, stores, user, &data.Case{Name: "first"})
+	second := mustAddCase(t, stores, user, &data.Case{Name: "second"})
+	got, err := stores.DBStore.ListCases()
+	if err != nil {
+		t.Fatalf("listing cases: %v", err)
+	}
+	want := []data.Case{*first, *second}
+	if !cmp.Equal(want, got, sortCases) {
+		t.Errorf(cmp.Diff(want, got, sortCases))
+	}
+}
+
+func testGetCaseByUserID(t *testing.T, stores data.Stores) {
+	owner := mustAddUser(t, stores.User, "owner")
+	other := mustAddUser(t, stores.User, "other")
+	cs := mustAddCase(t, stores, owner, &data.Case{Name: "first"})
+	mustAddCase(t, stores, other, &data.Case{Name: "second"})
+	got, err := stores.DBStore.GetCaseByUserID(owner.ID)
+	if err != nil {
+		t.Fatalf("getting cases by user: %v", err)
+	}
+	want := []data.Case{*cs}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func testFindCaseByTags(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "first", Tags: []string{"murder", "robbery"}})
+	mustAddCase(t, stores, user, &data.Case{Name: "second", Tags: []string{"robbery"}})
+	mustAddCase(t, stores, user, &data.Case{Name: "third"})
+	got, err := stores.DBStore.FindCaseByTags([]string{"robbery", "murder"})
+	if err != nil {
+		t.Fatalf("finding cases: %v", err)
+	}
+	want := []data.Case{*cs}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func testDBRemoveCase(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	err := stores.DBStore.RemoveCase(cs)
+	if err != nil {
+		t.Fatalf("removing case: %v", err)
+	}
+	exists, err := stores.DBStore.CaseExists("test")
+	if err != nil || exists {
+		t.Errorf("expected case to be removed, got %v, %v", exists, err)
+	}
+	cases, err := stores.DBStore.GetCaseByUserID(user.ID)
+	if err != nil || len(cases) != 0 {
+		t.Errorf("expected no cases for user, got %v, %v", cases, err)
+	}
+}
+
+func testCaseMembers(t *testing.T, stores data.Stores) {
+	owner := mustAddUser(t, stores.User, "owner")
+	viewer := mustAddUser(t, stores.User, "viewer")
+	cs := mustAddCase(t, stores, owner, &data.Case{Name: "test"})
+	got, err := stores.DBStore.GetCaseMember(cs.ID, owner.ID)
+	if err != nil {
+		t.Fatalf("getting case owner: %v", err)
+	}
+	want := &data.CaseMember{CaseID: cs.ID, UserID: owner.ID, Username: "owner", Role: data.CaseOwner}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	_, err = stores.DBStore.GetCaseMember(cs.ID, viewer.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for user that isn't a member, got %v", data.ErrNotFound, err)
+	}
+	for _, role := range []string{data.CaseViewer, data.CaseContributor} {
+		err = stores.DBStore.AddCaseMember(&data.CaseMember{CaseID: cs.ID, UserID: viewer.ID, Role: role})
+		if err != nil {
+			t.Fatalf("adding case member as %s: %v", role, err)
+		}
+	}
+	members, err := stores.DBStore.ListCaseMembers(cs.ID)
+	if err != nil {
+		t.Fatalf("listing case members: %v", err)
+	}
+	wantMembers := []data.CaseMember{*want, {CaseID: cs.ID, UserID: viewer.ID, Username: "viewer", Role: data.CaseContributor}}
+	if !cmp.Equal(wantMembers, members) {
+		t.Errorf(cmp.Diff(wantMembers, members))
+	}
+	cases, err := stores.DBStore.GetCaseByUserID(viewer.ID)
+	if err != nil || len(cases) != 1 {
+		t.Errorf("expected the case of the member, got %v, %v", cases, err)
+	}
+	err = stores.DBStore.RemoveCaseMember(cs.ID, viewer.ID)
+	if err != nil {
+		t.Fatalf("removing case member: %v", err)
+	}
+	err = stores.DBStore.RemoveCaseMember(cs.ID, viewer.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v removing a missing member, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testDBCreateEvidence(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	hashes := data.Hashes{data.HashMD5: "md5", data.HashSHA1: "sha1", data.HashSHA512: "sha512"}
+	ev := &data.Evidence{CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "Police report/Videos", ObjectName: "evidence-1", Hash: "hash", Hashes: hashes}
+	id, err := stores.DBStore.CreateEvidence(ev)
+	if err != nil {
+		t.Fatalf("creating evidence: %v", err)
+	}
+	if id < 1 || ev.ID != id {
+		t.Errorf("expected evidence ID to be set, got %d and %d", id, ev.ID)
+	}
+	got, err := stores.DBStore.GetEvidenceByID(id, cs.ID)
+	if err != nil {
+		t.Fatalf("getting evidence: %v", err)
+	}
+	want := &data.Evidence{ID: id, CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "Police report/Videos", ObjectName: "evidence-1", Hash: "hash",
+		Hashes: data.Hashes{data.HashMD5: "md5", data.HashSHA1: "sha1", data.HashSHA256: "hash", data.HashSHA512: "sha512"}}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	_, err = stores.DBStore.GetFolder(cs.ID, "Police report/Videos")
+	if err != nil {
+		t.Errorf("expected the folder of the evidence to be added, got %v", err)
+	}
+	got, err = stores.DBStore.GetEvidenceByName(cs, "Police report/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Fatalf("getting evidence by name: %v", err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+}
+
+func testMissingEvidence(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	other := mustAddCase(t, stores, user, &data.Case{Name: "other"})
+	ev := mustAddEvidence(t, stores, cs, "video")
+	_, err := stores.DBStore.GetEvidenceByID(ev.ID, other.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for evidence in other case, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetEvidenceByID(1_000_000, cs.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v for missing evidence, got %v", sql.ErrNoRows, err)
+	}
+	_, err = stores.DBStore.GetEvidenceByName(cs, "", "missing")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for missing evidence name, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func testDBEvidenceExists(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	other := mustAddCase(t, stores, user, &data.Case{Name: "other"})
+	mustAddEvidence(t, stores, cs, "video")
+	exists, err := stores.DBStore.EvidenceExists(&data.Evidence{CaseID: cs.ID, Name: "video"})
+	if err != nil || !exists {
+		t.Errorf("expected evidence to exist, got %v, %v", exists, err)
+	}
+	exists, err = stores.DBStore.EvidenceExists(&data.Evidence{CaseID: other.ID, Name: "video"})
+	if err != nil || exists {
+		t.Errorf("expected evidence not to exist in other case, got %v, %v", exists, err)
+	}
+	exists, err = stores.DBStore.EvidenceExists(&data.Evidence{CaseID: cs.ID, Name: "missing"})
+	if err != nil || exists {
+		t.Errorf("expected missing evidence not to exist without error, got %v, %v", exists, err)
+	}
+}
+
+func testGetEvidenceByCaseID(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	other := mustAddCase(t, stores, user, &data.Case{Name: "other"})
+	first := mustAddEvidence(t, stores, cs, "first")
+	second := mustAddEvidence(t, stores, cs, "second")
+	mustAddEvidence(t, stores, other, "third")
+	got, err := stores.DBStore.GetEvidenceByCaseID(cs.ID)
+	if err != nil {
+		t.Fatalf("getting evidences: %v", err)
+	}
+	want := []data.Evidence{*first, *second}
+	if !cmp.Equal(want, got, sortEvidences) {
+		t.Errorf(cmp.Diff(want, got, sortEvidences))
+	}
+}
+
+func testDBRemoveEvidence(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	ev := mustAddEvidence(t, stores, cs, "video")
+	err := stores.DBStore.AddComment(&data.Comment{EvidenceID: ev.ID, Text: "comment"})
+	if err != nil {
+		t.Fatalf("adding comment: %v", err)
+	}
+	comments, err := stores.DBStore.GetCommentsByID(ev.ID)
+	if err != nil || len(comments) != 1 || comments[0].Text != "comment" {
+		t.Errorf("expected one comment, got %v, %v", comments, err)
+	}
+	err = stores.DBStore.RemoveEvidence(ev)
+	if err != nil {
+		t.Fatalf("removing evidence: %v", err)
+	}
+	exists, err := stores.DBStore.EvidenceExists(ev)
+	if err != nil || exists {
+		t.Errorf("expected evidence to be removed, got %v, %v", exists, err)
+	}
+	comments, err = stores.DBStore.GetCommentsByID(ev.ID)
+	if err != nil || len(comments) != 0 {
+		t.Errorf("expected comments to be removed, got %v, %v", comments, err)
+	}
+	err = stores.DBStore.RemoveCase(cs)
+	if err != nil {
+		t.Errorf("removing case without evidences: %v", err)
+	}
+}
+
+func testCreateEvidenceFirstVersion(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	ev := &data.Evidence{CaseID: cs.ID, Name: "video", Hash: "hash-video", UploadedBy: "clerk"}
+	_, err := stores.DBStore.CreateEvidence(ev)
+	if err != nil {
+		t.Fatalf("creating evidence: %v", err)
+	}
+	got, err := stores.DBStore.GetEvidenceVersion(ev.ID, 1)
+	if err != nil {
+		t.Fatalf("getting first version: %v", err)
+	}
+	want := &data.EvidenceVersion{EvidenceID: ev.ID, Version: 1, Hash: "hash-video", Hashes: data.Hashes{data.HashSHA256: "hash-video"}, ObjectName: "video", UploadedBy: "clerk"}
+	if !cmp.Equal(want, got, ignoreCreatedAt) {
+		t.Errorf(cmp.Diff(want, got, ignoreCreatedAt))
+	}
+	if got.CreatedAt.IsZero() {
+		t.Errorf("expected version to have a creation time")
+	}
+}
+
+func testAddEvidenceVersion(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	ev := mustAddEvidence(t, stores, cs, "video")
+	version := &data.EvidenceVersion{EvidenceID: ev.ID, Hash: "second", Hashes: data.Hashes{data.HashSHA1: "sha1-second"}, ObjectName: "version-2", UploadedBy: "judge"}
+	err := stores.DBStore.AddEvidenceVersion(version)
+	if err != nil {
+		t.Fatalf("adding version: %v", err)
+	}
+	if version.Version != 2 {
+		t.Errorf("expected version 2, got %d", version.Version)
+	}
+	got, err := stores.DBStore.GetEvidenceByID(ev.ID, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHashes := data.Hashes{data.HashSHA1: "sha1-second", data.HashSHA256: "second"}
+	if got.Hash != "second" || !cmp.Equal(wantHashes, got.Hashes) {
+		t.Errorf("expected evidence hashes to be the latest version hashes, got %q and %v", got.Hash, got.Hashes)
+	}
+	versions, err := stores.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil {
+		t.Fatalf("listing versions: %v", err)
+	}
+	want := []data.EvidenceVersion{
+		{EvidenceID: ev.ID, Version: 1, Hash: "hash-video", Hashes: ev.Hashes, ObjectName: "object-video"},
+		{EvidenceID: ev.ID, Version: 2, Hash: "second", Hashes: wantHashes, ObjectName: "version-2", UploadedBy: "judge"},
+	}
+	if !cmp.Equal(want, versions, ignoreCreatedAt) {
+		t.Errorf(cmp.Diff(want, versions, ignoreCreatedAt))
+	}
+	err = stores.DBStore.RemoveEvidence(ev)
+	if err != nil {
+		t.Fatalf("removing evidence: %v", err)
+	}
+	versions, err = stores.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil || len(versions) != 0 {
+		t.Errorf("expected versions to be removed with the evidence, got %v, %v", versions, err)
+	}
+}
+
+func testMissingEvidenceVersion(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	ev := mustAddEvidence(t, stores, cs, "video")
+	_, err := stores.DBStore.GetEvidenceVersion(ev.ID, 2)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing version, got %v", data.ErrNotFound, err)
+	}
+	err = stores.DBStore.AddEvidenceVersion(&data.EvidenceVersion{EvidenceID: ev.ID + 100, Hash: "hash", ObjectName: "version"})
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for version of missing evidence, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testFindEvidencesByHash(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	other := mustAddCase(t, stores, user, &data.Case{Name: "other"})
+	video := mustAddEvidence(t, stores, cs, "video")
+	copied := mustAddEvidence(t, stores, other, "video")
+	mustAddEvidence(t, stores, cs, "picture")
+	err := stores.DBStore.AddEvidenceVersion(&data.EvidenceVersion{EvidenceID: video.ID, Hash: "second", ObjectName: "version-2"})
+	if err != nil {
+		t.Fatalf("adding version: %v", err)
+	}
+	got, err := stores.DBStore.FindEvidencesByHash(data.HashMD5, "md5-video")
+	if err != nil {
+		t.Fatalf("finding evidences: %v", err)
+	}
+	var ids []int64
+	for _, ev := range got {
+		ids = append(ids, ev.ID)
+	}
+	want := []int64{video.ID, copied.ID}
+	if !cmp.Equal(want, ids) {
+		t.Errorf(cmp.Diff(want, ids))
+	}
+	got, err = stores.DBStore.FindEvidencesByHash(data.HashSHA256, "second")
+	if err != nil || len(got) != 1 || got[0].ID != video.ID {
+		t.Errorf("expected the evidence with the latest version hash, got %v, %v", got, err)
+	}
+	got, err = stores.DBStore.FindEvidencesByHash(data.HashSHA512, "missing")
+	if err != nil || len(got) != 0 {
+		t.Errorf("expected no evidences for a missing hash, got %v, %v", got, err)
+	}
+	_, err = stores.DBStore.FindEvidencesByHash("crc32", "md5-video")
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for unsupported algorithm, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+// folderPaths returns the paths of the folders
+func folderPaths(folders []data.Folder) []string {
+	var paths []string
+	for _, f := range folders {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+func testAddFolder(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	folder := &data.Folder{CaseID: cs.ID, Path: "Police report/Photos"}
+	err := stores.DBStore.AddFolder(folder)
+	if err != nil {
+		t.Fatalf("adding folder: %v", err)
+	}
+	if folder.ID < 1 || folder.Name != "Photos" || folder.CreatedAt.IsZero() {
+		t.Errorf("expected folder to have an ID, name and creation time, got %+v", folder)
+	}
+	got, err := stores.DBStore.GetFolder(cs.ID, "Police report/Photos")
+	if err != nil {
+		t.Fatalf("getting folder: %v", err)
+	}
+	if !cmp.Equal(folder, got, cmpopts.EquateApproxTime(time.Second)) {
+		t.Errorf(cmp.Diff(folder, got, cmpopts.EquateApproxTime(time.Second)))
+	}
+	err = stores.DBStore.AddFolder(&data.Folder{CaseID: cs.ID, Path: "Police report/Audio"})
+	if err != nil {
+		t.Fatalf("adding folder: %v", err)
+	}
+	folders, err := stores.DBStore.ListFolders(cs.ID, "")
+	if err != nil {
+		t.Fatalf("listing folders: %v", err)
+	}
+	if want := []string{"Police report"}; !cmp.Equal(want, folderPaths(folders)) {
+		t.Errorf(cmp.Diff(want, folderPaths(folders)))
+	}
+	folders, err = stores.DBStore.ListFolders(cs.ID, "Police report")
+	if err != nil {
+		t.Fatalf("listing folders: %v", err)
+	}
+	if want := []string{"Police report/Audio", "Police report/Photos"}; !cmp.Equal(want, folderPaths(folders)) {
+		t.Errorf(cmp.Diff(want, folderPaths(folders)))
+	}
+	err = stores.DBStore.AddFolder(&data.Folder{CaseID: cs.ID, Path: "Police report"})
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v for existing folder, got %v", data.ErrAlreadyExists, err)
+	}
+	_, err = stores.DBStore.GetFolder(cs.ID, "missing")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing folder, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testMoveEvidence(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	ev := mustAddEvidence(t, stores, cs, "video")
+	other := mustAddEvidence(t, stores, cs, "picture")
+	err := stores.DBStore.MoveEvidence(ev, "Police report/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Fatalf("moving evidence: %v", err)
+	}
+	got, err := stores.DBStore.GetEvidenceByName(cs, "Police report/Videos", "Scene 1.mp4")
+	if err != nil {
+		t.Fatalf("getting moved evidence: %v", err)
+	}
+	want := &data.Evidence{ID: ev.ID, CaseID: cs.ID, Name: "Scene 1.mp4", Folder: "Police report/Videos", ObjectName: "object-video", Hash: "hash-video", Hashes: ev.Hashes}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if !cmp.Equal(want, ev) {
+		t.Errorf(cmp.Diff(want, ev))
+	}
+	_, err = stores.DBStore.GetFolder(cs.ID, "Police report")
+	if err != nil {
+		t.Errorf("expected the folders of the evidence to be added, got %v", err)
+	}
+	err = stores.DBStore.MoveEvidence(other, "Police report/Videos", "Scene 1.mp4")
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v moving to a taken name, got %v", data.ErrAlreadyExists, err)
+	}
+	err = stores.DBStore.MoveEvidence(&data.Evidence{ID: other.ID + 100, CaseID: cs.ID}, "", "missing")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v moving a missing evidence, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testMoveFolder(t *testing.T, stores data.Stores) {
+	user := mustAddUser(t, stores.User, "user")
+	cs := mustAddCase(t, stores, user, &data.Case{Name: "test"})
+	for _, path := range []string{"Photos 50%/Scene_1", "Photos 50%x", "Photos 50%/Scene_1 copy"} {
+		err := stores.DBStore.AddFolder(&data.Folder{CaseID: cs.ID, Path: path})
+		if err != nil {
+			t.Fatalf("adding folder: %v", err)
+		}
+	}
+	ev := mustAddEvidence(t, stores, cs, "video")
+	err := stores.DBStore.MoveEvidence(ev, "Photos 50%/Scene_1", "video")
+	if err != nil {
+		t.Fatalf("moving evidence: %v", err)
+	}
+	err = stores.DBStore.MoveFolder(cs.ID, "Photos 50%", "Archive/Photos")
+	if err != nil {
+		t.Fatalf("moving folder: %v", err)
+	}
+	folders, err := stores.DBStore.ListFolders(cs.ID, "")
+	if err != nil {
+		t.Fatalf("listing folders: %v", err)
+	}
+	if want := []string{"Archive", "Photos 50%x"}; !cmp.Equal(want, folderPaths(folders)) {
+		t.Errorf(cmp.Diff(want, folderPaths(folders)))
+	}
+	folders, err = stores.DBStore.ListFolders(cs.ID, "Archive/Photos")
+	if err != nil {
+		t.Fatalf("listing folders: %v", err)
+	}
+	if want := []string{"Archive/Photos/Scene_1", "Archive/Photos/Scene_1 copy"}; !cmp.Equal(want, folderPaths(folders)) {
+		t.Errorf(cmp.Diff(want, folderPaths(folders)))
+	}
+	got, err := stores.DBStore.GetEvidenceByID(ev.ID, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Folder != "Archive/Photos/Scene_1" {
+		t.Errorf("expected evidence to be moved with its folder, got %q", got.Folder)
+	}
+	err = stores.DBStore.MoveFolder(cs.ID, "Photos 50%x", "Archive/Photos")
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v moving to an existing folder, got %v", data.ErrAlreadyExists, err)
+	}
+	err = stores.DBStore.MoveFolder(cs.ID, "Photos 50%", "Other")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v moving a missing folder, got %v", data.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package storetest provides conformance suites for implementations of the
+// data.ObjectStore, data.DBStore and data.UserStore interfaces. Every backend
+// must pass them, because Stores relies on the exact errors they return.
+package storetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// ObjectStoreFactory returns a new empty ObjectStore, it is called for every test
+type ObjectStoreFactory func(t *testing.T) data.ObjectStore
+
+// RunObjectStoreSuite runs the ObjectStore conformance tests against the
+// stores created by the factory.
+func RunObjectStoreSuite(t *testing.T, factory ObjectStoreFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, obs data.ObjectStore)
+	}{
+		{"CreateCase with valid name succeeded", testCreateCase},
+		{"CreateCase with invalid name failed", testCreateCaseInvalidName},
+		{"CreateCase that already exists returned ErrAlreadyExists", testCreateCaseAlreadyExists},
+		{"RemoveCase removed empty case", testRemoveCase},
+		{"RemoveCase failed for missing or non-empty case", testRemoveCaseFailed},
+		{"ListCases returned all cases", testListCases},
+		{"CreateEvidence returned SHA256 of the content", testCreateEvidenceHash},
+		{"CreateEvidence with invalid input returned ErrInvalidRequest", testCreateEvidenceInvalid},
+		{"EvidenceExists returned false without error for missing evidence", testEvidenceExists},
+		{"RemoveEvidence removed evidence and ignored missing ones", testRemoveEvidence},
+		{"ListEvidences returned all evidences of the case", testListEvidences},
+		{"GetEvidence returned the content or ErrNotFound", testGetEvidence},
+		{"GetEvidence returned seekable content", testGetEvidenceSeekable},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+// mustCreateCase creates a case in the ObjectStore or fails the test
+func mustCreateCase(t *testing.T, obs data.ObjectStore, name string) {
+	t.Helper()
+	err := obs.CreateCase(&data.Case{Name: name})
+	if err != nil {
+		t.Fatalf("creating case %q: %v", name, err)
+	}
+}
+
+// mustCreateEvidence creates an evidence in the ObjectStore or fails the test
+func mustCreateEvidence(t *testing.T, obs data.ObjectStore, caseName, name, content string) string {
+	t.Helper()
+	hash, err := obs.CreateEvidence(&data.Evidence{Name: name}, caseName, bytes.NewBufferString(content))
+	if err != nil {
+		t.Fatalf("creating evidence %q: %v", name, err)
+	}
+	return hash
+}
+
+func testCreateCase(t *testing.T, obs data.ObjectStore) {
+	for _, name := range []string{"test", "test23test", "test-test"} {
+		mustCreateCase(t, obs, name)
+		exists, err := obs.CaseExists(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("expected case %q to exist", name)
+		}
+	}
+}
+
+func testCreateCaseInvalidName(t *testing.T, obs data.ObjectStore) {
+	for _, name := range []string{"", "test/test", "test test", "TEST", ".."} {
+		err := obs.CreateCase(&data.Case{Name: name})
+		if err == nil {
+			t.Errorf("expected error for case name %q, got nil", name)
+		}
+	}
+}
+
+func testCreateCaseAlreadyExists(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	err := obs.CreateCase(&data.Case{Name: "test"})
+	if !errors.Is(err, data.ErrAlreadyExists) {
+		t.Errorf("expected %v, got %v", data.ErrAlreadyExists, err)
+	}
+}
+
+func testRemoveCase(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	err := obs.RemoveCase("test")
+	if err != nil {
+		t.Fatalf("removing case: %v", err)
+	}
+	exists, err := obs.CaseExists("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("expected case to be removed")
+	}
+}
+
+func testRemoveCaseFailed(t *testing.T, obs data.ObjectStore) {
+	err := obs.RemoveCase("missing")
+	if err == nil {
+		t.Errorf("expected error removing case that doesn't exist")
+	}
+	mustCreateCase(t, obs, "test")
+	mustCreateEvidence(t, obs, "test", "video", "content")
+	err = obs.RemoveCase("test")
+	if err == nil {
+		t.Errorf("expected error removing case that is not empty")
+	}
+}
+
+func testListCases(t *testing.T, obs data.ObjectStore) {
+	want := []data.Case{{Name: "first"}, {Name: "second"}}
+	for _, cs := range want {
+		mustCreateCase(t, obs, cs.Name)
+	}
+	got, err := obs.ListCases()
+	if err != nil {
+		t.Fatalf("listing cases: %v", err)
+	}
+	if !cmp.Equal(want, got, sortCases) {
+		t.Errorf(cmp.Diff(want, got, sortCases))
+	}
+}
+
+func testCreateEvidenceHash(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	sum := sha256.Sum256([]byte("sample"))
+	want := hex.EncodeToString(sum[:])
+	got := mustCreateEvidence(t, obs, "test", "video", "sample")
+	if got != want {
+		t.Errorf("expected hash %q, got %q", want, got)
+	}
+	other := mustCreateEvidence(t, obs, "test", "picture", "other")
+	if other == got {
+		t.Errorf("expected different files to have different hashes")
+	}
+}
+
+func testCreateEvidenceInvalid(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	for _, name := range []string{"test/test", "test test"} {
+		_, err := obs.CreateEvidence(&data.Evidence{Name: name}, "test", bytes.NewBufferString("s"))
+		if !errors.Is(err, data.ErrInvalidRequest) {
+			t.Errorf("expected %v for evidence name %q, got %v", data.ErrInvalidRequest, name, err)
+		}
+	}
+	_, err := obs.CreateEvidence(&data.Evidence{Name: "video"}, "test", nil)
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for nil file, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func testEvidenceExists(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	mustCreateEvidence(t, obs, "test", "video", "content")
+	exists, err := obs.EvidenceExists("test", "video")
+	if err != nil || !exists {
+		t.Errorf("expected evidence to exist, got %v, %v", exists, err)
+	}
+	exists, err = obs.EvidenceExists("test", "missing")
+	if err != nil || exists {
+		t.Errorf("expected missing evidence not to exist without error, got %v, %v", exists, err)
+	}
+}
+
+func testRemoveEvidence(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	mustCreateEvidence(t, obs, "test", "video", "content")
+	err := obs.RemoveEvidence(&data.Evidence{Name: "video"}, "test")
+	if err != nil {
+		t.Fatalf("removing evidence: %v", err)
+	}
+	exists, err := obs.EvidenceExists("test", "video")
+	if err != nil || exists {
+		t.Errorf("expected evidence to be removed, got %v, %v", exists, err)
+	}
+	err = obs.RemoveEvidence(&data.Evidence{Name: "missing"}, "test")
+	if err != nil {
+		t.Errorf("expected no error removing missing evidence, got %v", err)
+	}
+}
+
+func testListEvidences(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	mustCreateCase(t, obs, "other")
+	want := []data.Evidence{{Name: "file1"}, {Name: "file2"}}
+	for _, ev := range want {
+		mustCreateEvidence(t, obs, "test", ev.Name, ev.Name)
+	}
+	mustCreateEvidence(t, obs, "other", "file3", "file3")
+	got, err := obs.ListEvidences("test")
+	if err != nil {
+		t.Fatalf("listing evidences: %v", err)
+	}
+	if !cmp.Equal(want, got, sortEvidences) {
+		t.Errorf(cmp.Diff(want, got, sortEvidences))
+	}
+}
+
+func testGetEvidence(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	mustCreateEvidence(t, obs, "test", "video", "sample")
+	file, err := obs.GetEvidence("test", "video")
+	if err != nil {
+		t.Fatalf("getting evidence: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "sample" {
+		t.Errorf("expected content %q, got %q", "sample", content)
+	}
+	_, err = obs.GetEvidence("test", "missing")
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing evidence, got %v", data.ErrNotFound, err)
+	}
+}
+
+var (
+	sortCases     = cmpopts.SortSlices(func(a, b data.Case) bool { return a.Name < b.Name })
+	sortEvidences = cmpopts.SortSlices(func(a, b data.Evidence) bool { return a.Name < b.Name })
+)
+
+func testGetEvidenceSeekable(t *testing.T, obs data.ObjectStore) {
+	mustCreateCase(t, obs, "test")
+	mustCreateEvidence(t, obs, "test", "video", "sample")
+	file, err := obs.GetEvidence("test", "video")
+	if err != nil {
+		t.Fatalf("getting evidence: %v", err)
+	}
+	defer file.Close()
+	seeker, ok := file.(io.ReadSeeker)
+	if !ok {
+		t.Fatalf("expected evidence content to be seekable")
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil || size != 6 {
+		t.Fatalf("expected size 6, got %d, %v", size, err)
+	}
+	_, err = seeker.Seek(2, io.SeekStart)
+	if err != nil {
+		t.Fatalf("seeking evidence: %v", err)
+	}
+	content, err := io.ReadAll(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "mple" {
+		t.Errorf("expected content %q, got %q", "mple", content)
+	}
+}
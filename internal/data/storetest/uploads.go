@@ -0,0 +1,161 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// RunUploadStoreSuite runs the UploadStore conformance tests against the stores
+// created by the factory.
+func RunUploadStoreSuite(t *testing.T, factory StoresFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, uploads data.UploadStore)
+	}{
+		{"CreateUpload added an empty upload that can be found by ID and case", testCreateUpload},
+		{"UpdateUpload stored the state or returned ErrConflict for another offset", testUpdateUpload},
+		{"ClaimUpload removed only complete uploads", testClaimUpload},
+		{"RemoveUpload returned the removed upload with its parts", testRemoveUpload},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t).Uploads)
+		})
+	}
+}
+
+// uploadOptions ignore the creation time set by the store, an upload
+// without parts or hash state may be stored with empty ones
+var uploadOptions = cmp.Options{cmpopts.IgnoreFields(data.Upload{}, "CreatedAt"), cmpopts.EquateEmpty()}
+
+// mustCreateUpload creates an upload of the length and returns it with its ID
+func mustCreateUpload(t *testing.T, uploads data.UploadStore, length int64) *data.Upload {
+	t.Helper()
+	upload := &data.Upload{CaseID: 1, Name: "video", Folder: "interviews", Length: length, Username: "clerk"}
+	err := uploads.CreateUpload(upload)
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+	return upload
+}
+
+func testCreateUpload(t *testing.T, uploads data.UploadStore) {
+	err := uploads.CreateUpload(&data.Upload{CaseID: 1, Name: "video", Length: -1})
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for negative length, got %v", data.ErrInvalidRequest, err)
+	}
+	upload := mustCreateUpload(t, uploads, 6)
+	if upload.ID == "" || upload.CreatedAt.IsZero() {
+		t.Errorf("expected upload with ID and creation time, got %+v", upload)
+	}
+	got, err := uploads.GetUpload(upload.ID)
+	if err != nil {
+		t.Fatalf("failed to get upload: %v", err)
+	}
+	if !cmp.Equal(upload, got, uploadOptions) {
+		t.Errorf(cmp.Diff(upload, got, uploadOptions))
+	}
+	listed, err := uploads.ListUploads(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != upload.ID {
+		t.Errorf("expected the upload in its case, got %+v", listed)
+	}
+	listed, err = uploads.ListUploads(2)
+	if err != nil || len(listed) != 0 {
+		t.Errorf("expected no uploads in another case, got %+v, %v", listed, err)
+	}
+	_, err = uploads.GetUpload(data.NewUploadID())
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing upload, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testUpdateUpload(t *testing.T, uploads data.UploadStore) {
+	upload := mustCreateUpload(t, uploads, 6)
+	next := *upload
+	next.Offset = 3
+	next.HashState = []byte("state")
+	next.Parts = []string{"upload-1"}
+	err := uploads.UpdateUpload(&next, 0)
+	if err != nil {
+		t.Fatalf("failed to update upload: %v", err)
+	}
+	// a chunk received concurrently at the same offset
+	other := next
+	other.Parts = []string{"upload-2"}
+	err = uploads.UpdateUpload(&other, 0)
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected %v for another chunk at the offset, got %v", data.ErrConflict, err)
+	}
+	got, err := uploads.GetUpload(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(&next, got, uploadOptions) {
+		t.Errorf(cmp.Diff(&next, got, uploadOptions))
+	}
+	missing := data.Upload{ID: data.NewUploadID(), Offset: 3}
+	err = uploads.UpdateUpload(&missing, 0)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing upload, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testClaimUpload(t *testing.T, uploads data.UploadStore) {
+	upload := mustCreateUpload(t, uploads, 3)
+	_, err := uploads.ClaimUpload(upload.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for incomplete upload, got %v", data.ErrNotFound, err)
+	}
+	next := *upload
+	next.Offset = 3
+	next.Parts = []string{"upload-1"}
+	err = uploads.UpdateUpload(&next, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := uploads.ClaimUpload(upload.ID)
+	if err != nil {
+		t.Fatalf("failed to claim upload: %v", err)
+	}
+	if !cmp.Equal(&next, claimed, uploadOptions) {
+		t.Errorf(cmp.Diff(&next, claimed, uploadOptions))
+	}
+	_, err = uploads.ClaimUpload(upload.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for claimed upload, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testRemoveUpload(t *testing.T, uploads data.UploadStore) {
+	upload := mustCreateUpload(t, uploads, 6)
+	next := *upload
+	next.Offset = 3
+	next.Parts = []string{"upload-1"}
+	err := uploads.UpdateUpload(&next, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := uploads.RemoveUpload(upload.ID)
+	if err != nil {
+		t.Fatalf("failed to remove upload: %v", err)
+	}
+	if !cmp.Equal(next.Parts, removed.Parts) {
+		t.Errorf(cmp.Diff(next.Parts, removed.Parts))
+	}
+	_, err = uploads.GetUpload(upload.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for removed upload, got %v", data.ErrNotFound, err)
+	}
+	_, err = uploads.RemoveUpload(upload.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v removing it again, got %v", data.ErrNotFound, err)
+	}
+}
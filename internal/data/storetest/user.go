@@ -0,0 +1,113 @@
+package storetest
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// RunUserStoreSuite runs the UserStore conformance tests against the stores
+// created by the factory.
+func RunUserStoreSuite(t *testing.T, factory StoresFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, users data.UserStore)
+	}{
+		{"Add without username or password returned ErrInvalidRequest", testAddUserInvalid},
+		{"Add stored user with default role and hashed password", testAddUser},
+		{"missing user returned sql.ErrNoRows by username and ErrNotFound by ID", testMissingUser},
+		{"SetRole changed the role or returned ErrNotFound", testSetUserRole},
+		{"Remove removed the user or returned ErrNotFound", testRemoveUser},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t).User)
+		})
+	}
+}
+
+func testAddUserInvalid(t *testing.T, users data.UserStore) {
+	err := users.Add(&data.User{Username: "user"})
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for user without password, got %v", data.ErrInvalidRequest, err)
+	}
+	user := &data.User{}
+	err = user.Password.Set("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.Add(user)
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v for user without username, got %v", data.ErrInvalidRequest, err)
+	}
+}
+
+func testAddUser(t *testing.T, users data.UserStore) {
+	user := mustAddUser(t, users, "user")
+	if user.ID < 1 {
+		t.Errorf("expected user to have an ID, got %d", user.ID)
+	}
+	if user.Role != data.DefaultRole {
+		t.Errorf("expected default role %q, got %q", data.DefaultRole, user.Role)
+	}
+	match, err := user.Password.Matches("password")
+	if err != nil || !match {
+		t.Errorf("expected password to match, got %v, %v", match, err)
+	}
+	got, err := users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("getting user by ID: %v", err)
+	}
+	if got.Username != "user" {
+		t.Errorf("expected username %q, got %q", "user", got.Username)
+	}
+}
+
+func testMissingUser(t *testing.T, users data.UserStore) {
+	_, err := users.GetByUsername("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+	}
+	_, err = users.GetByID(1_000_000)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testSetUserRole(t *testing.T, users data.UserStore) {
+	user := mustAddUser(t, users, "user")
+	err := users.SetRole(user.ID, data.RoleJudge)
+	if err != nil {
+		t.Fatalf("setting role: %v", err)
+	}
+	got, err := users.GetByUsername("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Role != data.RoleJudge {
+		t.Errorf("expected role %q, got %q", data.RoleJudge, got.Role)
+	}
+	err = users.SetRole(1_000_000, data.RoleJudge)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v for missing user, got %v", data.ErrNotFound, err)
+	}
+}
+
+func testRemoveUser(t *testing.T, users data.UserStore) {
+	user := mustAddUser(t, users, "user")
+	err := users.Remove(user.ID)
+	if err != nil {
+		t.Fatalf("removing user: %v", err)
+	}
+	_, err = users.GetByID(user.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v after removing, got %v", data.ErrNotFound, err)
+	}
+	err = users.Remove(user.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v removing twice, got %v", data.ErrNotFound, err)
+	}
+}
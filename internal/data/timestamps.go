@@ -0,0 +1,321 @@
+package data
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+// TimestampLocal is the TSA URL that selects the built-in time-stamping authority
+const TimestampLocal = "local"
+
+// maxTimestampResponse limits the size of a response read from a TSA
+const maxTimestampResponse = 1 << 20
+
+// localTSAPolicy is the policy the built-in TSA issues its tokens under, anyPolicy
+var localTSAPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+// Timestamper requests RFC 3161 time-stamp tokens for SHA256 digests. Timestamp
+// returns the DER encoded token and Certificate returns the certificate the tokens
+// must be signed with, nil when any certificate in the token is accepted.
+type Timestamper interface {
+	Timestamp(digest []byte) ([]byte, error)
+	Certificate() *x509.Certificate
+}
+
+// TSAClient requests time-stamp tokens from a time-stamping authority over HTTP
+type TSAClient struct {
+	URL    string
+	Client *http.Client
+	cert   *x509.Certificate
+}
+
+// Timestamp sends a time-stamp query for the digest to the TSA and returns the
+// token of its reply, the reply must cover the digest and the nonce of the query
+func (c *TSAClient) Timestamp(digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	query, err := (&timestamp.Request{
+		HashAlgorithm: crypto.SHA256,
+		HashedMessage: digest,
+		Certificates:  true,
+		Nonce:         nonce,
+	}).Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("creating time-stamp query : %w", err)
+	}
+	resp, err := c.Client.Post(c.URL, "application/timestamp-query", bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("requesting time-stamp : %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting time-stamp : TSA responded with status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTimestampResponse))
+	if err != nil {
+		return nil, fmt.Errorf("reading time-stamp reply : %w", err)
+	}
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("reading time-stamp reply : %w", err)
+	}
+	if !bytes.Equal(ts.HashedMessage, digest) || ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w : time-stamp reply doesn't match the query", ErrIntegrity)
+	}
+	return ts.RawToken, nil
+}
+
+// Certificate returns the configured certificate of the TSA
+func (c *TSAClient) Certificate() *x509.Certificate {
+	return c.cert
+}
+
+// LocalTSA is a time-stamping authority built into the registry, for courts
+// without access to a public TSA and for tests
+type LocalTSA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// NewLocalTSA creates a built-in TSA that signs with the certificate and its key,
+// when both are nil it signs with an ephemeral self-signed certificate
+func NewLocalTSA(cert *x509.Certificate, key crypto.Signer) (*LocalTSA, error) {
+	if cert == nil && key == nil {
+		return newEphemeralTSA()
+	}
+	if cert == nil || key == nil {
+		return nil, fmt.Errorf("%w : local TSA needs both a certificate and a key", ErrInvalidRequest)
+	}
+	return &LocalTSA{cert: cert, key: key}, nil
+}
+
+// newEphemeralTSA creates a built-in TSA with a new ECDSA key and a self-signed
+// certificate, its tokens can only be verified while the server runs
+func newEphemeralTSA() (*LocalTSA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "der local TSA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("creating local TSA certificate : %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalTSA{cert: cert, key: key}, nil
+}
+
+// Timestamp signs a time-stamp token for the digest with the current time
+func (l *LocalTSA) Timestamp(digest []byte) ([]byte, error) {
+	reply, err := (&timestamp.Timestamp{
+		HashAlgorithm:     crypto.SHA256,
+		HashedMessage:     digest,
+		Time:              time.Now().UTC(),
+		Policy:            localTSAPolicy,
+		AddTSACertificate: true,
+	}).CreateResponseWithOpts(l.cert, l.key, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("signing time-stamp : %w", err)
+	}
+	ts, err := timestamp.ParseResponse(reply)
+	if err != nil {
+		return nil, fmt.Errorf("reading time-stamp reply : %w", err)
+	}
+	return ts.RawToken, nil
+}
+
+// Certificate returns the certificate the built-in TSA signs with
+func (l *LocalTSA) Certificate() *x509.Certificate {
+	return l.cert
+}
+
+// FromTimestampingConfig creates the Timestamper when a TSA URL is configured,
+// otherwise it returns nil. The URL "local" selects the built-in TSA.
+func FromTimestampingConfig(config Config) (Timestamper, error) {
+	tc := config.Timestamping
+	if tc.URL == "" {
+		return nil, nil
+	}
+	var cert *x509.Certificate
+	if tc.CertFile != "" {
+		var err error
+		cert, err = readCertificate(tc.CertFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tc.URL != TimestampLocal {
+		return &TSAClient{URL: tc.URL, Client: &http.Client{Timeout: 30 * time.Second}, cert: cert}, nil
+	}
+	var key crypto.Signer
+	if tc.KeyFile != "" {
+		var err error
+		key, err = readPrivateKey(tc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewLocalTSA(cert, key)
+}
+
+// readPEM returns the DER content of the first PEM block of the file
+func readPEM(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%w : %q is not PEM encoded", ErrInvalidRequest, path)
+	}
+	return block.Bytes, nil
+}
+
+// readCertificate reads a PEM encoded certificate
+func readCertificate(path string) (*x509.Certificate, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// readPrivateKey reads a PEM encoded PKCS #8 private key
+func readPrivateKey(path string) (crypto.Signer, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w : %q is not a signing key", ErrInvalidRequest, path)
+	}
+	return signer, nil
+}
+
+// timestamp requests a token for the SHA256 hash, it returns nil when time-stamping
+// is not configured
+func (s *Stores) timestamp(hash string) ([]byte, error) {
+	if s.Timestamper == nil {
+		return nil, nil
+	}
+	digest, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w : invalid sha256 hash %q", ErrInvalidRequest, hash)
+	}
+	return s.Timestamper.Timestamp(digest)
+}
+
+// TimestampVerification is the result of checking the time-stamp token of one
+// version of an evidence against its SHA256 hash
+type TimestampVerification struct {
+	EvidenceID   int64     `json:"evidence_id"`
+	Version      int64     `json:"version"`
+	Hash         string    `json:"hash"`
+	Valid        bool      `json:"valid"`
+	Detail       string    `json:"detail,omitempty"`
+	Time         time.Time `json:"time"`
+	SerialNumber string    `json:"serial_number,omitempty"`
+	Authority    string    `json:"authority,omitempty"`
+}
+
+// VerifyTimestampToken checks that the token is signed by the certificate it
+// carries and covers the SHA256 hash. When cert is not nil the token must be
+// signed with it. It returns the time of the token.
+func VerifyTimestampToken(token []byte, hash string, cert *x509.Certificate) (*timestamp.Timestamp, error) {
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w : reading time-stamp token : %v", ErrIntegrity, err)
+	}
+	if len(ts.Certificates) == 0 {
+		return ts, fmt.Errorf("%w : time-stamp token carries no TSA certificate", ErrIntegrity)
+	}
+	if cert != nil && !ts.Certificates[0].Equal(cert) {
+		return ts, fmt.Errorf("%w : time-stamp token was signed by %q", ErrIntegrity, ts.Certificates[0].Subject)
+	}
+	if ts.HashAlgorithm != crypto.SHA256 || hex.EncodeToString(ts.HashedMessage) != hash {
+		return ts, fmt.Errorf("%w : time-stamp token covers %x, expected %s", ErrIntegrity, ts.HashedMessage, hash)
+	}
+	return ts, nil
+}
+
+// GetTimestampToken returns the time-stamp token of a version of the evidence,
+// version 0 is the current version
+func (s *Stores) GetTimestampToken(ev *Evidence, version int64) (*EvidenceVersion, error) {
+	v, err := s.GetEvidenceVersion(ev, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.TimestampToken) == 0 {
+		return nil, fmt.Errorf("%w : version %d of evidence %q has no time-stamp token", ErrNotFound, v.Version, ev.Name)
+	}
+	return v, nil
+}
+
+// VerifyTimestamp checks the time-stamp token of a version of the evidence against
+// the hash the version was stored with, version 0 is the current version
+func (s *Stores) VerifyTimestamp(ev *Evidence, version int64) (*TimestampVerification, error) {
+	v, err := s.GetTimestampToken(ev, version)
+	if err != nil {
+		return nil, err
+	}
+	var cert *x509.Certificate
+	if s.Timestamper != nil {
+		cert = s.Timestamper.Certificate()
+	}
+	result := &TimestampVerification{EvidenceID: ev.ID, Version: v.Version, Hash: v.Hash}
+	ts, err := VerifyTimestampToken(v.TimestampToken, v.Hash, cert)
+	if ts != nil {
+		result.Time = ts.Time
+		if ts.SerialNumber != nil {
+			result.SerialNumber = ts.SerialNumber.String()
+		}
+		if len(ts.Certificates) > 0 {
+			result.Authority = ts.Certificates[0].Subject.String()
+		}
+	}
+	if err != nil {
+		result.Detail = err.Error()
+		return result, nil
+	}
+	result.Valid = true
+	return result, nil
+}
@@ -0,0 +1,338 @@
+package data_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// getTestTSACertificate returns a self-signed time-stamping certificate and its key
+func getTestTSACertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// getTestTimestampStores returns the hold test stores with the built-in TSA
+func getTestTimestampStores(t *testing.T) (data.Stores, *data.Case) {
+	stores, cs := getTestHoldStores(t)
+	tsa, err := data.NewLocalTSA(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create local TSA: %v", err)
+	}
+	stores.Timestamper = tsa
+	return stores, cs
+}
+
+func TestCreateEvidenceWithTimestamperTimestampedEveryVersion(t *testing.T) {
+	stores, cs := getTestTimestampStores(t)
+	for _, content := range []string{"first", "second"} {
+		err := stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "scene.mp4", File: strings.NewReader(content)}, cs)
+		if err != nil {
+			t.Fatalf("failed to create evidence: %v", err)
+		}
+	}
+	ev, err := stores.DBStore.GetEvidenceByName(cs, "", "scene.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version, content := range map[int64]string{1: "first", 2: "second"} {
+		got, err := stores.VerifyTimestamp(ev, version)
+		if err != nil {
+			t.Fatalf("failed to verify time-stamp of version %d: %v", version, err)
+		}
+		if !got.Valid || got.Hash != hashesOf(content)[data.HashSHA256] || got.Version != version {
+			t.Errorf("expected valid time-stamp of version %d, got %+v", version, got)
+		}
+		if time.Since(got.Time) > time.Minute || got.Authority == "" {
+			t.Errorf("expected time-stamp of the local TSA at ingest, got %+v", got)
+		}
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(t *testing.T, stores *data.Stores, ev *data.Evidence)
+		wantValid bool
+		wantErr   error
+	}{
+		{
+			name:      "untouched token is valid",
+			change:    func(t *testing.T, stores *data.Stores, ev *data.Evidence) {},
+			wantValid: true,
+		},
+		{
+			name: "token of another hash is invalid",
+			change: func(t *testing.T, stores *data.Stores, ev *data.Evidence) {
+				swapTimestampToken(t, stores, ev, hashesOf("other")[data.HashSHA256], stores.Timestamper)
+			},
+		},
+		{
+			name: "token of another TSA is invalid",
+			change: func(t *testing.T, stores *data.Stores, ev *data.Evidence) {
+				other, err := data.NewLocalTSA(nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				swapTimestampToken(t, stores, ev, ev.Hash, other)
+			},
+		},
+		{
+			name: "evidence without token fails",
+			change: func(t *testing.T, stores *data.Stores, ev *data.Evidence) {
+				stores.Timestamper = nil
+				cs, err := stores.GetCaseByID(ev.CaseID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = stores.CreateEvidence(&data.Evidence{CaseID: ev.CaseID, Name: ev.Name, File: strings.NewReader("untimed")}, cs)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: data.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestTimestampStores(t)
+			err := stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "scene.mp4", File: strings.NewReader("scene")}, cs)
+			if err != nil {
+				t.Fatalf("failed to create evidence: %v", err)
+			}
+			ev, err := stores.DBStore.GetEvidenceByName(cs, "", "scene.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, &stores, ev)
+			got, err := stores.VerifyTimestamp(ev, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got.Valid != tt.wantValid {
+				t.Errorf("expected valid %v, got %+v", tt.wantValid, got)
+			}
+			if !got.Valid && got.Detail == "" {
+				t.Errorf("expected the reason of the failed verification")
+			}
+		})
+	}
+}
+
+// swapTimestampToken stores a new version of the evidence with its content but
+// with a token of the hash from the TSA
+func swapTimestampToken(t *testing.T, stores *data.Stores, ev *data.Evidence, hash string, tsa data.Timestamper) {
+	token, err := tsa.Timestamp(mustDecodeHex(t, hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.DBStore.AddEvidenceVersion(&data.EvidenceVersion{EvidenceID: ev.ID, Hash: ev.Hash, ObjectName: ev.ObjectName, TimestampToken: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newTestTSAServer returns a TSA that replies to time-stamp queries, reply changes
+// the time-stamp before it is signed
+func newTestTSAServer(t *testing.T, reply func(ts *timestamp.Timestamp)) (*httptest.Server, *x509.Certificate) {
+	cert, key := getTestTSACertificate(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req, err := timestamp.ParseRequest(body)
+		if err != nil || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "invalid time-stamp query", http.StatusBadRequest)
+			return
+		}
+		ts := &timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              time.Now(),
+			Nonce:             req.Nonce,
+			Policy:            asn1.ObjectIdentifier{2, 5, 29, 32, 0},
+			AddTSACertificate: req.Certificates,
+		}
+		reply(ts)
+		resp, err := ts.CreateResponseWithOpts(cert, key, crypto.SHA256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, cert
+}
+
+func TestTSAClientTimestamp(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   func(ts *timestamp.Timestamp)
+		wantErr bool
+	}{
+		{
+			name:  "reply to the query is accepted",
+			reply: func(ts *timestamp.Timestamp) {},
+		},
+		{
+			name:    "reply with another nonce is rejected",
+			reply:   func(ts *timestamp.Timestamp) { ts.Nonce = big.NewInt(7) },
+			wantErr: true,
+		},
+		{
+			name:    "reply for another digest is rejected",
+			reply:   func(ts *timestamp.Timestamp) { ts.HashedMessage = make([]byte, 32) },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cert := newTestTSAServer(t, tt.reply)
+			client := &data.TSAClient{URL: srv.URL, Client: srv.Client()}
+			hash := hashesOf("scene")[data.HashSHA256]
+			token, err := client.Timestamp(mustDecodeHex(t, hash))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			_, err = data.VerifyTimestampToken(token, hash, cert)
+			if err != nil {
+				t.Errorf("expected token of the TSA, got %v", err)
+			}
+		})
+	}
+}
+
+// writePEM writes the DER content as a PEM block of the type to a file in dir
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFromTimestampingConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := getTestTSACertificate(t)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, dir, "tsa.crt", "CERTIFICATE", cert.Raw)
+	keyFile := writePEM(t, dir, "tsa.key", "PRIVATE KEY", keyDER)
+	tests := []struct {
+		name     string
+		config   data.TimestampingConfig
+		wantCert *x509.Certificate
+		wantNil  bool
+		wantErr  bool
+	}{
+		{
+			name:    "without URL time-stamping is disabled",
+			wantNil: true,
+		},
+		{
+			name:   "local TSA without files uses an ephemeral certificate",
+			config: data.TimestampingConfig{URL: data.TimestampLocal},
+		},
+		{
+			name:     "local TSA signs with the configured certificate",
+			config:   data.TimestampingConfig{URL: data.TimestampLocal, CertFile: certFile, KeyFile: keyFile},
+			wantCert: cert,
+		},
+		{
+			name:    "local TSA with certificate but without key fails",
+			config:  data.TimestampingConfig{URL: data.TimestampLocal, CertFile: certFile},
+			wantErr: true,
+		},
+		{
+			name:     "remote TSA trusts the configured certificate",
+			config:   data.TimestampingConfig{URL: "https://tsa.example.com", CertFile: certFile},
+			wantCert: cert,
+		},
+		{
+			name:    "missing certificate file fails",
+			config:  data.TimestampingConfig{URL: "https://tsa.example.com", CertFile: filepath.Join(dir, "missing.crt")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := data.TestAppConfig()
+			config.Timestamping = tt.config
+			got, err := data.FromTimestampingConfig(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("expected nil timestamper %v, got %v", tt.wantNil, got)
+			}
+			if got == nil || tt.wantCert == nil {
+				return
+			}
+			if !got.Certificate().Equal(tt.wantCert) {
+				t.Errorf("expected the configured certificate, got %q", got.Certificate().Subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package data
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Upload is a resumable evidence upload that is still in progress. The received
+// chunks are stored as objects in the bucket of the case and Parts has their
+// names in order. The content is hashed incrementally so the hash state is kept
+// between chunks.
+type Upload struct {
+	ID        string    `json:"id"`
+	CaseID    int64     `json:"case_id"`
+	Name      string    `json:"name"`
+	Folder    string    `json:"folder,omitempty"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Username  string    `json:"username"`
+	HashState []byte    `json:"hash_state,omitempty"`
+	Parts     []string  `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Complete returns true when all bytes of the upload were received
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// UploadStore keeps the state of uploads until they are complete. The state is
+// in the database, so every replica of the API can receive the next chunk.
+type UploadStore interface {
+	CreateUpload(upload *Upload) error
+	GetUpload(id string) (*Upload, error)
+	ListUploads(caseID int64) ([]Upload, error)
+	UpdateUpload(upload *Upload, offset int64) error
+	ClaimUpload(id string) (*Upload, error)
+	RemoveUpload(id string) (*Upload, error)
+}
+
+// NewUploadID returns a new random upload ID
+func NewUploadID() string {
+	return uuid.New().String()
+}
+
+// NewUploadPartObjectName returns a new object name for a chunk of an upload, it
+// can't collide with the objects of evidences and versions
+func NewUploadPartObjectName() string {
+	return "upload-" + uuid.New().String()
+}
+
+// uploadColumns are the columns scanned by scanUpload
+const uploadColumns = `"id", "case_id", "name", "folder", "length", "offset", "username", "hash_state", "parts", "created_at"`
+
+type Uploads struct {
+	DB *sql.DB
+}
+
+func NewUploadStore(db *sql.DB) UploadStore {
+	return &Uploads{
+		DB: db,
+	}
+}
+
+// CreateUpload creates an empty upload with a new ID
+func (u *Uploads) CreateUpload(upload *Upload) error {
+	if upload.Length < 0 {
+		return fmt.Errorf("%w : upload length can't be negative", ErrInvalidRequest)
+	}
+	upload.ID = NewUploadID()
+	upload.Offset = 0
+	upload.HashState = nil
+	upload.Parts = nil
+	err := u.DB.QueryRow(`INSERT INTO "uploads" ("id", "case_id", "name", "folder", "length", "username") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "created_at"`,
+		upload.ID, upload.CaseID, upload.Name, upload.Folder, upload.Length, upload.Username).Scan(&upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting upload : %w", err)
+	}
+	return nil
+}
+
+// GetUpload returns the upload state or ErrNotFound
+func (u *Uploads) GetUpload(id string) (*Upload, error) {
+	return scanUpload(u.DB.QueryRow(`SELECT `+uploadColumns+` FROM "uploads" WHERE "id" = $1`, id), id)
+}
+
+// ListUploads returns the uploads in progress in the case
+func (u *Uploads) ListUploads(caseID int64) ([]Upload, error) {
+	rows, err := u.DB.Query(`SELECT `+uploadColumns+` FROM "uploads" WHERE "case_id" = $1 ORDER BY "created_at"`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var uploads []Upload
+	for rows.Next() {
+		var upload Upload
+		err = rows.Scan(&upload.ID, &upload.CaseID, &upload.Name, &upload.Folder, &upload.Length, &upload.Offset, &upload.Username, &upload.HashState, pq.Array(&upload.Parts), &upload.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// UpdateUpload stores the state of the upload after a chunk was received, offset
+// is the offset the chunk was received at. When another chunk was received at
+// that offset in the meantime the state isn't changed and ErrConflict is returned.
+func (u *Uploads) UpdateUpload(upload *Upload, offset int64) error {
+	result, err := u.DB.Exec(`UPDATE "uploads" SET "offset" = $1, "hash_state" = $2, "parts" = $3 WHERE "id" = $4 AND "offset" = $5`,
+		upload.Offset, upload.HashState, pq.Array(upload.Parts), upload.ID, offset)
+	if err != nil {
+		return fmt.Errorf("updating upload : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		current, err := u.GetUpload(upload.ID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w : upload offset is %d not %d", ErrConflict, current.Offset, offset)
+	}
+	return nil
+}
+
+// ClaimUpload removes a complete upload and returns it, so of concurrent
+// completions only the first one creates the evidence. It returns ErrNotFound
+// when the upload doesn't exist or isn't complete.
+func (u *Uploads) ClaimUpload(id string) (*Upload, error) {
+	return scanUpload(u.DB.QueryRow(`DELETE FROM "uploads" WHERE "id" = $1 AND "offset" = "length" RETURNING `+uploadColumns, id), id)
+}
+
+// RemoveUpload removes the upload and returns it with the parts received so far
+func (u *Uploads) RemoveUpload(id string) (*Upload, error) {
+	return scanUpload(u.DB.QueryRow(`DELETE FROM "uploads" WHERE "id" = $1 RETURNING `+uploadColumns, id), id)
+}
+
+// scanUpload scans the uploadColumns of the upload with the id or returns ErrNotFound
+func scanUpload(row *sql.Row, id string) (*Upload, error) {
+	upload := &Upload{}
+	err := row.Scan(&upload.ID, &upload.CaseID, &upload.Name, &upload.Folder, &upload.Length, &upload.Offset, &upload.Username, &upload.HashState, pq.Array(&upload.Parts), &upload.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w : upload : %q", ErrNotFound, id)
+		}
+		return nil, err
+	}
+	return upload, nil
+}
+
+// uploadReader reads the parts of an upload one after another, a part is opened
+// when the one before it was read
+type uploadReader struct {
+	objects ObjectStore
+	bucket  string
+	parts   []string
+	part    io.ReadCloser
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	for {
+		if u.part == nil {
+			if len(u.parts) == 0 {
+				return 0, io.EOF
+			}
+			part, err := u.objects.GetEvidence(u.bucket, u.parts[0])
+			if err != nil {
+				return 0, fmt.Errorf("opening upload part %q : %w", u.parts[0], err)
+			}
+			u.part, u.parts = part, u.parts[1:]
+		}
+		n, err := u.part.Read(p)
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		err = u.part.Close()
+		u.part = nil
+		if err != nil || n > 0 {
+			return n, err
+		}
+	}
+}
+
+func (u *uploadReader) Close() error {
+	if u.part == nil {
+		return nil
+	}
+	return u.part.Close()
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// checkChunkEnd fails if the chunk has more bytes after the upload length was
+// read from it
+func checkChunkEnd(chunk io.Reader) error {
+	extra, err := chunk.Read(make([]byte, 1))
+	if extra > 0 {
+		return fmt.Errorf("%w : chunk exceeds upload length", ErrInvalidRequest)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("receiving chunk : %w", err)
+	}
+	return nil
+}
+
+// MarshalUploadHash returns the internal state of the hash so hashing can be resumed
+func MarshalUploadHash(h hash.Hash) ([]byte, error) {
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("hash state can't be saved")
+	}
+	return m.MarshalBinary()
+}
+
+// UnmarshalUploadHash restores a SHA256 hash from a state returned by
+// MarshalUploadHash, an empty state returns a new hash
+func UnmarshalUploadHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if len(state) == 0 {
+		return h, nil
+	}
+	err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+	if err != nil {
+		return nil, fmt.Errorf("restoring upload hash : %w", err)
+	}
+	return h, nil
+}
+
+// UploadHash returns the SHA256 of all bytes received in the upload
+func UploadHash(upload *Upload) (string, error) {
+	h, err := UnmarshalUploadHash(upload.HashState)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
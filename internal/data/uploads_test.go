@@ -0,0 +1,176 @@
+package data_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miloszizic/der/internal/data"
+)
+
+// mustCreateUpload starts an upload of the evidence in the case
+func mustCreateUpload(t *testing.T, stores data.Stores, cs *data.Case, name string, length int64) *data.Upload {
+	t.Helper()
+	upload := &data.Upload{CaseID: cs.ID, Name: name, Length: length, Username: "clerk"}
+	err := stores.CreateUpload(upload)
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+	return upload
+}
+
+func TestUploadResumedAndCompletedFromObjectStore(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	upload := mustCreateUpload(t, stores, cs, "audio", 6)
+	_, err := stores.AppendUpload(upload, cs, 0, strings.NewReader("sam"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	// the next chunk is received from the stored state, like on another replica
+	upload, err = stores.Uploads.GetUpload(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Offset != 3 || len(upload.Parts) != 1 {
+		t.Fatalf("expected 3 bytes in one part, got %+v", upload)
+	}
+	exist, err := stores.ObjectStore.EvidenceExists(cs.Bucket(), upload.Parts[0])
+	if err != nil || !exist {
+		t.Fatalf("expected the part in the case bucket, got %v, %v", exist, err)
+	}
+	_, err = stores.AppendUpload(upload, cs, 0, strings.NewReader("sam"))
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected %v for wrong offset, got %v", data.ErrConflict, err)
+	}
+	got, err := stores.AppendUpload(upload, cs, 3, strings.NewReader("ple"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	if !got.Complete() {
+		t.Errorf("expected upload to be complete, offset %d of %d", got.Offset, got.Length)
+	}
+	hash, err := data.UploadHash(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256Hex("sample"); hash != want {
+		t.Errorf("expected hash %q, got %q", want, hash)
+	}
+	ev, err := stores.CompleteUpload(got, cs, nil)
+	if err != nil {
+		t.Fatalf("failed to complete upload: %v", err)
+	}
+	file, err := stores.DownloadEvidence(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(*file)
+	(*file).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "sample" || ev.UploadedBy != "clerk" {
+		t.Errorf("expected the evidence of the clerk with content %q, got %q by %q", "sample", content, ev.UploadedBy)
+	}
+	for _, part := range got.Parts {
+		exist, err = stores.ObjectStore.EvidenceExists(cs.Bucket(), part)
+		if err != nil || exist {
+			t.Errorf("expected part %q to be removed, got %v, %v", part, exist, err)
+		}
+	}
+	_, err = stores.Uploads.GetUpload(upload.ID)
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v after completing upload, got %v", data.ErrNotFound, err)
+	}
+}
+
+func TestAppendUploadRejectedChunkLongerThanUpload(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	upload := mustCreateUpload(t, stores, cs, "audio", 3)
+	got, err := stores.AppendUpload(upload, cs, 0, strings.NewReader("sample"))
+	if !errors.Is(err, data.ErrInvalidRequest) {
+		t.Errorf("expected %v, got %v", data.ErrInvalidRequest, err)
+	}
+	if got == nil || got.Offset != 3 {
+		t.Errorf("expected received bytes to be kept, got %+v", got)
+	}
+}
+
+func TestCompleteUploadCompletedOnce(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	upload := mustCreateUpload(t, stores, cs, "audio", 6)
+	upload, err := stores.AppendUpload(upload, cs, 0, strings.NewReader("sample"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	errs := make([]error, 4)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = stores.CompleteUpload(upload, cs, nil)
+		}(i)
+	}
+	wg.Wait()
+	completed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			completed++
+		case !errors.Is(err, data.ErrNotFound):
+			t.Errorf("expected %v for a completed upload, got %v", data.ErrNotFound, err)
+		}
+	}
+	if completed != 1 {
+		t.Errorf("expected the upload to be completed once, got %d", completed)
+	}
+	ev, err := stores.DBStore.GetEvidenceByName(cs, "", "audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := stores.ListEvidenceVersions(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("expected 1 version, got %d", len(versions))
+	}
+}
+
+func TestRemoveUploadRemovedParts(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	upload := mustCreateUpload(t, stores, cs, "audio", 6)
+	upload, err := stores.AppendUpload(upload, cs, 0, strings.NewReader("sam"))
+	if err != nil {
+		t.Fatalf("failed to append chunk: %v", err)
+	}
+	err = stores.RemoveUpload(upload, cs)
+	if err != nil {
+		t.Fatalf("failed to remove upload: %v", err)
+	}
+	exist, err := stores.ObjectStore.EvidenceExists(cs.Bucket(), upload.Parts[0])
+	if err != nil || exist {
+		t.Errorf("expected the part to be removed, got %v, %v", exist, err)
+	}
+	_, err = stores.AppendUpload(upload, cs, 3, strings.NewReader("ple"))
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected %v appending to a removed upload, got %v", data.ErrNotFound, err)
+	}
+}
+
+func TestCreateUploadWithInvalidNameFailed(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	for _, upload := range []*data.Upload{
+		{CaseID: cs.ID, Name: "", Length: 6},
+		{CaseID: cs.ID, Name: "audio", Folder: "a//b", Length: 6},
+		{CaseID: cs.ID, Name: "audio", Length: -1},
+	} {
+		err := stores.CreateUpload(upload)
+		if !errors.Is(err, data.ErrInvalidRequest) {
+			t.Errorf("expected %v for upload %+v, got %v", data.ErrInvalidRequest, upload, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -37,6 +38,11 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// IsSet returns true if a plaintext password was set and hashed.
+func (p *password) IsSet() bool {
+	return p.plaintext != nil
+}
+
 // Matches returns true if the plaintext password matches the hash.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
@@ -56,6 +62,7 @@ type UserStore interface {
 	Add(user *User) error
 	GetByID(id int64) (*User, error)
 	GetByUsername(username string) (*User, error)
+	SetRole(id int64, role string) error
 	Remove(id int64) error
 }
 
@@ -67,15 +74,20 @@ type UserDB struct {
 	DB *sql.DB
 }
 
-// Add adds a user to the database if the username and password are not empty.
+// Add adds a user to the database if the username and password are not empty,
+// a taken username returns ErrConflict.
 func (u *UserDB) Add(user *User) error {
 	if user.Username == "" || user.Password.plaintext == nil {
 		return fmt.Errorf("%w: username and password cannot be empty", ErrInvalidRequest)
 	}
 	if user.Role == "" {
-		user.Role = "admin"
+		user.Role = DefaultRole
 	}
 	_, err := u.DB.Exec(`INSERT INTO "users" ("username", "password",role) VALUES ($1,$2,$3);`, user.Username, user.Password.hash, user.Role)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w : username %q is taken by another user", ErrConflict, user.Username)
+	}
 	return err
 }
 
@@ -102,6 +114,22 @@ func (u *UserDB) GetByUsername(username string) (*User, error) {
 	return &user, err
 }
 
+// SetRole changes the role of the user or returns ErrNotFound
+func (u *UserDB) SetRole(id int64, role string) error {
+	result, err := u.DB.Exec(`UPDATE "users" SET "role" = $1 WHERE id = $2`, role, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: user id: %d", ErrNotFound, id)
+	}
+	return nil
+}
+
 // Remove find the user by ID and removes it from the database
 func (u *UserDB) Remove(id int64) error {
 	result, err := u.DB.Exec("DELETE FROM users WHERE id = $1", id)
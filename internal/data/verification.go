@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Results of re-verifying the stored hash of an evidence
+const (
+	VerificationPassed     = "verified"
+	VerificationMismatch   = "mismatch"
+	VerificationMissing    = "missing"
+	VerificationUnreadable = "unreadable"
+)
+
+// ScrubberName is recorded as the verifier of checks made by the background scrubber
+const ScrubberName = "scrubber"
+
+// Verification is the result of recomputing the hash of one version of an evidence
+type Verification struct {
+	ID           int64     `json:"id"`
+	EvidenceID   int64     `json:"evidence_id"`
+	CaseID       int64     `json:"case_id"`
+	Version      int64     `json:"version"`
+	Status       string    `json:"status"`
+	ExpectedHash string    `json:"expected_hash"`
+	ComputedHash string    `json:"computed_hash,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	VerifiedBy   string    `json:"verified_by"`
+	VerifiedAt   time.Time `json:"verified_at"`
+}
+
+// VerificationStore keeps the verification history of evidences
+type VerificationStore interface {
+	RecordVerification(ev *Evidence, results []Verification) error
+	ListVerifications(evidenceID int64) ([]Verification, error)
+}
+
+type Verifications struct {
+	DB *sql.DB
+}
+
+func NewVerificationStore(db *sql.DB) VerificationStore {
+	return &Verifications{
+		DB: db,
+	}
+}
+
+// RecordVerification stores the results and sets their IDs, the verification
+// status and time of the evidence are updated with them
+func (v *Verifications) RecordVerification(ev *Evidence, results []Verification) error {
+	tx, err := v.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range results {
+		r := &results[i]
+		err = tx.QueryRow(`INSERT INTO "verifications" ("evidence_id", "case_id", "version", "status", "expected_hash", "computed_hash", "detail", "verified_by", "verified_at")
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+			r.EvidenceID, r.CaseID, r.Version, r.Status, r.ExpectedHash, r.ComputedHash, r.Detail, r.VerifiedBy, r.VerifiedAt).Scan(&r.ID)
+		if err != nil {
+			return fmt.Errorf("inserting verification : %w", err)
+		}
+	}
+	result, err := tx.Exec(`UPDATE "evidences" SET "verified_at" = $1, "verification_status" = $2 WHERE id = $3`,
+		ev.VerifiedAt, ev.VerificationStatus, ev.ID)
+	if err != nil {
+		return fmt.Errorf("updating evidence verification : %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w : evidence id : %d", ErrNotFound, ev.ID)
+	}
+	return tx.Commit()
+}
+
+// ListVerifications returns the verification history of an evidence, newest first
+func (v *Verifications) ListVerifications(evidenceID int64) ([]Verification, error) {
+	rows, err := v.DB.Query(`SELECT "id", "evidence_id", "case_id", "version", "status", "expected_hash", "computed_hash", "detail", "verified_by", "verified_at"
+		FROM "verifications" WHERE evidence_id = $1 ORDER BY id DESC`, evidenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var verifications []Verification
+	for rows.Next() {
+		var r Verification
+		err = rows.Scan(&r.ID, &r.EvidenceID, &r.CaseID, &r.Version, &r.Status, &r.ExpectedHash, &r.ComputedHash, &r.Detail, &r.VerifiedBy, &r.VerifiedAt)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, r)
+	}
+	return verifications, rows.Err()
+}
+
+// ScrubReport counts the evidences checked by one pass of the scrubber
+type ScrubReport struct {
+	Evidences int `json:"evidences"`
+	Passed    int `json:"passed"`
+	Failed    int `json:"failed"`
+}
+
+// VerifyEvidence recomputes the hash of every version of the evidence and compares
+// it with the stored one. The results are recorded and the evidence gets the status
+// of the first version that failed, or VerificationPassed, and the check is added
+// to its chain of custody.
+func (s *Stores) VerifyEvidence(ev *Evidence, verifiedBy string) ([]Verification, error) {
+	cs, err := s.GetCaseByID(ev.CaseID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.DBStore.ListEvidenceVersions(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting evidence versions from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	if len(versions) == 0 {
+		versions = []EvidenceVersion{{EvidenceID: ev.ID, Hash: ev.Hash, ObjectName: ev.Object()}}
+	}
+	now := time.Now().UTC()
+	status := VerificationPassed
+	results := make([]Verification, 0, len(versions))
+	for _, v := range versions {
+		result := Verification{
+			EvidenceID:   ev.ID,
+			CaseID:       cs.ID,
+			Version:      v.Version,
+			ExpectedHash: v.Hash,
+			VerifiedBy:   verifiedBy,
+			VerifiedAt:   now,
+		}
+		hash, err := s.objectHash(cs, v.ObjectName)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			result.Status = VerificationMissing
+			result.Detail = err.Error()
+		case err != nil:
+			result.Status = VerificationUnreadable
+			result.Detail = err.Error()
+		case hash != v.Hash:
+			result.Status = VerificationMismatch
+			result.ComputedHash = hash
+		default:
+			result.Status = VerificationPassed
+			result.ComputedHash = hash
+		}
+		if status == VerificationPassed {
+			status = result.Status
+		}
+		results = append(results, result)
+	}
+	ev.VerifiedAt = &now
+	ev.VerificationStatus = status
+	err = s.Verifications.RecordVerification(ev, results)
+	if err != nil {
+		return nil, fmt.Errorf("recording verification: %w , evidence name: %q ", err, ev.Name)
+	}
+	err = s.RecordCustody(&CustodyEvent{
+		EvidenceID: ev.ID,
+		CaseID:     cs.ID,
+		Action:     CustodyVerify,
+		Username:   verifiedBy,
+		Hash:       ev.Hash,
+		Detail:     status,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ListVerifications returns the verification history of the evidence, newest first
+func (s *Stores) ListVerifications(ev *Evidence) ([]Verification, error) {
+	verifications, err := s.Verifications.ListVerifications(ev.ID)
+	if err != nil {
+		return nil, fmt.Errorf("getting verifications from DB: %w , evidence id: %d ", err, ev.ID)
+	}
+	return verifications, nil
+}
+
+// VerifyAllEvidences verifies every evidence of every case, it stops between
+// evidences when the context is cancelled
+func (s *Stores) VerifyAllEvidences(ctx context.Context, verifiedBy string) (*ScrubReport, error) {
+	report := &ScrubReport{}
+	cases, err := s.DBStore.ListCases()
+	if err != nil {
+		return report, fmt.Errorf("listing cases from DB: %w", err)
+	}
+	for _, cs := range cases {
+		evidences, err := s.DBStore.GetEvidenceByCaseID(cs.ID)
+		if err != nil {
+			return report, fmt.Errorf("listing evidences from DB: %w , case name: %q ", err, cs.Name)
+		}
+		for i := range evidences {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			ev := &evidences[i]
+			_, err = s.VerifyEvidence(ev, verifiedBy)
+			if err != nil {
+				return report, err
+			}
+			report.Evidences++
+			if ev.VerificationStatus == VerificationPassed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,154 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/der/internal/data"
+)
+
+// replaceObject overwrites the content of the first version of an evidence in the
+// root folder like tampering in the object store would
+func replaceObject(t *testing.T, stores data.Stores, cs *data.Case, evidenceName string, content string) {
+	objectName := objectOf(t, stores, cs, evidenceName)
+	err := stores.ObjectStore.RemoveEvidence(&data.Evidence{Name: objectName}, cs.Bucket())
+	if err != nil {
+		t.Fatalf("failed to remove object: %v", err)
+	}
+	_, err = stores.ObjectStore.CreateEvidence(&data.Evidence{Name: objectName}, cs.Bucket(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to create object: %v", err)
+	}
+}
+
+func TestVerifyEvidenceRecordedResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, stores data.Stores, cs *data.Case)
+		want   string
+	}{
+		{
+			name:   "for untouched evidence passed",
+			tamper: func(t *testing.T, stores data.Stores, cs *data.Case) {},
+			want:   data.VerificationPassed,
+		},
+		{
+			name: "for changed evidence found a mismatch",
+			tamper: func(t *testing.T, stores data.Stores, cs *data.Case) {
+				replaceObject(t, stores, cs, "video", "edited video")
+			},
+			want: data.VerificationMismatch,
+		},
+		{
+			name: "for removed evidence found it missing",
+			tamper: func(t *testing.T, stores data.Stores, cs *data.Case) {
+				err := stores.ObjectStore.RemoveEvidence(&data.Evidence{Name: objectOf(t, stores, cs, "video")}, cs.Bucket())
+				if err != nil {
+					t.Fatalf("failed to remove object: %v", err)
+				}
+			},
+			want: data.VerificationMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores, cs := getTestHoldStores(t)
+			tt.tamper(t, stores, cs)
+			ev, err := stores.GetEvidenceByID(1, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := stores.VerifyEvidence(ev, "clerk")
+			if err != nil {
+				t.Fatalf("failed to verify evidence: %v", err)
+			}
+			if len(results) != 1 || results[0].Status != tt.want || results[0].VerifiedBy != "clerk" {
+				t.Errorf("expected one %q result by clerk, got %+v", tt.want, results)
+			}
+			got, err := stores.GetEvidenceByID(1, cs.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.VerificationStatus != tt.want || got.VerifiedAt == nil {
+				t.Errorf("expected evidence to be verified with %q, got %q at %v", tt.want, got.VerificationStatus, got.VerifiedAt)
+			}
+			history, err := stores.ListVerifications(ev)
+			if err != nil {
+				t.Fatalf("failed to list verifications: %v", err)
+			}
+			if !cmp.Equal(results, history) {
+				t.Errorf(cmp.Diff(results, history))
+			}
+		})
+	}
+}
+
+func TestVerifyEvidenceCheckedEveryVersion(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	err := stores.CreateEvidence(&data.Evidence{CaseID: cs.ID, Name: "video", File: strings.NewReader("edited video")}, cs)
+	if err != nil {
+		t.Fatalf("failed to add evidence version: %v", err)
+	}
+	ev, err := stores.GetEvidenceByID(1, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the first version is replaced
+	replaceObject(t, stores, cs, "video", "tampered video")
+	results, err := stores.VerifyEvidence(ev, "clerk")
+	if err != nil {
+		t.Fatalf("failed to verify evidence: %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Status)
+	}
+	want := []string{data.VerificationMismatch, data.VerificationPassed}
+	if !cmp.Equal(want, got) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if ev.VerificationStatus != data.VerificationMismatch {
+		t.Errorf("expected evidence status %q, got %q", data.VerificationMismatch, ev.VerificationStatus)
+	}
+}
+
+func TestVerifyAllEvidencesReported(t *testing.T) {
+	stores, cs := getTestHoldStores(t)
+	replaceObject(t, stores, cs, "picture", "edited picture")
+	report, err := stores.VerifyAllEvidences(context.Background(), data.ScrubberName)
+	if err != nil {
+		t.Fatalf("failed to verify evidences: %v", err)
+	}
+	want := &data.ScrubReport{Evidences: 2, Passed: 1, Failed: 1}
+	if !cmp.Equal(want, report) {
+		t.Errorf(cmp.Diff(want, report))
+	}
+	// a second pass is added to the history
+	_, err = stores.VerifyAllEvidences(context.Background(), data.ScrubberName)
+	if err != nil {
+		t.Fatalf("failed to verify evidences: %v", err)
+	}
+	history, err := stores.ListVerifications(&data.Evidence{ID: 2})
+	if err != nil {
+		t.Fatalf("failed to list verifications: %v", err)
+	}
+	if len(history) != 2 || history[0].ID < history[1].ID {
+		t.Errorf("expected two verifications newest first, got %+v", history)
+	}
+}
+
+func TestVerifyAllEvidencesStoppedWhenCancelled(t *testing.T) {
+	stores, _ := getTestHoldStores(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := stores.VerifyAllEvidences(ctx, data.ScrubberName)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if report.Evidences != 0 {
+		t.Errorf("expected no evidences to be verified, got %d", report.Evidences)
+	}
+}